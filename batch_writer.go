@@ -3,6 +3,7 @@ package ghostferry
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -62,6 +63,7 @@ func (w *BatchWriter) WriteRowBatch(batch *RowBatch) error {
 			table = targetTableName
 		}
 
+		start := time.Now()
 		query, args, err := batch.AsSQLQuery(db, table)
 		if err != nil {
 			return fmt.Errorf("during generating sql query at paginationKey %v -> %v: %v", startPaginationKeypos, endPaginationKeypos, err)
@@ -105,7 +107,8 @@ func (w *BatchWriter) WriteRowBatch(batch *RowBatch) error {
 		// Note that the state tracker expects us the track based on the original
 		// database and table names as opposed to the target ones.
 		if w.StateTracker != nil {
-			w.StateTracker.UpdateLastSuccessfulPaginationKey(batch.TableSchema().String(), endPaginationKeypos)
+			w.StateTracker.UpdateBatch(map[string]uint64{batch.TableSchema().String(): endPaginationKeypos}, uint64(batch.Size()))
+			w.StateTracker.RecordBatchLatency(batch.TableSchema().String(), time.Since(start))
 		}
 
 		return nil
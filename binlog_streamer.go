@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	uuid "github.com/satori/go.uuid"
 	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
 	"github.com/sirupsen/logrus"
@@ -30,6 +31,14 @@ type BinlogStreamer struct {
 	lastProcessedEventTime     time.Time
 	lastLagMetricEmittedTime   time.Time
 
+	// The GTID set of the transactions committed before the last streamed
+	// binlog position, or nil if the GTIDs are not known. It is replaced
+	// rather than updated when a transaction commits, as the DML events of
+	// the previous transactions hold it. pendingGTID is the GTID of the
+	// transaction being streamed.
+	lastStreamedGTIDSet mysql.GTIDSet
+	pendingGTID         string
+
 	stopRequested bool
 
 	logger         *logrus.Entry
@@ -79,13 +88,15 @@ func (s *BinlogStreamer) createBinlogSyncer() error {
 func (s *BinlogStreamer) ConnectBinlogStreamerToMysql() (mysql.Position, error) {
 	s.ensureLogger()
 
-	currentPosition, err := ShowMasterStatusBinlogPosition(s.DB)
+	currentPosition, currentGTIDSet, err := ShowMasterStatusBinlogPositionAndGTIDSet(s.DB)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to read current binlog position")
 		return mysql.Position{}, err
 	}
 
-	return s.ConnectBinlogStreamerToMysqlFrom(currentPosition)
+	pos, err := s.ConnectBinlogStreamerToMysqlFrom(currentPosition)
+	s.lastStreamedGTIDSet = currentGTIDSet
+	return pos, err
 }
 
 func (s *BinlogStreamer) ConnectBinlogStreamerToMysqlFrom(startFromBinlogPosition mysql.Position) (mysql.Position, error) {
@@ -112,6 +123,32 @@ func (s *BinlogStreamer) ConnectBinlogStreamerToMysqlFrom(startFromBinlogPositio
 	return s.lastStreamedBinlogPosition, err
 }
 
+// Starts streaming after the transactions of the GTID set, such as the GTID
+// set of a state, which unlike a binlog position remains valid after the
+// source fails over to a replica. The binlog position is only known once it
+// is streamed, so the returned position is empty.
+func (s *BinlogStreamer) ConnectBinlogStreamerToMysqlFromGTIDSet(startFromGTIDSet mysql.GTIDSet) (mysql.Position, error) {
+	s.ensureLogger()
+
+	err := s.createBinlogSyncer()
+	if err != nil {
+		return mysql.Position{}, err
+	}
+
+	s.lastStreamedBinlogPosition = mysql.Position{}
+	s.lastStreamedGTIDSet = startFromGTIDSet.Clone()
+
+	s.logger.WithField("gtid_set", startFromGTIDSet.String()).Info("starting binlog streaming from gtid set")
+
+	s.binlogStreamer, err = s.binlogSyncer.StartSyncGTID(startFromGTIDSet.Clone())
+	if err != nil {
+		s.logger.WithError(err).Error("unable to start binlog streamer")
+		return mysql.Position{}, err
+	}
+
+	return s.lastStreamedBinlogPosition, nil
+}
+
 func (s *BinlogStreamer) Run() {
 	s.ensureLogger()
 
@@ -165,6 +202,25 @@ func (s *BinlogStreamer) Run() {
 				s.ErrorHandler.Fatal("binlog_streamer", err)
 			}
 
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.GTIDEvent:
+			u, err := uuid.FromBytes(e.SID)
+			if err == nil {
+				s.pendingGTID = fmt.Sprintf("%s:%d", u.String(), e.GNO)
+			} else {
+				s.pendingGTID = ""
+			}
+
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.XIDEvent:
+			s.commitPendingGTID()
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.QueryEvent:
+			// The transactions without a XIDEvent, such as DDL statements and
+			// the writes to non-transactional tables, end with a QueryEvent.
+			if string(e.Query) != "BEGIN" {
+				s.commitPendingGTID()
+			}
 			s.updateLastStreamedPosAndTime(ev)
 		case *replication.FormatDescriptionEvent:
 			// This event has a LogPos = 0, presumably because this is the first
@@ -196,6 +252,36 @@ func (s *BinlogStreamer) GetLastStreamedBinlogPosition() mysql.Position {
 	return s.lastStreamedBinlogPosition
 }
 
+// Returns a copy of the GTID set of the last streamed binlog position, or nil
+// if the GTIDs are not known, such as when GTIDs are not enabled on the
+// source or the streaming started from a binlog position of a state.
+func (s *BinlogStreamer) GetLastStreamedGTIDSet() mysql.GTIDSet {
+	if s.lastStreamedGTIDSet == nil {
+		return nil
+	}
+	return s.lastStreamedGTIDSet.Clone()
+}
+
+// Adds the GTID of the transaction which just committed to the
+// lastStreamedGTIDSet, if the GTIDs are tracked.
+func (s *BinlogStreamer) commitPendingGTID() {
+	if s.lastStreamedGTIDSet == nil || s.pendingGTID == "" {
+		return
+	}
+
+	gtidSet := s.lastStreamedGTIDSet.Clone()
+	err := gtidSet.Update(s.pendingGTID)
+	if err != nil {
+		// The binlog position is still tracked, so the GTIDs are no longer
+		// tracked rather than failing the run.
+		s.logger.WithError(err).WithField("gtid", s.pendingGTID).Error("failed to track the GTID, no longer tracking GTIDs")
+		gtidSet = nil
+	}
+
+	s.lastStreamedGTIDSet = gtidSet
+	s.pendingGTID = ""
+}
+
 func (s *BinlogStreamer) IsAlmostCaughtUp() bool {
 	return time.Now().Sub(s.lastProcessedEventTime) < caughtUpThreshold
 }
@@ -265,6 +351,12 @@ func (s *BinlogStreamer) handleRowsEvent(ev *replication.BinlogEvent) error {
 		return err
 	}
 
+	if s.lastStreamedGTIDSet != nil {
+		for _, dmlEv := range dmlEvs {
+			dmlEv.(interface{ setGTIDSet(mysql.GTIDSet) }).setGTIDSet(s.lastStreamedGTIDSet)
+		}
+	}
+
 	events := make([]DMLEvent, 0)
 
 	for _, dmlEv := range dmlEvs {
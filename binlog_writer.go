@@ -51,17 +51,46 @@ func (b *BinlogWriter) Run() {
 			}
 		}
 
-		err := WithRetries(b.WriteRetries, 0, b.logger, "write events to target", func() error {
-			return b.writeEvents(batch)
-		})
-		if err != nil {
-			b.ErrorHandler.Fatal("binlog_writer", err)
+		for len(batch) > 0 {
+			events := b.releasedEvents(batch)
+			err := WithRetries(b.WriteRetries, 0, b.logger, "write events to target", func() error {
+				return b.writeEvents(events)
+			})
+			if err != nil {
+				b.ErrorHandler.Fatal("binlog_writer", err)
+			}
+			batch = batch[len(events):]
 		}
 
 		batch = make([]DMLEvent, 0, b.BatchSize)
 	}
 }
 
+// Returns the first events of the batch that are not past a position held by
+// StateTracker.HoldBinlogPosition, blocking until there is at least one.
+func (b *BinlogWriter) releasedEvents(batch []DMLEvent) []DMLEvent {
+	if b.StateTracker == nil {
+		return batch
+	}
+
+	for {
+		b.StateTracker.waitForBinlogPositionRelease(batch[0].BinlogPosition())
+
+		held, found := b.StateTracker.heldBinlogPosition()
+		if !found {
+			return batch
+		}
+
+		released := 0
+		for released < len(batch) && compareBinlogPositions(batch[released].BinlogPosition(), held) <= 0 {
+			released++
+		}
+		if released > 0 {
+			return batch[:released]
+		}
+	}
+}
+
 func (b *BinlogWriter) Stop() {
 	close(b.binlogEventBuffer)
 }
@@ -79,7 +108,14 @@ func (b *BinlogWriter) writeEvents(events []DMLEvent) error {
 
 	queryBuffer := []byte("BEGIN;\n")
 
+	statements := 0
 	for _, ev := range events {
+		// The events of a table dropped from the source are not applied, as
+		// the table is not copied anymore.
+		if b.StateTracker != nil && b.StateTracker.IsTableDropped(ev.TableSchema().String()) {
+			continue
+		}
+
 		eventDatabaseName := ev.Database()
 		if targetDatabaseName, exists := b.DatabaseRewrites[eventDatabaseName]; exists {
 			eventDatabaseName = targetDatabaseName
@@ -97,20 +133,28 @@ func (b *BinlogWriter) writeEvents(events []DMLEvent) error {
 
 		queryBuffer = append(queryBuffer, sql...)
 		queryBuffer = append(queryBuffer, ";\n"...)
+		statements++
 	}
 
 	queryBuffer = append(queryBuffer, "COMMIT"...)
 
 	startEv := events[0]
 	endEv := events[len(events)-1]
-	query := string(queryBuffer)
-	_, err := b.DB.Exec(query)
-	if err != nil {
-		return fmt.Errorf("exec query at pos %v -> %v (%d bytes): %v", startEv.BinlogPosition(), endEv.BinlogPosition(), len(query), err)
+	if statements > 0 {
+		query := string(queryBuffer)
+		_, err := b.DB.Exec(query)
+		if err != nil {
+			return fmt.Errorf("exec query at pos %v -> %v (%d bytes): %v", startEv.BinlogPosition(), endEv.BinlogPosition(), len(query), err)
+		}
 	}
 
 	if b.StateTracker != nil {
 		b.StateTracker.UpdateLastWrittenBinlogPosition(events[len(events)-1].BinlogPosition())
+		if gtidSet := endEv.GTIDSet(); gtidSet != nil {
+			b.StateTracker.UpdateLastWrittenGTID(gtidSet)
+		}
+		b.StateTracker.UpdateAppliedEventTime(startEv.Timestamp())
+		b.StateTracker.UpdateAppliedEventTime(endEv.Timestamp())
 	}
 
 	return nil
@@ -0,0 +1,104 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The progress of the copy of a table, given to a CompletionPredicate.
+type TableCompletionProgress struct {
+	Table *TableSchema
+
+	// The last pagination key copied, as recorded by the StateTracker.
+	LastSuccessfulPaginationKey uint64
+
+	// The pagination key the copy iterates up to, determined when the copy of
+	// the table started.
+	MaxPaginationKey uint64
+
+	// The batch that was just copied, or nil if Exhausted.
+	Batch *RowBatch
+
+	// Set once the copy reached MaxPaginationKey or found no more rows to
+	// copy. This is the last time the predicate is evaluated for the table in
+	// this run.
+	Exhausted bool
+}
+
+// Decides when the copy of a table is complete. The DataIterator evaluates the
+// predicate of the table after each batch is copied: once it returns true, the
+// iteration of the table stops and the table is marked as completed. If it
+// still returns false once the progress is Exhausted, the table is left
+// incomplete: neither the CompletedTables of the state nor the data copy of
+// the run include it.
+//
+// Predicates are serialized in the state by their name, so they must be
+// registered with RegisterCompletionPredicate to be found again on resume.
+// A resumed run restores the predicates of the tables from the state, before
+// the Config.CompletionPredicates are applied. A table completed in a
+// previous run is not iterated again, so its predicate is not evaluated
+// anymore, while an incomplete table is iterated again from its last
+// successful pagination key and evaluated as usual.
+type CompletionPredicate interface {
+	Name() string
+	IsComplete(progress TableCompletionProgress) bool
+}
+
+const (
+	CompletionPredicateReachedMaxPaginationKey = "reached_max_pagination_key"
+	CompletionPredicateNever                   = "never"
+)
+
+// The default predicate: the table is complete once it is copied up to its
+// max pagination key.
+type ReachedMaxPaginationKeyPredicate struct{}
+
+func (p ReachedMaxPaginationKeyPredicate) Name() string {
+	return CompletionPredicateReachedMaxPaginationKey
+}
+
+func (p ReachedMaxPaginationKeyPredicate) IsComplete(progress TableCompletionProgress) bool {
+	return progress.Exhausted || progress.LastSuccessfulPaginationKey >= progress.MaxPaginationKey
+}
+
+// For the tables that are never fully copied, such as append-only logs whose
+// new rows are only replicated via the binlog.
+type NeverCompletePredicate struct{}
+
+func (p NeverCompletePredicate) Name() string {
+	return CompletionPredicateNever
+}
+
+func (p NeverCompletePredicate) IsComplete(progress TableCompletionProgress) bool {
+	return false
+}
+
+var (
+	completionPredicatesMutex sync.RWMutex
+	completionPredicates      = map[string]CompletionPredicate{
+		CompletionPredicateReachedMaxPaginationKey: ReachedMaxPaginationKeyPredicate{},
+		CompletionPredicateNever:                   NeverCompletePredicate{},
+	}
+)
+
+// Registers the predicate under its name, such that it can be referenced by
+// the Config.CompletionPredicates and restored from a serialized state.
+func RegisterCompletionPredicate(predicate CompletionPredicate) error {
+	completionPredicatesMutex.Lock()
+	defer completionPredicatesMutex.Unlock()
+
+	if _, found := completionPredicates[predicate.Name()]; found {
+		return fmt.Errorf("completion predicate %s is already registered", predicate.Name())
+	}
+
+	completionPredicates[predicate.Name()] = predicate
+	return nil
+}
+
+func LookupCompletionPredicate(name string) (CompletionPredicate, bool) {
+	completionPredicatesMutex.RLock()
+	defer completionPredicatesMutex.RUnlock()
+
+	predicate, found := completionPredicates[name]
+	return predicate, found
+}
@@ -20,6 +20,12 @@ const (
 	VerifierTypeNoVerification = "NoVerification"
 )
 
+const (
+	ResumeVerifyCursorOff   = ""
+	ResumeVerifyCursorWarn  = "Warn"
+	ResumeVerifyCursorError = "Error"
+)
+
 type TLSConfig struct {
 	CertPath   string
 	ServerName string
@@ -179,6 +185,66 @@ func (c *InlineVerifierConfig) Validate() error {
 	return nil
 }
 
+type BinlogPositionOverrideConfig struct {
+	// The binlog file and position to resume the binlog streaming from,
+	// instead of the position stored in StateToResumeFrom.
+	Name string
+	Pos  uint32
+
+	// Must be set to acknowledge that the binlog events between the stored
+	// position and the override are never replicated, which leaves gaps in
+	// the data unless the affected tables are copied again.
+	ConfirmDataLoss bool
+}
+
+func (c *BinlogPositionOverrideConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("Name is empty")
+	}
+
+	if !c.ConfirmDataLoss {
+		return fmt.Errorf("ConfirmDataLoss must be set to acknowledge the binlog events that may be skipped")
+	}
+
+	return nil
+}
+
+type TargetConsistencyCheckConfig struct {
+	// The number of completed tables to spot check. All the completed tables
+	// are checked if there are fewer.
+	SampleSize int
+
+	// The minimum ratio of the number of rows of a table on the target to its
+	// number of rows on the source. The default of 0.9 allows for the rows the
+	// binlog streamer has not replicated yet, while catching a target missing
+	// most of the copied data.
+	//
+	// Optional: defaults to 0.9
+	MinRowCountRatio float64
+
+	// If true, a failed check prevents the run from resuming. Otherwise, the
+	// mismatching tables are only logged.
+	//
+	// Optional: defaults to false
+	FailOnMismatch bool
+}
+
+func (c *TargetConsistencyCheckConfig) Validate() error {
+	if c.SampleSize <= 0 {
+		return fmt.Errorf("SampleSize must be greater than 0")
+	}
+
+	if c.MinRowCountRatio == 0 {
+		c.MinRowCountRatio = 0.9
+	}
+
+	if c.MinRowCountRatio < 0 || c.MinRowCountRatio > 1 {
+		return fmt.Errorf("MinRowCountRatio must be between 0 and 1")
+	}
+
+	return nil
+}
+
 type IterativeVerifierConfig struct {
 	// List of tables that should be ignored by the IterativeVerifier.
 	IgnoredTables []string
@@ -275,6 +341,12 @@ type CascadingPaginationColumnConfig struct {
 	// PerTable has greatest specificity and takes precedence over the other options
 	PerTable map[string]map[string]string // SchemaName => TableName => ColumnName
 
+	// PerTableIndex configures tables to paginate over a unique index rather
+	// than a column. The index must be unique and consist of a single, non
+	// nullable, numeric column. A column specified in PerTable takes
+	// precedence over an index specified here.
+	PerTableIndex map[string]map[string]string // SchemaName => TableName => IndexName
+
 	// FallbackColumn is a global default to fallback to and is less specific than the
 	// default, which is the Primary Key
 	FallbackColumn string
@@ -299,6 +371,25 @@ func (c *CascadingPaginationColumnConfig) PaginationColumnFor(schemaName, tableN
 	return column, true
 }
 
+// PaginationIndexFor is a helper function to retrieve the unique index to paginate by
+func (c *CascadingPaginationColumnConfig) PaginationIndexFor(schemaName, tableName string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	tableConfig, found := c.PerTableIndex[schemaName]
+	if !found {
+		return "", false
+	}
+
+	index, found := tableConfig[tableName]
+	if !found {
+		return "", false
+	}
+
+	return index, true
+}
+
 // FallbackPaginationColumnName retreives the column name specified as a fallback when the Primary Key isn't suitable for pagination
 func (c *CascadingPaginationColumnConfig) FallbackPaginationColumnName() (string, bool) {
 	if c == nil || c.FallbackColumn == "" {
@@ -392,6 +483,91 @@ type Config struct {
 	// Optional: defaults to 4
 	DataIterationConcurrency int
 
+	// This specifies whether the time spent waiting on the StateTracker
+	// mutexes should be emitted as metrics. This is useful to find out if the
+	// StateTracker is a bottleneck at high DataIterationConcurrency, but the
+	// timing has some overhead.
+	//
+	// Optional: defaults to false
+	InstrumentStateTrackerLocks bool
+
+	// This specifies whether the most recent error of each table should be
+	// kept by the StateTracker, serialized in the state and reported via the
+	// Progress. The error of a table is dropped once it is completed.
+	//
+	// Optional: defaults to false
+	TrackTableErrors bool
+
+	// This specifies whether the copy speed of each table should be tracked,
+	// which makes the ETA reported in the Progress account for very
+	// differently sized tables. See StateTracker.WeightedETA.
+	//
+	// Optional: defaults to false
+	TrackTableRates bool
+
+	// This specifies whether the number of rows copied from each table should
+	// be tracked and serialized into the state, such that the state can be
+	// reconciled against the row counts of the source and target once the
+	// run is done. See StateTracker.TrackTableRowsCopied.
+	//
+	// Optional: defaults to false
+	TrackTableRowsCopied bool
+
+	// The window, in milliseconds, over which the copy rate of each table is
+	// compared to its peak to report the slow tables in the Progress. Only
+	// used if TrackTableRates is set. See StateTracker.SlowTables.
+	//
+	// Optional: defaults to ghostferry.DefaultSlowTableWindow
+	SlowTableWindow int
+
+	// The fraction of its peak rate below which a table is reported as slow
+	// in the Progress, between 0 and 1. See StateTracker.SlowTables.
+	//
+	// Optional: defaults to ghostferry.DefaultSlowTableFactor
+	SlowTableFactor float64
+
+	// This specifies whether the CompletedTables of the dumped and
+	// checkpointed states are encoded as a sorted list of table names rather
+	// than as a map, which is about half the size with many completed tables.
+	// States in either form can be resumed from, but versions of Ghostferry
+	// before this option cannot resume from a state in the list form.
+	//
+	// Optional: defaults to false
+	CompactCompletedTables bool
+
+	// The fractions of the overall progress of the copy, between 0 and 1, at
+	// which StateTracker.OnMilestone is called. See StateTracker.Milestones.
+	//
+	// Optional: defaults to ghostferry.DefaultMilestones
+	ProgressMilestones []float64
+
+	// The durations, in milliseconds and keyed by name, of the windows over
+	// which the copy rates are averaged in the Progress. See
+	// StateTracker.Rates.
+	//
+	// Optional: defaults to ghostferry.DefaultRateWindows
+	RateWindows map[string]int
+
+	// The capacity of the queue of the completed tables handed out to a
+	// verifier, see StateTracker.PopCompletedForVerification.
+	//
+	// Optional: defaults to 0, which disables the queue
+	VerificationQueueSize int
+
+	// This specifies how the StateTracker handles a table being completed
+	// when it already is: DuplicateTableCompletionIgnore,
+	// DuplicateTableCompletionWarn or DuplicateTableCompletionPanic. The
+	// completion is idempotent regardless of this setting.
+	//
+	// Optional: defaults to DuplicateTableCompletionIgnore
+	DuplicateTableCompletion string
+
+	// The upper bounds, in seconds and in increasing order, of the buckets of
+	// the BatchCopyLatency histogram metric.
+	//
+	// Optional: defaults to ghostferry.DefaultBatchLatencyBuckets
+	BatchLatencyBuckets []float64
+
 	// This specifies if Ghostferry will pause before cutover or not.
 	//
 	// Optional: defaults to false
@@ -412,11 +588,136 @@ type Config struct {
 	ProgressCallback        HTTPCallback
 	ProgressReportFrequency int
 
+	// The frequency, in milliseconds, at which the state is stored in the
+	// Ferry's StateStore. Only used if a StateStore is given to the Ferry.
+	//
+	// Optional: defaults to 60000 (1 minute)
+	StateCheckpointFrequency int
+
+	// This specifies whether the states stored in the Ferry's StateStore are
+	// serialized without their schema cache, which makes the checkpoints much
+	// smaller with a large schema. A run resumed from such a state reloads the
+	// schema from the source, unless the Ferry is given a
+	// TableSchemaCacheToResumeWith, and verifies it against the schema hashes
+	// of the state. See StateTracker.SerializeProgressOnly.
+	//
+	// Optional: defaults to false
+	StateCheckpointProgressOnly bool
+
+	// The minimum time, in milliseconds, between two samples of the copy
+	// speed used for the ETA. See StateTracker.MinSpeedLogSampleInterval.
+	//
+	// Optional: defaults to 10
+	MinSpeedLogSampleInterval int
+
 	// The state to resume from as dumped by the PanicErrorHandler.
 	// If this is null, a new Ghostferry run will be started. Otherwise, the
 	// reconciliation process will start and Ghostferry will resume after that.
 	StateToResumeFrom *SerializableState
 
+	// This specifies whether a resumed run copies the tables created on the
+	// source after the run started, i.e. the tables matching the TableFilter
+	// that are not part of the schema of StateToResumeFrom. The schema of the
+	// source is loaded even if the state has a schema cache, to find them,
+	// and they are copied from scratch. See StateTracker.RegisterNewTable.
+	//
+	// If false, the new tables are only copied if the schema is loaded from
+	// the source anyway, and a state verified against its schema hashes fails
+	// to resume as their schema is unknown to the state.
+	//
+	// Optional: defaults to false
+	CopyNewTablesOnResume bool
+
+	// The pagination keys up to which the tables are known to be copied
+	// already, keyed by the table name (i.e. "db.table"), such as the ranges
+	// migrated by another tool before handing off to Ghostferry. See
+	// StateTracker.SeedProgress.
+	//
+	// Optional: defaults to nil. Cannot be used with StateToResumeFrom.
+	SeedPaginationKeys map[string]uint64
+
+	// The names of the CompletionPredicates of the tables, keyed by the table
+	// name (i.e. "db.table"), which decide when the copy of the table is
+	// complete. The predicates must be registered with
+	// RegisterCompletionPredicate. On resume, these take precedence over the
+	// predicates stored in StateToResumeFrom.
+	//
+	// Optional: defaults to ReachedMaxPaginationKeyPredicate for every table
+	CompletionPredicates map[string]string
+
+	// The ranges of pagination keys, both ends inclusive, whose rows are not
+	// copied, keyed by the table name (i.e. "db.table"), such as ranges of
+	// known garbage rows. On resume, these are added to the ranges excluded
+	// in StateToResumeFrom. See StateTracker.ExcludePaginationKeyRange.
+	//
+	// Optional: defaults to nil
+	ExcludedPaginationKeyRanges map[string][][2]uint64
+
+	// The tables which must be completed before the copy of each table
+	// starts, keyed by the table name (i.e. "db.table"), such as the tables
+	// referenced by its foreign keys on the target. The dependencies must not
+	// have cycles. On resume, these replace the dependencies stored in
+	// StateToResumeFrom. See StateTracker.SetTableDependencies.
+	//
+	// Optional: defaults to the dependencies of StateToResumeFrom, if any
+	TableDependencies map[string][]string
+
+	// On resume, checks that the source still has the row at the last
+	// successful pagination key of each table in the middle of its copy,
+	// before continuing the copy. A missing row means that the source may
+	// have changed underneath the state, such as being restored from a backup,
+	// which could silently leave rows uncopied. It may also just have been
+	// deleted since, which is why this is opt-in. See
+	// StateTracker.ResumeCursors.
+	//
+	// With ResumeVerifyCursorWarn, the missing rows are logged. With
+	// ResumeVerifyCursorError, they abort the run.
+	//
+	// Optional: defaults to ResumeVerifyCursorOff
+	ResumeVerifyCursor string
+
+	// If true, the run resumes from a StateToResumeFrom of a version which is
+	// not compatible with the current version, in which case the state may be
+	// misinterpreted. The incompatibility is only logged. See
+	// SerializableState.CheckCompatibility.
+	//
+	// Optional: defaults to false
+	AllowVersionMismatch bool
+
+	// If true, the run resumes from a StateToResumeFrom with its
+	// LastKnownTableSchemaCache without validating it against the schema of
+	// the source and the target. Otherwise the source schema and the target
+	// tables of the tables still in progress are loaded on resume, and the
+	// run is aborted if the primary key or the columns of one of them
+	// changed. See SerializableState.ValidateAgainst and
+	// SerializableState.ValidateTargetAgainst.
+	//
+	// Optional: defaults to false
+	SkipResumeSchemaValidation bool
+
+	// Break-glass recovery for a resume that fails because the stored binlog
+	// position was purged from the source: the binlog streaming resumes from
+	// this position instead. The events in between are never replicated, so
+	// the override must be confirmed via ConfirmDataLoss, and is recorded in
+	// the BinlogPositionOverrides of the state for auditing.
+	//
+	// Optional: defaults to nil. Requires StateToResumeFrom.
+	ResumeBinlogPositionOverride *BinlogPositionOverrideConfig
+
+	// If true, the run resumed from StateToResumeFrom will not copy any data
+	// and will only verify the data copied by the interrupted run. This allows
+	// the copy to be done, the state persisted, and the verification to be
+	// performed later by a fresh process.
+	//
+	// All the tables must be completed in StateToResumeFrom. The binlog
+	// streaming resumes from the position in StateToResumeFrom as usual, so
+	// the target keeps up with the source while the verifier is running. The
+	// InlineVerifier will reverify the rows in the BinlogVerifyStore of the
+	// state as well as the rows changed since then.
+	//
+	// Optional: defaults to false. Requires StateToResumeFrom and a verifier.
+	VerifyOnly bool
+
 	// The verifier to use during the run. Valid choices are:
 	// ChecksumTable
 	// Iterative
@@ -479,6 +780,14 @@ type Config struct {
 	// 2. Use the table's primary key column as the pagination column. Fail if the primary key is not numeric or is a composite key without a FallbackColumn specified.
 	// 3. Use the FallbackColumn pagination column, if configured. Fail if we cannot find this column in the table.
 	CascadingPaginationColumnConfig *CascadingPaginationColumnConfig
+
+	// If specified, a resumed run spot checks that the target contains the
+	// data of the tables completed before the interruption, which guards
+	// against resuming onto the wrong target, e.g. after a target failover.
+	// See Ferry.VerifyTargetConsistency.
+	//
+	// Optional: no check is done if this is nil
+	TargetConsistencyCheck *TargetConsistencyCheckConfig
 }
 
 func (c *Config) ValidateConfig() error {
@@ -494,8 +803,78 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("Table filter function must be provided")
 	}
 
-	if c.StateToResumeFrom != nil && c.StateToResumeFrom.GhostferryVersion != VersionString {
-		return fmt.Errorf("StateToResumeFrom version mismatch: resume = %s, current = %s", c.StateToResumeFrom.GhostferryVersion, VersionString)
+	if c.StateToResumeFrom != nil && !c.AllowVersionMismatch {
+		if err := c.StateToResumeFrom.CheckCompatibility(VersionString); err != nil {
+			return fmt.Errorf("StateToResumeFrom: %s", err)
+		}
+	}
+
+	for table, name := range c.CompletionPredicates {
+		if _, found := LookupCompletionPredicate(name); !found {
+			return fmt.Errorf("CompletionPredicates: predicate %s of table %s is not registered", name, table)
+		}
+	}
+
+	switch c.ResumeVerifyCursor {
+	case ResumeVerifyCursorOff, ResumeVerifyCursorWarn, ResumeVerifyCursorError:
+	default:
+		return fmt.Errorf("ResumeVerifyCursor: %s is not a valid mode", c.ResumeVerifyCursor)
+	}
+
+	if err := CheckTableDependencies(c.TableDependencies); err != nil {
+		return fmt.Errorf("TableDependencies: %s", err)
+	}
+
+	for _, milestone := range c.ProgressMilestones {
+		if milestone <= 0 || milestone > 1 {
+			return fmt.Errorf("ProgressMilestones: milestone %v must be above 0 and at most 1", milestone)
+		}
+	}
+
+	for table, ranges := range c.ExcludedPaginationKeyRanges {
+		for _, r := range ranges {
+			if r[0] > r[1] {
+				return fmt.Errorf("ExcludedPaginationKeyRanges: range [%d, %d] of table %s is inverted", r[0], r[1], table)
+			}
+		}
+	}
+
+	if c.StateToResumeFrom != nil {
+		for table, name := range c.StateToResumeFrom.CompletionPredicates {
+			if _, found := LookupCompletionPredicate(name); !found {
+				return fmt.Errorf("StateToResumeFrom: completion predicate %s of table %s is not registered", name, table)
+			}
+		}
+	}
+
+	// The coordinates of other sources are tracked by the applications
+	// streaming from them, see StateTracker.UpdateLastWrittenCoordinate.
+	if c.StateToResumeFrom != nil && c.StateToResumeFrom.LastWrittenCoordinate != nil {
+		return fmt.Errorf("StateToResumeFrom: the binlog streamer can only resume from binlog file positions, not from a %s coordinate", c.StateToResumeFrom.LastWrittenCoordinate.Kind)
+	}
+
+	if len(c.SeedPaginationKeys) > 0 && c.StateToResumeFrom != nil {
+		return fmt.Errorf("SeedPaginationKeys cannot be used with StateToResumeFrom")
+	}
+
+	if c.ResumeBinlogPositionOverride != nil {
+		if c.StateToResumeFrom == nil {
+			return fmt.Errorf("ResumeBinlogPositionOverride requires StateToResumeFrom")
+		}
+
+		if err := c.ResumeBinlogPositionOverride.Validate(); err != nil {
+			return fmt.Errorf("ResumeBinlogPositionOverride invalid: %v", err)
+		}
+	}
+
+	if c.VerifyOnly {
+		if c.StateToResumeFrom == nil {
+			return fmt.Errorf("VerifyOnly requires StateToResumeFrom")
+		}
+
+		if c.VerifierType == VerifierTypeNoVerification {
+			return fmt.Errorf("VerifyOnly cannot be used with VerifierType %s", VerifierTypeNoVerification)
+		}
 	}
 
 	if c.VerifierType == VerifierTypeIterative {
@@ -536,5 +915,51 @@ func (c *Config) ValidateConfig() error {
 		c.WebBasedir = "."
 	}
 
+	if c.TargetConsistencyCheck != nil {
+		if err := c.TargetConsistencyCheck.Validate(); err != nil {
+			return fmt.Errorf("TargetConsistencyCheck invalid: %v", err)
+		}
+	}
+
+	switch c.DuplicateTableCompletion {
+	case "":
+		c.DuplicateTableCompletion = DuplicateTableCompletionIgnore
+	case DuplicateTableCompletionIgnore, DuplicateTableCompletionWarn, DuplicateTableCompletionPanic:
+	default:
+		return fmt.Errorf("DuplicateTableCompletion %s is not supported", c.DuplicateTableCompletion)
+	}
+
+	for i, bucket := range c.BatchLatencyBuckets {
+		if bucket <= 0 || (i > 0 && bucket <= c.BatchLatencyBuckets[i-1]) {
+			return fmt.Errorf("BatchLatencyBuckets must be positive and in increasing order")
+		}
+	}
+
+	if c.SlowTableWindow < 0 {
+		return fmt.Errorf("SlowTableWindow must not be negative")
+	}
+
+	if c.SlowTableFactor < 0 || c.SlowTableFactor > 1 {
+		return fmt.Errorf("SlowTableFactor must be between 0 and 1")
+	}
+
+	if c.SlowTableFactor == 0 {
+		c.SlowTableFactor = DefaultSlowTableFactor
+	}
+
+	for name, duration := range c.RateWindows {
+		if duration <= 0 {
+			return fmt.Errorf("RateWindows: the duration of %s must be positive", name)
+		}
+	}
+
+	if c.StateCheckpointFrequency == 0 {
+		c.StateCheckpointFrequency = 60000
+	}
+
+	if c.MinSpeedLogSampleInterval == 0 {
+		c.MinSpeedLogSampleInterval = 10
+	}
+
 	return nil
 }
@@ -34,6 +34,7 @@ func (this *ControlServer) Initialize() (err error) {
 	this.router.HandleFunc("/api/actions/cutover", this.HandleCutover).Queries("type", "{type:automatic|manual}").Methods("POST")
 	this.router.HandleFunc("/api/actions/stop", this.HandleStop).Methods("POST")
 	this.router.HandleFunc("/api/actions/verify", this.HandleVerify).Methods("POST")
+	this.router.HandleFunc("/api/dashboard", this.HandleDashboard).Methods("GET")
 
 	if WebUiBasedir != "" {
 		this.Basedir = WebUiBasedir
@@ -136,3 +137,20 @@ func (this *ControlServer) HandleVerify(w http.ResponseWriter, r *http.Request)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// Serves the StateTracker.DashboardJSON of the run, for external dashboards.
+func (this *ControlServer) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	if this.F.StateTracker == nil {
+		http.Error(w, "the ferry is not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := this.F.StateTracker.DashboardJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
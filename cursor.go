@@ -2,7 +2,9 @@ package ghostferry
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/Masterminds/squirrel"
@@ -10,6 +12,10 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Returned by the callback of Cursor.Each to stop the iteration without an
+// error.
+var errStopCursor = errors.New("cursor stopped")
+
 // both `sql.Tx` and `sql.DB` allow a SQL query to be `Prepare`d
 type SqlPreparer interface {
 	Prepare(string) (*sql.Stmt, error)
@@ -65,6 +71,11 @@ type Cursor struct {
 	MaxPaginationKey uint64
 	RowLock          bool
 
+	// The ranges of pagination keys, both ends inclusive, sorted and
+	// non-overlapping, whose rows are skipped. See
+	// StateTracker.ExcludePaginationKeyRange.
+	ExcludedPaginationKeyRanges [][2]uint64
+
 	paginationKeyColumn         *schema.TableColumn
 	lastSuccessfulPaginationKey uint64
 	logger                      *logrus.Entry
@@ -81,6 +92,7 @@ func (c *Cursor) Each(f func(*RowBatch) error) error {
 		c.ColumnsToSelect = []string{"*"}
 	}
 
+	c.skipExcludedPaginationKeyRange()
 	for c.lastSuccessfulPaginationKey < c.MaxPaginationKey {
 		var tx SqlPreparerAndRollbacker
 		var batch *RowBatch
@@ -129,7 +141,28 @@ func (c *Cursor) Each(f func(*RowBatch) error) error {
 			return err
 		}
 
+		// The rows of a batch reaching into an excluded range are dropped,
+		// after which the next batch starts past the excluded range.
+		batch, err = c.withoutExcludedRows(batch)
+		if err != nil {
+			tx.Rollback()
+			c.logger.WithError(err).Error("failed to drop the excluded rows")
+			return err
+		}
+
+		if batch.Size() == 0 {
+			tx.Rollback()
+			c.lastSuccessfulPaginationKey = paginationKeypos
+			c.skipExcludedPaginationKeyRange()
+			continue
+		}
+
 		err = f(batch)
+		if err == errStopCursor {
+			tx.Rollback()
+			return nil
+		}
+
 		if err != nil {
 			tx.Rollback()
 			c.logger.WithError(err).Error("failed to call each callback")
@@ -139,11 +172,54 @@ func (c *Cursor) Each(f func(*RowBatch) error) error {
 		tx.Rollback()
 
 		c.lastSuccessfulPaginationKey = paginationKeypos
+		c.skipExcludedPaginationKeyRange()
 	}
 
 	return nil
 }
 
+// Moves the last successful pagination key to the end of the excluded range
+// directly following it, if any.
+func (c *Cursor) skipExcludedPaginationKeyRange() {
+	if c.lastSuccessfulPaginationKey == math.MaxUint64 {
+		return
+	}
+
+	end, found := paginationKeyRangeEnd(c.ExcludedPaginationKeyRanges, c.lastSuccessfulPaginationKey+1)
+	if !found {
+		return
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"from": c.lastSuccessfulPaginationKey,
+		"to":   end,
+	}).Debug("skipping excluded pagination key range")
+	c.lastSuccessfulPaginationKey = end
+}
+
+func (c *Cursor) withoutExcludedRows(batch *RowBatch) (*RowBatch, error) {
+	if len(c.ExcludedPaginationKeyRanges) == 0 {
+		return batch, nil
+	}
+
+	values := make([]RowData, 0, batch.Size())
+	for _, rowData := range batch.Values() {
+		paginationKey, err := rowData.GetUint64(batch.PaginationKeyIndex())
+		if err != nil {
+			return nil, err
+		}
+
+		if _, excluded := paginationKeyRangeEnd(c.ExcludedPaginationKeyRanges, paginationKey); !excluded {
+			values = append(values, rowData)
+		}
+	}
+
+	if len(values) == batch.Size() {
+		return batch, nil
+	}
+	return NewRowBatch(c.Table, values, batch.PaginationKeyIndex()), nil
+}
+
 func (c *Cursor) Fetch(db SqlPreparer) (batch *RowBatch, paginationKeypos uint64, err error) {
 	var selectBuilder squirrel.SelectBuilder
 
@@ -1,9 +1,12 @@
 package ghostferry
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/sirupsen/logrus"
@@ -14,6 +17,9 @@ type DataIterator struct {
 	Concurrency       int
 	SelectFingerprint bool
 
+	// One of the ResumeVerifyCursor* modes, see Config.ResumeVerifyCursor.
+	ResumeVerifyCursor string
+
 	ErrorHandler ErrorHandler
 	CursorConfig *CursorConfig
 	StateTracker *StateTracker
@@ -35,20 +41,63 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 		d.StateTracker = NewStateTracker(0)
 	}
 
+	// The tables dropped from the source cannot be iterated, and must not be
+	// copied again on resume.
+	remainingTables := make([]*TableSchema, 0, len(tables))
+	for _, table := range tables {
+		if d.StateTracker.IsTableDropped(table.String()) {
+			d.logger.WithField("table", table.String()).Info("skipping the dropped table")
+			continue
+		}
+		remainingTables = append(remainingTables, table)
+	}
+	tables = remainingTables
+
 	d.logger.WithField("tablesCount", len(tables)).Info("starting data iterator run")
 	tablesWithData, emptyTables, err := MaxPaginationKeys(d.DB, tables, d.logger)
 	if err != nil {
 		d.ErrorHandler.Fatal("data_iterator", err)
 	}
 
+	currentMax := make(map[string]uint64, len(tablesWithData)+len(emptyTables))
+	for table, maxPaginationKey := range tablesWithData {
+		currentMax[table.String()] = maxPaginationKey
+	}
 	for _, table := range emptyTables {
-		d.StateTracker.MarkTableAsCompleted(table.String())
+		currentMax[table.String()] = 0
+	}
+	d.StateTracker.SetTableSizes(currentMax)
+
+	if d.StateTracker.IsResume() {
+		for _, anomaly := range d.StateTracker.PaginationKeyAnomalies(currentMax) {
+			d.logger.WithFields(logrus.Fields{
+				"table":                       anomaly.Table,
+				"recorded_pagination_key":     anomaly.RecordedPaginationKey,
+				"observed_max_pagination_key": anomaly.ObservedMaxPaginationKey,
+			}).Warn("the resumed copy progress is beyond the max pagination key of the source, the source may have been restored from a backup")
+		}
+
+		if d.ResumeVerifyCursor != ResumeVerifyCursorOff {
+			err := d.verifyResumeCursors(tablesWithData)
+			if err != nil {
+				d.ErrorHandler.Fatal("data_iterator", err)
+				return
+			}
+		}
+	}
+
+	for _, table := range emptyTables {
+		// On resume, the empty tables may have been completed already.
+		if !d.StateTracker.IsTableComplete(table.String()) {
+			d.StateTracker.MarkTableAsCompleted(table.String())
+		}
 	}
 
 	for table, maxPaginationKey := range tablesWithData {
 		tableName := table.String()
-		if d.StateTracker.IsTableComplete(tableName) {
-			// In a previous run, the table may have been completed.
+		if d.StateTracker.IsTableCopyComplete(tableName) {
+			// In a previous run, the table may have been completed, or copied
+			// and pending verification.
 			// We don't need to reiterate those tables as it has already been done.
 			delete(tablesWithData, table)
 		} else {
@@ -56,8 +105,49 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 		}
 	}
 
+	// The copy of a table waits for its prerequisites, which would never
+	// complete if they are not copied by this run.
+	inRun := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		inRun[table.String()] = true
+	}
+	for table := range tablesWithData {
+		for _, prerequisite := range d.StateTracker.TablePrerequisites(table.String()) {
+			if !inRun[prerequisite] && !d.StateTracker.IsTableComplete(prerequisite) && !d.StateTracker.IsTableDropped(prerequisite) {
+				err := fmt.Errorf("the prerequisite %s of table %s is not copied by this run and is not completed", prerequisite, table.String())
+				d.logger.WithError(err).Error("cannot satisfy the table dependencies")
+				d.ErrorHandler.Fatal("data_iterator", err)
+				return
+			}
+		}
+	}
+
+	// Closed once the table is done being iterated by this run, completed or
+	// not, or right away for the tables this run does not iterate. The tables
+	// deferred until their prerequisites are completed stop waiting then, so
+	// they do not wait forever for a prerequisite that ended incomplete.
+	iterated := make(map[string]chan struct{}, len(tables))
+	for _, table := range tables {
+		done := make(chan struct{})
+		if _, found := tablesWithData[table]; !found {
+			close(done)
+		}
+		iterated[table.String()] = done
+	}
+
+	// Cancels the tables still waiting for their prerequisites once the run is
+	// over.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	tablesQueue := make(chan *TableSchema)
 	wg := &sync.WaitGroup{}
+
+	// Counts the tables not done yet, including the paused ones waiting to be
+	// queued again, such that the queue is only closed once they are done.
+	tablesWg := &sync.WaitGroup{}
+	tablesWg.Add(len(tablesWithData))
+
 	wg.Add(d.Concurrency)
 
 	for i := 0; i < d.Concurrency; i++ {
@@ -70,91 +160,42 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 					break
 				}
 
-				logger := d.logger.WithField("table", table.String())
-
-				targetPaginationKeyInterface, found := d.targetPaginationKeys.Load(table.String())
-				if !found {
-					err := fmt.Errorf("%s not found in targetPaginationKeys, this is likely a programmer error", table.String())
-					logger.WithError(err).Error("this is definitely a bug")
-					d.ErrorHandler.Fatal("data_iterator", err)
-					return
-				}
-
-				startPaginationKey := d.StateTracker.LastSuccessfulPaginationKey(table.String())
-				if startPaginationKey == math.MaxUint64 {
-					err := fmt.Errorf("%v has been marked as completed but a table iterator has been spawned, this is likely a programmer error which resulted in the inconsistent starting state", table.String())
-					logger.WithError(err).Error("this is definitely a bug")
-					d.ErrorHandler.Fatal("data_iterator", err)
-					return
-				}
-
-				cursor := d.CursorConfig.NewCursor(table, startPaginationKey, targetPaginationKeyInterface.(uint64))
-				if d.SelectFingerprint {
-					if len(cursor.ColumnsToSelect) == 0 {
-						cursor.ColumnsToSelect = []string{"*"}
-					}
-
-					cursor.ColumnsToSelect = append(cursor.ColumnsToSelect, table.RowMd5Query())
-				}
-
-				err := cursor.Each(func(batch *RowBatch) error {
-					metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
-						MetricTag{"table", table.Name},
-						MetricTag{"source", "table"},
-					}, 1.0)
-
-					if d.SelectFingerprint {
-						fingerprints := make(map[uint64][]byte)
-						rows := make([]RowData, batch.Size())
+				if !d.StateTracker.CanStartTable(table.String()) {
+					d.logger.WithField("table", table.String()).Info("deferring the table until its prerequisites are completed")
+					go func(table *TableSchema) {
+						for _, prerequisite := range d.StateTracker.TablePrerequisites(table.String()) {
+							err := d.waitForPrerequisite(ctx, prerequisite, iterated[prerequisite])
+							if err == context.Canceled {
+								return
+							}
 
-						for i, rowData := range batch.Values() {
-							paginationKey, err := rowData.GetUint64(batch.PaginationKeyIndex())
 							if err != nil {
-								logger.WithError(err).Error("failed to get paginationKey data")
-								return err
+								err = fmt.Errorf("cannot copy table %s: %v", table.String(), err)
+								d.logger.WithError(err).Error("the prerequisite of the table will never be completed")
+								d.StateTracker.RecordTableError(table.String(), err)
+								d.ErrorHandler.Fatal("data_iterator", err)
+								close(iterated[table.String()])
+								tablesWg.Done()
+								return
 							}
-
-							fingerprints[paginationKey] = rowData[len(rowData)-1].([]byte)
-							rows[i] = rowData[:len(rowData)-1]
 						}
-
-						batch = &RowBatch{
-							values:             rows,
-							paginationKeyIndex: batch.PaginationKeyIndex(),
-							table:              table,
-							fingerprints:       fingerprints,
-						}
-					}
-
-					for _, listener := range d.batchListeners {
-						err := listener(batch)
-						if err != nil {
-							logger.WithError(err).Error("failed to process row batch with listeners")
-							return err
-						}
-					}
-
-					return nil
-				})
-
-				if err != nil {
-					switch e := err.(type) {
-					case BatchWriterVerificationFailed:
-						logger.WithField("incorrect_tables", e.table).Error(e.Error())
-						d.ErrorHandler.Fatal("inline_verifier", err)
-					default:
-						logger.WithError(err).Error("failed to iterate table")
-						d.ErrorHandler.Fatal("data_iterator", err)
-					}
-
+						tablesQueue <- table
+					}(table)
+					continue
 				}
 
-				logger.Debug("table iteration completed")
+				if d.iterateTable(table) {
+					// The table is queued again once resumed, and is not
+					// done until then.
+					go func(table *TableSchema) {
+						<-d.StateTracker.TableResumed(table.String())
+						tablesQueue <- table
+					}(table)
+					continue
+				}
 
-				// Right now the BatchWriter.WriteRowBatch happens synchronously in
-				// this method. If it ever becomes async, this MarkTableAsCompleted
-				// call MUST be done in WriteRowBatch somehow.
-				d.StateTracker.MarkTableAsCompleted(table.String())
+				close(iterated[table.String()])
+				tablesWg.Done()
 			}
 		}()
 	}
@@ -173,15 +214,245 @@ func (d *DataIterator) Run(tables []*TableSchema) {
 		}
 	}
 
-	d.logger.Info("done queueing tables to be iterated, closing table channel")
+	d.logger.Info("done queueing tables to be iterated, waiting for them to be done")
+	tablesWg.Wait()
+
+	d.logger.Info("done iterating tables, closing table channel")
 	close(tablesQueue)
 
 	wg.Wait()
+	d.notifyDoneListeners()
+}
+
+// Waits for the prerequisite to be completed. The dropped prerequisites are
+// not waited for. Returns an error if the prerequisite is done being iterated
+// without being completed, such as a table whose CompletionPredicate is not
+// satisfied or a table pending verification, see
+// StateTracker.MarkTableCopyComplete.
+func (d *DataIterator) waitForPrerequisite(ctx context.Context, prerequisite string, iterated <-chan struct{}) error {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-iterated:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	err := d.StateTracker.WaitForTableComplete(waitCtx, prerequisite)
+	if err == nil || d.StateTracker.IsTableDropped(prerequisite) {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// The prerequisite may have been completed right before it was done
+	// being iterated.
+	if d.StateTracker.IsTableComplete(prerequisite) {
+		return nil
+	}
+
+	return fmt.Errorf("the prerequisite %s is done being iterated but is not completed", prerequisite)
+}
+
+// Also called by the Ferry when the data copy is skipped, as the listeners
+// still expect to be told that there is no more data to copy.
+func (d *DataIterator) notifyDoneListeners() {
 	for _, listener := range d.doneListeners {
 		listener()
 	}
 }
 
+// Iterates the table until it is complete. Returns true if the iteration
+// stopped because the table is paused, see StateTracker.PauseTable.
+func (d *DataIterator) iterateTable(table *TableSchema) bool {
+	logger := d.logger.WithField("table", table.String())
+
+	if d.StateTracker.IsTableDropped(table.String()) {
+		logger.Info("the table was dropped before its iteration, abandoning it")
+		return false
+	}
+
+	if d.StateTracker.IsTablePaused(table.String()) {
+		logger.Info("the table is paused, deferring its iteration until it is resumed")
+		return true
+	}
+
+	targetPaginationKeyInterface, found := d.targetPaginationKeys.Load(table.String())
+	if !found {
+		err := fmt.Errorf("%s not found in targetPaginationKeys, this is likely a programmer error", table.String())
+		logger.WithError(err).Error("this is definitely a bug")
+		d.ErrorHandler.Fatal("data_iterator", err)
+		return false
+	}
+
+	startPaginationKey := d.StateTracker.LastSuccessfulPaginationKey(table.String())
+	if startPaginationKey == math.MaxUint64 {
+		err := fmt.Errorf("%v has been marked as completed but a table iterator has been spawned, this is likely a programmer error which resulted in the inconsistent starting state", table.String())
+		logger.WithError(err).Error("this is definitely a bug")
+		d.ErrorHandler.Fatal("data_iterator", err)
+		return false
+	}
+
+	cursor := d.CursorConfig.NewCursor(table, startPaginationKey, targetPaginationKeyInterface.(uint64))
+	cursor.ExcludedPaginationKeyRanges = d.StateTracker.ExcludedPaginationKeyRanges(table.String())
+	if d.SelectFingerprint {
+		if len(cursor.ColumnsToSelect) == 0 {
+			cursor.ColumnsToSelect = []string{"*"}
+		}
+
+		cursor.ColumnsToSelect = append(cursor.ColumnsToSelect, table.RowMd5Query())
+	}
+
+	completed := false
+	paused := false
+	err := cursor.Each(func(batch *RowBatch) error {
+		if d.StateTracker.IsTableDropped(table.String()) {
+			return errStopCursor
+		}
+
+		if d.StateTracker.IsTablePaused(table.String()) {
+			paused = true
+			return errStopCursor
+		}
+
+		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
+			MetricTag{"table", table.Name},
+			MetricTag{"source", "table"},
+		}, 1.0)
+
+		if d.SelectFingerprint {
+			fingerprints := make(map[uint64][]byte)
+			rows := make([]RowData, batch.Size())
+
+			for i, rowData := range batch.Values() {
+				paginationKey, err := rowData.GetUint64(batch.PaginationKeyIndex())
+				if err != nil {
+					logger.WithError(err).Error("failed to get paginationKey data")
+					return err
+				}
+
+				fingerprints[paginationKey] = rowData[len(rowData)-1].([]byte)
+				rows[i] = rowData[:len(rowData)-1]
+			}
+
+			batch = &RowBatch{
+				values:             rows,
+				paginationKeyIndex: batch.PaginationKeyIndex(),
+				table:              table,
+				fingerprints:       fingerprints,
+			}
+		}
+
+		for _, listener := range d.batchListeners {
+			err := listener(batch)
+			if err != nil {
+				logger.WithError(err).Error("failed to process row batch with listeners")
+				return err
+			}
+		}
+
+		if d.isTableComplete(table, targetPaginationKeyInterface.(uint64), batch) {
+			completed = true
+			return errStopCursor
+		}
+
+		return nil
+	})
+
+	// The table may be dropped while it is iterated, in which case the
+	// iteration fails as the table does not exist anymore.
+	if d.StateTracker.IsTableDropped(table.String()) {
+		logger.WithError(err).Info("the table was dropped during its iteration, abandoning it")
+		return false
+	}
+
+	// The batches copied before the pause are tracked, so the iteration
+	// continues from the last of them once the table is resumed.
+	if paused {
+		logger.Info("the table was paused during its iteration, deferring the rest of it until it is resumed")
+		return true
+	}
+
+	if err != nil {
+		d.StateTracker.RecordTableError(table.String(), err)
+
+		switch e := err.(type) {
+		case BatchWriterVerificationFailed:
+			logger.WithField("incorrect_tables", e.table).Error(e.Error())
+			d.ErrorHandler.Fatal("inline_verifier", err)
+		default:
+			logger.WithError(err).Error("failed to iterate table")
+			d.ErrorHandler.Fatal("data_iterator", err)
+		}
+
+	}
+
+	logger.Debug("table iteration completed")
+
+	if !completed && !d.isTableComplete(table, targetPaginationKeyInterface.(uint64), nil) {
+		logger.Info("the completion predicate of the table does not consider it complete, leaving it incomplete")
+		return false
+	}
+
+	// Right now the BatchWriter.WriteRowBatch happens synchronously in this
+	// method. If it ever becomes async, this MarkTableAsCompleted call MUST be
+	// done in WriteRowBatch somehow.
+	d.StateTracker.MarkTableAsCompleted(table.String())
+	return false
+}
+
+// Checks that the rows at the resume cursors of the tables still exist on the
+// source, see Config.ResumeVerifyCursor. Returns an error for the missing rows
+// only with ResumeVerifyCursorError.
+func (d *DataIterator) verifyResumeCursors(tables map[*TableSchema]uint64) error {
+	cursors := d.StateTracker.ResumeCursors()
+
+	missing := make([]string, 0)
+	for table := range tables {
+		paginationKey, found := cursors[table.String()]
+		if !found {
+			continue
+		}
+
+		exists, err := paginationKeyExists(d.DB, table, paginationKey)
+		if err != nil {
+			d.logger.WithError(err).WithField("table", table.String()).Error("failed to verify the resume cursor")
+			return err
+		}
+
+		if !exists {
+			d.logger.WithFields(logrus.Fields{
+				"table":                          table.String(),
+				"last_successful_pagination_key": paginationKey,
+			}).Warn("the row at the resume cursor is missing from the source, the source may have changed underneath the state")
+			missing = append(missing, table.String())
+		}
+	}
+
+	if len(missing) > 0 && d.ResumeVerifyCursor == ResumeVerifyCursorError {
+		sort.Strings(missing)
+		return fmt.Errorf("the rows at the resume cursors of %s are missing from the source", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Evaluates the CompletionPredicate of the table, after the batch is copied or
+// with a nil batch once the copy is exhausted.
+func (d *DataIterator) isTableComplete(table *TableSchema, maxPaginationKey uint64, batch *RowBatch) bool {
+	return d.StateTracker.CompletionPredicate(table.String()).IsComplete(TableCompletionProgress{
+		Table:                       table,
+		LastSuccessfulPaginationKey: d.StateTracker.LastSuccessfulPaginationKey(table.String()),
+		MaxPaginationKey:            maxPaginationKey,
+		Batch:                       batch,
+		Exhausted:                   batch == nil,
+	})
+}
+
 func (d *DataIterator) AddBatchListener(listener func(*RowBatch) error) {
 	d.batchListeners = append(d.batchListeners, listener)
 }
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 
@@ -44,12 +45,23 @@ type DMLEvent interface {
 	NewValues() RowData
 	PaginationKey() (uint64, error)
 	BinlogPosition() mysql.Position
+
+	// The time of the binlog event from its header, or the zero time if it
+	// is not known.
+	Timestamp() time.Time
+
+	// The GTID set of the transactions committed before the transaction of
+	// the event, i.e. the set to resume from to stream the event again, or nil
+	// if the GTIDs are not known.
+	GTIDSet() mysql.GTIDSet
 }
 
 // The base of DMLEvent to provide the necessary methods.
 type DMLEventBase struct {
-	table *TableSchema
-	pos   mysql.Position
+	table     *TableSchema
+	pos       mysql.Position
+	timestamp time.Time
+	gtidSet   mysql.GTIDSet
 }
 
 func (e *DMLEventBase) Database() string {
@@ -68,6 +80,22 @@ func (e *DMLEventBase) BinlogPosition() mysql.Position {
 	return e.pos
 }
 
+func (e *DMLEventBase) Timestamp() time.Time {
+	return e.timestamp
+}
+
+func (e *DMLEventBase) setTimestamp(timestamp time.Time) {
+	e.timestamp = timestamp
+}
+
+func (e *DMLEventBase) GTIDSet() mysql.GTIDSet {
+	return e.gtidSet
+}
+
+func (e *DMLEventBase) setGTIDSet(gtidSet mysql.GTIDSet) {
+	e.gtidSet = gtidSet
+}
+
 type BinlogInsertEvent struct {
 	newValues RowData
 	*DMLEventBase
@@ -236,16 +264,28 @@ func NewBinlogDMLEvents(table *TableSchema, ev *replication.BinlogEvent, pos mys
 		}
 	}
 
+	var dmlEvents []DMLEvent
+	var err error
 	switch ev.Header.EventType {
 	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
-		return NewBinlogInsertEvents(table, rowsEvent, pos)
+		dmlEvents, err = NewBinlogInsertEvents(table, rowsEvent, pos)
 	case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
-		return NewBinlogDeleteEvents(table, rowsEvent, pos)
+		dmlEvents, err = NewBinlogDeleteEvents(table, rowsEvent, pos)
 	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
-		return NewBinlogUpdateEvents(table, rowsEvent, pos)
+		dmlEvents, err = NewBinlogUpdateEvents(table, rowsEvent, pos)
 	default:
 		return nil, fmt.Errorf("unrecognized rows event: %s", ev.Header.EventType.String())
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Unix(int64(ev.Header.Timestamp), 0)
+	for _, dmlEv := range dmlEvents {
+		dmlEv.(interface{ setTimestamp(time.Time) }).setTimestamp(timestamp)
+	}
+
+	return dmlEvents, nil
 }
 
 func quotedColumnNames(table *TableSchema) []string {
@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -35,6 +36,10 @@ const (
 	StateDone                = "done"
 )
 
+// The interval at which the estimated copy speed is published to the
+// subscribers of the StateTracker.
+const progressEventRateInterval = 1 * time.Second
+
 func quoteField(field string) string {
 	return fmt.Sprintf("`%s`", field)
 }
@@ -61,11 +66,43 @@ type Ferry struct {
 	DataIterator *DataIterator
 	BatchWriter  *BatchWriter
 
+	// This is created by Initialize, unless a tracker constructed with
+	// NewStateTrackerForBinlogOnly is given.
 	StateTracker                       *StateTracker
 	ErrorHandler                       ErrorHandler
 	Throttler                          Throttler
 	WaitUntilReplicaIsCaughtUpToMaster *WaitUntilReplicaIsCaughtUpToMaster
 
+	// This can be specified by the caller. If specified, the state is stored
+	// in it every StateCheckpointFrequency milliseconds during the run as well
+	// as at the end of the run.
+	StateStore StateStore
+
+	// This can be specified by the caller. If specified, the periodic
+	// checkpoints are skipped while it returns false, in addition to while
+	// StateTracker.CanSerialize returns false. The final checkpoint, stored
+	// once the run is done, is not affected.
+	CanSerialize func() bool
+
+	// This can be specified by the caller. If specified, it is given to the
+	// StateTracker to create spans around the phases of the run and the
+	// significant operations of the tracker.
+	Tracer Tracer
+
+	// This can be specified by the caller. If specified, the schema cache of
+	// every state dumped or checkpointed by the Ferry is redacted with it.
+	StateRedactor StateRedactor
+
+	// This can be specified by the caller. If specified, this is the schema
+	// cache a StateToResumeFrom serialized without its schema cache, see
+	// StateTracker.SerializeProgressOnly, is resumed with, instead of the
+	// schema loaded from the source.
+	TableSchemaCacheToResumeWith TableSchemaCache
+
+	// This can be specified by the caller. If specified, the progress events
+	// of the run are produced to Kafka by it during the run.
+	KafkaProgressSink *KafkaProgressSink
+
 	// This can be specified by the caller. If specified, do not specify
 	// VerifierType in Config (or as an empty string) or an error will be
 	// returned in Initialize.
@@ -85,6 +122,16 @@ type Ferry struct {
 	logger *logrus.Entry
 
 	rowCopyCompleteCh chan struct{}
+
+	// The checkpointRecord of the last checkpoint.
+	lastCheckpoint atomic.Value
+}
+
+type checkpointRecord struct {
+	SerializeDuration time.Duration
+
+	// The size of the state encoded in JSON, 0 if not measured.
+	StateSize int
 }
 
 func (f *Ferry) NewDataIterator() *DataIterator {
@@ -95,6 +142,8 @@ func (f *Ferry) NewDataIterator() *DataIterator {
 		Concurrency:       f.Config.DataIterationConcurrency,
 		SelectFingerprint: f.Config.VerifierType == VerifierTypeInline,
 
+		ResumeVerifyCursor: f.Config.ResumeVerifyCursor,
+
 		ErrorHandler: f.ErrorHandler,
 		CursorConfig: &CursorConfig{
 			DB:        f.SourceDB,
@@ -405,11 +454,105 @@ func (f *Ferry) Initialize() (err error) {
 		f.Throttler = &PauserThrottler{}
 	}
 
-	if f.StateToResumeFrom == nil {
+	if f.StateToResumeFrom != nil && f.StateToResumeFrom.LastKnownTableSchemaCacheRef != "" {
+		err = errors.New("cannot resume from a state without its schema cache, it must be loaded via the SplitSchemaStateStore")
+		f.logger.WithError(err).Error("cannot resume from a state referencing its schema cache")
+		return err
+	}
+
+	if f.StateToResumeFrom != nil && f.StateToResumeFrom.LastKnownTableSchemaCacheCompressed != nil {
+		err = errors.New("cannot resume from a state with a compressed schema cache, it must be decoded with DeserializeCompressed")
+		f.logger.WithError(err).Error("cannot resume from a state with a compressed schema cache")
+		return err
+	}
+
+	if f.StateToResumeFrom != nil && len(f.StateToResumeFrom.OmittedCompletedTables) > 0 {
+		err = errors.New("cannot resume from an incremental state, it must be merged with its prior state first")
+		f.logger.WithError(err).Error("cannot resume from an incremental state")
+		return err
+	}
+
+	if f.StateToResumeFrom != nil && f.Config.ResumeBinlogPositionOverride != nil {
+		override := siddontangmysql.Position{
+			Name: f.Config.ResumeBinlogPositionOverride.Name,
+			Pos:  f.Config.ResumeBinlogPositionOverride.Pos,
+		}
+		f.logger.WithFields(logrus.Fields{
+			"stored_binlog_position":     f.StateToResumeFrom.MinBinlogPosition(),
+			"overridden_binlog_position": override,
+		}).Error("overriding the binlog position to resume from: the binlog events in between will NOT be replicated and the target may be missing data, the affected tables must be copied again")
+		f.StateToResumeFrom = f.StateToResumeFrom.WithBinlogPositionOverride(override, time.Now())
+	}
+
+	if f.StateToResumeFrom != nil {
+		err = f.StateToResumeFrom.CheckCompatibility(VersionString)
+		if err != nil && !f.Config.AllowVersionMismatch {
+			f.logger.WithError(err).Error("cannot resume from the state")
+			return err
+		} else if err != nil {
+			f.logger.WithError(err).Warn("resuming from a state of an incompatible version as AllowVersionMismatch is set")
+		}
+	}
+
+	if f.StateTracker != nil && f.StateTracker.IsBinlogOnly() {
+		if f.StateToResumeFrom != nil || f.Config.VerifyOnly {
+			err = errors.New("a binlog-only StateTracker cannot be used with StateToResumeFrom or VerifyOnly")
+			f.logger.WithError(err).Error("cannot start a binlog-only run")
+			return err
+		}
+	} else if f.StateToResumeFrom == nil {
 		f.StateTracker = NewStateTracker(f.DataIterationConcurrency * 10)
+	} else if f.Config.VerifyOnly {
+		f.StateTracker, err = NewVerifyOnlyStateTrackerFromSerializedState(f.DataIterationConcurrency*10, f.StateToResumeFrom)
+		if err != nil {
+			f.logger.WithError(err).Error("cannot resume in verify-only mode")
+			return err
+		}
 	} else {
 		f.StateTracker = NewStateTrackerFromSerializedState(f.DataIterationConcurrency*10, f.StateToResumeFrom)
 	}
+	f.StateTracker.InstrumentLockContention = f.Config.InstrumentStateTrackerLocks
+	f.StateTracker.Tracer = f.Tracer
+	f.logger = f.logger.WithField("resumed", f.StateTracker.IsResume())
+	f.StateTracker.TrackTableErrors = f.Config.TrackTableErrors
+	f.StateTracker.TrackTableRates = f.Config.TrackTableRates
+	f.StateTracker.TrackTableRowsCopied = f.Config.TrackTableRowsCopied
+	f.StateTracker.CompactCompletedTables = f.Config.CompactCompletedTables
+	f.StateTracker.SlowTableWindow = time.Duration(f.Config.SlowTableWindow) * time.Millisecond
+	f.StateTracker.DuplicateTableCompletion = f.Config.DuplicateTableCompletion
+	f.StateTracker.VerificationQueueSize = f.Config.VerificationQueueSize
+	if f.Config.ProgressMilestones != nil {
+		f.StateTracker.Milestones = f.Config.ProgressMilestones
+	}
+	if f.Config.RateWindows != nil {
+		rateWindows := make(map[string]time.Duration, len(f.Config.RateWindows))
+		for name, duration := range f.Config.RateWindows {
+			rateWindows[name] = time.Duration(duration) * time.Millisecond
+		}
+		f.StateTracker.SetRateWindows(rateWindows)
+	}
+	for table, name := range f.Config.CompletionPredicates {
+		// The names are checked by ValidateConfig.
+		predicate, _ := LookupCompletionPredicate(name)
+		f.StateTracker.SetCompletionPredicate(table, predicate)
+	}
+	if f.Config.TableDependencies != nil {
+		err = f.StateTracker.SetTableDependencies(f.Config.TableDependencies)
+		if err != nil {
+			f.logger.WithError(err).Error("invalid table dependencies")
+			return err
+		}
+	}
+	for table, ranges := range f.Config.ExcludedPaginationKeyRanges {
+		for _, r := range ranges {
+			f.StateTracker.ExcludePaginationKeyRange(table, r[0], r[1])
+		}
+	}
+	f.StateTracker.BatchLatencyBuckets = f.Config.BatchLatencyBuckets
+	if f.Config.MinSpeedLogSampleInterval > 0 {
+		f.StateTracker.MinSpeedLogSampleInterval = time.Duration(f.Config.MinSpeedLogSampleInterval) * time.Millisecond
+	}
+	f.StateTracker.SetPhase(f.OverallState)
 
 	// Loads the schema of the tables that are applicable.
 	// We need to do this at the beginning of the run as this is required
@@ -419,16 +562,95 @@ func (f *Ferry) Initialize() (err error) {
 	//
 	// If this is a resuming run and the last known table schema cache is not given
 	// we'll regenerate it from the source database, assuming it has not been
-	// changed.
-	if f.StateToResumeFrom == nil || f.StateToResumeFrom.LastKnownTableSchemaCache == nil {
+	// changed. A redacted schema cache is regenerated as well, but it is
+	// verified against the schema hashes of the state.
+	//
+	// A state serialized without its schema cache is resumed with the
+	// TableSchemaCacheToResumeWith if given, and otherwise also regenerates
+	// it. Either way, the schema is verified against the schema hashes of the
+	// state, if any.
+	schemaLoadedFromSource := false
+	if f.StateToResumeFrom != nil && f.StateToResumeFrom.LastKnownTableSchemaCacheOmitted && f.TableSchemaCacheToResumeWith != nil {
+		f.Tables = f.TableSchemaCacheToResumeWith
+	} else if f.StateToResumeFrom == nil || f.StateToResumeFrom.LastKnownTableSchemaCache == nil || f.StateToResumeFrom.LastKnownTableSchemaCacheRedacted {
 		metrics.Measure("LoadTables", nil, 1.0, func() {
 			f.Tables, err = LoadTables(f.SourceDB, f.TableFilter, f.CompressedColumnsForVerification, f.IgnoredColumnsForVerification, f.CascadingPaginationColumnConfig)
 		})
 		if err != nil {
 			return err
 		}
+		schemaLoadedFromSource = true
+
+		if f.StateToResumeFrom != nil && f.StateToResumeFrom.LastKnownTableSchemaCacheRedacted {
+			err = f.checkSchemaOfRedactedState()
+			if err != nil {
+				f.logger.WithError(err).Error("cannot resume from a redacted state")
+				return err
+			}
+		}
 	} else {
 		f.Tables = f.StateToResumeFrom.LastKnownTableSchemaCache
+
+		if !f.Config.SkipResumeSchemaValidation {
+			err = f.validateSchemaOfResumedState()
+			if err != nil {
+				f.logger.WithError(err).Error("cannot resume from a state whose schema changed, set SkipResumeSchemaValidation to resume regardless")
+				return err
+			}
+		}
+	}
+
+	if f.StateToResumeFrom != nil && f.StateToResumeFrom.LastKnownTableSchemaCacheOmitted {
+		err = f.checkSchemaOfProgressOnlyState()
+		if err != nil {
+			f.logger.WithError(err).Error("cannot resume from a state serialized without its schema cache")
+			return err
+		}
+	}
+
+	if f.StateToResumeFrom != nil && f.Config.CopyNewTablesOnResume {
+		err = f.registerNewTables(schemaLoadedFromSource)
+		if err != nil {
+			f.logger.WithError(err).Error("cannot register the tables created after the run started")
+			return err
+		}
+	}
+
+	f.StateTracker.SetDeclaredMaxPaginationKeys(f.Tables)
+
+	if len(f.Config.SeedPaginationKeys) > 0 {
+		err = f.StateTracker.SeedProgress(f.Config.SeedPaginationKeys, f.Tables)
+		if err != nil {
+			f.logger.WithError(err).Error("cannot seed the copy progress")
+			return err
+		}
+	}
+
+	if f.StateTracker.IsBinlogOnly() {
+		for tableName := range f.Tables {
+			if !f.StateTracker.IsTableComplete(tableName) {
+				err = fmt.Errorf("cannot start a binlog-only run as %s is not marked as completed", tableName)
+				f.logger.WithError(err).Error("cannot start a binlog-only run")
+				return err
+			}
+		}
+	}
+
+	if f.Config.VerifyOnly {
+		for tableName := range f.Tables {
+			if !f.StateTracker.IsTableCopyComplete(tableName) {
+				err = fmt.Errorf("cannot resume in verify-only mode as %s is not completely copied", tableName)
+				f.logger.WithError(err).Error("cannot resume in verify-only mode")
+				return err
+			}
+		}
+	}
+
+	if f.StateToResumeFrom != nil && f.Config.TargetConsistencyCheck != nil {
+		err = f.checkTargetConsistency()
+		if err != nil {
+			return err
+		}
 	}
 
 	// The iterative verifier needs the binlog streamer so this has to be first.
@@ -464,6 +686,10 @@ func (f *Ferry) Initialize() (err error) {
 		}
 	}
 
+	if f.Config.VerifyOnly && f.Verifier == nil {
+		return errors.New("VerifyOnly requires a verifier")
+	}
+
 	f.logger.Info("ferry initialized")
 	return nil
 }
@@ -495,8 +721,27 @@ func (f *Ferry) Start() error {
 	// the starting binlog coordinates are determined.
 	var pos siddontangmysql.Position
 	var err error
+	var resumeFromGTIDSet siddontangmysql.GTIDSet
 	if f.StateToResumeFrom != nil {
-		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.StateToResumeFrom.MinBinlogPosition())
+		resumeFromGTIDSet, err = f.StateToResumeFrom.MinGTIDSet()
+		if err != nil {
+			f.logger.WithError(err).Warn("failed to parse the GTID set of the state, resuming from its binlog position instead")
+			resumeFromGTIDSet = nil
+		}
+	}
+
+	if resumeFromGTIDSet != nil {
+		// The binlog position of the state may be from a source which has
+		// since failed over.
+		f.logger.WithField("gtid_set", resumeFromGTIDSet.String()).Info("resuming the binlog streaming from the gtid set of the state")
+		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFromGTIDSet(resumeFromGTIDSet)
+	} else if f.StateToResumeFrom != nil {
+		resumeFrom := f.StateToResumeFrom.MinBinlogConsumerPosition()
+		f.logger.WithField("resume_floor", resumeFrom.String()).Info("resuming the binlog streaming from the earliest position still needed")
+		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(resumeFrom.Position)
+	} else if f.StateTracker.IsBinlogOnly() {
+		snapshot := f.StateTracker.Snapshot()
+		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(snapshot.MinBinlogPosition())
 	} else {
 		pos, err = f.BinlogStreamer.ConnectBinlogStreamerToMysql()
 	}
@@ -507,7 +752,16 @@ func (f *Ferry) Start() error {
 	// If we don't set this now, there is a race condition where Ghostferry
 	// is terminated with some rows copied but no binlog events are written.
 	// This guarentees that we are able to restart from a valid location.
-	f.StateTracker.UpdateLastWrittenBinlogPosition(pos)
+	if resumeFromGTIDSet != nil {
+		// The position is only known once streamed, and the positions of the
+		// state may not be comparable with the ones of the source anymore.
+		f.StateTracker.ForceBinlogPosition(pos)
+	} else {
+		f.StateTracker.UpdateLastWrittenBinlogPosition(pos)
+	}
+	if gtidSet := f.BinlogStreamer.GetLastStreamedGTIDSet(); gtidSet != nil {
+		f.StateTracker.UpdateLastWrittenGTID(gtidSet)
+	}
 	if f.inlineVerifier != nil {
 		f.StateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(pos)
 	}
@@ -519,7 +773,7 @@ func (f *Ferry) Start() error {
 // Wait for the background tasks to finish.
 func (f *Ferry) Run() {
 	f.logger.Info("starting ferry run")
-	f.OverallState = StateCopying
+	f.setOverallState(StateCopying)
 
 	ctx, shutdown := context.WithCancel(context.Background())
 
@@ -530,7 +784,12 @@ func (f *Ferry) Run() {
 	}
 
 	supportingServicesWg := &sync.WaitGroup{}
-	supportingServicesWg.Add(1)
+	supportingServicesWg.Add(2)
+
+	go func() {
+		defer supportingServicesWg.Done()
+		f.StateTracker.PublishRateUpdates(ctx, progressEventRateInterval)
+	}()
 
 	go func() {
 		defer supportingServicesWg.Done()
@@ -555,6 +814,37 @@ func (f *Ferry) Run() {
 		}()
 	}
 
+	if f.KafkaProgressSink != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			f.KafkaProgressSink.Run(ctx, f.StateTracker)
+		}()
+	}
+
+	if f.StateStore != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+
+			frequency := time.Duration(f.Config.StateCheckpointFrequency) * time.Millisecond
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(frequency):
+					if !f.StateTracker.CanSerialize() || (f.CanSerialize != nil && !f.CanSerialize()) {
+						f.logger.WithField("phase", f.StateTracker.Phase()).Info("skipping the checkpoint as the state is not safe to serialize")
+						continue
+					}
+
+					f.checkpointState()
+				}
+			}
+		}()
+	}
+
 	if f.DumpStateOnSignal {
 		go func() {
 			c := make(chan os.Signal, 1)
@@ -601,6 +891,19 @@ func (f *Ferry) Run() {
 
 	go func() {
 		defer dataIteratorWg.Done()
+
+		if f.StateTracker.IsVerifyOnly() {
+			f.logger.Info("verify-only run, skipping the data copy")
+			f.DataIterator.notifyDoneListeners()
+			return
+		}
+
+		if f.StateTracker.IsBinlogOnly() {
+			f.logger.Info("binlog-only run, skipping the data copy")
+			f.DataIterator.notifyDoneListeners()
+			return
+		}
+
 		f.DataIterator.Run(f.Tables.AsSlice())
 	}()
 
@@ -613,7 +916,7 @@ func (f *Ferry) Run() {
 
 	if f.Verifier != nil {
 		f.logger.Info("calling VerifyBeforeCutover")
-		f.OverallState = StateVerifyBeforeCutover
+		f.setOverallState(StateVerifyBeforeCutover)
 
 		metrics.Measure("VerifyBeforeCutover", nil, 1.0, func() {
 			err := f.Verifier.VerifyBeforeCutover()
@@ -625,11 +928,13 @@ func (f *Ferry) Run() {
 	}
 
 	f.logger.Info("data copy is complete, waiting for cutover")
-	f.OverallState = StateWaitingForCutover
+	f.setOverallState(StateWaitingForCutover)
+	cutoverWaitSpan := f.StateTracker.startSpan(SpanCutoverWait, nil)
 	f.waitUntilAutomaticCutoverIsTrue()
+	cutoverWaitSpan.End()
 
 	f.logger.Info("entering cutover phase, notifying caller that row copy is complete")
-	f.OverallState = StateCutover
+	f.setOverallState(StateCutover)
 	f.notifyRowCopyComplete()
 
 	// Cutover is a cooperative activity between the Ghostferry library and
@@ -645,12 +950,21 @@ func (f *Ferry) Run() {
 	binlogWg.Wait()
 
 	f.logger.Info("ghostferry run is complete, shutting down auxiliary services")
-	f.OverallState = StateDone
+	f.setOverallState(StateDone)
 	f.DoneTime = time.Now()
 
+	// The pending progress must be flushed before the finalization, as the
+	// finalized tracker ignores it.
+	f.flushStateTracker()
+	f.StateTracker.Finalize()
+
 	shutdown()
 	supportingServicesWg.Wait()
 
+	if f.StateStore != nil {
+		f.checkpointState()
+	}
+
 	if f.Config.ProgressCallback.URI != "" {
 		f.ReportProgress()
 	}
@@ -724,19 +1038,272 @@ func (f *Ferry) FlushBinlogAndStopStreaming() {
 }
 
 func (f *Ferry) SerializeStateToJSON() (string, error) {
+	if f.StateTracker != nil {
+		f.flushStateTracker()
+	}
+
+	serializedState, err := f.serializeState(false)
+	if err != nil {
+		return "", err
+	}
+
+	stateBytes, err := json.MarshalIndent(serializedState, "", " ")
+	return string(stateBytes), err
+}
+
+// Returns the state at exactly the target binlog position: once the binlog
+// writer reaches the target, it is held there until the state is serialized,
+// so the last written binlog position of the state is the target. The target
+// is usually a position taken from the source with SHOW MASTER STATUS, which
+// is often not the end of an event the Ferry writes, but the end of a
+// transaction or of a filtered event. The writer is then held before its
+// first event past the target, and the last written binlog position of the
+// state is the end of the last event before the target, which is the same
+// state, as no event is written in between. Returns an error if the target
+// was already passed, or the error of the context if it is done before the
+// target is reached, e.g. as no event past the target was streamed yet.
+//
+// The binlog streaming stalls from the target until the state is serialized.
+// The data copy is not held: the copy progress of the state may be ahead of
+// the target, which is safe to resume from like any other state, as the
+// binlog events from the target are applied again on resume.
+func (f *Ferry) SerializeAt(ctx context.Context, target siddontangmysql.Position) (*SerializableState, error) {
+	if f.StateTracker == nil {
+		return nil, errors.New("no valid StateTracker")
+	}
+
+	reached, release := f.StateTracker.HoldBinlogPosition(target)
+	defer release()
+
+	select {
+	case <-reached:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	pos := f.StateTracker.LastWrittenBinlogPosition()
+	if compareBinlogPositions(pos, target) > 0 {
+		return nil, fmt.Errorf("the binlog position %v was already passed, the last written binlog position is %v", target, pos)
+	}
+
+	return f.serializeState(false)
+}
+
+// Stores the current state in the StateStore. Failures are only logged as
+// the next checkpoint will store a more recent state anyway, except for stale
+// states which are logged as errors: another process is likely storing the
+// states of the same run, see ErrStaleStateGeneration.
+func (f *Ferry) checkpointState() {
+	start := time.Now()
+	serializedState, err := f.serializeState(f.Config.StateCheckpointProgressOnly)
+	if err == nil {
+		f.recordCheckpoint(serializedState, time.Since(start))
+		metrics.Measure("StateCheckpoint", nil, 1.0, func() {
+			err = f.StateStore.StoreState(serializedState)
+		})
+	}
+
+	if err == ErrStaleStateGeneration {
+		f.logger.WithError(err).WithField("generation", serializedState.Generation).Error("failed to checkpoint the state, a newer state was stored, possibly by another process running the same migration")
+	} else if err != nil {
+		f.logger.WithError(err).Warn("failed to checkpoint the state")
+	}
+}
+
+// Emits the time taken to serialize the state as the StateSerialize timer
+// metric and its size in JSON, in bytes, as the StateSize gauge metric, to
+// tune the StateCheckpointFrequency. Encoding the state is as expensive as
+// storing it, so the size is only measured if a metrics sink is set.
+func (f *Ferry) recordCheckpoint(serializedState *SerializableState, serializeDuration time.Duration) {
+	record := checkpointRecord{SerializeDuration: serializeDuration}
+	metrics.Timer("StateSerialize", serializeDuration, nil, 1.0)
+
+	if metrics.Enabled() {
+		data, err := json.Marshal(serializedState)
+		if err != nil {
+			f.logger.WithError(err).Warn("failed to measure the size of the state")
+		} else {
+			record.StateSize = len(data)
+			metrics.Gauge("StateSize", float64(record.StateSize), nil, 1.0)
+		}
+	}
+
+	f.lastCheckpoint.Store(record)
+}
+
+func (f *Ferry) checkSchemaOfRedactedState() error {
+	if f.StateToResumeFrom.LastKnownTableSchemaHashes == nil {
+		return errors.New("the redacted state has no schema hashes to verify the schema against")
+	}
+
+	driftedTables, err := f.StateToResumeFrom.TablesWithSchemaDrift(f.Tables)
+	if err != nil {
+		return err
+	}
+
+	driftedTables = f.withoutNewTables(driftedTables)
+	if len(driftedTables) > 0 {
+		return fmt.Errorf("the schema of %v changed since the redacted state was dumped", driftedTables)
+	}
+
+	return nil
+}
+
+// The schema cache of the state is used as is on resume, so the PaginationKeys
+// of the tables in progress are validated to still point at the same rows of
+// the source, and their target tables to still match the rows copied to them.
+func (f *Ferry) validateSchemaOfResumedState() error {
+	var current TableSchemaCache
+	var err error
+	metrics.Measure("LoadTables", nil, 1.0, func() {
+		current, err = LoadTables(f.SourceDB, f.TableFilter, f.CompressedColumnsForVerification, f.IgnoredColumnsForVerification, f.CascadingPaginationColumnConfig)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = f.StateToResumeFrom.ValidateAgainst(current)
+	if err != nil {
+		return err
+	}
+
+	var target TableSchemaCache
+	targetTables := f.StateToResumeFrom.TargetTablesInProgress(f.Config.DatabaseRewrites, f.Config.TableRewrites)
+	metrics.Measure("LoadTargetTables", nil, 1.0, func() {
+		target, err = loadTargetTables(f.TargetDB, targetTables, f.StateToResumeFrom.LastKnownTableSchemaCache)
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.StateToResumeFrom.ValidateTargetAgainst(target, f.Config.DatabaseRewrites, f.Config.TableRewrites)
+}
+
+// Unlike a redacted state, a state serialized without its schema cache may
+// have no hashes, if it was serialized without a schema cache to hash, in
+// which case the schema is assumed unchanged.
+func (f *Ferry) checkSchemaOfProgressOnlyState() error {
+	if f.StateToResumeFrom.LastKnownTableSchemaHashes == nil {
+		f.logger.Warn("the state was serialized without its schema cache nor schema hashes, assuming the schema has not changed")
+		return nil
+	}
+
+	driftedTables, err := f.StateToResumeFrom.TablesWithSchemaDrift(f.Tables)
+	if err != nil {
+		return err
+	}
+
+	driftedTables = f.withoutNewTables(driftedTables)
+	if len(driftedTables) > 0 {
+		return fmt.Errorf("the schema of %v changed since the state was serialized", driftedTables)
+	}
+
+	return nil
+}
+
+// With CopyNewTablesOnResume, the tables created after the run started are
+// expected to be missing from the schema of the state, and are not a drift.
+func (f *Ferry) withoutNewTables(driftedTables []string) []string {
+	if !f.Config.CopyNewTablesOnResume {
+		return driftedTables
+	}
+
+	newTables := make(map[string]bool)
+	for _, tableName := range f.StateToResumeFrom.NewTables(f.Tables) {
+		newTables[tableName] = true
+	}
+
+	filtered := make([]string, 0, len(driftedTables))
+	for _, tableName := range driftedTables {
+		if !newTables[tableName] {
+			filtered = append(filtered, tableName)
+		}
+	}
+	return filtered
+}
+
+// Registers the tables created on the source after the run started with the
+// StateTracker, such that they are copied from scratch, see
+// Config.CopyNewTablesOnResume. Unless the schema was just loaded from the
+// source, it is loaded to find them, and they are added to the Tables.
+//
+// Besides the tables missing from the schema of the state, the tables dropped
+// during the run that exist on the source again were re-created.
+func (f *Ferry) registerNewTables(schemaLoadedFromSource bool) error {
+	current := f.Tables
+	if !schemaLoadedFromSource {
+		var err error
+		metrics.Measure("LoadTables", nil, 1.0, func() {
+			current, err = LoadTables(f.SourceDB, f.TableFilter, f.CompressedColumnsForVerification, f.IgnoredColumnsForVerification, f.CascadingPaginationColumnConfig)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	newTables := f.StateToResumeFrom.NewTables(current)
+	for tableName := range current {
+		if f.StateTracker.IsTableDropped(tableName) {
+			newTables = append(newTables, tableName)
+		}
+	}
+
+	if !schemaLoadedFromSource {
+		// The schema cache of the state is not modified.
+		tables := make(TableSchemaCache, len(f.Tables)+len(newTables))
+		for tableName, table := range f.Tables {
+			tables[tableName] = table
+		}
+		for _, tableName := range newTables {
+			tables[tableName] = current[tableName]
+		}
+		f.Tables = tables
+	}
+
+	for _, tableName := range newTables {
+		f.StateTracker.RegisterNewTable(tableName)
+	}
+
+	return nil
+}
+
+// Flushes the pending progress of the flush listeners before the final state
+// is serialized, see StateTracker.Flush. The state may be dumped even if the
+// flush failed, as the state would under-report the progress, which only
+// causes some data to be recopied.
+func (f *Ferry) flushStateTracker() {
+	err := f.StateTracker.Flush()
+	if err != nil {
+		f.logger.WithError(err).Warn("failed to flush the state tracker, the dumped state may under-report the progress")
+	}
+}
+
+// If progressOnly is true, the state is serialized without its schema cache,
+// see StateTracker.SerializeProgressOnly.
+func (f *Ferry) serializeState(progressOnly bool) (*SerializableState, error) {
 	if f.StateTracker == nil {
 		err := errors.New("no valid StateTracker")
-		return "", err
+		return nil, err
 	}
 	var binlogVerifyStore *BinlogVerifyStore = nil
 	if f.inlineVerifier != nil {
 		binlogVerifyStore = f.inlineVerifier.reverifyStore
 	}
 
-	serializedState := f.StateTracker.Serialize(f.Tables, binlogVerifyStore)
+	var serializedState *SerializableState
+	if progressOnly {
+		serializedState = f.StateTracker.SerializeProgressOnly(f.Tables, binlogVerifyStore)
+	} else {
+		serializedState = f.StateTracker.Serialize(f.Tables, binlogVerifyStore)
+	}
+	if f.StateRedactor != nil {
+		err := RedactSerializableState(serializedState, f.StateRedactor)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	stateBytes, err := json.MarshalIndent(serializedState, "", " ")
-	return string(stateBytes), err
+	return serializedState, nil
 }
 
 func (f *Ferry) Progress() *Progress {
@@ -744,6 +1311,7 @@ func (f *Ferry) Progress() *Progress {
 		CurrentState:  f.OverallState,
 		CustomPayload: f.Config.ProgressCallback.Payload,
 		VerifierType:  f.VerifierType,
+		Resumed:       f.StateTracker.IsResume(),
 	}
 
 	s.Throttled = f.Throttler.Throttled()
@@ -752,10 +1320,18 @@ func (f *Ferry) Progress() *Progress {
 	s.LastSuccessfulBinlogPos = f.BinlogStreamer.lastStreamedBinlogPosition
 	s.BinlogStreamerLag = time.Now().Sub(f.BinlogStreamer.lastProcessedEventTime).Seconds()
 	s.FinalBinlogPos = f.BinlogStreamer.targetBinlogPosition
+	s.BinlogFilesTraversed = f.StateTracker.BinlogFilesTraversedCount()
+	s.EstimatedBinlogRetentionNeeded = f.StateTracker.EstimatedBinlogRetentionNeeded()
+	s.AppliedEventLag = f.StateTracker.AppliedEventLag().Seconds()
 
 	// Table Progress
-	serializedState := f.StateTracker.Serialize(nil, nil)
+	serializedState := f.StateTracker.Snapshot()
 	s.Tables = make(map[string]TableProgress)
+	s.PausedTables = f.StateTracker.PausedTables()
+	if record, ok := f.lastCheckpoint.Load().(checkpointRecord); ok {
+		s.LastCheckpointSerializeDuration = record.SerializeDuration.Seconds()
+		s.LastCheckpointStateSize = record.StateSize
+	}
 	targetPaginationKeys := make(map[string]uint64)
 	f.DataIterator.targetPaginationKeys.Range(func(k, v interface{}) bool {
 		targetPaginationKeys[k.(string)] = v.(uint64)
@@ -763,6 +1339,7 @@ func (f *Ferry) Progress() *Progress {
 	})
 
 	tables := f.Tables.AsSlice()
+	s.DistinctTablesSeen = f.StateTracker.DistinctTablesSeen()
 
 	for _, table := range tables {
 		var currentAction string
@@ -771,33 +1348,38 @@ func (f *Ferry) Progress() *Progress {
 
 		if serializedState.CompletedTables[tableName] {
 			currentAction = TableActionCompleted
+		} else if serializedState.CopyCompletedTables[tableName] {
+			currentAction = TableActionCopied
 		} else if foundInProgress {
 			currentAction = TableActionCopying
 		} else {
 			currentAction = TableActionWaiting
 		}
 
+		state, reason := f.StateTracker.TableStatus(tableName)
+		if reason == TableReasonCopying && s.Throttled {
+			reason = TableReasonThrottled
+		}
+
 		s.Tables[tableName] = TableProgress{
 			LastSuccessfulPaginationKey: lastSuccessfulPaginationKey,
+			FirstPaginationKey:          serializedState.FirstPaginationKeys[tableName],
 			TargetPaginationKey:         targetPaginationKeys[tableName],
 			CurrentAction:               currentAction,
+			LastError:                   serializedState.TableErrors[tableName],
+			State:                       state,
+			Reason:                      reason,
 		}
 	}
 
-	// ETA
-	var totalPaginationKeysToCopy uint64 = 0
-	var completedPaginationKeys uint64 = 0
+	// ETA, left at 0 until a speed is known.
 	estimatedPaginationKeysPerSecond := f.StateTracker.EstimatedPaginationKeysPerSecond()
-	for _, targetPaginationKey := range targetPaginationKeys {
-		totalPaginationKeysToCopy += targetPaginationKey
-	}
-
-	for _, completedPaginationKey := range serializedState.LastSuccessfulPaginationKeys {
-		completedPaginationKeys += completedPaginationKey
+	if eta, ok := f.StateTracker.EstimatedTimeRemaining(targetPaginationKeys); ok {
+		s.ETA = math.Ceil(eta.Seconds())
 	}
-
-	s.ETA = (time.Duration(math.Ceil(float64(totalPaginationKeysToCopy-completedPaginationKeys)/estimatedPaginationKeysPerSecond)) * time.Second).Seconds()
 	s.PaginationKeysPerSecond = uint64(estimatedPaginationKeysPerSecond)
+	s.Rates = f.StateTracker.Rates()
+	s.SlowTables = f.StateTracker.SlowTables(f.Config.SlowTableFactor)
 	s.TimeTaken = time.Now().Sub(f.StartTime).Seconds()
 
 	return s
@@ -826,6 +1408,11 @@ func (f *Ferry) waitUntilAutomaticCutoverIsTrue() {
 	}
 }
 
+func (f *Ferry) setOverallState(state string) {
+	f.OverallState = state
+	f.StateTracker.SetPhase(state)
+}
+
 func (f *Ferry) ensureInitialized() {
 	// TODO: refactor Ferry.Initialize to a constructor.
 	// Note: the constructor shouldn't have a large amount of positional argument
@@ -97,10 +97,14 @@ func NewBinlogVerifyStore() *BinlogVerifyStore {
 	}
 }
 
+// Restores a store from BinlogVerifyStore.Serialize, or from the
+// BinlogVerifyStore of a SerializableState. The store is copied, so the
+// serialized store is not modified, and a nil store is restored as an empty
+// one.
 func NewBinlogVerifyStoreFromSerialized(serialized BinlogVerifySerializedStore) *BinlogVerifyStore {
 	s := NewBinlogVerifyStore()
 
-	s.store = serialized
+	s.store = serialized.Copy()
 	s.currentRowCount = serialized.RowCount()
 
 	s.totalRowCount = s.currentRowCount
@@ -0,0 +1,259 @@
+package ghostferry
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultKafkaProgressBatchSize     = 100
+	DefaultKafkaProgressFlushInterval = time.Second
+	DefaultKafkaProgressBufferSize    = 10000
+	DefaultKafkaProgressStopTimeout   = 10 * time.Second
+)
+
+// Publishes messages to a Kafka topic. This is the minimal surface of a Kafka
+// producer, so the client of the application, whichever it is, can be adapted
+// to it in a few lines without Ghostferry depending on it. For example, with
+// sarama:
+//
+//	func (p saramaProducer) Produce(topic string, messages []ghostferry.KafkaMessage) error {
+//	  batch := make([]*sarama.ProducerMessage, len(messages))
+//	  for i, m := range messages {
+//	    batch[i] = &sarama.ProducerMessage{Topic: topic, Key: sarama.ByteEncoder(m.Key), Value: sarama.ByteEncoder(m.Value)}
+//	  }
+//	  return p.producer.SendMessages(batch)
+//	}
+//
+// If Produce returns an error, the messages are produced again with the next
+// batch, so they must not have been partially produced.
+type KafkaProducer interface {
+	Produce(topic string, messages []KafkaMessage) error
+}
+
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// The value of the messages produced by the KafkaProgressSink, as JSON. The
+// fields are the ones of the ProgressEvent the message is produced for.
+type KafkaProgressMessage struct {
+	RunID                   string
+	Type                    string
+	At                      time.Time
+	Table                   string  `json:",omitempty"`
+	Phase                   string  `json:",omitempty"`
+	PaginationKeysPerSecond float64 `json:",omitempty"`
+}
+
+// Produces the ProgressEvents of a StateTracker to a Kafka topic: the tables
+// completed, the phase changes and the periodic rate updates. The messages are
+// keyed by RunID, such that the messages of a run land in the same partition
+// and can be consumed as its timeline.
+//
+// The messages are produced in batches from a buffer. The copy never waits on
+// the broker: while Produce fails, the messages stay in the buffer and are
+// produced again every FlushInterval, and once the buffer is full the oldest
+// messages are dropped for the newest ones. The last messages are produced
+// when the run is over, but the Ferry only waits for them for StopTimeout.
+type KafkaProgressSink struct {
+	Producer KafkaProducer
+	Topic    string
+	RunID    string
+
+	// The maximum number of messages given to a single Produce.
+	//
+	// Optional: defaults to DefaultKafkaProgressBatchSize
+	BatchSize int
+
+	// The interval at which the buffered messages are produced, if fewer than
+	// BatchSize are buffered, and at which a failed Produce is retried.
+	//
+	// Optional: defaults to DefaultKafkaProgressFlushInterval
+	FlushInterval time.Duration
+
+	// The maximum number of messages buffered.
+	//
+	// Optional: defaults to DefaultKafkaProgressBufferSize
+	BufferSize int
+
+	// The maximum time Run waits for the last messages to be produced once
+	// ctx is done, such that an unavailable broker does not hang the end of
+	// the run. The messages still buffered then are dropped.
+	//
+	// Optional: defaults to DefaultKafkaProgressStopTimeout
+	StopTimeout time.Duration
+
+	bufferMutex sync.Mutex
+	buffer      []KafkaMessage
+	dropped     uint64
+
+	logger *logrus.Entry
+}
+
+// Produces the events of the stateTracker until ctx is done, then produces
+// the buffered messages one last time before returning, for at most
+// StopTimeout.
+func (k *KafkaProgressSink) Run(ctx context.Context, stateTracker *StateTracker) {
+	if k.BatchSize <= 0 {
+		k.BatchSize = DefaultKafkaProgressBatchSize
+	}
+	if k.FlushInterval <= 0 {
+		k.FlushInterval = DefaultKafkaProgressFlushInterval
+	}
+	if k.BufferSize <= 0 {
+		k.BufferSize = DefaultKafkaProgressBufferSize
+	}
+	if k.StopTimeout <= 0 {
+		k.StopTimeout = DefaultKafkaProgressStopTimeout
+	}
+	k.logger = logrus.WithFields(logrus.Fields{
+		"tag":   "kafka_progress_sink",
+		"topic": k.Topic,
+	})
+
+	events := stateTracker.Subscribe()
+	defer stateTracker.Unsubscribe(events)
+
+	// Produce can block for as long as the broker is unavailable, so it is
+	// called from its own goroutine while the events keep being buffered.
+	batchReady := make(chan struct{}, 1)
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		k.produceUntilClosed(batchReady)
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if k.enqueue(event) >= k.BatchSize {
+				select {
+				case batchReady <- struct{}{}:
+				default:
+				}
+			}
+		case <-ctx.Done():
+			// The events published before ctx was done, such as the last
+			// phase changes, are still produced.
+		drain:
+			for {
+				select {
+				case event := <-events:
+					k.enqueue(event)
+				default:
+					break drain
+				}
+			}
+
+			close(batchReady)
+			select {
+			case <-producerDone:
+			case <-time.After(k.StopTimeout):
+				// The producer goroutine returns once Produce does.
+				k.bufferMutex.Lock()
+				buffered := len(k.buffer)
+				k.bufferMutex.Unlock()
+				k.logger.WithField("buffered", buffered).Warn("timed out producing the last progress events, they are dropped")
+			}
+			return
+		}
+	}
+}
+
+// Returns the number of messages dropped as the buffer was full.
+func (k *KafkaProgressSink) Dropped() uint64 {
+	k.bufferMutex.Lock()
+	defer k.bufferMutex.Unlock()
+
+	return k.dropped
+}
+
+// Returns the number of messages buffered after the event.
+func (k *KafkaProgressSink) enqueue(event ProgressEvent) int {
+	value, err := json.Marshal(KafkaProgressMessage{
+		RunID:                   k.RunID,
+		Type:                    event.Type,
+		At:                      event.At,
+		Table:                   event.Table,
+		Phase:                   event.Phase,
+		PaginationKeysPerSecond: event.PaginationKeysPerSecond,
+	})
+	if err != nil {
+		k.logger.WithError(err).WithField("event", event.Type).Error("failed to encode progress event, dropping it")
+		return 0
+	}
+
+	k.bufferMutex.Lock()
+	defer k.bufferMutex.Unlock()
+
+	k.buffer = append(k.buffer, KafkaMessage{Key: []byte(k.RunID), Value: value})
+	k.dropOldestUnlocked()
+	return len(k.buffer)
+}
+
+func (k *KafkaProgressSink) produceUntilClosed(batchReady <-chan struct{}) {
+	ticker := time.NewTicker(k.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case _, open := <-batchReady:
+			if !open {
+				k.flush()
+				if dropped := k.Dropped(); dropped > 0 {
+					k.logger.WithField("dropped", dropped).Warn("progress events were dropped as the buffer was full")
+				}
+				return
+			}
+			k.flush()
+		case <-ticker.C:
+			k.flush()
+		}
+	}
+}
+
+// Produces the buffered messages in batches, until the buffer is empty or
+// Produce fails.
+func (k *KafkaProgressSink) flush() {
+	for {
+		k.bufferMutex.Lock()
+		size := len(k.buffer)
+		if size > k.BatchSize {
+			size = k.BatchSize
+		}
+		batch := k.buffer[:size:size]
+		k.buffer = k.buffer[size:]
+		k.bufferMutex.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+
+		err := k.Producer.Produce(k.Topic, batch)
+		if err != nil {
+			k.logger.WithError(err).WithField("messages", len(batch)).Warn("failed to produce progress events, retrying later")
+
+			// The failed batch is older than the messages buffered meanwhile,
+			// so it goes back to the front of the buffer, and is the first to
+			// be dropped if that overflows it.
+			k.bufferMutex.Lock()
+			k.buffer = append(batch, k.buffer...)
+			k.dropOldestUnlocked()
+			k.bufferMutex.Unlock()
+			return
+		}
+	}
+}
+
+func (k *KafkaProgressSink) dropOldestUnlocked() {
+	if overflow := len(k.buffer) - k.BufferSize; overflow > 0 {
+		k.buffer = k.buffer[overflow:]
+		k.dropped += uint64(overflow)
+	}
+}
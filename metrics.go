@@ -90,12 +90,40 @@ func (m *Metrics) Timer(key string, duration time.Duration, tags []MetricTag, sa
 	})
 }
 
+// A single observation for a histogram. Unlike the other metrics, which the
+// sink can forward as is, histograms are aggregated by the sink (e.g. into a
+// Prometheus histogram), and Buckets are the upper bounds of its buckets in
+// increasing order.
+type HistogramMetric struct {
+	MetricBase
+	Value   float64
+	Buckets []float64
+}
+
+func (m *Metrics) Histogram(key string, value float64, buckets []float64, tags []MetricTag, sampleRate float64) {
+	m.sendMetric(HistogramMetric{
+		MetricBase: MetricBase{
+			Key:        m.applyPrefix(key),
+			Tags:       m.mergeWithDefaultTags(tags),
+			SampleRate: sampleRate,
+		},
+		Value:   value,
+		Buckets: buckets,
+	})
+}
+
 func (m *Metrics) Measure(key string, tags []MetricTag, sampleRate float64, f func()) {
 	start := time.Now()
 	f()
 	m.Timer(key, time.Since(start), m.mergeWithDefaultTags(tags), sampleRate)
 }
 
+// Returns true if a sink is set, such that the metrics that are expensive to
+// compute can be skipped otherwise.
+func (m *Metrics) Enabled() bool {
+	return m.Sink != nil
+}
+
 func (m *Metrics) AddConsumer() {
 	m.wg.Add(1)
 }
@@ -0,0 +1,476 @@
+package ghostferry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+const (
+	paginationKeyChunkBits  = 1 << 16
+	paginationKeyChunkWords = paginationKeyChunkBits / 64
+
+	// The memory taken by a range and by a chunk of the bitmap, in bytes.
+	paginationKeyRangeBytes = 16
+	paginationKeyChunkBytes = paginationKeyChunkBits / 8
+
+	// The bitmap is not considered below this many ranges, as the ranges are
+	// small regardless.
+	paginationKeySetMinRangesForBitmap = 1024
+)
+
+// The pagination keys completed via MarkRangeComplete above the last
+// successful pagination key of a table.
+//
+// The keys are kept as sorted, non-overlapping ranges, which is compact while
+// the ranges are few. When the workers of a table complete many ranges out of
+// order, the ranges can fragment into more ranges than a bitmap of the keys
+// they span would take, in which case the keys are kept in a bitmap instead,
+// similar to a roaring bitmap: the keys are split into chunks of 65536 keys,
+// and only the chunks with completed keys are allocated, the full ones
+// without their bits. The set switches back to the ranges once they take
+// less than half the memory of the bitmap, which is only checked as the keys
+// are removed, see removeRangesEndingBy.
+type paginationKeySet struct {
+	// Used if chunks is nil.
+	ranges [][2]uint64
+
+	// Keyed by the pagination key divided by paginationKeyChunkBits, with the
+	// keys sorted in chunkKeys. Chunks without any key are removed.
+	chunks    map[uint64]*paginationKeyChunk
+	chunkKeys []uint64
+}
+
+type paginationKeyChunk struct {
+	// nil if every key of the chunk is completed.
+	bits  *[paginationKeyChunkWords]uint64
+	count int
+}
+
+func newPaginationKeySet(ranges [][2]uint64) *paginationKeySet {
+	set := &paginationKeySet{ranges: append([][2]uint64(nil), ranges...)}
+	set.maybeUseBitmap()
+	return set
+}
+
+func (s *paginationKeySet) isBitmap() bool {
+	return s.chunks != nil
+}
+
+// Adds the keys from lo to hi, both inclusive, and returns the number of keys
+// that were not in the set yet.
+func (s *paginationKeySet) add(lo, hi uint64) uint64 {
+	if !s.isBitmap() {
+		var newlyCompleted uint64
+		s.ranges, newlyCompleted = mergePaginationKeyRange(s.ranges, lo, hi)
+		s.maybeUseBitmap()
+		return newlyCompleted
+	}
+
+	return s.addToBitmap(lo, hi)
+}
+
+func (s *paginationKeySet) addToBitmap(lo, hi uint64) uint64 {
+	var newlyCompleted uint64
+	for key := lo / paginationKeyChunkBits; ; key++ {
+		from, to := uint64(0), uint64(paginationKeyChunkBits-1)
+		if key == lo/paginationKeyChunkBits {
+			from = lo % paginationKeyChunkBits
+		}
+		if key == hi/paginationKeyChunkBits {
+			to = hi % paginationKeyChunkBits
+		}
+
+		newlyCompleted += uint64(s.chunk(key).set(from, to))
+
+		if key == hi/paginationKeyChunkBits {
+			return newlyCompleted
+		}
+	}
+}
+
+// Returns the chunk, allocating it if needed.
+func (s *paginationKeySet) chunk(key uint64) *paginationKeyChunk {
+	chunk, found := s.chunks[key]
+	if !found {
+		chunk = &paginationKeyChunk{bits: &[paginationKeyChunkWords]uint64{}}
+		s.chunks[key] = chunk
+
+		i := sort.Search(len(s.chunkKeys), func(i int) bool { return s.chunkKeys[i] > key })
+		s.chunkKeys = append(s.chunkKeys, 0)
+		copy(s.chunkKeys[i+1:], s.chunkKeys[i:])
+		s.chunkKeys[i] = key
+	}
+	return chunk
+}
+
+// Sets the bits from the offset from to the offset to, both inclusive, and
+// returns the number of bits that were not set yet.
+func (c *paginationKeyChunk) set(from, to uint64) int {
+	if c.bits == nil {
+		return 0
+	}
+
+	before := c.count
+	for offset := from; offset <= to; {
+		word := offset / 64
+		last := word*64 + 63
+		if last > to {
+			last = to
+		}
+
+		mask := wordMask(offset%64, last%64)
+		c.count += bits.OnesCount64(mask &^ c.bits[word])
+		c.bits[word] |= mask
+		offset = last + 1
+	}
+
+	if c.count == paginationKeyChunkBits {
+		c.bits = nil
+	}
+	return c.count - before
+}
+
+// Clears the bits up to the offset to, inclusive.
+func (c *paginationKeyChunk) clearThrough(to uint64) {
+	if c.bits == nil {
+		c.bits = &[paginationKeyChunkWords]uint64{}
+		for i := range c.bits {
+			c.bits[i] = ^uint64(0)
+		}
+	}
+
+	for word := uint64(0); word <= to/64; word++ {
+		mask := ^uint64(0)
+		if word == to/64 {
+			mask = wordMask(0, to%64)
+		}
+		c.count -= bits.OnesCount64(mask & c.bits[word])
+		c.bits[word] &^= mask
+	}
+}
+
+func (c *paginationKeyChunk) isSet(offset uint64) bool {
+	return c.bits == nil || c.bits[offset/64]&(1<<(offset%64)) != 0
+}
+
+// The bits from the bit from to the bit to of a word, both inclusive.
+func wordMask(from, to uint64) uint64 {
+	return (^uint64(0) >> (63 - to)) &^ (1<<from - 1)
+}
+
+func (s *paginationKeySet) contains(paginationKey uint64) bool {
+	if !s.isBitmap() {
+		i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i][1] >= paginationKey })
+		return i < len(s.ranges) && s.ranges[i][0] <= paginationKey
+	}
+
+	chunk, found := s.chunks[paginationKey/paginationKeyChunkBits]
+	return found && chunk.isSet(paginationKey%paginationKeyChunkBits)
+}
+
+func (s *paginationKeySet) empty() bool {
+	if !s.isBitmap() {
+		return len(s.ranges) == 0
+	}
+	return len(s.chunkKeys) == 0
+}
+
+// Calls f with the ranges of the set in order, until f returns false.
+func (s *paginationKeySet) eachRange(f func(r [2]uint64) bool) {
+	if !s.isBitmap() {
+		for _, r := range s.ranges {
+			if !f(r) {
+				return
+			}
+		}
+		return
+	}
+
+	var pending [2]uint64
+	hasPending := false
+	// Returns false once f does.
+	emit := func(lo, hi uint64) bool {
+		if hasPending && lo == pending[1]+1 {
+			pending[1] = hi
+			return true
+		}
+
+		if hasPending && !f(pending) {
+			return false
+		}
+		pending = [2]uint64{lo, hi}
+		hasPending = true
+		return true
+	}
+
+	for _, key := range s.chunkKeys {
+		chunk := s.chunks[key]
+		base := key * paginationKeyChunkBits
+		if chunk.bits == nil {
+			if !emit(base, base+paginationKeyChunkBits-1) {
+				return
+			}
+			continue
+		}
+
+		inRun := false
+		var start uint64
+		for offset := uint64(0); offset < paginationKeyChunkBits; offset++ {
+			word := chunk.bits[offset/64]
+			// Skips the words without any change.
+			if offset%64 == 0 && ((!inRun && word == 0) || (inRun && word == ^uint64(0))) {
+				offset += 63
+				continue
+			}
+
+			set := word&(1<<(offset%64)) != 0
+			if set && !inRun {
+				start = base + offset
+				inRun = true
+			} else if !set && inRun {
+				inRun = false
+				if !emit(start, base+offset-1) {
+					return
+				}
+			}
+		}
+
+		if inRun && !emit(start, base+paginationKeyChunkBits-1) {
+			return
+		}
+	}
+
+	if hasPending {
+		f(pending)
+	}
+}
+
+// Returns the ranges of the set. The returned ranges must not be modified.
+func (s *paginationKeySet) rangeList() [][2]uint64 {
+	if !s.isBitmap() {
+		return s.ranges
+	}
+
+	ranges := make([][2]uint64, 0)
+	s.eachRange(func(r [2]uint64) bool {
+		ranges = append(ranges, r)
+		return true
+	})
+	return ranges
+}
+
+func (s *paginationKeySet) first() ([2]uint64, bool) {
+	var first [2]uint64
+	found := false
+	s.eachRange(func(r [2]uint64) bool {
+		first = r
+		found = true
+		return false
+	})
+	return first, found
+}
+
+// Returns the highest key of the set, which must not be empty.
+func (s *paginationKeySet) last() uint64 {
+	if !s.isBitmap() {
+		return s.ranges[len(s.ranges)-1][1]
+	}
+
+	key := s.chunkKeys[len(s.chunkKeys)-1]
+	chunk := s.chunks[key]
+	offset := uint64(paginationKeyChunkBits - 1)
+	for !chunk.isSet(offset) {
+		offset--
+	}
+	return key*paginationKeyChunkBits + offset
+}
+
+// Returns the number of keys in the set.
+func (s *paginationKeySet) count() uint64 {
+	var count uint64
+	if !s.isBitmap() {
+		for _, r := range s.ranges {
+			count += r[1] - r[0] + 1
+		}
+		return count
+	}
+
+	for _, chunk := range s.chunks {
+		count += uint64(chunk.count)
+	}
+	return count
+}
+
+// Removes the ranges ending at or before the pagination key. A range
+// containing the pagination key but ending after it is kept whole.
+func (s *paginationKeySet) removeRangesEndingBy(paginationKey uint64) {
+	if !s.isBitmap() {
+		i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i][1] > paginationKey })
+		s.ranges = s.ranges[i:]
+		return
+	}
+
+	// Removes the keys up to the start of the first range that is kept.
+	remaining, found := [2]uint64{}, false
+	s.eachRange(func(r [2]uint64) bool {
+		if r[1] > paginationKey {
+			remaining, found = r, true
+			return false
+		}
+		return true
+	})
+
+	if !found {
+		s.chunks, s.chunkKeys = nil, nil
+		s.ranges = nil
+		return
+	}
+
+	if remaining[0] == 0 {
+		return
+	}
+
+	through := remaining[0] - 1
+	removed := false
+	kept := s.chunkKeys[:0]
+	for _, key := range s.chunkKeys {
+		switch {
+		case key < through/paginationKeyChunkBits:
+			delete(s.chunks, key)
+			removed = true
+		case key == through/paginationKeyChunkBits:
+			chunk := s.chunks[key]
+			count := chunk.count
+			chunk.clearThrough(through % paginationKeyChunkBits)
+			removed = removed || chunk.count < count
+			if chunk.count == 0 {
+				delete(s.chunks, key)
+			} else {
+				kept = append(kept, key)
+			}
+		default:
+			kept = append(kept, key)
+		}
+	}
+	s.chunkKeys = kept
+
+	if removed {
+		s.maybeUseRanges()
+	}
+}
+
+func (s *paginationKeySet) maybeUseBitmap() {
+	if len(s.ranges) < paginationKeySetMinRangesForBitmap {
+		return
+	}
+
+	spannedChunks := s.ranges[len(s.ranges)-1][1]/paginationKeyChunkBits - s.ranges[0][0]/paginationKeyChunkBits + 1
+	if uint64(len(s.ranges))*paginationKeyRangeBytes <= spannedChunks*paginationKeyChunkBytes {
+		return
+	}
+
+	ranges := s.ranges
+	s.ranges = nil
+	s.chunks = make(map[uint64]*paginationKeyChunk)
+	for _, r := range ranges {
+		s.addToBitmap(r[0], r[1])
+	}
+}
+
+func (s *paginationKeySet) maybeUseRanges() {
+	if len(s.chunkKeys) == 0 {
+		s.chunks, s.chunkKeys = nil, nil
+		s.ranges = nil
+		return
+	}
+
+	limit := len(s.chunks) * paginationKeyChunkBytes / paginationKeyRangeBytes / 2
+	ranges := make([][2]uint64, 0)
+	s.eachRange(func(r [2]uint64) bool {
+		ranges = append(ranges, r)
+		return len(ranges) < limit
+	})
+
+	if len(ranges) < limit {
+		s.chunks, s.chunkKeys = nil, nil
+		s.ranges = ranges
+	}
+}
+
+// Encodes the bitmap as, for each chunk, the difference of its key with the
+// key of the previous chunk (or 0) as a uvarint, then 0 for a full chunk, or
+// 1 followed by its bits as little endian 64 bits words.
+func (s *paginationKeySet) marshalBitmap() []byte {
+	buf := &bytes.Buffer{}
+	varint := make([]byte, binary.MaxVarintLen64)
+	previousKey := uint64(0)
+	for _, key := range s.chunkKeys {
+		buf.Write(varint[:binary.PutUvarint(varint, key-previousKey)])
+		previousKey = key
+
+		chunk := s.chunks[key]
+		if chunk.bits == nil {
+			buf.WriteByte(0)
+			continue
+		}
+
+		buf.WriteByte(1)
+		binary.Write(buf, binary.LittleEndian, chunk.bits)
+	}
+	return buf.Bytes()
+}
+
+func unmarshalPaginationKeyBitmap(data []byte) (*paginationKeySet, error) {
+	s := &paginationKeySet{chunks: make(map[uint64]*paginationKeyChunk)}
+	r := bytes.NewReader(data)
+	previousKey := uint64(0)
+	for r.Len() > 0 {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+
+		key := previousKey + delta
+		if len(s.chunkKeys) > 0 && delta == 0 {
+			return nil, fmt.Errorf("duplicate pagination key bitmap chunk %d", key)
+		}
+		previousKey = key
+
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := &paginationKeyChunk{count: paginationKeyChunkBits}
+		switch kind {
+		case 0:
+		case 1:
+			chunk.bits = &[paginationKeyChunkWords]uint64{}
+			err = binary.Read(r, binary.LittleEndian, chunk.bits)
+			if err != nil {
+				return nil, err
+			}
+
+			chunk.count = 0
+			for _, word := range chunk.bits {
+				chunk.count += bits.OnesCount64(word)
+			}
+		default:
+			return nil, fmt.Errorf("unknown pagination key bitmap chunk kind %d", kind)
+		}
+
+		if chunk.count == 0 {
+			return nil, errors.New("empty pagination key bitmap chunk")
+		}
+
+		s.chunks[key] = chunk
+		s.chunkKeys = append(s.chunkKeys, key)
+	}
+
+	s.maybeUseRanges()
+	return s, nil
+}
@@ -1,6 +1,11 @@
 package ghostferry
 
 import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/satori/go.uuid"
 	"github.com/siddontang/go-mysql/mysql"
 )
 
@@ -8,12 +13,65 @@ const (
 	TableActionWaiting   = "waiting"
 	TableActionCopying   = "copying"
 	TableActionCompleted = "completed"
+
+	// Copied, but pending verification. See StateTracker.MarkTableCopyComplete.
+	TableActionCopied = "copied"
 )
 
 type TableProgress struct {
 	LastSuccessfulPaginationKey uint64
+	FirstPaginationKey          uint64 // See StateTracker.FirstPaginationKey. 0 if the copy of the table has not started
 	TargetPaginationKey         uint64
 	CurrentAction               string // Possible values are defined via the constants TableAction*
+	LastError                   string // The most recent error encountered while copying the table, if any
+
+	// Machine readable state of the table, see StateTracker.TableStatus.
+	State  TableState
+	Reason TableReason
+}
+
+// Returns the fraction of the pagination keys from minPaginationKey to the
+// TargetPaginationKey that have been copied, between 0 and 1. Tables whose
+// pagination keys do not start near 0 should pass their smallest pagination
+// key, or the FirstPaginationKey if it is not known, as the fraction would
+// otherwise be heavily overestimated.
+func (p TableProgress) CompletedFraction(minPaginationKey uint64) float64 {
+	if p.CurrentAction == TableActionCompleted || p.CurrentAction == TableActionCopied {
+		return 1
+	}
+
+	if p.LastSuccessfulPaginationKey <= minPaginationKey {
+		return 0
+	}
+
+	// Covers single row tables, where the minimum is the target.
+	if p.LastSuccessfulPaginationKey >= p.TargetPaginationKey {
+		return 1
+	}
+
+	return float64(p.LastSuccessfulPaginationKey-minPaginationKey) / float64(p.TargetPaginationKey-minPaginationKey)
+}
+
+// Returns the position of the UUID in the 128-bit UUID space as a fraction
+// between 0 and 1. As UUIDv4s are uniformly distributed, this estimates the
+// fraction of the rows of a table with UUIDv4 keys that have a key smaller
+// than or equal to id, even though the table has no meaningful maximum key.
+//
+// Tables can only be paginated by numeric columns for now, so the
+// StateTracker does not store UUIDs and cannot report this by itself: this
+// is meant for tools that know the last copied UUID of such a table.
+func UUIDKeyspaceFraction(id string) (float64, error) {
+	parsed, err := uuid.FromString(id)
+	if err != nil {
+		return 0, err
+	}
+
+	high := binary.BigEndian.Uint64(parsed[:8])
+	low := binary.BigEndian.Uint64(parsed[8:])
+	fraction := float64(high)/math.Exp2(64) + float64(low)/math.Exp2(128)
+
+	// The largest UUIDs round up to 1.
+	return math.Min(fraction, 1), nil
 }
 
 type Progress struct {
@@ -27,11 +85,31 @@ type Progress struct {
 	// server and you want some sort of custom identification with this field.
 	CustomPayload string
 
+	// True if the run was resumed from a previously serialized state.
+	Resumed bool
+
 	Tables                  map[string]TableProgress
 	LastSuccessfulBinlogPos mysql.Position
 	BinlogStreamerLag       float64 // seconds
 	Throttled               bool
 
+	// The number of distinct tables with copy progress, to be compared with
+	// the number of Tables. See StateTracker.DistinctTablesSeen.
+	DistinctTablesSeen int
+
+	// The number of distinct binlog files written since the run started or
+	// resumed. See StateTracker.BinlogFilesTraversed.
+	BinlogFilesTraversed int
+
+	// How long the source must retain its binlog files for the run to be
+	// resumed from the last serialized state, or -1 if unknown. See
+	// StateTracker.EstimatedBinlogRetentionNeeded.
+	EstimatedBinlogRetentionNeeded time.Duration
+
+	// The time since the latest binlog event applied to the target was
+	// written on the source, in seconds. See StateTracker.AppliedEventLag.
+	AppliedEventLag float64
+
 	// The behaviour of Ghostferry varies with respect to the VerifierType.
 	// For example: a long cutover is OK if
 	VerifierType string
@@ -44,4 +122,46 @@ type Progress struct {
 	PaginationKeysPerSecond uint64
 	ETA                     float64 // seconds
 	TimeTaken               float64 // seconds
+
+	// The pagination keys copied per second over multiple windows of time,
+	// see StateTracker.Rates.
+	Rates map[string]float64
+
+	// The tables whose copy slowed down relative to their own recent peak,
+	// see StateTracker.SlowTables. Only set if TrackTableRates is.
+	SlowTables []string
+
+	// The tables whose copy is paused, see StateTracker.PauseTable.
+	PausedTables []string
+
+	// The time taken to serialize the state of the last checkpoint, in
+	// seconds, and the size of that state in JSON, in bytes. The size is only
+	// measured if a metrics sink is set, and is 0 otherwise.
+	LastCheckpointSerializeDuration float64
+	LastCheckpointStateSize         int
+}
+
+const (
+	ProgressEventTableCompleted = "table-completed"
+	ProgressEventPhaseChanged   = "phase-changed"
+	ProgressEventRateUpdated    = "rate-updated"
+)
+
+// Pushed to the subscribers of the StateTracker. See StateTracker.Subscribe.
+type ProgressEvent struct {
+	Type string // Possible values are defined via the constants ProgressEvent*
+	At   time.Time
+
+	// Only set for ProgressEventTableCompleted.
+	Table string
+
+	// Only set for ProgressEventPhaseChanged. Possible values are defined in
+	// ferry.go.
+	Phase string
+
+	// Set for ProgressEventRateUpdated. For ProgressEventTableCompleted, the
+	// average rate of the copy of the table if TrackTableRates is set, see
+	// StateTracker.EstimatedPaginationKeysPerSecondForTable, and 0 if the
+	// table was not copied by MarkTableAsCompleted.
+	PaginationKeysPerSecond float64
 }
@@ -0,0 +1,116 @@
+package ghostferry
+
+import (
+	"time"
+)
+
+// The number of buckets of each rate window. The memory of a window is fixed
+// regardless of its duration, while its precision is its duration divided by
+// the number of buckets.
+const rateWindowBuckets = 60
+
+// The rate windows of a new StateTracker, see StateTracker.SetRateWindows.
+var DefaultRateWindows = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+// Sums the pagination keys copied over a sliding window of time, in a ring of
+// rateWindowBuckets buckets of equal width. The bucket at current covers from
+// bucketStart to bucketStart+bucketWidth.
+type rateWindow struct {
+	duration    time.Duration
+	bucketWidth time.Duration
+	buckets     [rateWindowBuckets]uint64
+	current     int
+	bucketStart time.Time
+
+	// The time of the first observation, as the window does not cover its
+	// full duration before then.
+	startedAt time.Time
+}
+
+func newRateWindow(duration time.Duration) *rateWindow {
+	bucketWidth := duration / rateWindowBuckets
+	if bucketWidth <= 0 {
+		bucketWidth = 1
+	}
+
+	return &rateWindow{
+		duration:    duration,
+		bucketWidth: bucketWidth,
+	}
+}
+
+func (w *rateWindow) observe(paginationKeys uint64, now time.Time) {
+	if w.startedAt.IsZero() {
+		w.startedAt = now
+		w.bucketStart = now
+	}
+
+	elapsedBuckets := w.elapsedBuckets(now)
+	if elapsedBuckets >= rateWindowBuckets {
+		w.buckets = [rateWindowBuckets]uint64{}
+	} else {
+		for i := 0; i < elapsedBuckets; i++ {
+			w.current = (w.current + 1) % rateWindowBuckets
+			w.buckets[w.current] = 0
+		}
+	}
+	w.bucketStart = w.bucketStart.Add(time.Duration(elapsedBuckets) * w.bucketWidth)
+
+	w.buckets[w.current] += paginationKeys
+}
+
+// Returns the pagination keys copied per second over the window, or over the
+// time since the first observation if it is shorter.
+func (w *rateWindow) rate(now time.Time) float64 {
+	if w.startedAt.IsZero() {
+		return 0
+	}
+
+	covered := now.Sub(w.startedAt)
+	if covered > w.duration {
+		covered = w.duration
+	}
+	if covered <= 0 {
+		return 0
+	}
+
+	// The oldest buckets moved out of the window since the last observation,
+	// but are only cleared by the next observation, so they are skipped.
+	var total uint64
+	for age := 0; age < rateWindowBuckets-w.elapsedBuckets(now); age++ {
+		total += w.buckets[(w.current-age+rateWindowBuckets)%rateWindowBuckets]
+	}
+
+	return float64(total) / covered.Seconds()
+}
+
+// Shifts the times before pausedAt forward by d, such that the paused
+// interval neither empties the buckets nor counts towards the window.
+func (w *rateWindow) shift(pausedAt time.Time, d time.Duration) {
+	if w.startedAt.IsZero() {
+		return
+	}
+
+	if w.startedAt.Before(pausedAt) {
+		w.startedAt = w.startedAt.Add(d)
+	}
+	if w.bucketStart.Before(pausedAt) {
+		w.bucketStart = w.bucketStart.Add(d)
+	}
+}
+
+func (w *rateWindow) elapsedBuckets(now time.Time) int {
+	if now.Before(w.bucketStart) {
+		return 0
+	}
+
+	elapsed := now.Sub(w.bucketStart) / w.bucketWidth
+	if elapsed > rateWindowBuckets {
+		return rateWindowBuckets
+	}
+	return int(elapsed)
+}
@@ -0,0 +1,114 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// The position of the binlog writer in the stream of changes of the source,
+// such as a binlog file and offset, or the logical offset exposed by a CDC
+// layer fronting the source. The StateTracker tracks the binlog file
+// positions of MySQL by default, and any other coordinate given to
+// StateTracker.UpdateLastWrittenCoordinate.
+//
+// Coordinates are serialized in the state along with their Kind, so the kinds
+// other than BinlogFileCoordinate must be registered with
+// RegisterReplicationCoordinateKind to be decoded again on resume.
+type ReplicationCoordinate interface {
+	Kind() string
+
+	// Returns a negative number if the coordinate is before other, 0 if they
+	// are equal and a positive number if it is after. other is always of the
+	// same Kind.
+	Compare(other ReplicationCoordinate) int
+
+	String() string
+	Serialize() ([]byte, error)
+}
+
+// Decodes the coordinates of a kind from their Serialize.
+type ReplicationCoordinateDecoder func(data []byte) (ReplicationCoordinate, error)
+
+const ReplicationCoordinateKindBinlogFile = "binlog_file"
+
+// The default coordinate: a position in the binlog files of the source.
+type BinlogFileCoordinate mysql.Position
+
+func (c BinlogFileCoordinate) Kind() string {
+	return ReplicationCoordinateKindBinlogFile
+}
+
+func (c BinlogFileCoordinate) Compare(other ReplicationCoordinate) int {
+	return compareBinlogPositions(mysql.Position(c), mysql.Position(other.(BinlogFileCoordinate)))
+}
+
+func (c BinlogFileCoordinate) String() string {
+	return fmt.Sprintf("%s:%d", c.Name, c.Pos)
+}
+
+func (c BinlogFileCoordinate) Serialize() ([]byte, error) {
+	return json.Marshal(mysql.Position(c))
+}
+
+func decodeBinlogFileCoordinate(data []byte) (ReplicationCoordinate, error) {
+	var pos mysql.Position
+	err := json.Unmarshal(data, &pos)
+	return BinlogFileCoordinate(pos), err
+}
+
+// A ReplicationCoordinate as stored in the SerializableState.
+type SerializedReplicationCoordinate struct {
+	Kind string
+	Data []byte
+}
+
+func SerializeReplicationCoordinate(coordinate ReplicationCoordinate) (*SerializedReplicationCoordinate, error) {
+	data, err := coordinate.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SerializedReplicationCoordinate{Kind: coordinate.Kind(), Data: data}, nil
+}
+
+// Decodes the coordinate with the decoder registered for its Kind.
+func (c *SerializedReplicationCoordinate) Decode() (ReplicationCoordinate, error) {
+	decode, found := LookupReplicationCoordinateKind(c.Kind)
+	if !found {
+		return nil, fmt.Errorf("replication coordinate kind %s is not registered", c.Kind)
+	}
+
+	return decode(c.Data)
+}
+
+var (
+	replicationCoordinateKindsMutex sync.RWMutex
+	replicationCoordinateKinds      = map[string]ReplicationCoordinateDecoder{
+		ReplicationCoordinateKindBinlogFile: decodeBinlogFileCoordinate,
+	}
+)
+
+// Registers the decoder of the coordinates of the kind, such that they can be
+// restored from a serialized state.
+func RegisterReplicationCoordinateKind(kind string, decode ReplicationCoordinateDecoder) error {
+	replicationCoordinateKindsMutex.Lock()
+	defer replicationCoordinateKindsMutex.Unlock()
+
+	if _, found := replicationCoordinateKinds[kind]; found {
+		return fmt.Errorf("replication coordinate kind %s is already registered", kind)
+	}
+
+	replicationCoordinateKinds[kind] = decode
+	return nil
+}
+
+func LookupReplicationCoordinateKind(kind string) (ReplicationCoordinateDecoder, bool) {
+	replicationCoordinateKindsMutex.RLock()
+	defer replicationCoordinateKindsMutex.RUnlock()
+
+	decode, found := replicationCoordinateKinds[kind]
+	return decode, found
+}
@@ -0,0 +1,73 @@
+package ghostferry
+
+import (
+	"math"
+	"time"
+)
+
+const DefaultSmoothedSpeedHalfLife = 10 * time.Second
+
+// An exponentially weighted moving average of the pagination keys copied per
+// second, updated with every observation. The rate between two observations
+// weighs in proportion to the time between them: after a half-life, the
+// previous average only weighs half of the new one. The average decays
+// toward 0 while nothing is observed, see rate.
+type smoothedRate struct {
+	paginationKeysPerSecond float64
+	lastObservedAt          time.Time
+
+	// The pagination keys observed at lastObservedAt, when no time elapsed
+	// since the previous observation to compute a rate from.
+	pendingPaginationKeys uint64
+}
+
+func (r *smoothedRate) observe(paginationKeys uint64, now time.Time, halfLife time.Duration) {
+	// The first observation only starts the average, as the time over which
+	// its pagination keys were copied is unknown.
+	if r.lastObservedAt.IsZero() {
+		r.lastObservedAt = now
+		return
+	}
+
+	elapsed := now.Sub(r.lastObservedAt)
+	if elapsed <= 0 {
+		r.pendingPaginationKeys += paginationKeys
+		return
+	}
+
+	rate := float64(r.pendingPaginationKeys+paginationKeys) / elapsed.Seconds()
+	decay := smoothedRateDecay(elapsed, halfLife)
+	r.paginationKeysPerSecond = r.paginationKeysPerSecond*decay + rate*(1-decay)
+	r.lastObservedAt = now
+	r.pendingPaginationKeys = 0
+}
+
+// Returns the average as if nothing was copied since the last observation,
+// such that a copy that stalled is not reported at its last rate.
+func (r *smoothedRate) rate(now time.Time, halfLife time.Duration) float64 {
+	if r.lastObservedAt.IsZero() {
+		return 0
+	}
+
+	elapsed := now.Sub(r.lastObservedAt)
+	if elapsed <= 0 {
+		return r.paginationKeysPerSecond
+	}
+	return r.paginationKeysPerSecond * smoothedRateDecay(elapsed, halfLife)
+}
+
+// Shifts the last observation forward by d if it is before pausedAt, such
+// that the average neither decays over the paused interval nor averages the
+// next observation over it.
+func (r *smoothedRate) shift(pausedAt time.Time, d time.Duration) {
+	if !r.lastObservedAt.IsZero() && r.lastObservedAt.Before(pausedAt) {
+		r.lastObservedAt = r.lastObservedAt.Add(d)
+	}
+}
+
+func smoothedRateDecay(elapsed, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		halfLife = DefaultSmoothedSpeedHalfLife
+	}
+	return math.Exp2(-elapsed.Seconds() / halfLife.Seconds())
+}
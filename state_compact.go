@@ -0,0 +1,363 @@
+package ghostferry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// The compact binary format of the SerializableState, meant to ship the state
+// frequently between processes (e.g. over RPC) where JSON is too heavy. It is
+// not meant to be stored for long periods of time: use JSON for that.
+//
+// The format starts with compactStateMagic and is followed by, in order:
+//
+//   - GhostferryVersion
+//   - LastSuccessfulPaginationKeys: count, then (table, pagination key) pairs
+//   - CompletedTables: count, then the completed table names
+//   - LastWrittenBinlogPosition and LastStoredBinlogPositionForInlineVerifier:
+//     file name, then position
+//   - BinlogVerifyStore: count of databases, then for each the database name and
+//     count of tables, then for each the table name and count of rows, then for
+//     each the pagination key and the number of times it changed
+//   - CompletedPaginationKeyRanges: count of tables, then for each the table
+//     name and count of ranges, then for each the distance of its start from
+//     the end of the previous range (or from 0) and its length minus one. The
+//     ranges are sorted and merged first.
+//   - all the other fields, as a JSON encoded SerializableState
+//   - LastKnownTableSchemaCache, as JSON, or empty if it was excluded
+//
+// Strings and byte slices are prefixed with their length. Counts and unsigned
+// integers are uvarints, and signed integers are varints.
+//
+// The format is written by hand rather than generated from a protobuf schema,
+// as Ghostferry does not vendor a protobuf runtime. Only the fields that grow
+// with the number of tables or rows are encoded in binary: the other fields are
+// small, and are left as JSON such that the fields added to the
+// SerializableState are carried without changing the format.
+var compactStateMagic = []byte("GFS2")
+
+var ErrNotCompactState = errors.New("data is not a compact serialized state")
+
+// Returns the state in the compact binary format. The schema cache is large
+// and often already known to the receiver, so it is only included if
+// includeSchema is true.
+func (s *StateTracker) SerializeCompact(lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore, includeSchema bool) ([]byte, error) {
+	return s.Serialize(lastKnownTableSchemaCache, binlogVerifyStore).MarshalCompact(includeSchema)
+}
+
+func (s *SerializableState) MarshalCompact(includeSchema bool) ([]byte, error) {
+	w := &compactWriter{}
+	w.buf.Write(compactStateMagic)
+
+	w.writeString(s.GhostferryVersion)
+
+	tables := sortedKeys(s.LastSuccessfulPaginationKeys)
+	w.writeUvarint(uint64(len(tables)))
+	for _, table := range tables {
+		w.writeString(table)
+		w.writeUvarint(s.LastSuccessfulPaginationKeys[table])
+	}
+
+	completedTables := make([]string, 0, len(s.CompletedTables))
+	for table, completed := range s.CompletedTables {
+		if completed {
+			completedTables = append(completedTables, table)
+		}
+	}
+	sort.Strings(completedTables)
+	w.writeUvarint(uint64(len(completedTables)))
+	for _, table := range completedTables {
+		w.writeString(table)
+	}
+
+	w.writePosition(s.LastWrittenBinlogPosition)
+	w.writePosition(s.LastStoredBinlogPositionForInlineVerifier)
+
+	w.writeUvarint(uint64(len(s.BinlogVerifyStore)))
+	for db, dbStore := range s.BinlogVerifyStore {
+		w.writeString(db)
+		w.writeUvarint(uint64(len(dbStore)))
+		for table, tableStore := range dbStore {
+			w.writeString(table)
+			w.writeUvarint(uint64(len(tableStore)))
+			for paginationKey, count := range tableStore {
+				w.writeUvarint(paginationKey)
+				w.writeVarint(int64(count))
+			}
+		}
+	}
+
+	tables = make([]string, 0, len(s.CompletedPaginationKeyRanges))
+	for table := range s.CompletedPaginationKeyRanges {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	w.writeUvarint(uint64(len(tables)))
+	for _, table := range tables {
+		ranges, err := normalizePaginationKeyRanges(table, s.CompletedPaginationKeyRanges[table])
+		if err != nil {
+			return nil, err
+		}
+
+		w.writeString(table)
+		w.writeUvarint(uint64(len(ranges)))
+		previousEnd := uint64(0)
+		for _, r := range ranges {
+			w.writeUvarint(r[0] - previousEnd)
+			w.writeUvarint(r[1] - r[0])
+			previousEnd = r[1]
+		}
+	}
+
+	others := *s
+	others.GhostferryVersion = ""
+	others.LastSuccessfulPaginationKeys = nil
+	others.CompletedTables = nil
+	others.LastWrittenBinlogPosition = mysql.Position{}
+	others.LastStoredBinlogPositionForInlineVerifier = mysql.Position{}
+	others.BinlogVerifyStore = nil
+	others.CompletedPaginationKeyRanges = nil
+	others.LastKnownTableSchemaCache = nil
+	if !includeSchema {
+		others.LastKnownTableSchemaCacheHash = ""
+		others.LastKnownTableSchemaHashes = nil
+		others.LastKnownTableSchemaCacheRedacted = false
+	}
+
+	othersJSON, err := json.Marshal(others)
+	if err != nil {
+		return nil, err
+	}
+	w.writeBytes(othersJSON)
+
+	var schemaJSON []byte
+	if includeSchema && s.LastKnownTableSchemaCache != nil {
+		schemaJSON, err = json.Marshal(s.LastKnownTableSchemaCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.writeBytes(schemaJSON)
+
+	return w.buf.Bytes(), nil
+}
+
+func UnmarshalCompactState(data []byte) (*SerializableState, error) {
+	if !bytes.HasPrefix(data, compactStateMagic) {
+		return nil, ErrNotCompactState
+	}
+
+	r := &compactReader{r: bytes.NewReader(data[len(compactStateMagic):])}
+
+	state := &SerializableState{}
+	version := r.readString()
+
+	count := r.readUvarint()
+	state.LastSuccessfulPaginationKeys = make(map[string]uint64)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		table := r.readString()
+		state.LastSuccessfulPaginationKeys[table] = r.readUvarint()
+	}
+
+	count = r.readUvarint()
+	state.CompletedTables = make(map[string]bool)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		state.CompletedTables[r.readString()] = true
+	}
+
+	lastWrittenBinlogPosition := r.readPosition()
+	lastStoredBinlogPositionForInlineVerifier := r.readPosition()
+
+	binlogVerifyStore := make(BinlogVerifySerializedStore)
+	dbCount := r.readUvarint()
+	for i := uint64(0); i < dbCount && r.err == nil; i++ {
+		db := r.readString()
+		binlogVerifyStore[db] = make(map[string]map[uint64]int)
+		tableCount := r.readUvarint()
+		for j := uint64(0); j < tableCount && r.err == nil; j++ {
+			table := r.readString()
+			binlogVerifyStore[db][table] = make(map[uint64]int)
+			rowCount := r.readUvarint()
+			for k := uint64(0); k < rowCount && r.err == nil; k++ {
+				paginationKey := r.readUvarint()
+				binlogVerifyStore[db][table][paginationKey] = int(r.readVarint())
+			}
+		}
+	}
+
+	completedPaginationKeyRanges := make(map[string][][2]uint64)
+	rangeTableCount := r.readUvarint()
+	for i := uint64(0); i < rangeTableCount && r.err == nil; i++ {
+		table := r.readString()
+		rangeCount := r.readUvarint()
+		ranges := make([][2]uint64, 0)
+		previousEnd := uint64(0)
+		for j := uint64(0); j < rangeCount && r.err == nil; j++ {
+			lo := previousEnd + r.readUvarint()
+			hi := lo + r.readUvarint()
+			ranges = append(ranges, [2]uint64{lo, hi})
+			previousEnd = hi
+		}
+		completedPaginationKeyRanges[table] = ranges
+	}
+
+	othersJSON := r.readBytes()
+	schemaJSON := r.readBytes()
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to read compact serialized state: %v", r.err)
+	}
+
+	paginationKeys := state.LastSuccessfulPaginationKeys
+	completedTables := state.CompletedTables
+	err := json.Unmarshal(othersJSON, state)
+	if err != nil {
+		return nil, err
+	}
+
+	state.GhostferryVersion = version
+	state.LastSuccessfulPaginationKeys = paginationKeys
+	state.CompletedTables = completedTables
+	state.LastWrittenBinlogPosition = lastWrittenBinlogPosition
+	state.LastStoredBinlogPositionForInlineVerifier = lastStoredBinlogPositionForInlineVerifier
+	if dbCount > 0 {
+		state.BinlogVerifyStore = binlogVerifyStore
+	}
+	if rangeTableCount > 0 {
+		state.CompletedPaginationKeyRanges = completedPaginationKeyRanges
+	}
+
+	if len(schemaJSON) > 0 {
+		err = json.Unmarshal(schemaJSON, &state.LastKnownTableSchemaCache)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// The ranges are encoded relative to the end of the previous range, so they
+// must be sorted and non-overlapping. The ranges of a tracker are, but those
+// of a state edited by hand may not be.
+func normalizePaginationKeyRanges(table string, ranges [][2]uint64) ([][2]uint64, error) {
+	sorted := append([][2]uint64(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	normalized := make([][2]uint64, 0, len(sorted))
+	for _, r := range sorted {
+		if r[0] > r[1] {
+			return nil, fmt.Errorf("the completed pagination key range [%d, %d] of %s ends before it starts", r[0], r[1], table)
+		}
+
+		last := len(normalized) - 1
+		if last >= 0 && r[0] <= normalized[last][1] {
+			if r[1] > normalized[last][1] {
+				normalized[last][1] = r[1]
+			}
+			continue
+		}
+
+		normalized = append(normalized, r)
+	}
+
+	return normalized, nil
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type compactWriter struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *compactWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *compactWriter) writeVarint(v int64) {
+	n := binary.PutVarint(w.scratch[:], v)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *compactWriter) writeBytes(b []byte) {
+	w.writeUvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *compactWriter) writeString(s string) {
+	w.writeUvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *compactWriter) writePosition(pos mysql.Position) {
+	w.writeString(pos.Name)
+	w.writeUvarint(uint64(pos.Pos))
+}
+
+// Reading stops at the first error, which is kept in err. All reads after
+// an error return zero values.
+type compactReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *compactReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	var v uint64
+	v, r.err = binary.ReadUvarint(r.r)
+	return v
+}
+
+func (r *compactReader) readVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	var v int64
+	v, r.err = binary.ReadVarint(r.r)
+	return v
+}
+
+func (r *compactReader) readBytes() []byte {
+	length := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+
+	if length > uint64(r.r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := make([]byte, length)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+func (r *compactReader) readString() string {
+	return string(r.readBytes())
+}
+
+func (r *compactReader) readPosition() mysql.Position {
+	name := r.readString()
+	pos := r.readUvarint()
+	return mysql.Position{Name: name, Pos: uint32(pos)}
+}
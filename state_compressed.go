@@ -0,0 +1,78 @@
+package ghostferry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Like Serialize, but encodes the state as JSON with its
+// LastKnownTableSchemaCache compressed with gzip, into
+// LastKnownTableSchemaCacheCompressed. The schema cache is most of the size
+// of the state with a large schema, and compresses well as its tables repeat
+// the same column definitions, so this is much smaller than the JSON of
+// Serialize while the rest of the state remains readable. The state must be
+// decoded with DeserializeCompressed to be resumed from.
+func (s *StateTracker) SerializeCompressed(lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore) ([]byte, error) {
+	state := s.Serialize(lastKnownTableSchemaCache, binlogVerifyStore)
+
+	if state.LastKnownTableSchemaCache != nil {
+		data, err := json.Marshal(state.LastKnownTableSchemaCache)
+		if err != nil {
+			return nil, err
+		}
+
+		compressed := &bytes.Buffer{}
+		w := gzip.NewWriter(compressed)
+		_, err = w.Write(data)
+		if err != nil {
+			return nil, err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		state.LastKnownTableSchemaCache = nil
+		state.LastKnownTableSchemaCacheCompressed = compressed.Bytes()
+	}
+
+	return json.Marshal(state)
+}
+
+// Decodes a state encoded by StateTracker.SerializeCompressed, or by
+// Serialize as plain JSON, with its LastKnownTableSchemaCache decompressed.
+func DeserializeCompressed(data []byte) (*SerializableState, error) {
+	state := &SerializableState{}
+	err := json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.LastKnownTableSchemaCacheCompressed == nil {
+		return state, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(state.LastKnownTableSchemaCacheCompressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the schema cache of the state: %v", err)
+	}
+
+	schemaData, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the schema cache of the state, it may be truncated: %v", err)
+	}
+
+	cache := TableSchemaCache{}
+	err = json.Unmarshal(schemaData, &cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the schema cache of the state: %v", err)
+	}
+
+	state.LastKnownTableSchemaCache = cache
+	state.LastKnownTableSchemaCacheCompressed = nil
+	return state, nil
+}
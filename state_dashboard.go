@@ -0,0 +1,201 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The version of the Dashboard document. Fields may be added to a version, but
+// renaming or removing a field, or changing its meaning, bumps the version,
+// such that dashboards can rely on the shape of the versions they support.
+const DashboardVersion = 1
+
+const (
+	DashboardHealthOK      = "ok"
+	DashboardHealthWarning = "warning"
+)
+
+// The progress, rates, binlog position, lag and health of a run in a single
+// document, for external dashboards. See StateTracker.DashboardJSON.
+type Dashboard struct {
+	Version     int
+	GeneratedAt time.Time
+
+	Phase     string
+	Resumed   bool
+	Paused    bool
+	Finalized bool
+
+	// The time spent in each phase, in seconds, see StateTracker.PhaseDurations.
+	PhaseDurations map[string]float64
+
+	Progress DashboardProgress
+	Rates    DashboardRates
+	Binlog   DashboardBinlog
+	Health   DashboardHealth
+}
+
+type DashboardProgress struct {
+	// The fraction of the copy that is complete, between 0 and 1, against the
+	// sizes given to StateTracker.SetTableSizes. See
+	// StateTracker.OverallProgress.
+	OverallProgress float64
+	RowsCopied      uint64
+
+	// The number of tables in each state, see StateTracker.TableStatus. The
+	// tables not started yet are not known to the tracker.
+	CompletedTables           int
+	PendingVerificationTables int
+	InProgressTables          int
+	DroppedTables             int
+
+	// Sorted by name.
+	PausedTables  []string
+	ErroredTables []string
+}
+
+type DashboardRates struct {
+	// See StateTracker.EstimatedPaginationKeysPerSecond.
+	PaginationKeysPerSecond float64
+
+	// The rates of each window, see StateTracker.Rates.
+	Windows map[string]float64
+}
+
+type DashboardBinlog struct {
+	// As "file:position", or empty if no position was written yet.
+	LastWrittenBinlogPosition string
+
+	// The consumer the run is resumed from and its position, see
+	// StateTracker.MinBinlogConsumerPosition.
+	ResumesFrom string
+
+	BinlogFilesTraversed int
+
+	// In seconds, see StateTracker.AppliedEventLag.
+	AppliedEventLag float64
+}
+
+type DashboardHealth struct {
+	// One of the DashboardHealth* constants: DashboardHealthWarning if there
+	// are any Warnings.
+	Status   string
+	Warnings []string
+}
+
+// Returns the Dashboard of the tracker as JSON. The document is read
+// consistently under the tracker's locks, as Serialize is, so its figures do
+// not contradict each other.
+func (s *StateTracker) DashboardJSON() ([]byte, error) {
+	return json.Marshal(s.Dashboard())
+}
+
+// See DashboardJSON.
+func (s *StateTracker) Dashboard() Dashboard {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	s.milestonesMutex.Lock()
+	tableSizes := s.tableSizes
+	s.milestonesMutex.Unlock()
+
+	now := time.Now()
+	dashboard := Dashboard{
+		Version:        DashboardVersion,
+		GeneratedAt:    now,
+		Phase:          s.phase,
+		Resumed:        s.resumed,
+		Paused:         !s.pausedAt.IsZero(),
+		Finalized:      !s.FinalizedAt().IsZero(),
+		PhaseDurations: make(map[string]float64),
+		Progress: DashboardProgress{
+			OverallProgress: s.overallProgressUnlocked(tableSizes),
+			RowsCopied:      s.rowsCopied,
+			DroppedTables:   len(s.droppedTables),
+			PausedTables:    s.pausedTablesUnlocked(),
+			ErroredTables:   make([]string, 0),
+		},
+		Rates: DashboardRates{
+			PaginationKeysPerSecond: s.estimatedPaginationKeysPerSecondUnlocked(false),
+			Windows:                 s.ratesUnlocked(),
+		},
+		Binlog: DashboardBinlog{
+			ResumesFrom:          s.minBinlogConsumerPositionUnlocked().String(),
+			BinlogFilesTraversed: len(s.binlogFilesTraversed),
+		},
+		Health: DashboardHealth{
+			Status:   DashboardHealthOK,
+			Warnings: make([]string, 0),
+		},
+	}
+
+	for phase, duration := range s.phaseDurationsUnlocked() {
+		dashboard.PhaseDurations[phase] = duration.Seconds()
+	}
+
+	if pos := s.lastWrittenBinlogPosition; pos.Name != "" {
+		dashboard.Binlog.LastWrittenBinlogPosition = fmt.Sprintf("%s:%d", pos.Name, pos.Pos)
+	}
+	if !s.latestAppliedEventTime.IsZero() {
+		dashboard.Binlog.AppliedEventLag = now.Sub(s.latestAppliedEventTime).Seconds()
+	}
+
+	for _, completed := range s.completedTables {
+		if completed {
+			dashboard.Progress.CompletedTables++
+		}
+	}
+	dashboard.Progress.PendingVerificationTables = len(s.copyCompletedTables)
+
+	inProgress := make(map[string]bool)
+	for table := range s.lastSuccessfulPaginationKeys {
+		inProgress[table] = true
+	}
+	for table := range s.completedPaginationKeyRanges {
+		inProgress[table] = true
+	}
+	for table := range inProgress {
+		if !s.isTableCopiedUnlocked(table) {
+			dashboard.Progress.InProgressTables++
+		}
+	}
+
+	for table, err := range s.tableErrors {
+		if err != "" {
+			dashboard.Progress.ErroredTables = append(dashboard.Progress.ErroredTables, table)
+		}
+	}
+	sort.Strings(dashboard.Progress.ErroredTables)
+
+	nearKeyExhaustion := make([]string, 0)
+	for table := range s.declaredMaxPaginationKeys {
+		if s.nearKeyExhaustionUnlocked(table) {
+			nearKeyExhaustion = append(nearKeyExhaustion, table)
+		}
+	}
+	sort.Strings(nearKeyExhaustion)
+
+	health := &dashboard.Health
+	if len(dashboard.Progress.ErroredTables) > 0 {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("tables with errors: %d", len(dashboard.Progress.ErroredTables)))
+	}
+	if dashboard.Paused {
+		health.Warnings = append(health.Warnings, "the run is paused")
+	}
+	if len(dashboard.Progress.PausedTables) > 0 {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("paused tables: %d", len(dashboard.Progress.PausedTables)))
+	}
+	for _, table := range nearKeyExhaustion {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("%s is near key exhaustion", table))
+	}
+	if len(health.Warnings) > 0 {
+		health.Status = DashboardHealthWarning
+	}
+
+	return dashboard
+}
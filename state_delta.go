@@ -0,0 +1,226 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// StateDelta contains the changes of the StateTracker since a previously
+// serialized state. This allows a full SerializableState, which includes the
+// potentially very large schema cache, to be written only occasionally, with
+// small deltas written in between.
+//
+// A delta never contains the schema cache. The per table progress maps
+// (LastSuccessfulPaginationKeys, FirstPaginationKeys, CompletedTables and
+// TableErrors) only contain the tables that changed, and the tables removed
+// from them are listed in the Removed* fields, e.g. for a table reset with
+// StateTracker.ResetTable or dropped with MarkTableDropped. Every other field
+// is small and is included in full, as it would otherwise not be possible to
+// represent removed entries (e.g. rows verified and removed from the
+// BinlogVerifyStore).
+//
+// A delta cannot be resumed from by itself: it must be applied onto its base
+// with ApplyStateDeltas.
+type StateDelta struct {
+	SerializableState
+	StateDeltaRemovals
+}
+
+// The tables removed from the per table progress maps since the snapshot of
+// a StateDelta, sorted by name.
+type StateDeltaRemovals struct {
+	RemovedLastSuccessfulPaginationKeys []string `json:",omitempty"`
+	RemovedFirstPaginationKeys          []string `json:",omitempty"`
+	RemovedCompletedTables              []string `json:",omitempty"`
+	RemovedTableErrors                  []string `json:",omitempty"`
+}
+
+// Encodes the removals next to the fields of the SerializableState, whose
+// own MarshalJSON would otherwise be promoted and leave them out.
+func (d StateDelta) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	for _, part := range []interface{}{d.SerializableState, d.StateDeltaRemovals} {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(data, &fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+func (d *StateDelta) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, &d.SerializableState)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &d.StateDeltaRemovals)
+}
+
+// Returns the changes since the given snapshot, which is either the base
+// snapshot or the result of applying the previous deltas onto it with
+// ApplyStateDeltas.
+func (s *StateTracker) SerializeDelta(sinceSnapshot *SerializableState, binlogVerifyStore *BinlogVerifyStore) *StateDelta {
+	delta := &StateDelta{SerializableState: *s.Serialize(nil, binlogVerifyStore)}
+	delta.RemovedLastSuccessfulPaginationKeys = removedPaginationKeys(sinceSnapshot.LastSuccessfulPaginationKeys, delta.LastSuccessfulPaginationKeys)
+	delta.RemovedFirstPaginationKeys = removedPaginationKeys(sinceSnapshot.FirstPaginationKeys, delta.FirstPaginationKeys)
+	delta.RemovedCompletedTables = removedCompletedTables(sinceSnapshot.CompletedTables, delta.CompletedTables)
+	delta.RemovedTableErrors = removedTableErrors(sinceSnapshot.TableErrors, delta.TableErrors)
+
+	for table, paginationKey := range delta.LastSuccessfulPaginationKeys {
+		previous, found := sinceSnapshot.LastSuccessfulPaginationKeys[table]
+		if found && previous == paginationKey {
+			delete(delta.LastSuccessfulPaginationKeys, table)
+		}
+	}
+
+	for table, paginationKey := range delta.FirstPaginationKeys {
+		previous, found := sinceSnapshot.FirstPaginationKeys[table]
+		if found && previous == paginationKey {
+			delete(delta.FirstPaginationKeys, table)
+		}
+	}
+
+	for table, completed := range delta.CompletedTables {
+		if sinceSnapshot.CompletedTables[table] == completed {
+			delete(delta.CompletedTables, table)
+		}
+	}
+
+	for table, err := range delta.TableErrors {
+		previous, found := sinceSnapshot.TableErrors[table]
+		if found && previous == err {
+			delete(delta.TableErrors, table)
+		}
+	}
+
+	return delta
+}
+
+// Applies the deltas, in order, onto the base snapshot and returns the
+// resulting state, which can be resumed from. The base is not modified.
+func ApplyStateDeltas(base *SerializableState, deltas ...*StateDelta) *SerializableState {
+	state := *base
+	state.LastSuccessfulPaginationKeys = copyPaginationKeys(base.LastSuccessfulPaginationKeys)
+	state.FirstPaginationKeys = copyPaginationKeys(base.FirstPaginationKeys)
+	state.CompletedTables = copyCompletedTables(base.CompletedTables)
+	state.TableErrors = copyTableErrors(base.TableErrors)
+
+	for _, delta := range deltas {
+		paginationKeys := state.LastSuccessfulPaginationKeys
+		firstPaginationKeys := state.FirstPaginationKeys
+		completedTables := state.CompletedTables
+		tableErrors := state.TableErrors
+
+		state = delta.SerializableState
+
+		// The schema is only stored in the base.
+		state.LastKnownTableSchemaCache = base.LastKnownTableSchemaCache
+		state.LastKnownTableSchemaCacheHash = base.LastKnownTableSchemaCacheHash
+		state.LastKnownTableSchemaHashes = base.LastKnownTableSchemaHashes
+		state.LastKnownTableSchemaCacheRedacted = base.LastKnownTableSchemaCacheRedacted
+
+		for table, paginationKey := range delta.LastSuccessfulPaginationKeys {
+			paginationKeys[table] = paginationKey
+		}
+
+		for table, paginationKey := range delta.FirstPaginationKeys {
+			firstPaginationKeys[table] = paginationKey
+		}
+
+		for table, completed := range delta.CompletedTables {
+			completedTables[table] = completed
+		}
+
+		for table, err := range delta.TableErrors {
+			tableErrors[table] = err
+		}
+
+		for _, table := range delta.RemovedLastSuccessfulPaginationKeys {
+			delete(paginationKeys, table)
+		}
+
+		for _, table := range delta.RemovedFirstPaginationKeys {
+			delete(firstPaginationKeys, table)
+		}
+
+		for _, table := range delta.RemovedCompletedTables {
+			delete(completedTables, table)
+		}
+
+		for _, table := range delta.RemovedTableErrors {
+			delete(tableErrors, table)
+		}
+
+		state.LastSuccessfulPaginationKeys = paginationKeys
+		state.FirstPaginationKeys = firstPaginationKeys
+		state.CompletedTables = completedTables
+		state.TableErrors = tableErrors
+	}
+
+	return &state
+}
+
+func copyPaginationKeys(m map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyCompletedTables(m map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyTableErrors(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Returns the tables of the snapshot missing from current, sorted by name.
+func removedPaginationKeys(snapshot, current map[string]uint64) []string {
+	var removed []string
+	for table := range snapshot {
+		if _, found := current[table]; !found {
+			removed = append(removed, table)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+func removedCompletedTables(snapshot, current map[string]bool) []string {
+	var removed []string
+	for table := range snapshot {
+		if _, found := current[table]; !found {
+			removed = append(removed, table)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+func removedTableErrors(snapshot, current map[string]string) []string {
+	var removed []string
+	for table := range snapshot {
+		if _, found := current[table]; !found {
+			removed = append(removed, table)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
@@ -0,0 +1,127 @@
+package ghostferry
+
+import (
+	"sort"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// PaginationKeyAdvance records how far the copy of a single table progressed
+// between two SerializableStates.
+type PaginationKeyAdvance struct {
+	From uint64
+	To   uint64
+}
+
+// BinlogPositionMovement records the binlog position of a component in two
+// SerializableStates.
+type BinlogPositionMovement struct {
+	From mysql.Position
+	To   mysql.Position
+}
+
+func (m BinlogPositionMovement) Moved() bool {
+	return m.From.Compare(m.To) != 0
+}
+
+// StateDiff is a structured description of what happened between two
+// SerializableStates. It is meant to be marshaled (e.g. to JSON) for offline
+// analysis of periodically dumped states.
+type StateDiff struct {
+	FromGhostferryVersion string
+	ToGhostferryVersion   string
+
+	// Tables whose last successful pagination key increased. Tables that
+	// only appear in the newer state are reported as advancing from 0.
+	AdvancedTables map[string]PaginationKeyAdvance
+
+	// Tables that are completed in the newer state but were not completed in
+	// the older state. Sorted by name.
+	NewlyCompletedTables []string
+
+	// Tables of the older state that are missing from the newer state, or
+	// whose progress moved backwards in it, as if they were reset with
+	// StateTracker.ResetTable. Sorted by name.
+	ResetTables []string
+
+	// Tables that are dropped in the newer state but were not dropped in the
+	// older state, see StateTracker.MarkTableDropped. Sorted by name.
+	NewlyDroppedTables []string
+
+	LastWrittenBinlogPosition                 BinlogPositionMovement
+	LastStoredBinlogPositionForInlineVerifier BinlogPositionMovement
+}
+
+// DiffStates computes the changes between two SerializableStates, where a is
+// the older state and b is the newer state. Neither state is modified. The
+// states do not need to come from a live StateTracker, e.g. they can be loaded
+// from dumped files with LoadStateFromFile.
+func DiffStates(a, b *SerializableState) StateDiff {
+	diff := StateDiff{
+		FromGhostferryVersion: a.GhostferryVersion,
+		ToGhostferryVersion:   b.GhostferryVersion,
+		AdvancedTables:        make(map[string]PaginationKeyAdvance),
+		NewlyCompletedTables:  make([]string, 0),
+		ResetTables:           make([]string, 0),
+		NewlyDroppedTables:    make([]string, 0),
+
+		LastWrittenBinlogPosition: BinlogPositionMovement{
+			From: a.LastWrittenBinlogPosition,
+			To:   b.LastWrittenBinlogPosition,
+		},
+		LastStoredBinlogPositionForInlineVerifier: BinlogPositionMovement{
+			From: a.LastStoredBinlogPositionForInlineVerifier,
+			To:   b.LastStoredBinlogPositionForInlineVerifier,
+		},
+	}
+
+	for table, to := range b.LastSuccessfulPaginationKeys {
+		from := a.LastSuccessfulPaginationKeys[table]
+		if to > from {
+			diff.AdvancedTables[table] = PaginationKeyAdvance{From: from, To: to}
+		}
+	}
+
+	for table, completed := range b.CompletedTables {
+		if completed && !a.CompletedTables[table] {
+			diff.NewlyCompletedTables = append(diff.NewlyCompletedTables, table)
+		}
+	}
+	sort.Strings(diff.NewlyCompletedTables)
+
+	droppedBefore := make(map[string]bool, len(a.DroppedTables))
+	for _, table := range a.DroppedTables {
+		droppedBefore[table] = true
+	}
+	droppedAfter := make(map[string]bool, len(b.DroppedTables))
+	for _, table := range b.DroppedTables {
+		droppedAfter[table] = true
+		if !droppedBefore[table] {
+			diff.NewlyDroppedTables = append(diff.NewlyDroppedTables, table)
+		}
+	}
+	sort.Strings(diff.NewlyDroppedTables)
+
+	reset := make(map[string]bool)
+	for table, from := range a.LastSuccessfulPaginationKeys {
+		to, found := b.LastSuccessfulPaginationKeys[table]
+		if (!found && !b.CompletedTables[table] && !b.CopyCompletedTables[table]) || to < from {
+			reset[table] = true
+		}
+	}
+	for _, completed := range []map[string]bool{a.CompletedTables, a.CopyCompletedTables} {
+		for table, done := range completed {
+			if done && !b.CompletedTables[table] && !b.CopyCompletedTables[table] {
+				reset[table] = true
+			}
+		}
+	}
+	for table := range reset {
+		if !droppedAfter[table] {
+			diff.ResetTables = append(diff.ResetTables, table)
+		}
+	}
+	sort.Strings(diff.ResetTables)
+
+	return diff
+}
@@ -0,0 +1,188 @@
+package ghostferry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Serializes the tracker and writes the state as JSON to the file at path,
+// replacing it atomically: the state is written to a temporary file in the
+// same directory first, which is then renamed to path, so a crash while
+// dumping leaves the previous state in place rather than a truncated one.
+//
+// Only Serialize is done under the tracker's locks, the state is encoded and
+// written after they are released.
+func (s *StateTracker) DumpStateToFile(path string, schemaCache TableSchemaCache) error {
+	return writeStateFile(path, s.Serialize(schemaCache, nil))
+}
+
+// Serializes the tracker and stores the state in the store, see
+// StateStore.StoreState. As for DumpStateToFile, only Serialize is done under
+// the tracker's locks.
+func (s *StateTracker) StoreState(store StateStore, schemaCache TableSchemaCache) error {
+	return store.StoreState(s.Serialize(schemaCache, nil))
+}
+
+// Returns a tracker resumed from the last state stored in the store, or a new
+// tracker if the store has no state.
+func NewStateTrackerFromStateStore(speedLogCount int, store StateStore) (*StateTracker, error) {
+	state, err := store.LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		return NewStateTracker(speedLogCount), nil
+	}
+
+	return NewStateTrackerFromSerializedState(speedLogCount, state), nil
+}
+
+func writeStateFile(path string, state *SerializableState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// Starts a goroutine that dumps the state to the file at path with
+// DumpStateToFile at every interval, until the context is done. A failed dump
+// is logged and retried at the next interval, the file keeps the last
+// successfully dumped state. A dump in progress when the context is done is
+// completed.
+func (s *StateTracker) StartPeriodicDump(ctx context.Context, path string, interval time.Duration, schemaCache TableSchemaCache) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ctx.Err() != nil {
+					return
+				}
+
+				err := s.DumpStateToFile(path, schemaCache)
+				if err != nil {
+					s.logger.WithError(err).WithField("path", path).Error("failed to dump the state to file")
+				}
+			}
+		}
+	}()
+}
+
+// Loads a state written by StateTracker.DumpStateToFile.
+func LoadStateFromFile(path string) (*SerializableState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &SerializableState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// FileStateStore stores the state as JSON in a single file, replaced
+// atomically on every StoreState as by StateTracker.DumpStateToFile. Only the
+// last state is kept.
+//
+// The Generation of the states is compared to that of the last state stored
+// or loaded by the store, so a FileStateStore does not detect the states
+// stored by another process. A central store, such as the MySQLStateStore,
+// should be used with concurrent processes.
+type FileStateStore struct {
+	Path string
+
+	mutex          sync.Mutex
+	loaded         bool
+	lastGeneration uint64
+}
+
+// Returns ErrStaleStateGeneration if the state has a Generation and the last
+// state has a greater or equal one. States without a Generation are always
+// stored.
+func (s *FileStateStore) StoreState(state *SerializableState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.loaded {
+		_, err := s.loadStateUnlocked()
+		if err != nil {
+			return err
+		}
+	}
+
+	if state.Generation != 0 && state.Generation <= s.lastGeneration {
+		return ErrStaleStateGeneration
+	}
+
+	err := writeStateFile(s.Path, state)
+	if err != nil {
+		return err
+	}
+
+	if state.Generation > s.lastGeneration {
+		s.lastGeneration = state.Generation
+	}
+	return nil
+}
+
+// Returns nil if the file does not exist.
+func (s *FileStateStore) LoadState() (*SerializableState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.loadStateUnlocked()
+}
+
+func (s *FileStateStore) loadStateUnlocked() (*SerializableState, error) {
+	state, err := LoadStateFromFile(s.Path)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded = true
+	if state.Generation > s.lastGeneration {
+		s.lastGeneration = state.Generation
+	}
+	return state, nil
+}
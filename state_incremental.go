@@ -0,0 +1,148 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Returns the state like Serialize, but without the tables that were already
+// completed in the prior state and whose schema did not change since. These
+// tables never change again, so omitting them keeps the state small when most
+// of a large number of tables are completed, and most of the state would
+// otherwise be their progress and schema.
+//
+// A table is omitted if it is completed in both the prior and the current
+// states, and its schema hash in LastKnownTableSchemaHashes is the same in
+// both, or missing from both. All the entries of an omitted table are left
+// out: its progress, completion, error, schema and schema hash. The omitted
+// tables are listed in OmittedCompletedTables, and LastKnownTableSchemaCacheHash
+// is still the hash of the full schema cache.
+//
+// The returned state cannot be resumed from by itself: it must be merged with
+// the prior state with MergeIncrementalState. The prior state can itself be
+// the result of such a merge. If prior is nil, this is the same as Serialize.
+func (s *StateTracker) SerializeIncremental(prior *SerializableState, lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore) *SerializableState {
+	state := s.Serialize(lastKnownTableSchemaCache, binlogVerifyStore)
+	if prior == nil {
+		return state
+	}
+
+	omittedTables := make([]string, 0)
+	for table, completed := range state.CompletedTables {
+		if !completed || !prior.CompletedTables[table] {
+			continue
+		}
+
+		if state.LastKnownTableSchemaHashes[table] != prior.LastKnownTableSchemaHashes[table] {
+			continue
+		}
+
+		omittedTables = append(omittedTables, table)
+	}
+
+	if len(omittedTables) == 0 {
+		return state
+	}
+	sort.Strings(omittedTables)
+
+	// The cache belongs to the caller, and the hashes and cache must stay
+	// consistent, so both are copied without the omitted tables.
+	if state.LastKnownTableSchemaCache != nil {
+		cache := make(TableSchemaCache, len(state.LastKnownTableSchemaCache))
+		for table, tableSchema := range state.LastKnownTableSchemaCache {
+			cache[table] = tableSchema
+		}
+		state.LastKnownTableSchemaCache = cache
+	}
+
+	for _, table := range omittedTables {
+		delete(state.LastSuccessfulPaginationKeys, table)
+		delete(state.FirstPaginationKeys, table)
+		delete(state.CompletedTables, table)
+		delete(state.TableErrors, table)
+		delete(state.CompletedPaginationKeyRanges, table)
+		delete(state.CompletedPaginationKeyBitmaps, table)
+		delete(state.LastKnownTableSchemaCache, table)
+		delete(state.LastKnownTableSchemaHashes, table)
+	}
+
+	state.OmittedCompletedTables = omittedTables
+	return state
+}
+
+// Merges a state returned by SerializeIncremental with the prior state it was
+// serialized against, and returns the full state, which can be resumed from.
+// Neither of the states is modified.
+//
+// The merged state is the incremental state with, for each of its
+// OmittedCompletedTables, the entries of the table in the prior state. The
+// schema and schema hash of the omitted tables are only merged if the
+// incremental state has schema hashes: a state serialized without a schema
+// cache remains without one. Fails if the prior state does not have the
+// completed tables, or if the merged schema does not match
+// LastKnownTableSchemaCacheHash, as that is not the prior state the
+// incremental state was serialized against.
+func MergeIncrementalState(prior, incremental *SerializableState) (*SerializableState, error) {
+	state := *incremental
+	state.OmittedCompletedTables = nil
+	if len(incremental.OmittedCompletedTables) == 0 {
+		return &state, nil
+	}
+
+	state.LastSuccessfulPaginationKeys = copyPaginationKeys(incremental.LastSuccessfulPaginationKeys)
+	state.FirstPaginationKeys = copyPaginationKeys(incremental.FirstPaginationKeys)
+	state.CompletedTables = copyCompletedTables(incremental.CompletedTables)
+	state.TableErrors = copyTableErrors(incremental.TableErrors)
+
+	mergeSchema := incremental.LastKnownTableSchemaHashes != nil
+	if mergeSchema {
+		state.LastKnownTableSchemaHashes = make(map[string]string, len(incremental.LastKnownTableSchemaHashes))
+		for table, hash := range incremental.LastKnownTableSchemaHashes {
+			state.LastKnownTableSchemaHashes[table] = hash
+		}
+
+		state.LastKnownTableSchemaCache = make(TableSchemaCache, len(incremental.LastKnownTableSchemaCache))
+		for table, tableSchema := range incremental.LastKnownTableSchemaCache {
+			state.LastKnownTableSchemaCache[table] = tableSchema
+		}
+	}
+
+	for _, table := range incremental.OmittedCompletedTables {
+		if !prior.CompletedTables[table] {
+			return nil, fmt.Errorf("omitted table %s is not completed in the prior state", table)
+		}
+
+		state.CompletedTables[table] = true
+		if paginationKey, found := prior.LastSuccessfulPaginationKeys[table]; found {
+			state.LastSuccessfulPaginationKeys[table] = paginationKey
+		}
+		if paginationKey, found := prior.FirstPaginationKeys[table]; found {
+			state.FirstPaginationKeys[table] = paginationKey
+		}
+		if err, found := prior.TableErrors[table]; found {
+			state.TableErrors[table] = err
+		}
+
+		hash, found := prior.LastKnownTableSchemaHashes[table]
+		if !mergeSchema || !found {
+			continue
+		}
+
+		tableSchema, found := prior.LastKnownTableSchemaCache[table]
+		if !found {
+			return nil, fmt.Errorf("the schema of omitted table %s is missing from the prior state", table)
+		}
+
+		state.LastKnownTableSchemaHashes[table] = hash
+		state.LastKnownTableSchemaCache[table] = tableSchema
+		if prior.LastKnownTableSchemaCacheRedacted {
+			state.LastKnownTableSchemaCacheRedacted = true
+		}
+	}
+
+	if mergeSchema && CombinedSchemaHash(state.LastKnownTableSchemaHashes) != state.LastKnownTableSchemaCacheHash {
+		return nil, fmt.Errorf("the merged schema does not match the schema the incremental state was serialized with")
+	}
+
+	return &state, nil
+}
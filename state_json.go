@@ -0,0 +1,78 @@
+package ghostferry
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// The SerializableState without its JSON methods, to encode and decode its
+// fields with the default encoding.
+type plainSerializableState SerializableState
+
+// Encodes the CompletedTables as a sorted list of the completed tables if
+// CompactCompletedTables is set, and as a map otherwise.
+func (s SerializableState) MarshalJSON() ([]byte, error) {
+	if !s.CompactCompletedTables {
+		return json.Marshal(plainSerializableState(s))
+	}
+
+	completedTables := make([]string, 0, len(s.CompletedTables))
+	for table, completed := range s.CompletedTables {
+		if completed {
+			completedTables = append(completedTables, table)
+		}
+	}
+	sort.Strings(completedTables)
+
+	return json.Marshal(struct {
+		plainSerializableState
+		CompletedTables []string
+	}{
+		plainSerializableState: plainSerializableState(s),
+		CompletedTables:        completedTables,
+	})
+}
+
+// Decodes the CompletedTables from either the map or the list form. If it is
+// a list, CompactCompletedTables is set such that the state is encoded back
+// in the same form.
+func (s *SerializableState) UnmarshalJSON(data []byte) error {
+	decoded := struct {
+		*plainSerializableState
+		CompletedTables json.RawMessage
+	}{
+		plainSerializableState: (*plainSerializableState)(s),
+	}
+
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	s.CompactCompletedTables = false
+
+	raw := bytes.TrimSpace(decoded.CompletedTables)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+
+	if raw[0] != '[' {
+		return json.Unmarshal(raw, &s.CompletedTables)
+	}
+
+	var completedTables []string
+	err = json.Unmarshal(raw, &completedTables)
+	if err != nil {
+		return err
+	}
+
+	if s.CompletedTables == nil {
+		s.CompletedTables = make(map[string]bool, len(completedTables))
+	}
+	for _, table := range completedTables {
+		s.CompletedTables[table] = true
+	}
+	s.CompactCompletedTables = true
+	return nil
+}
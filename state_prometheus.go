@@ -0,0 +1,174 @@
+package ghostferry
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A registry of the StateTrackers of the runs of a process, served in the
+// Prometheus text exposition format. The metrics are read from the trackers
+// under their read locks when the registry is scraped, so there is no
+// goroutine updating them in the background.
+//
+// Every metric has a run_id label:
+//
+//   - ghostferry_pagination_keys_per_second, a gauge, see
+//     StateTracker.EstimatedPaginationKeysPerSecond,
+//   - ghostferry_completed_tables, a gauge,
+//   - ghostferry_last_successful_pagination_key, a gauge with a table label,
+//   - ghostferry_last_written_binlog_position, a counter of the last written
+//     binlog position as the number of its binlog file times 2^32 plus its
+//     position within the file, which only increases as the binlog is
+//     written.
+//
+// Ghostferry does not depend on the Prometheus client library: the registry
+// is an http.Handler to serve on its own path, e.g. /metrics.
+type PrometheusRegistry struct {
+	mutex    sync.Mutex
+	trackers map[string]*StateTracker
+}
+
+func NewPrometheusRegistry() *PrometheusRegistry {
+	return &PrometheusRegistry{
+		trackers: make(map[string]*StateTracker),
+	}
+}
+
+// Publishes the metrics of the tracker in the registry under the run ID. A
+// tracker registered again under the same run ID, such as the tracker of a
+// run restarted within the same process, replaces the previous one.
+func (s *StateTracker) RegisterMetrics(registry *PrometheusRegistry, runID string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.trackers[runID] = s
+}
+
+// Stops publishing the metrics of the run.
+func (r *PrometheusRegistry) Unregister(runID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.trackers, runID)
+}
+
+func (r *PrometheusRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(r.Gather())
+}
+
+// Returns the metrics of every registered tracker in the Prometheus text
+// exposition format, sorted by metric, run ID and table.
+func (r *PrometheusRegistry) Gather() []byte {
+	r.mutex.Lock()
+	runIDs := make([]string, 0, len(r.trackers))
+	trackers := make(map[string]*StateTracker, len(r.trackers))
+	for runID, tracker := range r.trackers {
+		runIDs = append(runIDs, runID)
+		trackers[runID] = tracker
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(runIDs)
+	samples := make([]prometheusSample, len(runIDs))
+	for i, runID := range runIDs {
+		samples[i] = trackers[runID].prometheusSample()
+	}
+
+	buf := &bytes.Buffer{}
+
+	writePrometheusHeader(buf, "ghostferry_pagination_keys_per_second", "gauge", "The estimated number of pagination keys copied per second.")
+	for i, runID := range runIDs {
+		writePrometheusValue(buf, "ghostferry_pagination_keys_per_second", runID, "", samples[i].paginationKeysPerSecond)
+	}
+
+	writePrometheusHeader(buf, "ghostferry_completed_tables", "gauge", "The number of tables whose copy is complete.")
+	for i, runID := range runIDs {
+		writePrometheusValue(buf, "ghostferry_completed_tables", runID, "", float64(samples[i].completedTables))
+	}
+
+	writePrometheusHeader(buf, "ghostferry_last_successful_pagination_key", "gauge", "The last successful pagination key of each table.")
+	for i, runID := range runIDs {
+		tables := make([]string, 0, len(samples[i].lastSuccessfulPaginationKeys))
+		for table := range samples[i].lastSuccessfulPaginationKeys {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+
+		for _, table := range tables {
+			writePrometheusValue(buf, "ghostferry_last_successful_pagination_key", runID, table, float64(samples[i].lastSuccessfulPaginationKeys[table]))
+		}
+	}
+
+	writePrometheusHeader(buf, "ghostferry_last_written_binlog_position", "counter", "The last written binlog position, as the binlog file number times 2^32 plus the position.")
+	for i, runID := range runIDs {
+		writePrometheusValue(buf, "ghostferry_last_written_binlog_position", runID, "", samples[i].lastWrittenBinlogPosition)
+	}
+
+	return buf.Bytes()
+}
+
+type prometheusSample struct {
+	paginationKeysPerSecond      float64
+	completedTables              int
+	lastSuccessfulPaginationKeys map[string]uint64
+	lastWrittenBinlogPosition    float64
+}
+
+func (s *StateTracker) prometheusSample() prometheusSample {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	sample := prometheusSample{
+		paginationKeysPerSecond:      s.estimatedPaginationKeysPerSecondUnlocked(false),
+		lastSuccessfulPaginationKeys: make(map[string]uint64, len(s.lastSuccessfulPaginationKeys)),
+	}
+
+	for _, completed := range s.completedTables {
+		if completed {
+			sample.completedTables++
+		}
+	}
+
+	for table, paginationKey := range s.lastSuccessfulPaginationKeys {
+		sample.lastSuccessfulPaginationKeys[table] = paginationKey
+	}
+
+	if number, ok := binlogFileNumber(s.lastWrittenBinlogPosition.Name); ok {
+		sample.lastWrittenBinlogPosition = float64(number)*math.Exp2(32) + float64(s.lastWrittenBinlogPosition.Pos)
+	}
+
+	return sample
+}
+
+func writePrometheusHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writePrometheusValue(buf *bytes.Buffer, name, runID, table string, value float64) {
+	buf.WriteString(name)
+	buf.WriteString(`{run_id="`)
+	buf.WriteString(escapePrometheusLabel(runID))
+	if table != "" {
+		buf.WriteString(`",table="`)
+		buf.WriteString(escapePrometheusLabel(table))
+	}
+	buf.WriteString(`"} `)
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	buf.WriteString("\n")
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePrometheusLabel(value string) string {
+	return prometheusLabelEscaper.Replace(value)
+}
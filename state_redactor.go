@@ -0,0 +1,69 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// A StateRedactor scrubs sensitive data, such as column names or enum values,
+// from the LastKnownTableSchemaCache of a state before it is dumped, so the
+// state can be stored outside of the databases' data policies.
+//
+// Only the schema cache can be redacted. The rest of the state is required to
+// resume and is kept as is, which includes the fully qualified table names
+// and the pagination key values of the copy progress and of the
+// BinlogVerifyStore.
+//
+// A redacted schema cache is never resumed from: a run resumed from a state
+// with a redacted schema cache reloads the schema from the source database
+// and refuses to start if the reloaded schema does not match the
+// LastKnownTableSchemaHashes, which are computed before the redaction.
+type StateRedactor interface {
+	// Redacts the table in place. The table is a copy, so the schema used by
+	// the running Ferry is not affected.
+	RedactTableSchema(table *TableSchema) error
+}
+
+// Redacts the LastKnownTableSchemaCache of the state with the redactor. The
+// cache is replaced by a redacted copy, so the cache given to
+// StateTracker.Serialize is not modified.
+func RedactSerializableState(state *SerializableState, redactor StateRedactor) error {
+	if state.LastKnownTableSchemaCache == nil {
+		return nil
+	}
+
+	if state.LastKnownTableSchemaHashes == nil {
+		return fmt.Errorf("cannot redact a state without LastKnownTableSchemaHashes, as the schema could no longer be verified on resume")
+	}
+
+	// The JSON round trip is the simplest deep copy of the schemas, and the
+	// cache has to survive it anyway to be dumped.
+	cacheBytes, err := json.Marshal(state.LastKnownTableSchemaCache)
+	if err != nil {
+		return err
+	}
+
+	redactedCache := make(TableSchemaCache)
+	err = json.Unmarshal(cacheBytes, &redactedCache)
+	if err != nil {
+		return err
+	}
+
+	tableNames := make([]string, 0, len(redactedCache))
+	for tableName := range redactedCache {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	for _, tableName := range tableNames {
+		err = redactor.RedactTableSchema(redactedCache[tableName])
+		if err != nil {
+			return fmt.Errorf("failed to redact the schema of %s: %v", tableName, err)
+		}
+	}
+
+	state.LastKnownTableSchemaCache = redactedCache
+	state.LastKnownTableSchemaCacheRedacted = true
+	return nil
+}
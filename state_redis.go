@@ -0,0 +1,276 @@
+package ghostferry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultRedisStateStoreKeyPrefix = "ghostferry:state:"
+	DefaultRedisStateStoreTimeout   = 5 * time.Second
+)
+
+// Compares the Generation of the state with that of the stored state, and
+// stores the state if it is newer, as MySQLStateStore.StoreState does. Redis
+// runs the script atomically. Returns 0 if the state is stale.
+const redisStoreStateScript = `
+local stored = tonumber(redis.call('HGET', KEYS[1], 'generation') or '0')
+local generation = tonumber(ARGV[2])
+if generation ~= 0 and generation <= stored then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[1])
+if generation > stored then
+	redis.call('HSET', KEYS[1], 'generation', ARGV[2])
+end
+return 1
+`
+
+// RedisStateStore stores the state of each run as JSON in a Redis hash keyed
+// by its RunID, such that the processes of many runs can store their states
+// on a central server. Only the last state of each run is kept.
+//
+// The SerializableState.Generation of the state is stored alongside it, and
+// compared and set by a script which Redis runs atomically, such that
+// concurrent processes cannot replace a state by an older one.
+//
+// Ghostferry does not vendor a Redis client: the store speaks the few
+// commands of the Redis protocol it needs, over a new connection for every
+// call, as the states are only stored every few seconds.
+type RedisStateStore struct {
+	// The host:port of the Redis server.
+	Addr string
+
+	// Sent with AUTH if set.
+	//
+	// Optional: defaults to no authentication
+	Password string
+
+	// The logical database, selected with SELECT if not 0.
+	//
+	// Optional: defaults to 0
+	DB int
+
+	// Identifies the run. Runs with different RunIDs can share the same
+	// server.
+	RunID string
+
+	// The key of the hash of a run is the KeyPrefix followed by the RunID.
+	//
+	// Optional: defaults to DefaultRedisStateStoreKeyPrefix
+	KeyPrefix string
+
+	// The timeout of every call, including connecting to the server.
+	//
+	// Optional: defaults to DefaultRedisStateStoreTimeout
+	Timeout time.Duration
+}
+
+// Validates the configuration and checks that the server can be reached.
+func (s *RedisStateStore) Initialize() error {
+	if s.RunID == "" {
+		return fmt.Errorf("RedisStateStore requires a RunID")
+	}
+
+	if s.Addr == "" {
+		return fmt.Errorf("RedisStateStore requires an Addr")
+	}
+
+	if s.KeyPrefix == "" {
+		s.KeyPrefix = DefaultRedisStateStoreKeyPrefix
+	}
+
+	if s.Timeout == 0 {
+		s.Timeout = DefaultRedisStateStoreTimeout
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.do("PING")
+	if err != nil {
+		return fmt.Errorf("failed to ping the redis server at %s: %v", s.Addr, err)
+	}
+
+	return nil
+}
+
+// Returns ErrStaleStateGeneration if the state has a Generation and the stored
+// state has a greater or equal one. States without a Generation are always
+// stored.
+func (s *RedisStateStore) StoreState(state *SerializableState) error {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reply, err := conn.do("EVAL", redisStoreStateScript, "1", s.key(), string(stateBytes), strconv.FormatUint(state.Generation, 10))
+	if err != nil {
+		return fmt.Errorf("during storing the state of run %s: %v", s.RunID, err)
+	}
+
+	if reply == int64(0) {
+		return ErrStaleStateGeneration
+	}
+
+	return nil
+}
+
+func (s *RedisStateStore) LoadState() (*SerializableState, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reply, err := conn.do("HGET", s.key(), "state")
+	if err != nil {
+		return nil, fmt.Errorf("during loading the state of run %s: %v", s.RunID, err)
+	}
+
+	if reply == nil {
+		return nil, nil
+	}
+
+	stateBytes, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply %v when loading the state of run %s", reply, s.RunID)
+	}
+
+	state := &SerializableState{}
+	err = json.Unmarshal([]byte(stateBytes), state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *RedisStateStore) key() string {
+	prefix := s.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultRedisStateStoreKeyPrefix
+	}
+
+	return prefix + s.RunID
+}
+
+func (s *RedisStateStore) dial() (*redisConn, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultRedisStateStoreTimeout
+	}
+
+	netConn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the redis server at %s: %v", s.Addr, err)
+	}
+
+	err = netConn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	conn := &redisConn{conn: netConn, r: bufio.NewReader(netConn)}
+	if s.Password != "" {
+		_, err = conn.do("AUTH", s.Password)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to the redis server at %s: %v", s.Addr, err)
+		}
+	}
+
+	if s.DB != 0 {
+		_, err = conn.do("SELECT", strconv.Itoa(s.DB))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select database %d of the redis server at %s: %v", s.DB, s.Addr, err)
+		}
+	}
+
+	return conn, nil
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// Sends the command and returns its reply: a string for the simple and bulk
+// strings, an int64 for the integers, and nil for the nil bulk string. An
+// error reply is returned as an error.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := c.conn.Write(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid redis reply %q", line)
+	}
+
+	payload := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, errors.New(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk string length %q", payload)
+		}
+
+		if length < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(c.r, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(data[:length]), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis reply %q", line)
+	}
+}
@@ -0,0 +1,160 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// The maximum number of tables listed by SerializableState.Report.
+const DefaultStateReportMaxTables = 50
+
+// Renders the state as a text block meant to be read by an operator, such as
+// the tool used to inspect a dumped state. See ReportWithLimit.
+func (s *SerializableState) Report() string {
+	return s.ReportWithLimit(DefaultStateReportMaxTables)
+}
+
+// Renders the version, the binlog positions and the progress of the copy,
+// followed by the tables still being copied with their pagination key, the
+// tables pending verification and the dropped tables. At most maxTables
+// tables are listed per section, the remaining ones are summarized by a
+// single line. A maxTables of 0 or less lists every table.
+func (s *SerializableState) ReportWithLimit(maxTables int) string {
+	completed := make(map[string]bool)
+	for table, isCompleted := range s.CompletedTables {
+		if isCompleted {
+			completed[table] = true
+		}
+	}
+	for _, table := range s.OmittedCompletedTables {
+		completed[table] = true
+	}
+
+	pendingVerification := make([]string, 0)
+	for table, copyCompleted := range s.CopyCompletedTables {
+		if copyCompleted && !completed[table] {
+			pendingVerification = append(pendingVerification, table)
+		}
+	}
+	sort.Strings(pendingVerification)
+
+	inProgress := make([]string, 0)
+	for table := range s.LastSuccessfulPaginationKeys {
+		if !completed[table] && !s.CopyCompletedTables[table] {
+			inProgress = append(inProgress, table)
+		}
+	}
+	sort.Strings(inProgress)
+
+	// The tables that did not start copying yet are only known from the
+	// schema cache.
+	tables := make(map[string]bool)
+	for table := range s.LastKnownTableSchemaCache {
+		tables[table] = true
+	}
+	for table := range completed {
+		tables[table] = true
+	}
+	for _, table := range pendingVerification {
+		tables[table] = true
+	}
+	for _, table := range inProgress {
+		tables[table] = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Ghostferry version: %s\n", valueOrNone(s.GhostferryVersion))
+	if s.FinalizedAt.IsZero() {
+		fmt.Fprintf(&b, "Finalized at: not finalized\n")
+	} else {
+		fmt.Fprintf(&b, "Finalized at: %s\n", s.FinalizedAt.UTC().Format(time.RFC3339))
+	}
+	if s.Paused {
+		fmt.Fprintf(&b, "Paused: yes\n")
+	}
+	fmt.Fprintf(&b, "Binlog position: %s\n", formatBinlogPosition(s.LastWrittenBinlogPosition))
+	fmt.Fprintf(&b, "Inline verifier binlog position: %s\n", formatBinlogPosition(s.LastStoredBinlogPositionForInlineVerifier))
+	if s.LastWrittenCoordinate != nil {
+		if coordinate, err := s.LastWrittenCoordinate.Decode(); err == nil {
+			fmt.Fprintf(&b, "Last written coordinate: %s\n", coordinate)
+		} else {
+			fmt.Fprintf(&b, "Last written coordinate: unknown %s coordinate\n", s.LastWrittenCoordinate.Kind)
+		}
+	}
+	consumers := make([]string, 0, len(s.BinlogConsumerPositions))
+	for name := range s.BinlogConsumerPositions {
+		consumers = append(consumers, name)
+	}
+	sort.Strings(consumers)
+	for _, name := range consumers {
+		fmt.Fprintf(&b, "Binlog consumer %s position: %s\n", name, formatBinlogPosition(s.BinlogConsumerPositions[name]))
+	}
+	if len(consumers) > 0 {
+		fmt.Fprintf(&b, "Resumes from: %s\n", s.MinBinlogConsumerPosition())
+	}
+	for _, override := range s.BinlogPositionOverrides {
+		fmt.Fprintf(&b, "Binlog position overridden at %s: %s -> %s\n", override.At.UTC().Format(time.RFC3339), formatBinlogPosition(override.From), formatBinlogPosition(override.To))
+	}
+	fmt.Fprintf(&b, "Rows copied: %d\n", s.RowsCopied)
+	fmt.Fprintf(&b, "Tables: %d/%d completed, %d pending verification, %d in progress\n", len(completed), len(tables), len(pendingVerification), len(inProgress))
+
+	if len(inProgress) > 0 {
+		fmt.Fprintf(&b, "\nIn progress tables:\n")
+		for i, table := range inProgress {
+			if maxTables > 0 && i >= maxTables {
+				fmt.Fprintf(&b, "  ... and %d more tables\n", len(inProgress)-i)
+				break
+			}
+
+			fmt.Fprintf(&b, "  %s: pagination key %d", table, s.LastSuccessfulPaginationKeys[table])
+			if err, found := s.TableErrors[table]; found {
+				fmt.Fprintf(&b, " (last error: %s)", err)
+			}
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+
+	if len(pendingVerification) > 0 {
+		fmt.Fprintf(&b, "\nTables pending verification:\n")
+		for i, table := range pendingVerification {
+			if maxTables > 0 && i >= maxTables {
+				fmt.Fprintf(&b, "  ... and %d more tables\n", len(pendingVerification)-i)
+				break
+			}
+
+			fmt.Fprintf(&b, "  %s\n", table)
+		}
+	}
+
+	if len(s.DroppedTables) > 0 {
+		fmt.Fprintf(&b, "\nDropped tables:\n")
+		for i, table := range s.DroppedTables {
+			if maxTables > 0 && i >= maxTables {
+				fmt.Fprintf(&b, "  ... and %d more tables\n", len(s.DroppedTables)-i)
+				break
+			}
+
+			fmt.Fprintf(&b, "  %s\n", table)
+		}
+	}
+
+	return b.String()
+}
+
+func formatBinlogPosition(pos mysql.Position) string {
+	if pos == (mysql.Position{}) {
+		return "none"
+	}
+	return fmt.Sprintf("%s:%d", pos.Name, pos.Pos)
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,217 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// What a run resumed from a state would do, see SerializableState.ResumePlan.
+// The tables are sorted by name.
+type ResumePlan struct {
+	// The tables whose copy is skipped as it is complete.
+	CompletedTables []string
+
+	// The tables whose copy is skipped as it is complete but that still have
+	// to be verified, see StateTracker.MarkTableCopyComplete.
+	PendingVerificationTables []string
+
+	// The tables whose copy resumes where it stopped.
+	ResumingTables []ResumePlanTable
+
+	// The tables whose copy starts from the beginning, as the state has no
+	// progress for them.
+	NewTables []string
+
+	// The tables that are skipped as they were dropped from the source, see
+	// StateTracker.MarkTableDropped.
+	DroppedTables []string
+
+	// The tables with progress in the state that are not part of the run,
+	// such as the tables excluded by the TableFilter since the state was
+	// dumped. Their progress is ignored.
+	UnknownTables []string
+
+	// The binlog position the binlog streaming resumes from, see
+	// SerializableState.MinBinlogPosition.
+	BinlogPosition mysql.Position
+
+	// The reasons for an operator to double check the state before resuming
+	// from it. Empty if nothing stands out.
+	Warnings []string
+}
+
+type ResumePlanTable struct {
+	Table string
+
+	// The copy resumes after this pagination key.
+	LastSuccessfulPaginationKey uint64
+
+	// The number of ranges above LastSuccessfulPaginationKey that are already
+	// copied and are skipped, see StateTracker.MarkRangeComplete.
+	CompletedRanges int
+
+	// The last error of the table in the run the state was dumped from, if
+	// any.
+	LastError string
+}
+
+// Returns true if the plan has warnings.
+func (p ResumePlan) IsRisky() bool {
+	return len(p.Warnings) > 0
+}
+
+// Returns what a run of allTables resumed from the state would do: the tables
+// it skips, the ones it resumes and from which pagination key, and the binlog
+// position it resumes from. Nothing is started, so this can be shown to an
+// operator before resuming. allTables are the tables of the run, in the same
+// format as the keys of LastSuccessfulPaginationKeys.
+func (s *SerializableState) ResumePlan(allTables []string) ResumePlan {
+	plan := ResumePlan{
+		CompletedTables:           make([]string, 0),
+		PendingVerificationTables: make([]string, 0),
+		ResumingTables:            make([]ResumePlanTable, 0),
+		NewTables:                 make([]string, 0),
+		DroppedTables:             make([]string, 0),
+		UnknownTables:             make([]string, 0),
+		BinlogPosition:            s.MinBinlogPosition(),
+		Warnings:                  make([]string, 0),
+	}
+
+	dropped := make(map[string]bool, len(s.DroppedTables))
+	for _, table := range s.DroppedTables {
+		dropped[table] = true
+	}
+
+	completedRanges := make(map[string]int)
+	for table, ranges := range s.CompletedPaginationKeyRanges {
+		completedRanges[table] = len(ranges)
+	}
+	for table, bitmap := range s.CompletedPaginationKeyBitmaps {
+		ranges, err := unmarshalPaginationKeyBitmap(bitmap)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("the completed ranges of %s cannot be decoded and will be copied again: %v", table, err))
+			continue
+		}
+		completedRanges[table] = len(ranges.rangeList())
+	}
+
+	inRun := make(map[string]bool, len(allTables))
+	for _, table := range allTables {
+		inRun[table] = true
+
+		paginationKey, hasPaginationKey := s.LastSuccessfulPaginationKeys[table]
+		_, hasRanges := completedRanges[table]
+
+		switch {
+		case dropped[table]:
+			plan.DroppedTables = append(plan.DroppedTables, table)
+		case s.CompletedTables[table]:
+			plan.CompletedTables = append(plan.CompletedTables, table)
+		case s.CopyCompletedTables[table]:
+			plan.PendingVerificationTables = append(plan.PendingVerificationTables, table)
+		case hasPaginationKey || hasRanges:
+			plan.ResumingTables = append(plan.ResumingTables, ResumePlanTable{
+				Table:                       table,
+				LastSuccessfulPaginationKey: paginationKey,
+				CompletedRanges:             completedRanges[table],
+				LastError:                   s.TableErrors[table],
+			})
+		default:
+			plan.NewTables = append(plan.NewTables, table)
+		}
+	}
+
+	unknown := make(map[string]bool)
+	for table := range s.LastSuccessfulPaginationKeys {
+		unknown[table] = true
+	}
+	for table := range completedRanges {
+		unknown[table] = true
+	}
+	for table, completed := range s.CompletedTables {
+		if completed {
+			unknown[table] = true
+		}
+	}
+	for table, copyCompleted := range s.CopyCompletedTables {
+		if copyCompleted {
+			unknown[table] = true
+		}
+	}
+	for table := range unknown {
+		if !inRun[table] && !dropped[table] {
+			plan.UnknownTables = append(plan.UnknownTables, table)
+		}
+	}
+
+	sort.Strings(plan.CompletedTables)
+	sort.Strings(plan.PendingVerificationTables)
+	sort.Slice(plan.ResumingTables, func(i, j int) bool { return plan.ResumingTables[i].Table < plan.ResumingTables[j].Table })
+	sort.Strings(plan.NewTables)
+	sort.Strings(plan.DroppedTables)
+	sort.Strings(plan.UnknownTables)
+
+	if len(s.OmittedCompletedTables) > 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the state is incremental, %d completed tables are omitted and would be copied again unless it is merged with MergeIncrementalState", len(s.OmittedCompletedTables)))
+	}
+	if plan.BinlogPosition == (mysql.Position{}) {
+		plan.Warnings = append(plan.Warnings, "the state has no binlog position to resume from")
+	}
+	if s.LastKnownTableSchemaCacheOmitted {
+		if s.LastKnownTableSchemaHashes == nil {
+			plan.Warnings = append(plan.Warnings, "the state has no schema cache nor schema hashes, the schema it is resumed with cannot be verified")
+		} else {
+			plan.Warnings = append(plan.Warnings, "the state has no schema cache, it is resumed with the schema of the source or Ferry.TableSchemaCacheToResumeWith")
+		}
+	}
+	if len(s.BinlogPositionOverrides) > 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("the binlog position was overridden %d times, binlog events may have been skipped", len(s.BinlogPositionOverrides)))
+	}
+	if len(plan.UnknownTables) > 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%d tables with progress in the state are not part of the run", len(plan.UnknownTables)))
+	}
+	for _, table := range plan.ResumingTables {
+		if table.LastError != "" {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s failed in the previous run: %s", table.Table, table.LastError))
+		}
+	}
+
+	return plan
+}
+
+// Renders the plan as a text block meant to be read by an operator.
+func (p ResumePlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Binlog position: %s\n", formatBinlogPosition(p.BinlogPosition))
+	fmt.Fprintf(&b, "Tables: %d skipped as completed, %d skipped pending verification, %d resuming, %d starting, %d dropped\n", len(p.CompletedTables), len(p.PendingVerificationTables), len(p.ResumingTables), len(p.NewTables), len(p.DroppedTables))
+
+	if len(p.ResumingTables) > 0 {
+		fmt.Fprintf(&b, "\nResuming tables:\n")
+		for _, table := range p.ResumingTables {
+			fmt.Fprintf(&b, "  %s: after pagination key %d", table.Table, table.LastSuccessfulPaginationKey)
+			if table.CompletedRanges > 0 {
+				fmt.Fprintf(&b, ", skipping %d completed ranges", table.CompletedRanges)
+			}
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+
+	if len(p.UnknownTables) > 0 {
+		fmt.Fprintf(&b, "\nTables not part of the run:\n")
+		for _, table := range p.UnknownTables {
+			fmt.Fprintf(&b, "  %s\n", table)
+		}
+	}
+
+	if len(p.Warnings) > 0 {
+		fmt.Fprintf(&b, "\nWarnings:\n")
+		for _, warning := range p.Warnings {
+			fmt.Fprintf(&b, "  %s\n", warning)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The version of the format of the schema caches stored by a
+// SchemaCacheStore. A schema cache of an unknown version is rejected on load.
+const schemaCacheFormatVersion = 1
+
+// A SchemaCacheStore persists schema caches separately from the progress of
+// a run, see SplitSchemaStateStore.
+//
+// Schema caches are content addressed: the reference of a cache is the
+// CombinedSchemaHash of its tables, so a stored cache never changes and is
+// shared by every state that references it, including the older generations
+// of a VersionedStateStore. The schema caches are never deleted by
+// Ghostferry.
+type SchemaCacheStore interface {
+	// Stores the cache under the reference. Storing a reference again has no
+	// effect.
+	StoreSchemaCache(ref string, cache TableSchemaCache) error
+
+	// Returns the cache stored under the reference, or nil if there is none.
+	LoadSchemaCache(ref string) (TableSchemaCache, error)
+}
+
+// The stored form of a schema cache.
+type storedSchemaCache struct {
+	FormatVersion int
+	Ref           string
+	Cache         TableSchemaCache
+}
+
+// Returns the reference of the cache in a SchemaCacheStore.
+func SchemaCacheRef(cache TableSchemaCache) (string, error) {
+	hashes, err := cache.SchemaHashes()
+	if err != nil {
+		return "", err
+	}
+
+	return CombinedSchemaHash(hashes), nil
+}
+
+// SplitSchemaStateStore stores the LastKnownTableSchemaCache of the states in
+// a SchemaCacheStore, only when the schema changes, and the rest of the
+// states in a StateStore. The schema cache is usually large and rarely
+// changes while the progress changes with every checkpoint, so this saves
+// rewriting the schema on every checkpoint.
+//
+// The states in the StateStore have no LastKnownTableSchemaCache: they
+// reference it by LastKnownTableSchemaCacheRef instead. The loaded states
+// are combined with their schema cache and can be resumed from as usual, but
+// a state loaded from the StateStore directly cannot.
+type SplitSchemaStateStore struct {
+	StateStore       StateStore
+	SchemaCacheStore SchemaCacheStore
+
+	mutex         sync.Mutex
+	lastStoredRef string
+}
+
+func (s *SplitSchemaStateStore) StoreState(state *SerializableState) error {
+	if state.LastKnownTableSchemaCache == nil || state.LastKnownTableSchemaCacheRef != "" {
+		return s.StateStore.StoreState(state)
+	}
+
+	ref, err := SchemaCacheRef(state.LastKnownTableSchemaCache)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The schema cache must be stored before the state that references it.
+	if ref != s.lastStoredRef {
+		err = s.SchemaCacheStore.StoreSchemaCache(ref, state.LastKnownTableSchemaCache)
+		if err != nil {
+			return fmt.Errorf("during storing schema cache %s: %v", ref, err)
+		}
+		s.lastStoredRef = ref
+	}
+
+	progress := *state
+	progress.LastKnownTableSchemaCache = nil
+	progress.LastKnownTableSchemaCacheRef = ref
+	return s.StateStore.StoreState(&progress)
+}
+
+func (s *SplitSchemaStateStore) LoadState() (*SerializableState, error) {
+	state, err := s.StateStore.LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.combine(state)
+}
+
+// Requires the StateStore to be a VersionedStateStore.
+func (s *SplitSchemaStateStore) ListGenerations() ([]uint64, error) {
+	versionedStore, ok := s.StateStore.(VersionedStateStore)
+	if !ok {
+		return nil, fmt.Errorf("the StateStore of the SplitSchemaStateStore is not versioned")
+	}
+
+	return versionedStore.ListGenerations()
+}
+
+// Requires the StateStore to be a VersionedStateStore.
+func (s *SplitSchemaStateStore) LoadStateGeneration(generation uint64) (*SerializableState, error) {
+	versionedStore, ok := s.StateStore.(VersionedStateStore)
+	if !ok {
+		return nil, fmt.Errorf("the StateStore of the SplitSchemaStateStore is not versioned")
+	}
+
+	state, err := versionedStore.LoadStateGeneration(generation)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.combine(state)
+}
+
+func (s *SplitSchemaStateStore) combine(state *SerializableState) (*SerializableState, error) {
+	if state == nil || state.LastKnownTableSchemaCacheRef == "" {
+		return state, nil
+	}
+
+	cache, err := s.SchemaCacheStore.LoadSchemaCache(state.LastKnownTableSchemaCacheRef)
+	if err != nil {
+		return nil, fmt.Errorf("during loading schema cache %s: %v", state.LastKnownTableSchemaCacheRef, err)
+	}
+
+	if cache == nil {
+		return nil, fmt.Errorf("schema cache %s referenced by the state is missing", state.LastKnownTableSchemaCacheRef)
+	}
+
+	ref, err := SchemaCacheRef(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref != state.LastKnownTableSchemaCacheRef {
+		return nil, fmt.Errorf("schema cache %s is corrupted, its contents hash to %s", state.LastKnownTableSchemaCacheRef, ref)
+	}
+
+	state.LastKnownTableSchemaCache = cache
+	state.LastKnownTableSchemaCacheRef = ""
+	return state, nil
+}
+
+// FileSchemaCacheStore stores each schema cache as a JSON file named after
+// its reference in Dir.
+type FileSchemaCacheStore struct {
+	Dir string
+}
+
+func (s *FileSchemaCacheStore) StoreSchemaCache(ref string, cache TableSchemaCache) error {
+	path := s.path(ref)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(storedSchemaCache{
+		FormatVersion: schemaCacheFormatVersion,
+		Ref:           ref,
+		Cache:         cache,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file first, so a partially written schema cache
+	// is never loaded.
+	tmpFile, err := ioutil.TempFile(s.Dir, "schema-cache-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func (s *FileSchemaCacheStore) LoadSchemaCache(ref string) (TableSchemaCache, error) {
+	data, err := ioutil.ReadFile(s.path(ref))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored := storedSchemaCache{}
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.FormatVersion != schemaCacheFormatVersion {
+		return nil, fmt.Errorf("unsupported schema cache format version %d", stored.FormatVersion)
+	}
+
+	if stored.Ref != ref {
+		return nil, fmt.Errorf("schema cache file for %s contains schema cache %s", ref, stored.Ref)
+	}
+
+	return stored.Cache, nil
+}
+
+func (s *FileSchemaCacheStore) path(ref string) string {
+	return filepath.Join(s.Dir, "schema-cache-"+ref+".json")
+}
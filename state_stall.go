@@ -0,0 +1,101 @@
+package ghostferry
+
+import (
+	"context"
+	"time"
+)
+
+// Sets the time without copy progress after which the copy is considered
+// stalled, see IsStalled, such as when it waits on a lock or is throttled
+// indefinitely. The copy progresses with every update moving the last
+// successful pagination key of a table forward and with every table
+// completed. The time is counted from the last progress, or from the first
+// call of SetStallThreshold if there was none since. A threshold of 0
+// disables the stall detection, which is the default.
+func (s *StateTracker) SetStallThreshold(threshold time.Duration) {
+	s.lockCopy("SetStallThreshold")
+	defer s.copyMutex.Unlock()
+
+	s.stallThreshold = threshold
+	if s.stallClockStartedAt.IsZero() {
+		s.stallClockStartedAt = time.Now()
+	}
+}
+
+// Returns true if the copy made no progress for longer than the threshold set
+// with SetStallThreshold. The copy is never stalled while the tracker is
+// paused, see Pause, once the copy of every table known to the tracker is
+// complete, or once the tracker is finalized. The tables known to the tracker
+// are the tables with copy progress or a size, see SetTableSizes, which the
+// DataIterator sets for every table it copies, so a copy which did not start
+// any table is stalled.
+func (s *StateTracker) IsStalled() bool {
+	s.milestonesMutex.Lock()
+	tableSizes := s.tableSizes
+	s.milestonesMutex.Unlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if s.stallThreshold <= 0 || !s.FinalizedAt().IsZero() || !s.pausedAt.IsZero() {
+		return false
+	}
+
+	if s.copyCompleteUnlocked(tableSizes) {
+		return false
+	}
+
+	lastProgressAt := s.lastProgressAt
+	if lastProgressAt.IsZero() {
+		lastProgressAt = s.stallClockStartedAt
+	}
+	return time.Since(lastProgressAt) > s.stallThreshold
+}
+
+func (s *StateTracker) copyCompleteUnlocked(tableSizes map[string]uint64) bool {
+	known := false
+	for _, tables := range []map[string]uint64{s.lastSuccessfulPaginationKeys, tableSizes} {
+		for table := range tables {
+			if !s.isTableCopiedUnlocked(table) && !s.droppedTables[table] {
+				return false
+			}
+			known = true
+		}
+	}
+
+	return known || len(s.completedTables) > 0 || len(s.copyCompletedTables) > 0
+}
+
+// Starts a goroutine checking whether the copy is stalled at every interval,
+// until the context is done or the tracker is finalized. The stall is logged
+// and OnStall is called when the copy becomes stalled, and not again until it
+// made progress in between.
+func (s *StateTracker) StartStallMonitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		stalled := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ctx.Err() != nil || !s.FinalizedAt().IsZero() {
+					return
+				}
+
+				wasStalled := stalled
+				stalled = s.IsStalled()
+				if !stalled || wasStalled {
+					continue
+				}
+
+				s.logger.Warn("the copy made no progress for longer than the stall threshold")
+				if s.OnStall != nil {
+					s.OnStall()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,292 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Returned by StoreState when the state is not newer than the stored state,
+// i.e. its Generation is not greater. The stored state is then left as is:
+// this usually means that another process, such as a process thought to be
+// dead, is storing the states of the same run, and the states of one of the
+// processes are lost either way.
+var ErrStaleStateGeneration = errors.New("the state is not newer than the stored state")
+
+// A StateStore persists the serialized state of a run so it can be resumed
+// from after Ghostferry is interrupted. Ghostferry ships the MySQLStateStore
+// and the RedisStateStore, shared by the processes of many runs, and the
+// FileStateStore for a single process. Other backends, such as object or
+// key-value stores, only need to implement these two methods.
+type StateStore interface {
+	// Stores the state, replacing the previously stored state. Should return
+	// ErrStaleStateGeneration, and keep the stored state, if the state has a
+	// Generation which is not greater than that of the stored state.
+	StoreState(state *SerializableState) error
+
+	// Returns the last stored state, or nil if no state was stored.
+	LoadState() (*SerializableState, error)
+}
+
+// A VersionedStateStore keeps some of the previously stored states, each
+// identified by a generation number which increases with every StoreState.
+// This allows resuming from an older state after discovering a problem, by
+// loading the state of the desired generation into Config.StateToResumeFrom.
+// The Generation of the older state must then be set to that of the last
+// stored state, as the states of the resumed run are otherwise stale.
+//
+// The generations of the store count the stored states, and are unrelated to
+// the SerializableState.Generation.
+type VersionedStateStore interface {
+	StateStore
+
+	// Returns the generations that are available, in increasing order.
+	ListGenerations() ([]uint64, error)
+
+	// Returns the state of the generation, or nil if the generation is not
+	// available.
+	LoadStateGeneration(generation uint64) (*SerializableState, error)
+}
+
+// MySQLStateStore stores the states as JSON blobs in a table, with one row
+// per run and generation. This is usually a table on the target database, so
+// the state of the run lives with the data that it copied and does not
+// require external storage.
+//
+// The SerializableState.Generation of the states is stored alongside them,
+// and compared and set in the same transaction, such that concurrent
+// processes cannot replace a state by an older one.
+type MySQLStateStore struct {
+	DB       *sql.DB
+	Database string
+	Table    string
+
+	// Identifies the run. Runs with different RunIDs can share the same
+	// table.
+	RunID string
+
+	// The number of generations to keep. Older generations are deleted when a
+	// state is stored.
+	//
+	// Optional: defaults to 1
+	KeepGenerations int
+}
+
+// Creates the state table if it does not exist.
+func (s *MySQLStateStore) Initialize() error {
+	if s.RunID == "" {
+		return fmt.Errorf("MySQLStateStore requires a RunID")
+	}
+
+	if s.KeepGenerations == 0 {
+		s.KeepGenerations = 1
+	}
+
+	if s.KeepGenerations < 0 {
+		return fmt.Errorf("MySQLStateStore KeepGenerations cannot be negative")
+	}
+
+	query := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s ("+
+			"run_id VARCHAR(255) NOT NULL, "+
+			"generation BIGINT UNSIGNED NOT NULL, "+
+			"state LONGBLOB NOT NULL, "+
+			"state_generation BIGINT UNSIGNED NOT NULL DEFAULT 0, "+
+			"created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, "+
+			"PRIMARY KEY (run_id, generation))",
+		s.quotedTable(),
+	)
+
+	_, err := s.DB.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to create state table %s: %v", s.quotedTable(), err)
+	}
+
+	// The tables created by older versions do not have the state_generation.
+	query, args, err := sq.
+		Select("COUNT(*)").
+		From("information_schema.columns").
+		Where(sq.Eq{"table_schema": s.Database, "table_name": s.Table, "column_name": "state_generation"}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var columns int
+	err = s.DB.QueryRow(query, args...).Scan(&columns)
+	if err != nil {
+		return fmt.Errorf("failed to read the columns of state table %s: %v", s.quotedTable(), err)
+	}
+
+	if columns == 0 {
+		_, err = s.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN state_generation BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER state", s.quotedTable()))
+		if err != nil {
+			return fmt.Errorf("failed to add the state_generation to state table %s: %v", s.quotedTable(), err)
+		}
+	}
+
+	return nil
+}
+
+// Stores the state as a new generation and deletes the generations that are
+// no longer to be kept, in a single transaction. Returns
+// ErrStaleStateGeneration if the state has a Generation and the stored state
+// has a greater or equal one. States without a Generation are always stored.
+func (s *MySQLStateStore) StoreState(state *SerializableState) error {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction in MySQLStateStore: %v", err)
+	}
+
+	// Locks the rows of the run, so concurrent stores of the same run cannot
+	// pick the same generation nor both pass the comparison of the
+	// state_generation.
+	query, args, err := sq.
+		Select("COALESCE(MAX(generation), 0)", "COALESCE(MAX(state_generation), 0)").
+		From(s.quotedTable()).
+		Where(sq.Eq{"run_id": s.RunID}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var lastGeneration, lastStateGeneration uint64
+	err = tx.QueryRow(query, args...).Scan(&lastGeneration, &lastStateGeneration)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("during reading the last generation of run %s: %v", s.RunID, err)
+	}
+
+	if state.Generation != 0 && state.Generation <= lastStateGeneration {
+		tx.Rollback()
+		return ErrStaleStateGeneration
+	}
+
+	generation := lastGeneration + 1
+	query, args, err = sq.
+		Insert(s.quotedTable()).
+		Columns("run_id", "generation", "state", "state_generation").
+		Values(s.RunID, generation, stateBytes, state.Generation).
+		ToSql()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("during storing generation %d of run %s: %v", generation, s.RunID, err)
+	}
+
+	if generation > uint64(s.KeepGenerations) {
+		query, args, err = sq.
+			Delete(s.quotedTable()).
+			Where(sq.Eq{"run_id": s.RunID}).
+			Where(sq.LtOrEq{"generation": generation - uint64(s.KeepGenerations)}).
+			ToSql()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(query, args...)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("during deleting old generations of run %s: %v", s.RunID, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("during commit of generation %d of run %s: %v", generation, s.RunID, err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStateStore) LoadState() (*SerializableState, error) {
+	return s.loadState(sq.
+		Select("state").
+		From(s.quotedTable()).
+		Where(sq.Eq{"run_id": s.RunID}).
+		OrderBy("generation DESC").
+		Limit(1))
+}
+
+func (s *MySQLStateStore) LoadStateGeneration(generation uint64) (*SerializableState, error) {
+	return s.loadState(sq.
+		Select("state").
+		From(s.quotedTable()).
+		Where(sq.Eq{"run_id": s.RunID, "generation": generation}))
+}
+
+func (s *MySQLStateStore) ListGenerations() ([]uint64, error) {
+	query, args, err := sq.
+		Select("generation").
+		From(s.quotedTable()).
+		Where(sq.Eq{"run_id": s.RunID}).
+		OrderBy("generation").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	generations := make([]uint64, 0)
+	for rows.Next() {
+		var generation uint64
+		err = rows.Scan(&generation)
+		if err != nil {
+			return generations, err
+		}
+
+		generations = append(generations, generation)
+	}
+
+	return generations, rows.Err()
+}
+
+func (s *MySQLStateStore) loadState(selectBuilder sq.SelectBuilder) (*SerializableState, error) {
+	query, args, err := selectBuilder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var stateBytes []byte
+	err = s.DB.QueryRow(query, args...).Scan(&stateBytes)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	state := &SerializableState{}
+	err = json.Unmarshal(stateBytes, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *MySQLStateStore) quotedTable() string {
+	return QuotedTableNameFromString(s.Database, s.Table)
+}
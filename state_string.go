@@ -0,0 +1,83 @@
+package ghostferry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// The prefix of the states encoded by ToString, followed by the JSON encoded
+// state compressed with gzip, as unpadded URL-safe base64. The CRC-32 of
+// gzip detects a truncated or corrupted string.
+const stateStringPrefix = "gfstate1:"
+
+var ErrNotStateString = errors.New("string is not a serialized state")
+
+// Encodes the state as a single line of printable characters, which can be
+// passed through an environment variable, a command-line argument or a JSON
+// config, and decoded back with SerializableStateFromString. The string only
+// has letters, digits and "-", "_" and ":", so does not need to be quoted.
+//
+// The state is compressed, but its size is still mostly that of the
+// LastKnownTableSchemaCache. This is only suitable for states of small
+// schemas: a single environment variable or argument is limited to 128KiB on
+// Linux and all of them to 2MiB in total, and to 32KiB on Windows.
+// A state with a large schema cache should be stored in a file or a
+// StateStore instead, or serialized with SerializeProgressOnly.
+func (s *SerializableState) ToString() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	compressed := &bytes.Buffer{}
+	w := gzip.NewWriter(compressed)
+	_, err = w.Write(data)
+	if err != nil {
+		return "", err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return stateStringPrefix + base64.RawURLEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// Decodes a state encoded by SerializableState.ToString. Whitespace around
+// the string, such as a trailing newline, is ignored.
+func SerializableStateFromString(str string) (*SerializableState, error) {
+	str = strings.TrimSpace(str)
+	if !strings.HasPrefix(str, stateStringPrefix) {
+		return nil, ErrNotStateString
+	}
+
+	compressed, err := base64.RawURLEncoding.DecodeString(str[len(stateStringPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the state string: %v", err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the state string: %v", err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the state string, it may be truncated: %v", err)
+	}
+
+	state := &SerializableState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
@@ -2,11 +2,18 @@ package ghostferry
 
 import (
 	"container/ring"
+	"context"
+	"fmt"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
 )
 
 // StateTracker design
@@ -34,195 +41,5175 @@ type SerializableState struct {
 	GhostferryVersion         string
 	LastKnownTableSchemaCache TableSchemaCache
 
+	// Hashes of LastKnownTableSchemaCache, used to cheaply detect schema
+	// drift. See TablesWithSchemaDrift.
+	LastKnownTableSchemaCacheHash string
+	LastKnownTableSchemaHashes    map[string]string
+
+	// If true, LastKnownTableSchemaCache was scrubbed by a StateRedactor and
+	// is only informational: the schema is reloaded from the source on
+	// resume.
+	LastKnownTableSchemaCacheRedacted bool
+
+	// Set by the SplitSchemaStateStore to the SchemaCacheRef of
+	// LastKnownTableSchemaCache, which is then stored separately and left out
+	// of the state. A state with a reference must be loaded via the
+	// SplitSchemaStateStore to be resumed from.
+	LastKnownTableSchemaCacheRef string
+
+	// If true, the state was serialized by SerializeProgressOnly and has no
+	// LastKnownTableSchemaCache. See SerializeProgressOnly for the schema it
+	// is resumed with.
+	LastKnownTableSchemaCacheOmitted bool
+
 	LastSuccessfulPaginationKeys              map[string]uint64
+	FirstPaginationKeys                       map[string]uint64
+	CompletedPaginationKeyRanges              map[string][][2]uint64
 	CompletedTables                           map[string]bool
+	CopyCompletedTables                       map[string]bool
+	TablesNearKeyExhaustion                   []string
+	TableErrors                               map[string]string
 	LastWrittenBinlogPosition                 mysql.Position
 	LastStoredBinlogPositionForInlineVerifier mysql.Position
 	BinlogVerifyStore                         BinlogVerifySerializedStore
+
+	// Arbitrary metadata attached by the application embedding Ghostferry via
+	// StateTracker.SetMetadata, such as a ticket ID or the operator's name.
+	// Ghostferry carries it across resumes untouched and ignores its contents.
+	Metadata map[string]string
+
+	// Maintenance pauses requested via StateTracker.Pause. The paused time is
+	// excluded from the copy speed estimations. A tracker resumed from a
+	// paused state is paused until Resume is called, as the pause was not
+	// over when the state was serialized.
+	Paused              bool
+	TotalPausedDuration time.Duration
+
+	// The time spent in each phase (see StateTracker.SetPhase), including the
+	// time spent in the current phase until the state was serialized.
+	PhaseDurations map[string]time.Duration
+
+	// The number of rows copied, as reported via StateTracker.UpdateBatch.
+	RowsCopied uint64
+
+	// Set if the state was serialized after StateTracker.Finalize, which the
+	// Ferry calls once the run completed cleanly. The zero time otherwise.
+	FinalizedAt time.Time
+
+	// Set by StateTracker.SerializeIncremental to the completed tables left
+	// out of the state, which must be merged with MergeIncrementalState.
+	OmittedCompletedTables []string
+
+	// The binlog positions overridden by an operator when resuming, in order,
+	// see WithBinlogPositionOverride. Carried across resumes for auditing.
+	BinlogPositionOverrides []BinlogPositionOverride
+
+	// The times, from the binlog event headers, of the earliest and latest
+	// binlog events applied to the target. The zero time if none were.
+	EarliestAppliedEventTime time.Time
+	LatestAppliedEventTime   time.Time
+
+	// The names of the CompletionPredicates of the tables not using the
+	// default, see StateTracker.SetCompletionPredicate.
+	CompletionPredicates map[string]string
+
+	// The completed tables not verified yet, when the verification queue is
+	// enabled, see StateTracker.PopCompletedForVerification. Sorted by name.
+	UnverifiedCompletedTables []string
+
+	// The tables dropped from the source during the run, see
+	// StateTracker.MarkTableDropped. Sorted by name.
+	DroppedTables []string
+
+	// The CompletedPaginationKeyRanges of the tables whose ranges are too
+	// fragmented to be stored as ranges, as bitmaps of the completed
+	// pagination keys instead. A table is in at most one of the two.
+	CompletedPaginationKeyBitmaps map[string][]byte
+
+	// The entries of the speed log, oldest first, such that the speed
+	// estimations of a resumed run do not start over. See
+	// NewStateTrackerFromSerializedState.
+	SpeedLog []PaginationKeyPositionLog
+
+	// The tables paused with StateTracker.PauseTable, which stay paused on
+	// resume. Sorted by name.
+	PausedTables []string
+
+	// If true, CompletedTables is encoded in JSON as a sorted list of the
+	// completed tables rather than as a map, which is about half the size.
+	// Both forms are decoded, and this is set when the list form is. Set by
+	// Serialize from StateTracker.CompactCompletedTables.
+	CompactCompletedTables bool `json:"-"`
+
+	// The binlog positions of the consumers registered with
+	// StateTracker.RegisterBinlogConsumer, keyed by name. Part of
+	// MinBinlogPosition.
+	BinlogConsumerPositions map[string]mysql.Position
+
+	// The number of rows copied from each table, including the tables whose
+	// copy completed, for reconciling against the row counts of the source
+	// and target once the run is done. Only set if
+	// StateTracker.TrackTableRowsCopied is.
+	TableRowsCopied map[string]uint64 `json:",omitempty"`
+
+	// The last written coordinate, if the tracker tracks coordinates of
+	// another kind than BinlogFileCoordinate, in which case the binlog
+	// positions are unset. See StateTracker.UpdateLastWrittenCoordinate.
+	LastWrittenCoordinate *SerializedReplicationCoordinate `json:",omitempty"`
+
+	// The pagination key ranges, both ends inclusive, excluded from the copy
+	// of each table not completed yet, see
+	// StateTracker.ExcludePaginationKeyRange. Sorted and non-overlapping.
+	ExcludedPaginationKeyRanges map[string][][2]uint64 `json:",omitempty"`
+
+	// The milestones of the OverallProgress already reached, sorted, such
+	// that a resumed run does not notify them again. See
+	// StateTracker.OnMilestone.
+	ReachedMilestones []float64 `json:",omitempty"`
+
+	// The tables which must be completed before the copy of each table
+	// starts, see StateTracker.SetTableDependencies.
+	TableDependencies map[string][]string `json:",omitempty"`
+
+	// The progress of the cleanup pass deleting rows from the target, see
+	// StateTracker.UpdateLastCleanedPaginationKey. Independent of the copy
+	// progress. CleanedTables is sorted by name.
+	LastCleanedPaginationKeys map[string]uint64 `json:",omitempty"`
+	CleanedTables             []string          `json:",omitempty"`
+
+	// Increases with every Serialize of the tracker, including the trackers
+	// resumed from the state, such that a StateStore can reject a state
+	// older than the one it stores. 0 for states from older versions.
+	Generation uint64 `json:",omitempty"`
+
+	// The MySQL GTID set of the transactions written before the
+	// LastWrittenBinlogPosition, as a string such as "uuid:1-100", if the
+	// source has GTIDs enabled. Unlike the binlog position, it remains valid
+	// after the source fails over to a replica. See MinGTIDSet.
+	LastWrittenGTIDSet string `json:",omitempty"`
+
+	// The LastWrittenBinlogPosition when the copy of each table completed, see
+	// StateTracker.BinlogPositionAtTableCompletion.
+	TableCompletionBinlogPositions map[string]mysql.Position `json:",omitempty"`
+
+	// The LastKnownTableSchemaCache as JSON compressed with gzip, in place of
+	// the LastKnownTableSchemaCache, see StateTracker.SerializeCompressed.
+	LastKnownTableSchemaCacheCompressed []byte `json:",omitempty"`
+
+	// The number of rows of each table skipped by a filter or deleted from
+	// the source during the run, see StateTracker.IncrementSkippedRows and
+	// StateTracker.IncrementDeletedRows.
+	SkippedRows map[string]uint64 `json:",omitempty"`
+	DeletedRows map[string]uint64 `json:",omitempty"`
+}
+
+// Records that the binlog streaming was resumed from To instead of the stored
+// From position, skipping the events in between.
+type BinlogPositionOverride struct {
+	From mysql.Position
+	To   mysql.Position
+	At   time.Time
+}
+
+// Returns a copy of the state whose binlog positions are replaced by pos, with
+// the override recorded in BinlogPositionOverrides. Both the binlog writer
+// and the inline verifier resume from pos, so the binlog events between the
+// stored positions and pos are skipped. The state itself is not modified.
+func (s *SerializableState) WithBinlogPositionOverride(pos mysql.Position, at time.Time) *SerializableState {
+	state := *s
+	state.BinlogPositionOverrides = append(append([]BinlogPositionOverride(nil), s.BinlogPositionOverrides...), BinlogPositionOverride{
+		From: s.MinBinlogPosition(),
+		To:   pos,
+		At:   at,
+	})
+	state.LastWrittenBinlogPosition = pos
+	state.LastStoredBinlogPositionForInlineVerifier = pos
+	if len(s.BinlogConsumerPositions) > 0 {
+		state.BinlogConsumerPositions = make(map[string]mysql.Position, len(s.BinlogConsumerPositions))
+		for name := range s.BinlogConsumerPositions {
+			state.BinlogConsumerPositions[name] = pos
+		}
+	}
+	return &state
+}
+
+// Returns the earliest binlog position still needed by any of the components
+// consuming the binlog: the binlog writer, the inline verifier and the
+// registered binlog consumers. The run resumes from there. Unset positions
+// are ignored.
+func (s *SerializableState) MinBinlogPosition() mysql.Position {
+	return s.MinBinlogConsumerPosition().Position
+}
+
+// Returns the GTID set the binlog streaming resumes from, the GTID-aware
+// equivalent of MinBinlogPosition, or nil if the binlog streaming must resume
+// from the MinBinlogPosition instead: when the state has no GTID set, or when
+// another binlog consumer, such as the inline verifier, is behind the binlog
+// writer, as the GTID set is only tracked for the binlog writer.
+func (s *SerializableState) MinGTIDSet() (mysql.GTIDSet, error) {
+	if s.LastWrittenGTIDSet == "" {
+		return nil, nil
+	}
+
+	if s.MinBinlogConsumerPosition().Consumer != BinlogWriterConsumer && s.MinBinlogPosition() != (mysql.Position{}) {
+		return nil, nil
+	}
+
+	return mysql.ParseMysqlGTIDSet(s.LastWrittenGTIDSet)
+}
+
+// Returns the coordinate the run resumes from: the MinBinlogPosition as a
+// BinlogFileCoordinate, or the LastWrittenCoordinate if set.
+func (s *SerializableState) MinReplicationCoordinate() (ReplicationCoordinate, error) {
+	if s.LastWrittenCoordinate != nil {
+		return s.LastWrittenCoordinate.Decode()
+	}
+	return BinlogFileCoordinate(s.MinBinlogPosition()), nil
+}
+
+// Returns the MinBinlogPosition along with the consumer holding it, to
+// explain the position the run resumes from.
+func (s *SerializableState) MinBinlogConsumerPosition() BinlogConsumerPosition {
+	return minBinlogConsumerPosition(s.LastWrittenBinlogPosition, s.LastStoredBinlogPositionForInlineVerifier, s.BinlogConsumerPositions)
+}
+
+// The names of the built-in binlog consumers in a BinlogConsumerPosition,
+// which cannot be used by the consumers registered with
+// StateTracker.RegisterBinlogConsumer.
+const (
+	BinlogWriterConsumer   = "binlog_writer"
+	InlineVerifierConsumer = "inline_verifier"
+)
+
+// The binlog position of a binlog consumer, see MinBinlogConsumerPosition.
+// The zero value if no consumer has a position.
+type BinlogConsumerPosition struct {
+	Consumer string
+	Position mysql.Position
+}
+
+func (p BinlogConsumerPosition) String() string {
+	if p.Consumer == "" {
+		return "none"
+	}
+	return fmt.Sprintf("%s at %s:%d", p.Consumer, p.Position.Name, p.Position.Pos)
+}
+
+// Returns the earliest of the set positions. The consumers are visited in a
+// fixed order, the binlog writer, the inline verifier and then the registered
+// consumers by name, and the first one at the earliest position holds it, so
+// the result does not depend on the iteration order of the map.
+func minBinlogConsumerPosition(binlogWriter, inlineVerifier mysql.Position, consumers map[string]mysql.Position) BinlogConsumerPosition {
+	var min BinlogConsumerPosition
+	visit := func(consumer string, pos mysql.Position) {
+		if pos == (mysql.Position{}) {
+			return
+		}
+
+		if min.Consumer == "" || compareBinlogPositions(pos, min.Position) < 0 {
+			min = BinlogConsumerPosition{Consumer: consumer, Position: pos}
+		}
+	}
+
+	visit(BinlogWriterConsumer, binlogWriter)
+	visit(InlineVerifierConsumer, inlineVerifier)
+
+	names := make([]string, 0, len(consumers))
+	for name := range consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name, consumers[name])
+	}
+
+	return min
+}
+
+// Returns the tables whose schema in current differs from the
+// LastKnownTableSchemaCache, including tables that only exist in one of them.
+// The combined hash is compared first, so the common case of no drift only
+// requires hashing the current schema. States serialized without hashes are
+// hashed on the fly from LastKnownTableSchemaCache.
+func (s *SerializableState) TablesWithSchemaDrift(current TableSchemaCache) ([]string, error) {
+	currentHashes, err := current.SchemaHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	lastKnownHashes := s.LastKnownTableSchemaHashes
+	lastKnownHash := s.LastKnownTableSchemaCacheHash
+	if lastKnownHashes == nil {
+		lastKnownHashes, err = s.LastKnownTableSchemaCache.SchemaHashes()
+		if err != nil {
+			return nil, err
+		}
+		lastKnownHash = CombinedSchemaHash(lastKnownHashes)
+	}
+
+	driftedTables := make([]string, 0)
+	if CombinedSchemaHash(currentHashes) == lastKnownHash {
+		return driftedTables, nil
+	}
+
+	for tableName, hash := range currentHashes {
+		if lastKnownHashes[tableName] != hash {
+			driftedTables = append(driftedTables, tableName)
+		}
+	}
+
+	for tableName := range lastKnownHashes {
+		if _, found := currentHashes[tableName]; !found {
+			driftedTables = append(driftedTables, tableName)
+		}
+	}
+
+	sort.Strings(driftedTables)
+	return driftedTables, nil
+}
+
+// Returns the tables of current that are not part of the schema the state
+// was serialized with, i.e. the tables created after the run started. The
+// tables are identified by the LastKnownTableSchemaHashes or, for the states
+// serialized without hashes, by the LastKnownTableSchemaCache. A state with
+// neither does not know its schema, and every table is considered known.
+func (s *SerializableState) NewTables(current TableSchemaCache) []string {
+	newTables := make([]string, 0)
+	if s.LastKnownTableSchemaHashes == nil && s.LastKnownTableSchemaCache == nil {
+		return newTables
+	}
+
+	for tableName := range current {
+		if _, found := s.LastKnownTableSchemaHashes[tableName]; found {
+			continue
+		}
+		if _, found := s.LastKnownTableSchemaCache[tableName]; found {
+			continue
+		}
+		newTables = append(newTables, tableName)
+	}
+
+	sort.Strings(newTables)
+	return newTables
+}
+
+// Returns an error detailing how the schema of the tables still in progress
+// changed in current since the state was serialized, if their primary key,
+// pagination key or columns changed, or if they no longer exist. The
+// LastSuccessfulPaginationKeys of such a table may no longer point to the
+// same rows, and resuming from them can skip or copy rows twice. Completed
+// and dropped tables are not resumed and are not validated, nor are the
+// tables created after the state was serialized. A state without its
+// LastKnownTableSchemaCache cannot be validated, see TablesWithSchemaDrift.
+func (s *SerializableState) ValidateAgainst(current TableSchemaCache) error {
+	changes := make([]string, 0)
+	for _, tableName := range s.tablesInProgress() {
+		lastKnown := s.LastKnownTableSchemaCache[tableName]
+		table, found := current[tableName]
+		if !found {
+			changes = append(changes, fmt.Sprintf("%s: the table no longer exists", tableName))
+			continue
+		}
+
+		for _, change := range tableSchemaChanges(lastKnown, table) {
+			changes = append(changes, fmt.Sprintf("%s: %s", tableName, change))
+		}
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("the schema of the tables in progress changed since the state was serialized: %s", strings.Join(changes, "; "))
+	}
+
+	return nil
+}
+
+// Same as ValidateAgainst, but against the schema of the target tables the
+// tables in progress are copied to, see TargetTablesInProgress, as the rows
+// already copied to a target table that changed may no longer match the rows
+// of the source. The target is keyed by the names of the target tables. The
+// column types are compared as they are displayed, so a target on a version
+// of MySQL which displays them differently fails the validation.
+func (s *SerializableState) ValidateTargetAgainst(target TableSchemaCache, databaseRewrites, tableRewrites map[string]string) error {
+	targetTables := s.TargetTablesInProgress(databaseRewrites, tableRewrites)
+
+	changes := make([]string, 0)
+	for _, tableName := range s.tablesInProgress() {
+		targetTable, found := targetTables[tableName]
+		if !found {
+			continue
+		}
+
+		targetTableName := fullTableName(targetTable.SchemaName, targetTable.TableName)
+		table, found := target[targetTableName]
+		if !found {
+			changes = append(changes, fmt.Sprintf("%s: the target table %s no longer exists", tableName, targetTableName))
+			continue
+		}
+
+		for _, change := range tableSchemaChanges(s.LastKnownTableSchemaCache[tableName], table) {
+			changes = append(changes, fmt.Sprintf("%s: in the target table %s, %s", tableName, targetTableName, change))
+		}
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("the schema of the target tables of the tables in progress differs from the schema of the state: %s", strings.Join(changes, "; "))
+	}
+
+	return nil
+}
+
+// Returns the target table of each table in progress, keyed by the name of
+// the table, once the databaseRewrites and tableRewrites of the run are
+// applied, as the BatchWriter does.
+func (s *SerializableState) TargetTablesInProgress(databaseRewrites, tableRewrites map[string]string) map[string]TableIdentifier {
+	targetTables := make(map[string]TableIdentifier)
+	for _, tableName := range s.tablesInProgress() {
+		table := s.LastKnownTableSchemaCache[tableName]
+		if table == nil || table.Table == nil {
+			continue
+		}
+
+		target := NewTableIdentifierFromSchemaTable(table)
+		if targetSchemaName, exists := databaseRewrites[target.SchemaName]; exists {
+			target.SchemaName = targetSchemaName
+		}
+		if targetTableName, exists := tableRewrites[target.TableName]; exists {
+			target.TableName = targetTableName
+		}
+		targetTables[tableName] = target
+	}
+	return targetTables
+}
+
+// Returns the names of the tables of the LastKnownTableSchemaCache which are
+// still in progress, sorted, see ValidateAgainst.
+func (s *SerializableState) tablesInProgress() []string {
+	exemptTables := make(map[string]bool, len(s.DroppedTables)+len(s.OmittedCompletedTables))
+	for _, tableName := range s.DroppedTables {
+		exemptTables[tableName] = true
+	}
+	for _, tableName := range s.OmittedCompletedTables {
+		exemptTables[tableName] = true
+	}
+
+	tableNames := make([]string, 0, len(s.LastKnownTableSchemaCache))
+	for tableName := range s.LastKnownTableSchemaCache {
+		if s.CompletedTables[tableName] || s.CopyCompletedTables[tableName] || exemptTables[tableName] {
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	return tableNames
+}
+
+func tableSchemaChanges(lastKnown, current *TableSchema) []string {
+	changes := make([]string, 0)
+	if lastKnown == nil || lastKnown.Table == nil || current == nil || current.Table == nil {
+		return changes
+	}
+
+	lastKnownPrimaryKey := primaryKeyColumnNames(lastKnown)
+	currentPrimaryKey := primaryKeyColumnNames(current)
+	if strings.Join(lastKnownPrimaryKey, ",") != strings.Join(currentPrimaryKey, ",") {
+		changes = append(changes, fmt.Sprintf("the primary key changed from %v to %v", lastKnownPrimaryKey, currentPrimaryKey))
+	}
+
+	if lastKnown.PaginationKeyColumn != nil {
+		if current.PaginationKeyColumn == nil {
+			changes = append(changes, fmt.Sprintf("the pagination key column %s is no longer found", lastKnown.PaginationKeyColumn.Name))
+		} else if lastKnown.PaginationKeyColumn.Name != current.PaginationKeyColumn.Name {
+			changes = append(changes, fmt.Sprintf("the pagination key column changed from %s to %s", lastKnown.PaginationKeyColumn.Name, current.PaginationKeyColumn.Name))
+		}
+	}
+
+	currentColumns := make(map[string]string, len(current.Columns))
+	for _, column := range current.Columns {
+		currentColumns[column.Name] = column.RawType
+	}
+
+	lastKnownColumns := make(map[string]bool, len(lastKnown.Columns))
+	for _, column := range lastKnown.Columns {
+		lastKnownColumns[column.Name] = true
+
+		rawType, found := currentColumns[column.Name]
+		if !found {
+			changes = append(changes, fmt.Sprintf("the column %s was removed", column.Name))
+		} else if rawType != column.RawType {
+			changes = append(changes, fmt.Sprintf("the type of the column %s changed from %s to %s", column.Name, column.RawType, rawType))
+		}
+	}
+
+	for _, column := range current.Columns {
+		if !lastKnownColumns[column.Name] {
+			changes = append(changes, fmt.Sprintf("the column %s was added", column.Name))
+		}
+	}
+
+	return changes
+}
+
+func primaryKeyColumnNames(table *TableSchema) []string {
+	names := make([]string, 0, len(table.PKColumns))
+	for _, index := range table.PKColumns {
+		if index < len(table.Columns) {
+			names = append(names, table.Columns[index].Name)
+		}
+	}
+	return names
+}
+
+// Returns the number at the end of a binlog file name, such as 42 for
+// mysql-bin.000042.
+func binlogFileNumber(name string) (uint64, bool) {
+	_, number, ok := splitBinlogFileName(name)
+	return number, ok
+}
+
+// Compares two binlog positions as mysql.Position.Compare, but compares the
+// numbers at the end of the file names numerically rather than as strings,
+// so that mysql-bin.1000000 is after mysql-bin.999999. The file names without
+// a number, or with different base names, are compared as strings.
+func compareBinlogPositions(a, b mysql.Position) int {
+	aBase, aNumber, aOk := splitBinlogFileName(a.Name)
+	bBase, bNumber, bOk := splitBinlogFileName(b.Name)
+	if !aOk || !bOk || aBase != bBase {
+		return a.Compare(b)
+	}
+
+	switch {
+	case aNumber < bNumber:
+		return -1
+	case aNumber > bNumber:
+		return 1
+	case a.Pos < b.Pos:
+		return -1
+	case a.Pos > b.Pos:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Splits a binlog file name into the base name and the number at its end,
+// such as mysql-bin. and 42 for mysql-bin.000042.
+func splitBinlogFileName(name string) (string, uint64, bool) {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+
+	if i == len(name) {
+		return name, 0, false
+	}
+
+	number, err := strconv.ParseUint(name[i:], 10, 64)
+	if err != nil {
+		return name, 0, false
+	}
+	return name[:i], number, true
+}
+
+const (
+	sortableBinlogFileNumberWidth = 20
+	sortableBinlogOffsetWidth     = 10
+
+	// The width of the file numbers of the binlog files named by MySQL, such
+	// as mysql-bin.000042.
+	mysqlBinlogFileNumberWidth = 6
+)
+
+// Formats the position as a string whose lexical order is the order of the
+// positions, for positions whose files share the same base name, as
+// <base name><file number>:<offset> with both numbers zero-padded to a fixed
+// width, such as mysql-bin.00000000000000000042:0000000154. The zero position
+// is formatted as the empty string, which sorts first.
+//
+// ParseSortableBinlogPosition is the inverse.
+func FormatSortableBinlogPosition(pos mysql.Position) string {
+	if pos == (mysql.Position{}) {
+		return ""
+	}
+
+	name := pos.Name
+	if baseName, number, ok := splitBinlogFileName(pos.Name); ok {
+		name = fmt.Sprintf("%s%0*d", baseName, sortableBinlogFileNumberWidth, number)
+	}
+	return fmt.Sprintf("%s:%0*d", name, sortableBinlogOffsetWidth, pos.Pos)
+}
+
+// Parses a position formatted by FormatSortableBinlogPosition. The file number
+// is padded back to the width MySQL names its binlog files with, so the
+// position of a file whose number is padded to a larger width does not round
+// trip.
+func ParseSortableBinlogPosition(s string) (mysql.Position, error) {
+	if s == "" {
+		return mysql.Position{}, nil
+	}
+
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return mysql.Position{}, fmt.Errorf("invalid binlog position %q: expected <file>:<offset>", s)
+	}
+
+	offset, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("invalid binlog position %q: %v", s, err)
+	}
+
+	name := s[:i]
+	if baseName, number, ok := splitBinlogFileName(name); ok {
+		name = fmt.Sprintf("%s%0*d", baseName, mysqlBinlogFileNumberWidth, number)
+	}
+
+	return mysql.Position{Name: name, Pos: uint32(offset)}, nil
+}
+
+// For tracking the speed of the copy.
+//
+// Position is the cumulative number of pagination keys copied. It wraps
+// around on overflow, which is harmless: only the difference between two
+// positions is ever used, and unsigned subtraction yields the correct
+// difference across the wrap as long as less than 2^64 pagination keys were
+// copied between the two entries.
+type PaginationKeyPositionLog struct {
+	Position uint64
+	At       time.Time
+}
+
+type binlogPositionWaiter struct {
+	coordinate ReplicationCoordinate
+	reached    chan struct{}
+}
+
+type binlogPositionHold struct {
+	pos      mysql.Position
+	released chan struct{}
+
+	// Closed once the events up to pos are written, see HoldBinlogPosition.
+	reached       chan struct{}
+	reachedClosed bool
+}
+
+func (h *binlogPositionHold) markReached() {
+	if !h.reachedClosed {
+		h.reachedClosed = true
+		close(h.reached)
+	}
+}
+
+// For tracking the speed of the copy of a single table, see
+// StateTracker.TrackTableRates.
+type tableCopyTiming struct {
+	startPaginationKey uint64
+	startedAt          time.Time
+	lastPaginationKey  uint64
+	lastUpdatedAt      time.Time
+}
+
+func (t tableCopyTiming) paginationKeysPerSecond() float64 {
+	elapsed := t.lastUpdatedAt.Sub(t.startedAt).Seconds()
+	if elapsed <= 0 || t.lastPaginationKey <= t.startPaginationKey {
+		return 0
+	}
+
+	return float64(t.lastPaginationKey-t.startPaginationKey) / elapsed
+}
+
+// Shifts the times before pausedAt forward by d.
+func (t tableCopyTiming) shift(pausedAt time.Time, d time.Duration) tableCopyTiming {
+	if t.startedAt.Before(pausedAt) {
+		t.startedAt = t.startedAt.Add(d)
+	}
+	if t.lastUpdatedAt.Before(pausedAt) {
+		t.lastUpdatedAt = t.lastUpdatedAt.Add(d)
+	}
+
+	return t
+}
+
+const DefaultMinSpeedLogSampleInterval = 10 * time.Millisecond
+
+// The number of intervals a SpeedLogWindow is divided into by
+// NewStateTrackerWithWindow.
+const speedLogWindowSamples = 100
+
+// The fractions of the OverallProgress notified via StateTracker.OnMilestone
+// by default.
+var DefaultMilestones = []float64{0.25, 0.5, 0.75, 0.9, 1}
+
+// The handling of a table being completed when it already is, see
+// StateTracker.DuplicateTableCompletion.
+const (
+	DuplicateTableCompletionIgnore = "ignore"
+	DuplicateTableCompletionWarn   = "warn"
+	DuplicateTableCompletionPanic  = "panic"
+)
+
+func newSpeedLogRing(speedLogCount int) *ring.Ring {
+	if speedLogCount <= 0 {
+		return nil
+	}
+
+	// The log starts with an entry at 0, so the first update yields a rate.
+	// Entries that were never logged have a nil Value.
+	speedLog := ring.New(speedLogCount)
+	speedLog.Value = PaginationKeyPositionLog{
+		Position: 0,
+		At:       time.Now(),
+	}
+
+	return speedLog
+}
+
+// rwLocker is implemented by *sync.RWMutex.
+type rwLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// Used in place of the mutexes by single-threaded trackers.
+type noopLocker struct{}
+
+func (noopLocker) Lock()    {}
+func (noopLocker) Unlock()  {}
+func (noopLocker) RLock()   {}
+func (noopLocker) RUnlock() {}
+
+// Locking contract: every field below is guarded by the mutex noted above
+// it. Any code reading a field must hold at least the read lock of its mutex
+// and any code mutating a field (including the contents of the maps) must hold
+// the write lock. Code holding more than one of the mutexes must acquire them
+// in the order BinlogRWMutex, CopyRWMutex, then any of the others, as
+// Serialize and Snapshot do, and must not acquire BinlogRWMutex or
+// CopyRWMutex while holding any of the others, so that no two goroutines can
+// wait on each other. Serialize iterates over the maps under the read locks, so a
+// single unguarded write would crash it with a concurrent map iteration and
+// write. The maps are never shared with the caller: they are copied on the
+// way in (NewStateTrackerFromSerializedState) and on the way out (Serialize).
+type StateTracker struct {
+	BinlogRWMutex *sync.RWMutex
+	CopyRWMutex   *sync.RWMutex
+
+	// The locks the tracker takes for BinlogRWMutex and CopyRWMutex: the
+	// mutexes themselves, or no-op locks for the trackers built by
+	// NewSingleThreadedStateTracker.
+	binlogMutex rwLocker
+	copyMutex   rwLocker
+
+	// If true, the time spent waiting to acquire the mutexes in the hot update
+	// methods is emitted as the StateTrackerLockWait timer metric. This is off
+	// by default as the timing itself has some overhead.
+	InstrumentLockContention bool
+
+	// If true, the most recent error of each table is kept (see
+	// RecordTableError). The errors are dropped when their table completes,
+	// but this is still off by default to keep the memory usage in check with
+	// a large number of failing tables.
+	TrackTableErrors bool
+
+	// If true, the copy speed of each table is tracked in addition to the
+	// overall speed, which improves the accuracy of WeightedETA when the
+	// tables have very different sizes, see also
+	// EstimatedPaginationKeysPerSecondForTable. The timings of a table are
+	// dropped when it completes.
+	TrackTableRates bool
+
+	// If true, the number of rows copied from each table is tracked and
+	// serialized into the TableRowsCopied of the state, see TableRowsCopied.
+	// Unlike the per-table rates, the counts are kept once the table
+	// completes, which is a map entry per table copied.
+	TrackTableRowsCopied bool
+
+	// The window over which the copy rate of each table is compared to its
+	// peak by SlowTables. Only used if TrackTableRates is set.
+	//
+	// Optional: defaults to DefaultSlowTableWindow
+	SlowTableWindow time.Duration
+
+	// If true, the serialized states encode their CompletedTables as a list,
+	// see SerializableState.CompactCompletedTables.
+	CompactCompletedTables bool
+
+	// The capacity of the queue of the completed tables to verify, see
+	// PopCompletedForVerification. Tables completed while the queue is full
+	// are handed out once it is drained.
+	//
+	// Optional: defaults to 0, which disables the queue
+	VerificationQueueSize int
+
+	// The upper bounds, in seconds, of the buckets of the BatchCopyLatency
+	// histogram emitted by RecordBatchLatency.
+	//
+	// Optional: defaults to DefaultBatchLatencyBuckets
+	BatchLatencyBuckets []float64
+
+	// If set, spans are created around the significant operations of the
+	// tracker. See Tracer.
+	//
+	// Optional: no spans are created if this is nil
+	Tracer Tracer
+
+	// If set, called by UpdateLastWrittenBinlogPosition when the last written
+	// binlog position moves from oldFile to the newFile, e.g. to coordinate
+	// the backups of the binlog of the source. It is called exactly once per
+	// rotation, after the tracker's locks are released, from the goroutine
+	// updating the position. It is not called for the first position of the
+	// tracker, nor by ForceBinlogPosition.
+	OnBinlogRotate func(oldFile, newFile string)
+
+	// If set, called with each of the Milestones the first time the
+	// OverallProgress of the copy reaches it, to notify operators. The
+	// progress is evaluated against the sizes given to SetTableSizes, falling
+	// back to the fraction of the tables whose copy is complete without
+	// sizes, as OverallProgress does.
+	//
+	// Each milestone is called exactly once, including across resumes, even
+	// if the progress later goes back below it. The milestones reached by a
+	// single update are called in increasing order. It is called after the
+	// tracker's locks are released, from the goroutine reporting the
+	// progress. The progress is evaluated on every update of the copy while
+	// this is set.
+	OnMilestone func(fraction float64)
+
+	// If set, called by the StartStallMonitor goroutine when the copy stalls,
+	// see IsStalled. It is called once per stall: the copy must make progress
+	// again before it is called for the next stall.
+	OnStall func()
+
+	// The fractions of the OverallProgress, between 0 and 1, at which
+	// OnMilestone is called.
+	//
+	// Optional: defaults to DefaultMilestones
+	Milestones []float64
+
+	// The minimum time between two entries of the speed log. The progress
+	// reported in between is accumulated into the next entry, so the entries
+	// span a meaningful amount of time even if the progress is reported very
+	// frequently, which would otherwise make the speed estimations noisy.
+	//
+	// Optional: defaults to DefaultMinSpeedLogSampleInterval
+	MinSpeedLogSampleInterval time.Duration
+
+	// If set, the speed estimations only use the entries of the speed logs
+	// logged within this window before now, such that the estimations average
+	// over the same time regardless of how often the progress is reported.
+	// The estimations are then 0 if the copy made no progress in the window.
+	// The speed logs must still be large enough to cover the window, see
+	// NewStateTrackerWithWindow.
+	//
+	// Optional: defaults to using every entry of the speed logs
+	SpeedLogWindow time.Duration
+
+	// The half-life of the SmoothedPaginationKeysPerSecond: the shorter, the
+	// faster it follows changes of the speed, and the noisier it is.
+	//
+	// Optional: defaults to DefaultSmoothedSpeedHalfLife
+	SmoothedSpeedHalfLife time.Duration
+
+	// If true, the mutating methods panic when called after Finalize instead
+	// of logging a warning and ignoring the call.
+	PanicOnMutationAfterFinalize bool
+
+	// How to handle a table being completed when it already is. The completion
+	// is idempotent regardless: the TableCompleted event is only published on
+	// the first completion, and the later ones do not change the state. This
+	// only selects whether the later ones are silently ignored, logged as a
+	// warning, or panic to surface the programmer error.
+	//
+	// Optional: defaults to DuplicateTableCompletionIgnore
+	DuplicateTableCompletion string
+
+	// Holds the time.Time at which Finalize was called. This is atomic
+	// rather than guarded by a mutex, as it is checked by methods holding
+	// any of the mutexes.
+	finalizedAt atomic.Value
+
+	// The time and binlog position of the last Serialize, as a
+	// serializeRecord. Atomic as Serialize only holds read locks.
+	lastSerialized atomic.Value
+
+	// The LastKnownTableSchemaHashes of the last Serialize given a schema
+	// cache, see SchemaChangedSince. Atomic as Serialize only holds read
+	// locks.
+	lastSerializedSchemaHashes atomic.Value
+
+	// The Generation of the last Serialize. Atomic as Serialize only holds
+	// read locks.
+	generation uint64
+
+	// Guarded by BinlogRWMutex.
+	lastWrittenBinlogPosition                 mysql.Position
+	lastStoredBinlogPositionForInlineVerifier mysql.Position
+
+	// The GTID set of the last written binlog position, or nil if unknown. See
+	// UpdateLastWrittenGTID.
+	lastWrittenGTIDSet mysql.GTIDSet
+
+	// The last written coordinate if it is not a BinlogFileCoordinate, in which
+	// case the binlog file positions are unset. See
+	// UpdateLastWrittenCoordinate.
+	lastWrittenCoordinate ReplicationCoordinate
+
+	// The positions of the registered binlog consumers, see
+	// RegisterBinlogConsumer.
+	binlogConsumerPositions map[string]mysql.Position
+
+	// The distinct binlog files of the last written binlog positions, in the
+	// order they were first seen.
+	binlogFilesTraversed    []string
+	binlogFilesTraversedSet map[string]bool
+
+	// The times at which the binlogFilesTraversed were first reached, in the
+	// same order.
+	binlogFilesReachedAt []time.Time
+
+	// Carried over from the serialized state, see
+	// SerializableState.BinlogPositionOverrides.
+	binlogPositionOverrides []BinlogPositionOverride
+
+	earliestAppliedEventTime time.Time
+	latestAppliedEventTime   time.Time
+
+	// Closed and removed once the last written binlog position reaches their
+	// position, see WaitForBinlogPosition.
+	binlogPositionWaiters []binlogPositionWaiter
+
+	// The positions the BinlogWriter must not write past, see
+	// HoldBinlogPosition, and the position of the next event of the writer
+	// while it is held.
+	binlogPositionHolds []*binlogPositionHold
+	binlogWriterHeldAt  mysql.Position
+
+	dualWriteTargetHead      mysql.Position
+	dualWriteAppliedPosition mysql.Position
+	dualWriteLastCaughtUpAt  time.Time
+
+	// Guarded by CopyRWMutex.
+	lastSuccessfulPaginationKeys map[string]uint64
+	firstPaginationKeys          map[string]uint64
+	completedTables              map[string]bool
+	tableErrors                  map[string]string
+
+	// The tables copied but pending verification, see MarkTableCopyComplete.
+	// A table is in at most one of completedTables and copyCompletedTables.
+	copyCompletedTables map[string]bool
+
+	// The tables dropped from the source, see MarkTableDropped. A dropped
+	// table is in none of the other maps.
+	droppedTables map[string]bool
+
+	// The tables paused with PauseTable.
+	pausedTables map[string]*tablePause
+
+	// The completed tables not verified yet, the bounded FIFO of those to hand
+	// out via PopCompletedForVerification, and those handed out, see
+	// VerificationQueueSize.
+	unverifiedTables      map[string]bool
+	verificationQueue     []string
+	verificationHandedOut map[string]bool
+
+	// The ranges completed via MarkRangeComplete above the last successful
+	// pagination key of each table, sorted and non-overlapping.
+	completedPaginationKeyRanges map[string]*paginationKeySet
+
+	// The ranges excluded via ExcludePaginationKeyRange, sorted and
+	// non-overlapping. Unlike the completed ranges, they are kept once the
+	// last successful pagination key passes them, until the table completes.
+	excludedPaginationKeyRanges map[string][][2]uint64
+
+	declaredMaxPaginationKeys map[string]uint64
+
+	// Closed and removed when the table completes, see WaitForTableComplete.
+	tableCompletionWaiters map[string]chan struct{}
+
+	// The predicates of the tables not using the default, see
+	// SetCompletionPredicate.
+	completionPredicates map[string]CompletionPredicate
+
+	// The prerequisites of the tables, see SetTableDependencies.
+	tableDependencies map[string][]string
+
+	// The progress of the cleanup pass, see UpdateLastCleanedPaginationKey. A
+	// cleaned table is not in lastCleanedPaginationKeys.
+	lastCleanedPaginationKeys map[string]uint64
+	cleanedTables             map[string]bool
+
+	// See BinlogPositionAtTableCompletion.
+	tableCompletionBinlogPositions map[string]mysql.Position
+
+	tableCopyTimings map[string]tableCopyTiming
+	tableSpeedLogs   map[string]*tableSpeedLog
+
+	rowsCopied      uint64
+	tableRowsCopied map[string]uint64
+	skippedRows     map[string]uint64
+	deletedRows     map[string]uint64
+
+	iterationSpeedLog *ring.Ring
+
+	// The rates over multiple timescales, see SetRateWindows.
+	rateWindows map[string]*rateWindow
+
+	// See SmoothedPaginationKeysPerSecond.
+	smoothedSpeed smoothedRate
+
+	// The progress not yet added to the speed log, and the time of the last
+	// entry, see MinSpeedLogSampleInterval.
+	pendingSpeedLogPaginationKeys uint64
+	lastSpeedLogSampleAt          time.Time
+
+	pausedAt            time.Time
+	totalPausedDuration time.Duration
+
+	// See SetStallThreshold. The stall clock starts when the threshold is
+	// set, and lastProgressAt is the time of the last copy progress since.
+	stallThreshold      time.Duration
+	stallClockStartedAt time.Time
+	lastProgressAt      time.Time
+
+	phase          string
+	phaseStartedAt time.Time
+	phaseDurations map[string]time.Duration
+
+	// The number of BeginSchemaFreeze not ended yet.
+	schemaFreezes int
+
+	// Set on construction and never modified.
+	resumed    bool
+	verifyOnly bool
+	binlogOnly bool
+	logger     *logrus.Entry
+
+	// Guarded by milestonesMutex, see OnMilestone.
+	milestonesMutex   sync.Locker
+	tableSizes        map[string]uint64
+	reachedMilestones map[float64]bool
+
+	// Guarded by metadataMutex.
+	metadataMutex rwLocker
+	metadata      map[string]string
+
+	// Guarded by flushListenersMutex.
+	flushListenersMutex sync.Locker
+	flushListeners      []func() error
+
+	// Guarded by subscribersMutex.
+	subscribersMutex sync.Locker
+	subscribers      map[<-chan ProgressEvent]chan ProgressEvent
+	phaseSpan        Span
+
+	// Guarded by subscribersMutex, see CompletionEvents.
+	completionSubscribers []chan string
+}
+
+// Returns a tracker whose speed estimations average over the last window of
+// time rather than over the last entries of its speed log, see
+// SpeedLogWindow. The MinSpeedLogSampleInterval is set to a hundredth of the
+// window, and the speed log holds enough entries to cover the window.
+func NewStateTrackerWithWindow(window time.Duration) *StateTracker {
+	s := NewStateTracker(speedLogWindowSamples + 1)
+	s.SpeedLogWindow = window
+	s.MinSpeedLogSampleInterval = window / speedLogWindowSamples
+	return s
+}
+
+func NewStateTracker(speedLogCount int) *StateTracker {
+	binlogMutex := &sync.RWMutex{}
+	copyMutex := &sync.RWMutex{}
+
+	return &StateTracker{
+		BinlogRWMutex: binlogMutex,
+		CopyRWMutex:   copyMutex,
+		binlogMutex:   binlogMutex,
+		copyMutex:     copyMutex,
+
+		binlogFilesTraversedSet: make(map[string]bool),
+		binlogConsumerPositions: make(map[string]mysql.Position),
+
+		lastSuccessfulPaginationKeys:   make(map[string]uint64),
+		firstPaginationKeys:            make(map[string]uint64),
+		completedTables:                make(map[string]bool),
+		copyCompletedTables:            make(map[string]bool),
+		droppedTables:                  make(map[string]bool),
+		tableRowsCopied:                make(map[string]uint64),
+		skippedRows:                    make(map[string]uint64),
+		deletedRows:                    make(map[string]uint64),
+		pausedTables:                   make(map[string]*tablePause),
+		tableErrors:                    make(map[string]string),
+		completedPaginationKeyRanges:   make(map[string]*paginationKeySet),
+		excludedPaginationKeyRanges:    make(map[string][][2]uint64),
+		phaseDurations:                 make(map[string]time.Duration),
+		declaredMaxPaginationKeys:      make(map[string]uint64),
+		tableCopyTimings:               make(map[string]tableCopyTiming),
+		tableSpeedLogs:                 make(map[string]*tableSpeedLog),
+		completionPredicates:           make(map[string]CompletionPredicate),
+		tableDependencies:              make(map[string][]string),
+		lastCleanedPaginationKeys:      make(map[string]uint64),
+		cleanedTables:                  make(map[string]bool),
+		tableCompletionBinlogPositions: make(map[string]mysql.Position),
+		unverifiedTables:               make(map[string]bool),
+		tableCompletionWaiters:         make(map[string]chan struct{}),
+		verificationHandedOut:          make(map[string]bool),
+		milestonesMutex:                &sync.Mutex{},
+		reachedMilestones:              make(map[float64]bool),
+		metadataMutex:                  &sync.RWMutex{},
+		metadata:                       make(map[string]string),
+		flushListenersMutex:            &sync.Mutex{},
+		subscribersMutex:               &sync.Mutex{},
+		subscribers:                    make(map[<-chan ProgressEvent]chan ProgressEvent),
+		iterationSpeedLog:              newSpeedLogRing(speedLogCount),
+		rateWindows:                    newRateWindows(DefaultRateWindows),
+		MinSpeedLogSampleInterval:      DefaultMinSpeedLogSampleInterval,
+		logger:                         logrus.WithField("tag", "state_tracker"),
+	}
+}
+
+// serializedState is a state the tracker should start from, as opposed to
+// starting from the beginning.
+func NewStateTrackerFromSerializedState(speedLogCount int, serializedState *SerializableState) *StateTracker {
+	s := NewStateTracker(speedLogCount)
+	s.resumed = true
+	s.logger = s.logger.WithField("resumed", true)
+	s.generation = serializedState.Generation
+	if serializedState.LastKnownTableSchemaHashes != nil {
+		s.storeSerializedSchemaHashes(serializedState.LastKnownTableSchemaHashes)
+	} else if serializedState.LastKnownTableSchemaCache != nil {
+		hashes, err := serializedState.LastKnownTableSchemaCache.SchemaHashes()
+		if err == nil {
+			s.storeSerializedSchemaHashes(hashes)
+		}
+	}
+	// The maps are copied as the caller may still be using the serialized state
+	// (e.g. Config.StateToResumeFrom) without holding our locks.
+	for table, paginationKey := range serializedState.LastSuccessfulPaginationKeys {
+		s.lastSuccessfulPaginationKeys[table] = paginationKey
+	}
+	for table, paginationKey := range serializedState.FirstPaginationKeys {
+		s.firstPaginationKeys[table] = paginationKey
+	}
+	for table, ranges := range serializedState.CompletedPaginationKeyRanges {
+		s.completedPaginationKeyRanges[table] = newPaginationKeySet(ranges)
+	}
+	for table, bitmap := range serializedState.CompletedPaginationKeyBitmaps {
+		set, err := unmarshalPaginationKeyBitmap(bitmap)
+		if err != nil {
+			// Only the completed ranges are lost, which are copied again.
+			s.logger.WithError(err).WithField("table", table).Error("failed to decode the completed pagination keys of the table, they will be copied again")
+			continue
+		}
+		s.completedPaginationKeyRanges[table] = set
+	}
+	for table, ranges := range serializedState.ExcludedPaginationKeyRanges {
+		s.excludedPaginationKeyRanges[table] = append([][2]uint64(nil), ranges...)
+	}
+	for table, completed := range serializedState.CompletedTables {
+		s.completedTables[table] = completed
+	}
+	for table, copyCompleted := range serializedState.CopyCompletedTables {
+		s.copyCompletedTables[table] = copyCompleted
+	}
+	for table, err := range serializedState.TableErrors {
+		s.tableErrors[table] = err
+	}
+	s.lastWrittenBinlogPosition = serializedState.LastWrittenBinlogPosition
+	s.lastStoredBinlogPositionForInlineVerifier = serializedState.LastStoredBinlogPositionForInlineVerifier
+	if serializedState.LastWrittenGTIDSet != "" {
+		gtidSet, err := mysql.ParseMysqlGTIDSet(serializedState.LastWrittenGTIDSet)
+		if err != nil {
+			// The binlog streaming then resumes from the binlog position.
+			s.logger.WithError(err).WithField("gtid_set", serializedState.LastWrittenGTIDSet).Error("failed to parse the last written GTID set, ignoring it")
+		} else {
+			s.lastWrittenGTIDSet = gtidSet
+		}
+	}
+	for name, pos := range serializedState.BinlogConsumerPositions {
+		s.binlogConsumerPositions[name] = pos
+	}
+	if serializedState.LastWrittenCoordinate != nil {
+		coordinate, err := serializedState.LastWrittenCoordinate.Decode()
+		if err != nil {
+			s.logger.WithError(err).Error("failed to decode the last written coordinate, the binlog will be consumed from the start")
+		} else {
+			s.lastWrittenCoordinate = coordinate
+		}
+	}
+	s.totalPausedDuration = serializedState.TotalPausedDuration
+	// The TotalPausedDuration includes the pause until the state was
+	// serialized, so the pause carries on from now rather than from its start.
+	if serializedState.Paused {
+		s.pausedAt = time.Now()
+	}
+	s.rowsCopied = serializedState.RowsCopied
+	// The counts are restored even if TrackTableRowsCopied is only set once
+	// the tracker is constructed, so a resumed run keeps accumulating them.
+	for table, rows := range serializedState.TableRowsCopied {
+		s.tableRowsCopied[table] = rows
+	}
+	for table, rows := range serializedState.SkippedRows {
+		s.skippedRows[table] = rows
+	}
+	for table, rows := range serializedState.DeletedRows {
+		s.deletedRows[table] = rows
+	}
+	// The time spent in the phase the state was serialized in carries over,
+	// so a resumed run continues accumulating rather than starting over.
+	for phase, duration := range serializedState.PhaseDurations {
+		s.phaseDurations[phase] = duration
+	}
+	for key, value := range serializedState.Metadata {
+		s.metadata[key] = value
+	}
+	s.binlogPositionOverrides = append([]BinlogPositionOverride(nil), serializedState.BinlogPositionOverrides...)
+	for table, name := range serializedState.CompletionPredicates {
+		predicate, found := LookupCompletionPredicate(name)
+		if !found {
+			s.logger.WithFields(logrus.Fields{
+				"table":     table,
+				"predicate": name,
+			}).Error("the completion predicate of the table is not registered, using the default")
+			continue
+		}
+		s.completionPredicates[table] = predicate
+	}
+	// The unverified tables are handed out again, whether or not they were
+	// being verified when the state was serialized.
+	for _, table := range serializedState.UnverifiedCompletedTables {
+		s.unverifiedTables[table] = true
+	}
+	s.earliestAppliedEventTime = serializedState.EarliestAppliedEventTime
+	s.latestAppliedEventTime = serializedState.LatestAppliedEventTime
+	for _, table := range serializedState.DroppedTables {
+		s.droppedTables[table] = true
+	}
+	for _, table := range serializedState.PausedTables {
+		s.pausedTables[table] = newTablePause(time.Now())
+	}
+	for _, milestone := range serializedState.ReachedMilestones {
+		s.reachedMilestones[milestone] = true
+	}
+	for table, prerequisites := range serializedState.TableDependencies {
+		s.tableDependencies[table] = append([]string(nil), prerequisites...)
+	}
+	for table, paginationKey := range serializedState.LastCleanedPaginationKeys {
+		s.lastCleanedPaginationKeys[table] = paginationKey
+	}
+	for _, table := range serializedState.CleanedTables {
+		s.cleanedTables[table] = true
+	}
+	for table, pos := range serializedState.TableCompletionBinlogPositions {
+		s.tableCompletionBinlogPositions[table] = pos
+	}
+	s.restoreSpeedLog(serializedState.SpeedLog)
+	return s
+}
+
+// Restores the entries of the speed log of the serialized state into the
+// speed log of speedLogCount entries. If there are more entries than
+// speedLogCount, only the most recent ones are kept, and if there are fewer,
+// the speed log fills up with the new entries as usual. The entries are
+// shifted forward so the latest one is at the time of the resume: like a
+// pause, the time between the runs does not count towards the time it took to
+// copy the logged pagination keys. The speed estimations of the resumed run
+// are then the ones of the previous run until the new entries replace them.
+//
+// The serialized timestamps lost their monotonic clock readings, so they are
+// subject to the adjustments of the wall clock, and the clock of the previous
+// run may even be ahead of the current one. The entries are therefore rebased
+// onto a monotonic reading of the current time, keeping their offsets to the
+// latest entry, and an entry later than the one after it, as recorded across
+// a backward jump of the wall clock, is moved to the time of that one. The
+// estimations never compare a monotonic time to a wall clock time, nor go back
+// in time.
+func (s *StateTracker) restoreSpeedLog(entries []PaginationKeyPositionLog) {
+	if s.iterationSpeedLog == nil || len(entries) == 0 {
+		return
+	}
+
+	if len(entries) > s.iterationSpeedLog.Len() {
+		entries = entries[len(entries)-s.iterationSpeedLog.Len():]
+	}
+
+	// The entry at 0 the log starts with is not part of the restored
+	// positions.
+	s.iterationSpeedLog = ring.New(s.iterationSpeedLog.Len())
+
+	rebased := make([]PaginationKeyPositionLog, len(entries))
+	now := time.Now()
+	latest := entries[len(entries)-1].At
+	for i := len(entries) - 1; i >= 0; i-- {
+		at := now.Add(entries[i].At.Sub(latest))
+		if i < len(entries)-1 && at.After(rebased[i+1].At) {
+			at = rebased[i+1].At
+		}
+		rebased[i] = PaginationKeyPositionLog{Position: entries[i].Position, At: at}
+	}
+
+	for _, entry := range rebased {
+		s.iterationSpeedLog = s.iterationSpeedLog.Next()
+		s.iterationSpeedLog.Value = entry
+	}
+}
+
+// Constructs a tracker without any locking, for tools that drive the tracker
+// from a single goroutine, such as offline manipulation of serialized states,
+// where the locking is pure overhead. serializedState is optional.
+//
+// The returned tracker is NOT safe for concurrent use: it must not be given to
+// a Ferry or used from more than one goroutine, including via
+// PublishRateUpdates.
+func NewSingleThreadedStateTracker(speedLogCount int, serializedState *SerializableState) *StateTracker {
+	var s *StateTracker
+	if serializedState == nil {
+		s = NewStateTracker(speedLogCount)
+	} else {
+		s = NewStateTrackerFromSerializedState(speedLogCount, serializedState)
+	}
+
+	s.binlogMutex = noopLocker{}
+	s.copyMutex = noopLocker{}
+	s.metadataMutex = noopLocker{}
+	s.milestonesMutex = noopLocker{}
+	s.flushListenersMutex = noopLocker{}
+	s.subscribersMutex = noopLocker{}
+	return s
+}
+
+// Constructs a tracker for a run that only verifies the data copied by a
+// previous run. All the tables that have been copied must be in the
+// CompletedTables of the serialized state: an error is returned if a table is
+// only partially copied, as the verify-only run will not copy any data.
+// Tables that were never started cannot be detected here and must be checked
+// against the schema by the caller (see Ferry.Initialize).
+func NewVerifyOnlyStateTrackerFromSerializedState(speedLogCount int, serializedState *SerializableState) (*StateTracker, error) {
+	for table := range serializedState.LastSuccessfulPaginationKeys {
+		if !serializedState.CompletedTables[table] && !serializedState.CopyCompletedTables[table] {
+			return nil, fmt.Errorf("cannot only verify a state where %s is not completely copied", table)
+		}
+	}
+
+	s := NewStateTrackerFromSerializedState(speedLogCount, serializedState)
+	s.verifyOnly = true
+	return s, nil
+}
+
+// Constructs a tracker for a run that only streams the binlog, starting at
+// pos, as the data of the tables was copied by other means (e.g. restored from
+// a backup taken at pos). The tables are marked as completed, so
+// LastSuccessfulPaginationKey returns math.MaxUint64 for them.
+//
+// Give the tracker to the Ferry before Ferry.Initialize: the Ferry then skips
+// the data copy entirely, and refuses to start if any of its tables is not in
+// completedTables. The states dumped during the run are regular states, which
+// resume as such.
+func NewStateTrackerForBinlogOnly(pos mysql.Position, completedTables []string) *StateTracker {
+	s := NewStateTracker(0)
+	s.binlogOnly = true
+	s.lastWrittenBinlogPosition = pos
+	for _, table := range completedTables {
+		s.completedTables[table] = true
+	}
+	return s
+}
+
+// Seals the tracker once the run is complete: all the mutating methods are
+// then ignored, or panic if PanicOnMutationAfterFinalize is set, while the
+// read methods and Serialize remain available. The serialized state records
+// the time of the finalization in FinalizedAt. Calling Finalize again has no
+// effect.
+//
+// A tracker resumed from a finalized state is not finalized, as the
+// finalization only protects the tracker of the run that completed.
+func (s *StateTracker) Finalize() {
+	if !s.FinalizedAt().IsZero() {
+		return
+	}
+
+	// Waiting for the in-flight mutations ensures they are all part of the
+	// finalized state.
+	s.lockBinlog("Finalize")
+	s.lockCopy("Finalize")
+	s.metadataMutex.Lock()
+	defer s.binlogMutex.Unlock()
+	defer s.copyMutex.Unlock()
+	defer s.metadataMutex.Unlock()
+
+	if s.FinalizedAt().IsZero() {
+		s.finalizedAt.Store(time.Now())
+	}
+
+	s.endPhaseSpan()
+	s.closeCompletionEvents()
+}
+
+// Returns the time at which Finalize was called, or the zero time if the
+// tracker is not finalized.
+func (s *StateTracker) FinalizedAt() time.Time {
+	finalizedAt, _ := s.finalizedAt.Load().(time.Time)
+	return finalizedAt
+}
+
+func (s *StateTracker) rejectIfFinalized(method string) bool {
+	if s.FinalizedAt().IsZero() {
+		return false
+	}
+
+	if s.PanicOnMutationAfterFinalize {
+		panic(fmt.Sprintf("StateTracker.%s called after the tracker was finalized", method))
+	}
+
+	s.logger.WithField("method", method).Warn("ignoring mutation of a finalized state tracker")
+	return true
+}
+
+// Returns true if the tracker was constructed from a serialized state, even if
+// that state did not record any progress.
+func (s *StateTracker) IsResume() bool {
+	return s.resumed
+}
+
+func (s *StateTracker) IsVerifyOnly() bool {
+	return s.verifyOnly
+}
+
+func (s *StateTracker) IsBinlogOnly() bool {
+	return s.binlogOnly
+}
+
+// The last written binlog position is a high water mark: positions earlier
+// than the current one are ignored, as moving it backwards would cause a
+// resume to skip binlog events that have not been written. Use
+// ForceBinlogPosition for legitimate rewinds.
+//
+// OnBinlogRotate is called, after the position is updated, if the position
+// moved to a new binlog file.
+func (s *StateTracker) UpdateLastWrittenBinlogPosition(pos mysql.Position) {
+	oldFile, rotated := s.updateLastWrittenBinlogPosition(pos)
+	if rotated && s.OnBinlogRotate != nil {
+		s.OnBinlogRotate(oldFile, pos.Name)
+	}
+}
+
+// Returns the previous binlog file and true if the position moved to a new
+// binlog file.
+func (s *StateTracker) updateLastWrittenBinlogPosition(pos mysql.Position) (string, bool) {
+	s.lockBinlog("UpdateLastWrittenBinlogPosition")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastWrittenBinlogPosition") {
+		return "", false
+	}
+
+	if s.lastWrittenCoordinate != nil {
+		s.logger.WithFields(logrus.Fields{
+			"current":  s.lastWrittenCoordinate.String(),
+			"rejected": pos,
+		}).Errorf("ignoring a binlog position as the tracker tracks %s coordinates", s.lastWrittenCoordinate.Kind())
+		return "", false
+	}
+
+	if compareBinlogPositions(pos, s.lastWrittenBinlogPosition) < 0 {
+		s.logger.WithFields(logrus.Fields{
+			"current":  s.lastWrittenBinlogPosition,
+			"rejected": pos,
+		}).Warn("ignoring attempt to move the last written binlog position backwards")
+		return "", false
+	}
+
+	oldFile := s.lastWrittenBinlogPosition.Name
+	s.lastWrittenBinlogPosition = pos
+	s.notifyBinlogPositionWaitersUnlocked()
+	if pos.Name != "" && !s.binlogFilesTraversedSet[pos.Name] {
+		s.binlogFilesTraversedSet[pos.Name] = true
+		s.binlogFilesTraversed = append(s.binlogFilesTraversed, pos.Name)
+		s.binlogFilesReachedAt = append(s.binlogFilesReachedAt, time.Now())
+	}
+
+	return oldFile, oldFile != "" && oldFile != pos.Name
+}
+
+// Returns the distinct binlog files that the last written binlog position
+// went through since the tracker was constructed, in the order they were
+// first reached. This is the binlog the source must retain for the run, to be
+// compared with its binlog expiration settings (e.g. expire_logs_days). The
+// files traversed before a resume are not included.
+func (s *StateTracker) BinlogFilesTraversed() []string {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return append([]string(nil), s.binlogFilesTraversed...)
+}
+
+func (s *StateTracker) BinlogFilesTraversedCount() int {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return len(s.binlogFilesTraversed)
+}
+
+// Returned by EstimatedBinlogRetentionNeeded when there is not enough data
+// for an estimate.
+const UnknownBinlogRetention time.Duration = -1
+
+type serializeRecord struct {
+	At             time.Time
+	BinlogPosition mysql.Position
+}
+
+// Returns how long the source must retain its binlog files for the run to be
+// resumed from the last serialized state if it were interrupted now: the age
+// of the binlog file the state resumes from, plus the time Ghostferry takes
+// to go through one binlog file, as the file may have been created before
+// Ghostferry reached it. The binlog expiration of the source (e.g.
+// expire_logs_days or binlog_expire_logs_seconds) must be at least this plus
+// the longest expected interruption.
+//
+// The age of a file is the time since the last written binlog position first
+// reached it. For the files reached before the tracker was constructed, such
+// as the file of a resumed state, it is extrapolated from the rate at which
+// the files are traversed, based on their numbers. As the rate is measured
+// once two files were traversed, UnknownBinlogRetention is returned until
+// then, as well as until a state is serialized. Snapshot does not count, as
+// the estimate is about the binlog position a run would resume from.
+func (s *StateTracker) EstimatedBinlogRetentionNeeded() time.Duration {
+	serialized, _ := s.lastSerialized.Load().(serializeRecord)
+	if serialized.At.IsZero() || serialized.BinlogPosition.Name == "" {
+		return UnknownBinlogRetention
+	}
+
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	traversed := len(s.binlogFilesTraversed)
+	if traversed < 2 {
+		return UnknownBinlogRetention
+	}
+
+	firstNumber, firstOk := binlogFileNumber(s.binlogFilesTraversed[0])
+	lastNumber, lastOk := binlogFileNumber(s.binlogFilesTraversed[traversed-1])
+	if !firstOk || !lastOk || lastNumber <= firstNumber {
+		return UnknownBinlogRetention
+	}
+	perFile := s.binlogFilesReachedAt[traversed-1].Sub(s.binlogFilesReachedAt[0]) / time.Duration(lastNumber-firstNumber)
+
+	var reachedAt time.Time
+	if s.binlogFilesTraversedSet[serialized.BinlogPosition.Name] {
+		for i, file := range s.binlogFilesTraversed {
+			if file == serialized.BinlogPosition.Name {
+				reachedAt = s.binlogFilesReachedAt[i]
+				break
+			}
+		}
+	} else {
+		number, ok := binlogFileNumber(serialized.BinlogPosition.Name)
+		if !ok || number > firstNumber {
+			return UnknownBinlogRetention
+		}
+		reachedAt = s.binlogFilesReachedAt[0].Add(-time.Duration(firstNumber-number) * perFile)
+	}
+
+	return time.Since(reachedAt) + perFile
+}
+
+func (s *StateTracker) LastWrittenBinlogPosition() mysql.Position {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.lastWrittenBinlogPosition
+}
+
+// Records the last written coordinate, the equivalent of
+// UpdateLastWrittenBinlogPosition for the sources whose changes are not
+// addressed by binlog file positions. A BinlogFileCoordinate is recorded as
+// the binlog position. A tracker tracks coordinates of a single kind: the
+// coordinates of another kind than the ones recorded so far are rejected, as
+// are the coordinates moving backwards.
+//
+// The other coordinates are only tracked for the binlog writer: the inline
+// verifier and the registered binlog consumers track binlog file positions,
+// and the features built on binlog files, such as BinlogFilesTraversed, do
+// not apply to them.
+func (s *StateTracker) UpdateLastWrittenCoordinate(coordinate ReplicationCoordinate) {
+	if pos, ok := coordinate.(BinlogFileCoordinate); ok {
+		s.UpdateLastWrittenBinlogPosition(mysql.Position(pos))
+		return
+	}
+
+	s.lockBinlog("UpdateLastWrittenCoordinate")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastWrittenCoordinate") {
+		return
+	}
+
+	if current, written := s.lastWrittenCoordinateUnlocked(); written {
+		if current.Kind() != coordinate.Kind() {
+			s.logger.WithFields(logrus.Fields{
+				"current":  current.String(),
+				"rejected": coordinate.String(),
+			}).Errorf("ignoring a %s coordinate as the tracker tracks %s coordinates", coordinate.Kind(), current.Kind())
+			return
+		}
+
+		if coordinate.Compare(current) < 0 {
+			s.logger.WithFields(logrus.Fields{
+				"current":  current.String(),
+				"rejected": coordinate.String(),
+			}).Warn("ignoring attempt to move the last written coordinate backwards")
+			return
+		}
+	}
+
+	s.lastWrittenCoordinate = coordinate
+	s.notifyBinlogPositionWaitersUnlocked()
+}
+
+// Returns the last written coordinate, which is the LastWrittenBinlogPosition
+// as a BinlogFileCoordinate unless coordinates of another kind are tracked.
+func (s *StateTracker) LastWrittenCoordinate() ReplicationCoordinate {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	current, _ := s.lastWrittenCoordinateUnlocked()
+	return current
+}
+
+// Also returns false if no coordinate was written yet.
+func (s *StateTracker) lastWrittenCoordinateUnlocked() (ReplicationCoordinate, bool) {
+	if s.lastWrittenCoordinate != nil {
+		return s.lastWrittenCoordinate, true
+	}
+	return BinlogFileCoordinate(s.lastWrittenBinlogPosition), s.lastWrittenBinlogPosition != (mysql.Position{})
+}
+
+// The LastWrittenBinlogPosition formatted with FormatSortableBinlogPosition,
+// for logging and comparing positions as strings.
+func (s *StateTracker) LastWrittenBinlogPositionString() string {
+	return FormatSortableBinlogPosition(s.LastWrittenBinlogPosition())
+}
+
+// Blocks until the last written binlog position reaches pos, or returns the
+// error of the context if it is done first. Returns immediately if the
+// position is already at or past pos.
+func (s *StateTracker) WaitForBinlogPosition(ctx context.Context, pos mysql.Position) error {
+	return s.WaitForCoordinate(ctx, BinlogFileCoordinate(pos))
+}
+
+// Blocks until the last written coordinate reaches coordinate, see
+// WaitForBinlogPosition. Returns an error if the tracker tracks coordinates
+// of another kind.
+func (s *StateTracker) WaitForCoordinate(ctx context.Context, coordinate ReplicationCoordinate) error {
+	s.lockBinlog("WaitForCoordinate")
+	if current, written := s.lastWrittenCoordinateUnlocked(); written {
+		if current.Kind() != coordinate.Kind() {
+			s.binlogMutex.Unlock()
+			return fmt.Errorf("cannot wait for a %s coordinate as the tracker tracks %s coordinates", coordinate.Kind(), current.Kind())
+		}
+
+		if current.Compare(coordinate) >= 0 {
+			s.binlogMutex.Unlock()
+			return nil
+		}
+	}
+
+	reached := make(chan struct{})
+	s.binlogPositionWaiters = append(s.binlogPositionWaiters, binlogPositionWaiter{coordinate: coordinate, reached: reached})
+	s.binlogMutex.Unlock()
+
+	select {
+	case <-reached:
+		return nil
+	case <-ctx.Done():
+		s.removeBinlogPositionWaiter(reached)
+		return ctx.Err()
+	}
+}
+
+// Removes the waiter of a WaitForCoordinate whose context is done, unless it
+// was reached meanwhile and already removed.
+func (s *StateTracker) removeBinlogPositionWaiter(reached chan struct{}) {
+	s.lockBinlog("WaitForCoordinate")
+	defer s.binlogMutex.Unlock()
+
+	for i, waiter := range s.binlogPositionWaiters {
+		if waiter.reached == reached {
+			s.binlogPositionWaiters = append(s.binlogPositionWaiters[:i], s.binlogPositionWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Wakes up the WaitForCoordinate whose coordinate is reached, and the holds
+// whose position is reached. The waiters of another kind than the coordinates
+// tracked are never woken up.
+func (s *StateTracker) notifyBinlogPositionWaitersUnlocked() {
+	s.markReachedBinlogPositionHoldsUnlocked()
+
+	current, _ := s.lastWrittenCoordinateUnlocked()
+
+	waiting := s.binlogPositionWaiters[:0]
+	for _, waiter := range s.binlogPositionWaiters {
+		if waiter.coordinate.Kind() == current.Kind() && current.Compare(waiter.coordinate) >= 0 {
+			close(waiter.reached)
+		} else {
+			waiting = append(waiting, waiter)
+		}
+	}
+	s.binlogPositionWaiters = waiting
+}
+
+// Prevents the BinlogWriter from writing the binlog events past pos until the
+// returned release function is called, such that the last written binlog
+// position stops exactly at pos if pos is the end of an event. The events up
+// to pos are still written, in a separate batch if needed. The binlog
+// streaming stalls while the writer waits, so the hold must be brief. See
+// Ferry.SerializeAt.
+//
+// The returned reached channel is closed once the events up to pos are
+// written: when the last written binlog position reaches pos, or when the
+// writer is held with its next event past pos, if pos is not the end of an
+// event it writes, such as the end of a transaction or of a filtered event.
+// The last written binlog position is then the end of the last event before
+// pos. It is also closed if the last written binlog position was already at
+// or past pos.
+func (s *StateTracker) HoldBinlogPosition(pos mysql.Position) (reached <-chan struct{}, release func()) {
+	s.lockBinlog("HoldBinlogPosition")
+	defer s.binlogMutex.Unlock()
+
+	hold := &binlogPositionHold{pos: pos, released: make(chan struct{}), reached: make(chan struct{})}
+	s.binlogPositionHolds = append(s.binlogPositionHolds, hold)
+	s.markReachedBinlogPositionHoldsUnlocked()
+
+	var once sync.Once
+	return hold.reached, func() {
+		once.Do(func() {
+			s.lockBinlog("HoldBinlogPosition")
+			defer s.binlogMutex.Unlock()
+
+			for i, held := range s.binlogPositionHolds {
+				if held == hold {
+					s.binlogPositionHolds = append(s.binlogPositionHolds[:i], s.binlogPositionHolds[i+1:]...)
+					break
+				}
+			}
+			close(hold.released)
+		})
+	}
+}
+
+// Returns the lowest position held by HoldBinlogPosition, or false if there is
+// none.
+func (s *StateTracker) heldBinlogPosition() (mysql.Position, bool) {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	hold, found := s.heldBinlogPositionUnlocked()
+	if !found {
+		return mysql.Position{}, false
+	}
+	return hold.pos, true
+}
+
+func (s *StateTracker) heldBinlogPositionUnlocked() (*binlogPositionHold, bool) {
+	var lowest *binlogPositionHold
+	for _, hold := range s.binlogPositionHolds {
+		if lowest == nil || compareBinlogPositions(hold.pos, lowest.pos) < 0 {
+			lowest = hold
+		}
+	}
+	return lowest, lowest != nil
+}
+
+// A hold is reached once the last written binlog position reaches it, or
+// once the BinlogWriter is held with its next event past it, as all the
+// events before it are written then.
+func (s *StateTracker) markReachedBinlogPositionHoldsUnlocked() {
+	for _, hold := range s.binlogPositionHolds {
+		written := compareBinlogPositions(s.lastWrittenBinlogPosition, hold.pos) >= 0
+		writerHeldPast := s.binlogWriterHeldAt.Name != "" && compareBinlogPositions(s.binlogWriterHeldAt, hold.pos) > 0
+		if written || writerHeldPast {
+			hold.markReached()
+		}
+	}
+}
+
+// Blocks while pos, the position of the next event of the BinlogWriter, is
+// past a position held by HoldBinlogPosition.
+func (s *StateTracker) waitForBinlogPositionRelease(pos mysql.Position) {
+	held := false
+	for {
+		s.binlogMutex.RLock()
+		hold, found := s.heldBinlogPositionUnlocked()
+		s.binlogMutex.RUnlock()
+
+		if !found || compareBinlogPositions(pos, hold.pos) <= 0 {
+			break
+		}
+
+		s.lockBinlog("waitForBinlogPositionRelease")
+		s.binlogWriterHeldAt = pos
+		s.markReachedBinlogPositionHoldsUnlocked()
+		s.binlogMutex.Unlock()
+		held = true
+
+		<-hold.released
+	}
+
+	if held {
+		s.lockBinlog("waitForBinlogPositionRelease")
+		s.binlogWriterHeldAt = mysql.Position{}
+		s.binlogMutex.Unlock()
+	}
+}
+
+// Records the time, from the binlog event header, of an event applied to the
+// target. The zero time is ignored, as it is used by the events that did not
+// come from the binlog.
+func (s *StateTracker) UpdateAppliedEventTime(ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+
+	s.lockBinlog("UpdateAppliedEventTime")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateAppliedEventTime") {
+		return
+	}
+
+	if s.earliestAppliedEventTime.IsZero() || ts.Before(s.earliestAppliedEventTime) {
+		s.earliestAppliedEventTime = ts
+	}
+	if ts.After(s.latestAppliedEventTime) {
+		s.latestAppliedEventTime = ts
+	}
+}
+
+// Returns the time of the earliest binlog event applied to the target, or the
+// zero time if none was applied.
+func (s *StateTracker) EarliestAppliedEventTime() time.Time {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.earliestAppliedEventTime
+}
+
+// Returns the time of the latest binlog event applied to the target, or the
+// zero time if none was applied.
+func (s *StateTracker) LatestAppliedEventTime() time.Time {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.latestAppliedEventTime
+}
+
+// Returns how far the target is behind the source, as the time since the
+// latest applied binlog event was written on the source. Unlike a heartbeat
+// based lag, this does not require a heartbeat table, but it grows while the
+// source is idle as no more events are applied. Returns 0 if no event was
+// applied.
+func (s *StateTracker) AppliedEventLag() time.Duration {
+	latest := s.LatestAppliedEventTime()
+	if latest.IsZero() {
+		return 0
+	}
+
+	return time.Since(latest)
+}
+
+func (s *StateTracker) ForceBinlogPosition(pos mysql.Position) {
+	s.lockBinlog("ForceBinlogPosition")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("ForceBinlogPosition") {
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"current": s.lastWrittenBinlogPosition,
+		"forced":  pos,
+	}).Warn("forcing the last written binlog position")
+
+	s.lastWrittenBinlogPosition = pos
+	s.notifyBinlogPositionWaitersUnlocked()
+}
+
+// Records the GTID set of the transactions written by the binlog writer, along
+// with the LastWrittenBinlogPosition, such that the binlog streaming can
+// resume from it after a failover of the source, see
+// SerializableState.MinGTIDSet. As the binlog position, this is a high water
+// mark: a set which does not contain the current one is ignored. A nil set is
+// ignored as well.
+func (s *StateTracker) UpdateLastWrittenGTID(gtidSet mysql.GTIDSet) {
+	if isNilGTIDSet(gtidSet) {
+		return
+	}
+
+	s.lockBinlog("UpdateLastWrittenGTID")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastWrittenGTID") {
+		return
+	}
+
+	if s.lastWrittenGTIDSet != nil && !gtidSet.Contain(s.lastWrittenGTIDSet) {
+		s.logger.WithFields(logrus.Fields{
+			"current":  s.lastWrittenGTIDSet.String(),
+			"rejected": gtidSet.String(),
+		}).Warn("ignoring attempt to move the last written GTID set backwards")
+		return
+	}
+
+	s.lastWrittenGTIDSet = gtidSet.Clone()
+}
+
+// The GTIDSet implementations of go-mysql dereference their receivers, so a
+// nil pointer in the interface panics as much as a nil interface does.
+func isNilGTIDSet(gtidSet mysql.GTIDSet) bool {
+	switch set := gtidSet.(type) {
+	case nil:
+		return true
+	case *mysql.MysqlGTIDSet:
+		return set == nil
+	case *mysql.MariadbGTIDSet:
+		return set == nil
+	default:
+		return false
+	}
+}
+
+// Returns a copy of the last written GTID set, or nil if it is not known.
+func (s *StateTracker) LastWrittenGTIDSet() mysql.GTIDSet {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	if s.lastWrittenGTIDSet == nil {
+		return nil
+	}
+	return s.lastWrittenGTIDSet.Clone()
+}
+
+func (s *StateTracker) UpdateLastStoredBinlogPositionForInlineVerifier(pos mysql.Position) {
+	s.lockBinlog("UpdateLastStoredBinlogPositionForInlineVerifier")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastStoredBinlogPositionForInlineVerifier") {
+		return
+	}
+
+	s.lastStoredBinlogPositionForInlineVerifier = pos
+}
+
+// Registers a component consuming the binlog besides the binlog writer and
+// the inline verifier, such that the run does not resume past the binlog
+// events it has yet to consume: MinBinlogPosition accounts for the position
+// it reports via UpdateConsumerPosition. The consumer starts at the current
+// MinBinlogPosition, so the binlog it needs is retained from its registration
+// on. Registering a consumer again, such as one restored from the serialized
+// state, keeps its position. The names of the built-in consumers,
+// BinlogWriterConsumer and InlineVerifierConsumer, are reserved.
+func (s *StateTracker) RegisterBinlogConsumer(name string) {
+	s.lockBinlog("RegisterBinlogConsumer")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("RegisterBinlogConsumer") {
+		return
+	}
+
+	if name == BinlogWriterConsumer || name == InlineVerifierConsumer {
+		s.logger.WithField("consumer", name).Error("ignoring the registration of a binlog consumer under the name of a built-in consumer")
+		return
+	}
+
+	if _, found := s.binlogConsumerPositions[name]; found {
+		return
+	}
+
+	s.binlogConsumerPositions[name] = s.minBinlogPositionUnlocked()
+}
+
+// Removes a consumer, such as once it stopped consuming the binlog, such that
+// its position does not hold MinBinlogPosition back anymore.
+func (s *StateTracker) UnregisterBinlogConsumer(name string) {
+	s.lockBinlog("UnregisterBinlogConsumer")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UnregisterBinlogConsumer") {
+		return
+	}
+
+	delete(s.binlogConsumerPositions, name)
+}
+
+// Records that the consumer consumed the binlog up to pos. Positions of
+// unregistered consumers, and positions moving a consumer backwards, are
+// ignored.
+func (s *StateTracker) UpdateConsumerPosition(name string, pos mysql.Position) {
+	s.lockBinlog("UpdateConsumerPosition")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateConsumerPosition") {
+		return
+	}
+
+	current, found := s.binlogConsumerPositions[name]
+	if !found {
+		s.logger.WithField("consumer", name).Warn("ignoring the binlog position of an unregistered binlog consumer")
+		return
+	}
+
+	if compareBinlogPositions(pos, current) < 0 {
+		s.logger.WithFields(logrus.Fields{
+			"consumer": name,
+			"current":  current,
+			"rejected": pos,
+		}).Warn("ignoring attempt to move the binlog position of a binlog consumer backwards")
+		return
+	}
+
+	s.binlogConsumerPositions[name] = pos
+}
+
+// Records the binlog position of a named binlog consumer, registering the
+// consumer at pos if it is not registered yet, such that a ferry tracks
+// several positions that all hold MinBinlogPosition back, e.g. the positions
+// of the stages of a cascading ferry streaming the same binlog. Positions
+// moving a consumer backwards are ignored. The names of the built-in
+// consumers update their positions: BinlogWriterConsumer, the default, is
+// the same as UpdateLastWrittenBinlogPosition, and InlineVerifierConsumer as
+// UpdateLastStoredBinlogPositionForInlineVerifier.
+//
+// All the positions are compared with each other, so they must be positions
+// of the same binlog: the binlog of another server, such as the target of a
+// ferry which is itself the source of a downstream ferry, is tracked by the
+// StateTracker of the downstream ferry instead.
+func (s *StateTracker) UpdateBinlogPosition(name string, pos mysql.Position) {
+	switch name {
+	case BinlogWriterConsumer:
+		s.UpdateLastWrittenBinlogPosition(pos)
+		return
+	case InlineVerifierConsumer:
+		s.UpdateLastStoredBinlogPositionForInlineVerifier(pos)
+		return
+	}
+
+	s.lockBinlog("UpdateBinlogPosition")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateBinlogPosition") {
+		return
+	}
+
+	if current, found := s.binlogConsumerPositions[name]; found && compareBinlogPositions(pos, current) < 0 {
+		s.logger.WithFields(logrus.Fields{
+			"consumer": name,
+			"current":  current,
+			"rejected": pos,
+		}).Warn("ignoring attempt to move the binlog position of a binlog consumer backwards")
+		return
+	}
+
+	s.binlogConsumerPositions[name] = pos
+}
+
+// Returns the binlog position of the named binlog consumer, and false if no
+// such consumer is registered. The built-in consumers are always registered,
+// see UpdateBinlogPosition.
+func (s *StateTracker) BinlogPosition(name string) (mysql.Position, bool) {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	switch name {
+	case BinlogWriterConsumer:
+		return s.lastWrittenBinlogPosition, true
+	case InlineVerifierConsumer:
+		return s.lastStoredBinlogPositionForInlineVerifier, true
+	}
+
+	pos, found := s.binlogConsumerPositions[name]
+	return pos, found
+}
+
+// Returns the earliest binlog position still needed, see
+// SerializableState.MinBinlogPosition.
+func (s *StateTracker) MinBinlogPosition() mysql.Position {
+	return s.MinBinlogConsumerPosition().Position
+}
+
+// Returns the GTID set the binlog streaming would resume from, see
+// SerializableState.MinGTIDSet.
+func (s *StateTracker) MinGTIDSet() mysql.GTIDSet {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	if s.lastWrittenGTIDSet == nil {
+		return nil
+	}
+
+	min := s.minBinlogConsumerPositionUnlocked()
+	if min.Consumer != BinlogWriterConsumer && min.Position != (mysql.Position{}) {
+		return nil
+	}
+	return s.lastWrittenGTIDSet.Clone()
+}
+
+// Returns the MinBinlogPosition as a BinlogFileCoordinate or, if coordinates
+// of another kind are tracked, the last written coordinate, see
+// UpdateLastWrittenCoordinate.
+func (s *StateTracker) MinReplicationCoordinate() ReplicationCoordinate {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	if s.lastWrittenCoordinate != nil {
+		return s.lastWrittenCoordinate
+	}
+	return BinlogFileCoordinate(s.minBinlogPositionUnlocked())
+}
+
+// Returns the MinBinlogPosition along with the consumer holding it, see
+// SerializableState.MinBinlogConsumerPosition. The positions are read under
+// a single acquisition of the lock, so they are consistent with each other
+// even while the consumers update them.
+func (s *StateTracker) MinBinlogConsumerPosition() BinlogConsumerPosition {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.minBinlogConsumerPositionUnlocked()
+}
+
+func (s *StateTracker) minBinlogPositionUnlocked() mysql.Position {
+	return s.minBinlogConsumerPositionUnlocked().Position
+}
+
+func (s *StateTracker) minBinlogConsumerPositionUnlocked() BinlogConsumerPosition {
+	return minBinlogConsumerPosition(s.lastWrittenBinlogPosition, s.lastStoredBinlogPositionForInlineVerifier, s.binlogConsumerPositions)
+}
+
+// During a dual-write phase, both the source and the target receive writes
+// and Ghostferry reconciles them. The target head position is the position of
+// the target's own writes, while the applied position is how far the
+// reconciliation has applied the binlog, in the same binlog coordinates.
+func (s *StateTracker) UpdateDualWriteTargetHead(pos mysql.Position) {
+	s.lockBinlog("UpdateDualWriteTargetHead")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateDualWriteTargetHead") {
+		return
+	}
+
+	s.dualWriteTargetHead = pos
+	s.updateDualWriteCaughtUp()
+}
+
+func (s *StateTracker) UpdateDualWriteAppliedPosition(pos mysql.Position) {
+	s.lockBinlog("UpdateDualWriteAppliedPosition")
+	defer s.binlogMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateDualWriteAppliedPosition") {
+		return
+	}
+
+	s.dualWriteAppliedPosition = pos
+	s.updateDualWriteCaughtUp()
+}
+
+func (s *StateTracker) updateDualWriteCaughtUp() {
+	if compareBinlogPositions(s.dualWriteAppliedPosition, s.dualWriteTargetHead) >= 0 {
+		s.dualWriteLastCaughtUpAt = time.Now()
+	}
+}
+
+func (s *StateTracker) DualWriteTargetHead() mysql.Position {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.dualWriteTargetHead
+}
+
+func (s *StateTracker) DualWriteAppliedPosition() mysql.Position {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	return s.dualWriteAppliedPosition
+}
+
+type DualWriteLag struct {
+	CaughtUp bool
+
+	// The number of binlog files the applied position is behind the target
+	// head. Only valid if the binlog file names end with a number, as MySQL
+	// names them.
+	Files uint64
+
+	// If the positions are in the same binlog file, the number of bytes the
+	// applied position is behind the target head. Otherwise, the offset of the
+	// target head in its binlog file, which is a lower bound of the lag.
+	Bytes uint64
+
+	// The time since the applied position was last caught up with the target
+	// head. Zero if it was never caught up.
+	Duration time.Duration
+}
+
+func (s *StateTracker) DualWriteLag() DualWriteLag {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	head := s.dualWriteTargetHead
+	applied := s.dualWriteAppliedPosition
+	if compareBinlogPositions(applied, head) >= 0 {
+		return DualWriteLag{CaughtUp: true}
+	}
+
+	lag := DualWriteLag{}
+	if !s.dualWriteLastCaughtUpAt.IsZero() {
+		lag.Duration = time.Since(s.dualWriteLastCaughtUpAt)
+	}
+
+	if head.Name == applied.Name {
+		lag.Bytes = uint64(head.Pos - applied.Pos)
+		return lag
+	}
+
+	lag.Bytes = uint64(head.Pos)
+	headNumber, headOk := binlogFileNumber(head.Name)
+	appliedNumber, appliedOk := binlogFileNumber(applied.Name)
+	if headOk && appliedOk && headNumber > appliedNumber {
+		lag.Files = headNumber - appliedNumber
+	}
+
+	return lag
+}
+
+// Records that the pagination keys of the table up to and including
+// paginationKey are copied. The last successful pagination key never moves
+// backwards: a lower pagination key is ignored with a warning.
+func (s *StateTracker) UpdateLastSuccessfulPaginationKey(table string, paginationKey uint64) {
+	defer s.notifyMilestones()
+	s.lockCopy("UpdateLastSuccessfulPaginationKey")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastSuccessfulPaginationKey") {
+		return
+	}
+
+	deltaPaginationKey := s.advancePaginationKeyUnlocked(table, paginationKey, time.Now())
+	s.updateSpeedLog(deltaPaginationKey)
+}
+
+// Applies the pagination key advances of several tables and increments the
+// number of rows copied under a single acquisition of the lock. This is
+// equivalent to calling UpdateLastSuccessfulPaginationKey for each table.
+func (s *StateTracker) UpdateBatch(updates map[string]uint64, rows uint64) {
+	defer s.notifyMilestones()
+	s.lockCopy("UpdateBatch")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateBatch") {
+		return
+	}
+
+	now := time.Now()
+	var deltaPaginationKey uint64
+	for table, paginationKey := range updates {
+		deltaPaginationKey += s.advancePaginationKeyUnlocked(table, paginationKey, now)
+	}
+
+	// The rows cannot be attributed to the tables of a batch spanning several
+	// tables, which are only counted in RowsCopied. The BatchWriter reports a
+	// single table per batch.
+	if len(updates) == 1 {
+		for table := range updates {
+			s.addRowsCopiedUnlocked(table, rows)
+		}
+	} else {
+		s.addRowsCopiedUnlocked("", rows)
+	}
+	s.updateSpeedLog(deltaPaginationKey)
+}
+
+// Records the final pagination key and rows of the table, as UpdateBatch
+// does, and marks the table as completed, as MarkTableAsCompleted does, under
+// a single acquisition of the lock. A table copied in a single batch is thus
+// never serialized as copied up to its last pagination key yet incomplete.
+func (s *StateTracker) CompleteTableWithFinalPaginationKey(table string, paginationKey uint64, rows uint64) {
+	defer s.notifyMilestones()
+	pos := s.LastWrittenBinlogPosition()
+	s.lockCopy("CompleteTableWithFinalPaginationKey")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("CompleteTableWithFinalPaginationKey") || s.rejectIfDroppedUnlocked("CompleteTableWithFinalPaginationKey", table) {
+		return
+	}
+
+	if s.completedTables[table] {
+		s.handleDuplicateCompletion("CompleteTableWithFinalPaginationKey", table)
+		return
+	}
+
+	deltaPaginationKey := s.advancePaginationKeyUnlocked(table, paginationKey, time.Now())
+	s.addRowsCopiedUnlocked(table, rows)
+	s.updateSpeedLog(deltaPaginationKey)
+	s.markTableAsCompletedUnlocked(table, pos)
+}
+
+// Also counts the rows in the TableRowsCopied of the table, unless the table
+// is empty as the rows cannot be attributed.
+func (s *StateTracker) addRowsCopiedUnlocked(table string, rows uint64) {
+	s.rowsCopied += rows
+	if s.TrackTableRowsCopied && table != "" && !s.droppedTables[table] {
+		s.tableRowsCopied[table] += rows
+	}
+}
+
+// The default buckets of the BatchCopyLatency histogram, in seconds.
+var DefaultBatchLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Reports the time taken to copy a batch of the table, which is emitted as
+// the BatchCopyLatency histogram metric for the metrics sink to aggregate.
+// Unlike the copy speed, this reveals the occasional slow batch. This does not
+// take any lock, as it does not change the state.
+func (s *StateTracker) RecordBatchLatency(table string, latency time.Duration) {
+	buckets := s.BatchLatencyBuckets
+	if buckets == nil {
+		buckets = DefaultBatchLatencyBuckets
+	}
+
+	metrics.Histogram("BatchCopyLatency", latency.Seconds(), buckets, []MetricTag{
+		MetricTag{"table", table},
+	}, 1.0)
+}
+
+// Returns the difference with the previous pagination key of the table.
+func (s *StateTracker) advancePaginationKeyUnlocked(table string, paginationKey uint64, now time.Time) uint64 {
+	if s.droppedTables[table] {
+		return 0
+	}
+
+	// A pagination key lower than the last successful one, such as one
+	// reported late by a retried batch, would move the copy of the table
+	// backwards, and its delta would underflow into a huge advance of the
+	// speed log.
+	if current, found := s.lastSuccessfulPaginationKeys[table]; found && paginationKey < current {
+		s.logger.WithFields(logrus.Fields{
+			"table":    table,
+			"current":  current,
+			"rejected": paginationKey,
+		}).Warn("ignoring attempt to move the last successful pagination key backwards")
+		return 0
+	}
+
+	deltaPaginationKey := paginationKey - s.lastSuccessfulPaginationKeys[table]
+
+	if _, found := s.firstPaginationKeys[table]; !found {
+		s.firstPaginationKeys[table] = paginationKey
+	}
+
+	if s.TrackTableRates {
+		timing, found := s.tableCopyTimings[table]
+		if !found {
+			timing = tableCopyTiming{startPaginationKey: paginationKey, startedAt: now}
+		}
+		timing.lastPaginationKey = paginationKey
+		timing.lastUpdatedAt = now
+		s.tableCopyTimings[table] = timing
+
+		speedLog, found := s.tableSpeedLogs[table]
+		if !found {
+			speedLog = &tableSpeedLog{}
+			s.tableSpeedLogs[table] = speedLog
+		}
+		speedLog.observe(paginationKey, now, s.slowTableSampleInterval())
+	}
+
+	s.lastSuccessfulPaginationKeys[table] = paginationKey
+	s.pruneCompletedPaginationKeyRangesUnlocked(table, false)
+	s.skipExcludedPaginationKeyRangeUnlocked(table)
+	return deltaPaginationKey
+}
+
+// Seeds the last successful pagination keys of the tables before the copy
+// starts, such that the copy of each table skips the pagination keys up to
+// and including its floor, e.g. the ranges already migrated by another tool.
+// Unlike resuming from a serialized state, no table is marked as completed
+// and the binlog positions are left untouched: the binlog streaming starts
+// from the current position of the source as for a new run.
+//
+// The seed is validated against the schema cache, and nothing is seeded if it
+// is invalid: every table must be in the schema cache, the floors must fit in
+// the pagination key columns, and the tables must not have any progress yet.
+// A floor of 0 is the same as not seeding the table.
+func (s *StateTracker) SeedProgress(floors map[string]uint64, tables TableSchemaCache) error {
+	s.lockCopy("SeedProgress")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("SeedProgress") {
+		return fmt.Errorf("cannot seed the progress of a finalized state tracker")
+	}
+
+	for table, floor := range floors {
+		tableSchema, found := tables[table]
+		if !found {
+			return fmt.Errorf("cannot seed the progress of %s as it is not in the schema cache", table)
+		}
+
+		if max, ok := tableSchema.MaxPaginationKeyValue(); ok && floor > max {
+			return fmt.Errorf("cannot seed the progress of %s to %d, above the max value %d of its pagination key", table, floor, max)
+		}
+
+		_, hasProgress := s.lastSuccessfulPaginationKeys[table]
+		_, hasRanges := s.completedPaginationKeyRanges[table]
+		if hasProgress || hasRanges || s.isTableCopiedUnlocked(table) {
+			return fmt.Errorf("cannot seed the progress of %s as its copy already started", table)
+		}
+	}
+
+	for table, floor := range floors {
+		if floor > 0 {
+			s.lastSuccessfulPaginationKeys[table] = floor
+		}
+	}
+
+	return nil
+}
+
+// Returns the first pagination key reported for the table, which is the end
+// of the first batch copied. This approximates the smallest pagination key of
+// tables whose keys do not start near 0, e.g. keys handed out in ranges by a
+// sharded allocator.
+func (s *StateTracker) FirstPaginationKey(table string) (uint64, bool) {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	paginationKey, found := s.firstPaginationKeys[table]
+	return paginationKey, found
+}
+
+func (s *StateTracker) RowsCopied() uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.rowsCopied
+}
+
+// Returns a copy of the number of rows copied from each table, as reported
+// via UpdateBatch, if TrackTableRowsCopied is set.
+func (s *StateTracker) TableRowsCopied() map[string]uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.tableRowsCopiedUnlocked()
+}
+
+func (s *StateTracker) tableRowsCopiedUnlocked() map[string]uint64 {
+	tableRowsCopied := make(map[string]uint64, len(s.tableRowsCopied))
+	for table, rows := range s.tableRowsCopied {
+		tableRowsCopied[table] = rows
+	}
+	return tableRowsCopied
+}
+
+// Counts rows of the table that are not copied to the target as they were
+// skipped, e.g. by a CopyFilter, such that the row counts of the source and
+// the target can be reconciled once the run is done. Unlike TableRowsCopied,
+// the counts are always tracked. The rows of dropped tables are not counted.
+func (s *StateTracker) IncrementSkippedRows(table string, n uint64) {
+	s.lockCopy("IncrementSkippedRows")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("IncrementSkippedRows") || s.droppedTables[table] {
+		return
+	}
+
+	s.skippedRows[table] += n
+}
+
+// Same as IncrementSkippedRows, but for the rows deleted from the source
+// during the run, which are missing from the source as well as the target.
+func (s *StateTracker) IncrementDeletedRows(table string, n uint64) {
+	s.lockCopy("IncrementDeletedRows")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("IncrementDeletedRows") || s.droppedTables[table] {
+		return
+	}
+
+	s.deletedRows[table] += n
+}
+
+// Returns the rows of the table counted by IncrementSkippedRows.
+func (s *StateTracker) SkippedRows(table string) uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.skippedRows[table]
+}
+
+// Returns the rows of the table counted by IncrementDeletedRows.
+func (s *StateTracker) DeletedRows(table string) uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.deletedRows[table]
+}
+
+func (s *StateTracker) LastSuccessfulPaginationKey(table string) uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if s.isTableCopiedUnlocked(table) {
+		return math.MaxUint64
+	}
+
+	paginationKey, found := s.lastSuccessfulPaginationKeys[table]
+	if !found {
+		return 0
+	}
+
+	return paginationKey
+}
+
+// Returns copies of the completed tables and of the last successful
+// pagination keys of the tables, as stored by the tracker. Unlike
+// LastSuccessfulPaginationKey, a completed table is not reported with the
+// max pagination key, and the tables pending verification are in neither of
+// the maps. Unlike Serialize, this does not involve the schema cache.
+func (s *StateTracker) CopyProgressSnapshot() (map[string]bool, map[string]uint64) {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	completed := make(map[string]bool, len(s.completedTables))
+	for table, isCompleted := range s.completedTables {
+		completed[table] = isCompleted
+	}
+
+	paginationKeys := make(map[string]uint64, len(s.lastSuccessfulPaginationKeys))
+	for table, paginationKey := range s.lastSuccessfulPaginationKeys {
+		paginationKeys[table] = paginationKey
+	}
+
+	return completed, paginationKeys
+}
+
+// Returns true if the row with the given pagination key has already been
+// copied, either because the table is completed or because the copy of the
+// table progressed past it. A row that is not copied yet will be copied, with
+// its latest data, by the DataIterator, unless it is in a range excluded via
+// ExcludePaginationKeyRange, in which case it is never copied.
+func (s *StateTracker) IsPaginationKeyCopied(table string, paginationKey uint64) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if s.isTableCopiedUnlocked(table) {
+		return true
+	}
+
+	lastSuccessfulPaginationKey, found := s.lastSuccessfulPaginationKeys[table]
+	if found && paginationKey <= lastSuccessfulPaginationKey {
+		return true
+	}
+
+	ranges, found := s.completedPaginationKeyRanges[table]
+	return found && ranges.contains(paginationKey)
+}
+
+// Marks the pagination keys from lo to hi, both inclusive, as copied. This is
+// for copying a single table with multiple workers, each working through a
+// range of pagination keys: the ranges can complete in any order, and the
+// completed ranges are kept in the state so they are not copied again after
+// a resume.
+//
+// Once the ranges are contiguous with the last successful pagination key of
+// the table, the last successful pagination key advances past them. For
+// example, with ranges [1, 100], [101, 200] and [201, 300], completing
+// [101, 200] and then [1, 100] advances the last successful pagination key to
+// 200, while [201, 300] remains outstanding.
+//
+// The copy does not have to start with a range starting at 0 or 1, as long as
+// no pagination key lower than it exists. Ranges overlapping previously
+// completed ones are merged with them.
+func (s *StateTracker) MarkRangeComplete(table string, lo, hi uint64) {
+	defer s.notifyMilestones()
+	s.lockCopy("MarkRangeComplete")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkRangeComplete") {
+		return
+	}
+
+	if lo > hi {
+		s.logger.WithFields(logrus.Fields{
+			"table": table,
+			"lo":    lo,
+			"hi":    hi,
+		}).Error("cannot mark an inverted pagination key range as complete, this is likely a programmer error")
+		return
+	}
+
+	if s.isTableCopiedUnlocked(table) || s.droppedTables[table] {
+		return
+	}
+
+	lastSuccessfulPaginationKey, found := s.lastSuccessfulPaginationKeys[table]
+	if found && lo <= lastSuccessfulPaginationKey {
+		if hi <= lastSuccessfulPaginationKey {
+			return
+		}
+		lo = lastSuccessfulPaginationKey + 1
+	}
+
+	if _, found := s.firstPaginationKeys[table]; !found {
+		s.firstPaginationKeys[table] = lo
+	}
+
+	ranges, found := s.completedPaginationKeyRanges[table]
+	if !found {
+		ranges = newPaginationKeySet(nil)
+		s.completedPaginationKeyRanges[table] = ranges
+	}
+	newlyCompleted := ranges.add(lo, hi)
+	s.pruneCompletedPaginationKeyRangesUnlocked(table, true)
+
+	s.updateSpeedLog(newlyCompleted)
+}
+
+// Returns the ranges, both ends inclusive, of pagination keys up to
+// maxPaginationKey which have not been copied yet, for the workers of a
+// resumed run to skip the ranges completed via MarkRangeComplete. The ranges
+// excluded via ExcludePaginationKeyRange are not returned either.
+func (s *StateTracker) UncopiedPaginationKeyRanges(table string, maxPaginationKey uint64) [][2]uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	uncopied := make([][2]uint64, 0)
+	if s.isTableCopiedUnlocked(table) {
+		return uncopied
+	}
+
+	next := uint64(0)
+	if lastSuccessfulPaginationKey, found := s.lastSuccessfulPaginationKeys[table]; found {
+		if lastSuccessfulPaginationKey >= maxPaginationKey {
+			return uncopied
+		}
+		next = lastSuccessfulPaginationKey + 1
+	}
+
+	covered := s.completedPaginationKeyRangesUnlocked(table)
+	if excluded := s.excludedPaginationKeyRanges[table]; len(excluded) > 0 {
+		for _, r := range excluded {
+			covered, _ = mergePaginationKeyRange(covered, r[0], r[1])
+		}
+	}
+
+	for _, r := range covered {
+		if r[0] > maxPaginationKey {
+			break
+		}
+
+		// The excluded ranges are kept once the last successful pagination
+		// key passes them.
+		if r[1] < next {
+			continue
+		}
+
+		if r[0] > next {
+			uncopied = append(uncopied, [2]uint64{next, r[0] - 1})
+		}
+
+		if r[1] >= maxPaginationKey {
+			return uncopied
+		}
+		next = r[1] + 1
+	}
+
+	return append(uncopied, [2]uint64{next, maxPaginationKey})
+}
+
+// Excludes the pagination keys from lo to hi, both inclusive, from the copy
+// of the table, such as ranges of known garbage rows or rows migrated by
+// other means. The DataIterator does not copy the rows in the excluded
+// ranges, and the excluded ranges are kept in the state such that a resumed
+// run does not copy them either.
+//
+// The excluded ranges are covered as far as the completion of the table is
+// concerned: the last successful pagination key of the table advances
+// through an excluded range directly following it as it does through the
+// ranges completed via MarkRangeComplete, and UncopiedPaginationKeyRanges
+// leaves them out. Excluded and completed ranges may overlap, and a table is
+// thus complete once every pagination key outside of its excluded ranges is
+// copied. The excluded keys are never counted in RowsCopied.
+//
+// This must be called before the copy of the table starts, as the
+// DataIterator reads the excluded ranges of a table when it starts copying
+// it. Keys already copied are not removed from the target, and excluding
+// keys of a completed table has no effect.
+func (s *StateTracker) ExcludePaginationKeyRange(table string, lo, hi uint64) {
+	defer s.notifyMilestones()
+	s.lockCopy("ExcludePaginationKeyRange")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("ExcludePaginationKeyRange") {
+		return
+	}
+
+	if lo > hi {
+		s.logger.WithFields(logrus.Fields{
+			"table": table,
+			"lo":    lo,
+			"hi":    hi,
+		}).Error("cannot exclude an inverted pagination key range, this is likely a programmer error")
+		return
+	}
+
+	if s.isTableCopiedUnlocked(table) || s.droppedTables[table] {
+		return
+	}
+
+	s.excludedPaginationKeyRanges[table], _ = mergePaginationKeyRange(s.excludedPaginationKeyRanges[table], lo, hi)
+	s.skipExcludedPaginationKeyRangeUnlocked(table)
+	s.pruneCompletedPaginationKeyRangesUnlocked(table, true)
+}
+
+// Returns the ranges, both ends inclusive, excluded from the copy of the table
+// via ExcludePaginationKeyRange, sorted and non-overlapping.
+func (s *StateTracker) ExcludedPaginationKeyRanges(table string) [][2]uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return append([][2]uint64(nil), s.excludedPaginationKeyRanges[table]...)
+}
+
+// Advances the last successful pagination key of the table through the
+// excluded range directly following it, if any. Returns true if it advanced.
+func (s *StateTracker) skipExcludedPaginationKeyRangeUnlocked(table string) bool {
+	excluded, found := s.excludedPaginationKeyRanges[table]
+	if !found {
+		return false
+	}
+
+	next := uint64(1)
+	if lastSuccessfulPaginationKey, found := s.lastSuccessfulPaginationKeys[table]; found {
+		if lastSuccessfulPaginationKey == math.MaxUint64 {
+			return false
+		}
+		next = lastSuccessfulPaginationKey + 1
+	}
+
+	end, found := paginationKeyRangeEnd(excluded, next)
+	if !found {
+		return false
+	}
+
+	s.lastSuccessfulPaginationKeys[table] = end
+	return true
+}
+
+// Drops the completed ranges that the last successful pagination key has
+// reached. If advance is true, the last successful pagination key also
+// advances through the completed and excluded ranges directly following it,
+// if any. This is not done for the completed ranges when a cursor reports
+// its progress, as the cursor is still working through the range and would
+// then report a pagination key lower than the last successful one.
+func (s *StateTracker) pruneCompletedPaginationKeyRangesUnlocked(table string, advance bool) {
+	ranges, found := s.completedPaginationKeyRanges[table]
+	if !found {
+		return
+	}
+
+	lastSuccessfulPaginationKey, found := s.lastSuccessfulPaginationKeys[table]
+	if found {
+		ranges.removeRangesEndingBy(lastSuccessfulPaginationKey)
+	}
+
+	for advance {
+		if s.skipExcludedPaginationKeyRangeUnlocked(table) {
+			lastSuccessfulPaginationKey, found = s.lastSuccessfulPaginationKeys[table], true
+			ranges.removeRangesEndingBy(lastSuccessfulPaginationKey)
+			continue
+		}
+
+		r, ok := ranges.first()
+		if !ok {
+			break
+		}
+
+		contiguous := r[0] <= 1
+		if found {
+			contiguous = r[0] <= lastSuccessfulPaginationKey+1
+		}
+
+		if !contiguous {
+			break
+		}
+
+		lastSuccessfulPaginationKey = r[1]
+		found = true
+		s.lastSuccessfulPaginationKeys[table] = lastSuccessfulPaginationKey
+		ranges.removeRangesEndingBy(lastSuccessfulPaginationKey)
+	}
+
+	if found {
+		s.lastSuccessfulPaginationKeys[table] = lastSuccessfulPaginationKey
+	}
+
+	if ranges.empty() {
+		delete(s.completedPaginationKeyRanges, table)
+	}
+}
+
+// Returns the completed ranges of the table, sorted and non-overlapping. The
+// returned ranges must not be modified.
+func (s *StateTracker) completedPaginationKeyRangesUnlocked(table string) [][2]uint64 {
+	ranges, found := s.completedPaginationKeyRanges[table]
+	if !found {
+		return nil
+	}
+	return ranges.rangeList()
+}
+
+// Returns the end of the range containing the pagination key among the
+// sorted, non-overlapping ranges, if any.
+func paginationKeyRangeEnd(ranges [][2]uint64, paginationKey uint64) (uint64, bool) {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i][1] >= paginationKey })
+	if i < len(ranges) && ranges[i][0] <= paginationKey {
+		return ranges[i][1], true
+	}
+	return 0, false
+}
+
+// Inserts [lo, hi] into the sorted, non-overlapping ranges, merging it with
+// the ranges it overlaps or is adjacent to. Returns the new ranges and the
+// number of pagination keys that were not covered before.
+func mergePaginationKeyRange(ranges [][2]uint64, lo, hi uint64) ([][2]uint64, uint64) {
+	merged := make([][2]uint64, 0, len(ranges)+1)
+	insertedLo, insertedHi := lo, hi
+	newlyCompleted := hi - lo + 1
+
+	i := 0
+	for ; i < len(ranges) && lo > 0 && ranges[i][1] < lo-1; i++ {
+		merged = append(merged, ranges[i])
+	}
+
+	for ; i < len(ranges) && (ranges[i][0] <= hi || ranges[i][0] == hi+1); i++ {
+		overlapLo, overlapHi := ranges[i][0], ranges[i][1]
+		if overlapLo < insertedLo {
+			overlapLo = insertedLo
+		}
+		if overlapHi > insertedHi {
+			overlapHi = insertedHi
+		}
+		if overlapLo <= overlapHi {
+			newlyCompleted -= overlapHi - overlapLo + 1
+		}
+
+		if ranges[i][0] < lo {
+			lo = ranges[i][0]
+		}
+		if ranges[i][1] > hi {
+			hi = ranges[i][1]
+		}
+	}
+
+	merged = append(merged, [2]uint64{lo, hi})
+	merged = append(merged, ranges[i:]...)
+	return merged, newlyCompleted
+}
+
+func (s *StateTracker) MarkTableAsCompleted(table string) {
+	defer s.notifyMilestones()
+	pos := s.LastWrittenBinlogPosition()
+	s.lockCopy("MarkTableAsCompleted")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTableAsCompleted") || s.rejectIfDroppedUnlocked("MarkTableAsCompleted", table) {
+		return
+	}
+
+	if s.completedTables[table] {
+		s.handleDuplicateCompletion("MarkTableAsCompleted", table)
+		return
+	}
+
+	s.markTableAsCompletedUnlocked(table, pos)
+}
+
+func (s *StateTracker) markTableAsCompletedUnlocked(table string, pos mysql.Position) {
+	// The timings are dropped with the copy progress.
+	paginationKeysPerSecond := s.tableCopyTimings[table].paginationKeysPerSecond()
+
+	s.completedTables[table] = true
+	s.tableCompletionBinlogPositions[table] = pos
+	s.lastProgressAt = time.Now()
+	delete(s.copyCompletedTables, table)
+	s.dropCopyProgressUnlocked(table)
+	s.enqueueForVerificationUnlocked(table)
+	s.notifyTableCompletedUnlocked(table)
+	s.deliverTableCompletion(table)
+	s.publish(ProgressEvent{
+		Type:                    ProgressEventTableCompleted,
+		At:                      time.Now(),
+		Table:                   table,
+		PaginationKeysPerSecond: paginationKeysPerSecond,
+	})
+}
+
+// Marks the copy of the table as complete, but not the table itself until it
+// is verified with MarkTableVerified. Like for a completed table, the copy of
+// the table is stopped and is not restarted on resume, but the table is not
+// in the CompletedTables of the serialized state: it is in the
+// CopyCompletedTables instead, so a resumed run still knows the table must be
+// verified.
+func (s *StateTracker) MarkTableCopyComplete(table string) {
+	defer s.notifyMilestones()
+	pos := s.LastWrittenBinlogPosition()
+	s.lockCopy("MarkTableCopyComplete")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTableCopyComplete") || s.rejectIfDroppedUnlocked("MarkTableCopyComplete", table) {
+		return
+	}
+
+	if s.isTableCopiedUnlocked(table) {
+		s.handleDuplicateCompletion("MarkTableCopyComplete", table)
+		return
+	}
+
+	s.copyCompletedTables[table] = true
+	s.tableCompletionBinlogPositions[table] = pos
+	s.dropCopyProgressUnlocked(table)
+}
+
+// Promotes a table marked with MarkTableCopyComplete to completed. For a
+// completed table handed out by PopCompletedForVerification, records that it
+// is verified instead.
+func (s *StateTracker) MarkTableVerified(table string) {
+	s.lockCopy("MarkTableVerified")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTableVerified") || s.rejectIfDroppedUnlocked("MarkTableVerified", table) {
+		return
+	}
+
+	if s.unverifiedTables[table] {
+		s.dropFromVerificationQueueUnlocked(table)
+		return
+	}
+
+	if !s.copyCompletedTables[table] {
+		if s.completedTables[table] {
+			s.handleDuplicateCompletion("MarkTableVerified", table)
+		} else {
+			s.logger.WithField("table", table).Error("cannot mark a table as verified before its copy is complete, this is likely a programmer error")
+		}
+		return
+	}
+
+	delete(s.copyCompletedTables, table)
+	s.completedTables[table] = true
+	s.notifyTableCompletedUnlocked(table)
+	s.deliverTableCompletion(table)
+	s.publish(ProgressEvent{
+		Type:  ProgressEventTableCompleted,
+		At:    time.Now(),
+		Table: table,
+	})
+}
+
+// Returns the next completed table to verify, in the order the tables were
+// completed, or false if there is none. This requires VerificationQueueSize.
+// The table remains unverified, and is handed out again on resume, until the
+// verifier calls MarkTableVerified. The tables left unverified by a previous
+// run are handed out after the tables queued by this run.
+func (s *StateTracker) PopCompletedForVerification() (string, bool) {
+	s.lockCopy("PopCompletedForVerification")
+	defer s.copyMutex.Unlock()
+
+	if len(s.verificationQueue) == 0 {
+		s.refillVerificationQueueUnlocked()
+	}
+
+	if len(s.verificationQueue) == 0 {
+		return "", false
+	}
+
+	table := s.verificationQueue[0]
+	s.verificationQueue = s.verificationQueue[1:]
+	s.verificationHandedOut[table] = true
+	return table, true
+}
+
+func (s *StateTracker) enqueueForVerificationUnlocked(table string) {
+	if s.VerificationQueueSize <= 0 {
+		return
+	}
+
+	s.unverifiedTables[table] = true
+	if len(s.verificationQueue) >= s.VerificationQueueSize {
+		s.logger.WithField("table", table).Warn("the verification queue is full, the table will be queued once it is drained")
+		return
+	}
+
+	s.verificationQueue = append(s.verificationQueue, table)
+}
+
+// Queues the unverified tables that did not fit in the queue or were left by
+// a previous run.
+func (s *StateTracker) refillVerificationQueueUnlocked() {
+	tables := make([]string, 0)
+	for table := range s.unverifiedTables {
+		if !s.verificationHandedOut[table] {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	if len(tables) > s.VerificationQueueSize {
+		tables = tables[:s.VerificationQueueSize]
+	}
+	s.verificationQueue = append(s.verificationQueue, tables...)
+}
+
+func (s *StateTracker) dropFromVerificationQueueUnlocked(table string) {
+	delete(s.unverifiedTables, table)
+	delete(s.verificationHandedOut, table)
+	for i, queued := range s.verificationQueue {
+		if queued == table {
+			s.verificationQueue = append(s.verificationQueue[:i], s.verificationQueue[i+1:]...)
+			break
+		}
+	}
+}
+
+// Returns true if the copy of the table is complete, whether the table is
+// completed or pending verification.
+func (s *StateTracker) IsTableCopyComplete(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.isTableCopiedUnlocked(table)
+}
+
+// Returns true if the table was marked with MarkTableCopyComplete but not
+// verified yet.
+func (s *StateTracker) IsTablePendingVerification(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.copyCompletedTables[table]
+}
+
+func (s *StateTracker) isTableCopiedUnlocked(table string) bool {
+	return s.completedTables[table] || s.copyCompletedTables[table]
+}
+
+// Drops the progress that is only needed while the table is being copied.
+func (s *StateTracker) dropCopyProgressUnlocked(table string) {
+	delete(s.tableErrors, table)
+	delete(s.tableCopyTimings, table)
+	delete(s.tableSpeedLogs, table)
+	delete(s.completedPaginationKeyRanges, table)
+	delete(s.excludedPaginationKeyRanges, table)
+}
+
+// Pre-seeds the completed tables before the copy starts, for tables that were
+// copied out-of-band (e.g. via a physical dump). Unlike excluding a table via
+// the TableFilter, these tables still have their binlog events replicated to
+// the target: only the data copy is skipped. As they are stored with the
+// other completed tables, they remain completed when the run is resumed.
+func (s *StateTracker) MarkTablesCompleted(tables []string) {
+	s.lockCopy("MarkTablesCompleted")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTablesCompleted") {
+		return
+	}
+
+	for _, table := range tables {
+		if s.rejectIfDroppedUnlocked("MarkTablesCompleted", table) {
+			continue
+		}
+
+		if s.completedTables[table] {
+			s.handleDuplicateCompletion("MarkTablesCompleted", table)
+			continue
+		}
+
+		s.completedTables[table] = true
+		delete(s.copyCompletedTables, table)
+		s.dropCopyProgressUnlocked(table)
+		s.notifyTableCompletedUnlocked(table)
+		s.deliverTableCompletion(table)
+		s.publish(ProgressEvent{
+			Type:  ProgressEventTableCompleted,
+			At:    time.Now(),
+			Table: table,
+		})
+	}
+}
+
+// Blocks until the table is completed, or returns the error of the context if
+// it is done first. Returns immediately if the table is already completed. A
+// table pending verification is not completed until it is verified, see
+// MarkTableVerified.
+func (s *StateTracker) WaitForTableComplete(ctx context.Context, table string) error {
+	s.lockCopy("WaitForTableComplete")
+	if s.completedTables[table] {
+		s.copyMutex.Unlock()
+		return nil
+	}
+
+	if s.droppedTables[table] {
+		s.copyMutex.Unlock()
+		return fmt.Errorf("table %s was dropped and will never complete", table)
+	}
+
+	completed, found := s.tableCompletionWaiters[table]
+	if !found {
+		completed = make(chan struct{})
+		s.tableCompletionWaiters[table] = completed
+	}
+	s.copyMutex.Unlock()
+
+	select {
+	case <-completed:
+		if s.IsTableDropped(table) {
+			return fmt.Errorf("table %s was dropped and will never complete", table)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Records that the table was dropped from the source during the run. The
+// table is moved out of the copy progress, the completed tables and the
+// tables pending verification into the DroppedTables of the serialized state,
+// so a resumed run neither copies it again nor fails to find it. The binlog
+// events of the table are not applied to the target anymore, see
+// BinlogWriter.
+//
+// Dropped takes precedence over every other state of the table: once
+// dropped, the progress reported for the table is ignored, and the table is
+// never completed nor verified. The WaitForTableComplete of the table return
+// an error. A table cannot be undropped, but a table re-created on the source
+// under the same name can be registered again with RegisterNewTable.
+func (s *StateTracker) MarkTableDropped(table string) {
+	s.lockCopy("MarkTableDropped")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTableDropped") {
+		return
+	}
+
+	if s.droppedTables[table] {
+		return
+	}
+
+	s.droppedTables[table] = true
+	delete(s.completedTables, table)
+	delete(s.copyCompletedTables, table)
+	delete(s.lastSuccessfulPaginationKeys, table)
+	delete(s.firstPaginationKeys, table)
+	delete(s.declaredMaxPaginationKeys, table)
+	delete(s.completionPredicates, table)
+	delete(s.tableRowsCopied, table)
+	delete(s.skippedRows, table)
+	delete(s.deletedRows, table)
+	delete(s.lastCleanedPaginationKeys, table)
+	delete(s.cleanedTables, table)
+	delete(s.tableCompletionBinlogPositions, table)
+	s.dropCopyProgressUnlocked(table)
+	s.dropFromVerificationQueueUnlocked(table)
+	s.notifyTableCompletedUnlocked(table)
+
+	// The iteration of a paused table waits for it to be resumed, and a
+	// dropped table is never resumed.
+	if pause, found := s.pausedTables[table]; found {
+		close(pause.resumed)
+		delete(s.pausedTables, table)
+	}
+}
+
+// Records the progress of a cleanup pass through the table, such as a pass
+// deleting the rows of the target that a filtered copy should not have
+// copied, such that an interrupted pass resumes after the pagination key.
+// The cleanup progress is tracked and serialized separately from the copy
+// progress: it neither advances the copy nor is dropped when the copy of the
+// table completes. Updates moving the pagination key backwards, and the
+// updates of cleaned or dropped tables, are ignored.
+//
+// The cleanup of a table is complete once MarkTableCleaned is called, which
+// the pass must do once it reaches the end of the table, and the cleanup
+// pass once IsCleanupComplete is true for the tables it goes through.
+func (s *StateTracker) UpdateLastCleanedPaginationKey(table string, paginationKey uint64) {
+	s.lockCopy("UpdateLastCleanedPaginationKey")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("UpdateLastCleanedPaginationKey") {
+		return
+	}
+
+	if s.cleanedTables[table] || s.droppedTables[table] {
+		return
+	}
+
+	if current, found := s.lastCleanedPaginationKeys[table]; found && paginationKey < current {
+		s.logger.WithFields(logrus.Fields{
+			"table":    table,
+			"current":  current,
+			"rejected": paginationKey,
+		}).Warn("ignoring attempt to move the last cleaned pagination key backwards")
+		return
+	}
+
+	s.lastCleanedPaginationKeys[table] = paginationKey
+}
+
+// Returns the pagination key the cleanup of the table resumes after: 0 if it
+// did not start, and math.MaxUint64 if the table is cleaned, as
+// LastSuccessfulPaginationKey does for the copy.
+func (s *StateTracker) LastCleanedPaginationKey(table string) uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if s.cleanedTables[table] {
+		return math.MaxUint64
+	}
+	return s.lastCleanedPaginationKeys[table]
+}
+
+// Marks the cleanup of the table as complete, see
+// UpdateLastCleanedPaginationKey.
+func (s *StateTracker) MarkTableCleaned(table string) {
+	s.lockCopy("MarkTableCleaned")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("MarkTableCleaned") || s.rejectIfDroppedUnlocked("MarkTableCleaned", table) {
+		return
+	}
+
+	s.cleanedTables[table] = true
+	delete(s.lastCleanedPaginationKeys, table)
+}
+
+func (s *StateTracker) IsTableCleaned(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.cleanedTables[table]
+}
+
+// Returns true if every table is cleaned or dropped, i.e. the cleanup pass
+// through the tables is complete. The dropped tables have nothing left to
+// clean up.
+func (s *StateTracker) IsCleanupComplete(tables []string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	for _, table := range tables {
+		if !s.cleanedTables[table] && !s.droppedTables[table] {
+			return false
+		}
+	}
+	return true
+}
+
+// Starts tracking a table created on the source after the run started, such
+// that it is copied from its first pagination key and its progress is part of
+// the serialized state from now on. Returns false, and does nothing, if the
+// table is already tracked, i.e. it has copy progress or is completed.
+//
+// A table dropped earlier in the run is considered re-created: it is not
+// dropped anymore, and is copied from scratch as the rows copied before the
+// drop are gone from the source. The tables excluded by the TableFilter must
+// not be registered, as they are never given to the tracker.
+func (s *StateTracker) RegisterNewTable(table string) bool {
+	s.lockCopy("RegisterNewTable")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("RegisterNewTable") {
+		return false
+	}
+
+	if !s.droppedTables[table] {
+		_, started := s.lastSuccessfulPaginationKeys[table]
+		if started || s.isTableCopiedUnlocked(table) {
+			return false
+		}
+	}
+
+	delete(s.droppedTables, table)
+	s.lastSuccessfulPaginationKeys[table] = 0
+
+	s.logger.WithField("table", table).Info("registered a table created after the run started")
+	return true
+}
+
+// Discards the copy progress of the table, whether it is being copied or
+// completed, such that it is copied again from its first pagination key, e.g.
+// after its copy was found to be corrupt. The other tables are untouched.
+// The table is removed from the completed tables and the tables pending
+// verification, and its speed log, copy timings, rows copied, skipped and
+// deleted, and completion binlog position are dropped. Its size, see
+// SetTargetPaginationKey, is kept as the table itself did not change.
+//
+// A running DataIterator does not copy the table again: the table is copied
+// again by the run resumed from a state serialized after the reset.
+//
+// The rows already copied to the target are not deleted, and the binlog
+// events of the table keep being applied to the target regardless. A dropped
+// table cannot be reset, see RegisterNewTable.
+func (s *StateTracker) ResetTable(table string) {
+	s.lockCopy("ResetTable")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("ResetTable") {
+		return
+	}
+
+	if s.droppedTables[table] {
+		s.logger.WithField("table", table).Warn("ignoring the reset of a dropped table")
+		return
+	}
+
+	delete(s.completedTables, table)
+	delete(s.copyCompletedTables, table)
+	delete(s.lastSuccessfulPaginationKeys, table)
+	delete(s.firstPaginationKeys, table)
+	delete(s.tableRowsCopied, table)
+	delete(s.skippedRows, table)
+	delete(s.deletedRows, table)
+	delete(s.tableCompletionBinlogPositions, table)
+	s.dropCopyProgressUnlocked(table)
+	s.dropFromVerificationQueueUnlocked(table)
+
+	s.logger.WithField("table", table).Info("reset the copy progress of the table")
+}
+
+func (s *StateTracker) IsTableDropped(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.droppedTables[table]
+}
+
+func (s *StateTracker) rejectIfDroppedUnlocked(method, table string) bool {
+	if !s.droppedTables[table] {
+		return false
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"method": method,
+		"table":  table,
+	}).Warn("ignoring the completion of a dropped table")
+	return true
+}
+
+// Wakes up all the WaitForTableComplete of the table.
+func (s *StateTracker) notifyTableCompletedUnlocked(table string) {
+	if completed, found := s.tableCompletionWaiters[table]; found {
+		close(completed)
+		delete(s.tableCompletionWaiters, table)
+	}
+}
+
+// Delivers the completion of the table to the CompletionEvents. Must be
+// called under the write lock of CopyRWMutex, which Finalize acquires before
+// closing them.
+func (s *StateTracker) deliverTableCompletion(table string) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	for _, subscriber := range s.completionSubscribers {
+		select {
+		case subscriber <- table:
+		default:
+			s.logger.WithField("table", table).Warn("table completion subscriber is full, dropping the completion")
+		}
+	}
+}
+
+func (s *StateTracker) handleDuplicateCompletion(method, table string) {
+	switch s.DuplicateTableCompletion {
+	case DuplicateTableCompletionPanic:
+		panic(fmt.Sprintf("StateTracker.%s called for the already completed table %s", method, table))
+	case DuplicateTableCompletionWarn:
+		s.logger.WithFields(logrus.Fields{
+			"method": method,
+			"table":  table,
+		}).Warn("ignoring the completion of an already completed table")
+	}
+}
+
+// Sets the predicate deciding when the copy of the table is complete, see
+// CompletionPredicate. The predicate must be registered with
+// RegisterCompletionPredicate to be restored on resume. A nil predicate
+// restores the default ReachedMaxPaginationKeyPredicate.
+func (s *StateTracker) SetCompletionPredicate(table string, predicate CompletionPredicate) {
+	s.lockCopy("SetCompletionPredicate")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("SetCompletionPredicate") {
+		return
+	}
+
+	if predicate == nil {
+		delete(s.completionPredicates, table)
+		return
+	}
+
+	s.completionPredicates[table] = predicate
+}
+
+func (s *StateTracker) CompletionPredicate(table string) CompletionPredicate {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if predicate, found := s.completionPredicates[table]; found {
+		return predicate
+	}
+	return ReachedMaxPaginationKeyPredicate{}
+}
+
+// Declares, for each table, the tables which must be completed before its
+// copy starts, such as the tables its foreign keys reference on the target.
+// This replaces the dependencies declared until now, including the ones
+// restored from a serialized state. An error is returned, and nothing is
+// changed, if the dependencies have a cycle.
+//
+// The DataIterator defers the copy of a table until CanStartTable is true.
+// The prerequisites must thus be copied by the same run, or be completed
+// already.
+func (s *StateTracker) SetTableDependencies(dependencies map[string][]string) error {
+	err := CheckTableDependencies(dependencies)
+	if err != nil {
+		return err
+	}
+
+	s.lockCopy("SetTableDependencies")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("SetTableDependencies") {
+		return nil
+	}
+
+	s.tableDependencies = make(map[string][]string, len(dependencies))
+	for table, prerequisites := range dependencies {
+		if len(prerequisites) > 0 {
+			s.tableDependencies[table] = append([]string(nil), prerequisites...)
+		}
+	}
+	return nil
+}
+
+// Returns the tables declared via SetTableDependencies as prerequisites of
+// the table.
+func (s *StateTracker) TablePrerequisites(table string) []string {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return append([]string(nil), s.tableDependencies[table]...)
+}
+
+// Returns true if every prerequisite of the table, see SetTableDependencies,
+// is completed. A prerequisite dropped from the source never completes, and
+// is thus not waited for.
+func (s *StateTracker) CanStartTable(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	for _, prerequisite := range s.tableDependencies[table] {
+		if !s.completedTables[prerequisite] && !s.droppedTables[prerequisite] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns an error naming the tables of a cycle if the dependencies, as given
+// to StateTracker.SetTableDependencies, have one.
+func CheckTableDependencies(dependencies map[string][]string) error {
+	tables := make([]string, 0, len(dependencies))
+	for table := range dependencies {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	visits := make(map[string]int)
+	path := make([]string, 0)
+
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch visits[table] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != table {
+				start++
+			}
+			cycle := append(append([]string(nil), path[start:]...), table)
+			return fmt.Errorf("the table dependencies have a cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		visits[table] = visiting
+		path = append(path, table)
+		for _, prerequisite := range dependencies[table] {
+			if err := visit(prerequisite); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visits[table] = visited
+		return nil
+	}
+
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The state of a table, see StateTracker.TableStatus.
+type TableState string
+
+const (
+	TableStateIncomplete          TableState = "incomplete"
+	TableStatePendingVerification TableState = "pending_verification"
+	TableStateCompleted           TableState = "completed"
+
+	// The table was dropped from the source, see MarkTableDropped. This takes
+	// precedence over the other states.
+	TableStateDropped TableState = "dropped"
+)
+
+// The machine readable reason for the state of a table, see
+// StateTracker.TableStatus.
+type TableReason string
+
+const (
+	// The table is completed.
+	TableReasonNone TableReason = "none"
+
+	// The copy of the table is complete, but the table is not verified yet,
+	// see MarkTableCopyComplete.
+	TableReasonAwaitingVerification TableReason = "awaiting_verification"
+
+	// Nothing was copied from the table yet.
+	TableReasonNotStarted TableReason = "not_started"
+
+	// The table is being copied.
+	TableReasonCopying TableReason = "copying"
+
+	// The table is being copied, but the copy is paused, see Pause. The
+	// Ferry.Progress also reports it while the Throttler is throttling.
+	TableReasonThrottled TableReason = "throttled"
+
+	// The copy of the table failed, see RecordTableError. This requires
+	// TrackTableErrors.
+	TableReasonErrored TableReason = "errored"
+
+	// The tracker is finalized while the table is incomplete, so the copy of
+	// the table cannot progress anymore, see Finalize.
+	TableReasonFrozen TableReason = "frozen"
+)
+
+// Returns the state of the table and the reason for it. A dropped table is
+// reported as dropped regardless of its progress. The reasons of an
+// incomplete table are checked in the following order: frozen, errored, not
+// started, throttled and copying. The first one that applies is returned.
+func (s *StateTracker) TableStatus(table string) (TableState, TableReason) {
+	finalized := !s.FinalizedAt().IsZero()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if s.droppedTables[table] {
+		return TableStateDropped, TableReasonNone
+	}
+
+	if s.completedTables[table] {
+		return TableStateCompleted, TableReasonNone
+	}
+
+	if s.copyCompletedTables[table] {
+		return TableStatePendingVerification, TableReasonAwaitingVerification
+	}
+
+	_, started := s.lastSuccessfulPaginationKeys[table]
+	_, hasRanges := s.completedPaginationKeyRanges[table]
+	started = started || hasRanges
+
+	switch {
+	case finalized:
+		return TableStateIncomplete, TableReasonFrozen
+	case s.tableErrors[table] != "":
+		return TableStateIncomplete, TableReasonErrored
+	case !started:
+		return TableStateIncomplete, TableReasonNotStarted
+	case !s.pausedAt.IsZero():
+		return TableStateIncomplete, TableReasonThrottled
+	default:
+		return TableStateIncomplete, TableReasonCopying
+	}
+}
+
+// Returns the last written binlog position when the copy of the table
+// completed, via MarkTableAsCompleted, CompleteTableWithFinalPaginationKey or
+// MarkTableCopyComplete, or false if it did not complete. The position is
+// read just before the completion is recorded, so the binlog events of the
+// table written after it must be applied to the copy of the table, e.g. to
+// replay the binlog for just that table after it is copied again. The tables
+// seeded with MarkTablesCompleted have no position.
+func (s *StateTracker) BinlogPositionAtTableCompletion(table string) (mysql.Position, bool) {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	pos, found := s.tableCompletionBinlogPositions[table]
+	return pos, found
+}
+
+func (s *StateTracker) IsTableComplete(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.completedTables[table]
+}
+
+// Only the most recent error of each table is kept, so operators can see which
+// table failed and why without going through the logs. This does nothing
+// unless TrackTableErrors is set.
+func (s *StateTracker) RecordTableError(table string, err error) {
+	if err == nil || !s.TrackTableErrors {
+		return
+	}
+
+	s.lockCopy("RecordTableError")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("RecordTableError") {
+		return
+	}
+
+	s.tableErrors[table] = err.Error()
+}
+
+func (s *StateTracker) LastTableError(table string) (string, bool) {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	err, found := s.tableErrors[table]
+	return err, found
+}
+
+type TablePaginationKeyProgress struct {
+	Table                       string
+	LastSuccessfulPaginationKey uint64
+	Completed                   bool
+}
+
+const (
+	SortByTableName               = "table-name"
+	SortByPaginationKeyDescending = "pagination-key-desc"
+)
+
+// Returns the progress of every table the tracker knows about, both in
+// progress and completed. The order is one of the SortBy* constants. Ties in
+// SortByPaginationKeyDescending are broken by table name.
+func (s *StateTracker) PaginationKeyProgressSorted(order string) []TablePaginationKeyProgress {
+	s.copyMutex.RLock()
+
+	progress := make([]TablePaginationKeyProgress, 0, len(s.lastSuccessfulPaginationKeys)+len(s.completedTables))
+	for table, paginationKey := range s.lastSuccessfulPaginationKeys {
+		progress = append(progress, TablePaginationKeyProgress{
+			Table:                       table,
+			LastSuccessfulPaginationKey: paginationKey,
+			Completed:                   s.completedTables[table],
+		})
+	}
+
+	for table, completed := range s.completedTables {
+		if _, found := s.lastSuccessfulPaginationKeys[table]; !found {
+			progress = append(progress, TablePaginationKeyProgress{
+				Table:     table,
+				Completed: completed,
+			})
+		}
+	}
+
+	s.copyMutex.RUnlock()
+
+	sort.Slice(progress, func(i, j int) bool {
+		if order == SortByPaginationKeyDescending && progress[i].LastSuccessfulPaginationKey != progress[j].LastSuccessfulPaginationKey {
+			return progress[i].LastSuccessfulPaginationKey > progress[j].LastSuccessfulPaginationKey
+		}
+
+		return progress[i].Table < progress[j].Table
+	})
+
+	return progress
+}
+
+// Returns the number of distinct tables the tracker recorded any copy progress
+// for: the tables with a last successful pagination key, completed ranges or a
+// table error, and the completed or copy-completed tables. The tables
+// excluded via the TableFilter are never given to the tracker, nor are they
+// in the schema cache, so once the copy is done this is expected to be the
+// number of tables in the schema cache. A lower count is an early sign that a
+// table was skipped entirely.
+//
+// The declared max pagination keys are set for every table of the schema
+// cache upfront, and thus are not counted.
+func (s *StateTracker) DistinctTablesSeen() int {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	tables := make(map[string]bool)
+	for table := range s.lastSuccessfulPaginationKeys {
+		tables[table] = true
+	}
+	for table := range s.completedPaginationKeyRanges {
+		tables[table] = true
+	}
+	for table := range s.tableErrors {
+		tables[table] = true
+	}
+	for table, completed := range s.completedTables {
+		if completed {
+			tables[table] = true
+		}
+	}
+	for table := range s.copyCompletedTables {
+		tables[table] = true
+	}
+
+	return len(tables)
+}
+
+// The fraction of the declared maximum value of the pagination key column at
+// which a table is considered to be near key exhaustion.
+const KeyExhaustionThreshold = 0.9
+
+// Records the largest value the pagination key column of each table can hold,
+// according to the schema cache. Tables whose pagination key type is unknown
+// are never reported as near key exhaustion.
+func (s *StateTracker) SetDeclaredMaxPaginationKeys(tables TableSchemaCache) {
+	s.lockCopy("SetDeclaredMaxPaginationKeys")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("SetDeclaredMaxPaginationKeys") {
+		return
+	}
+
+	for tableName, table := range tables {
+		if max, ok := table.MaxPaginationKeyValue(); ok {
+			s.declaredMaxPaginationKeys[tableName] = max
+		}
+	}
+}
+
+// Returns true if the last copied pagination key of the table is at or above
+// KeyExhaustionThreshold of the maximum its column type can hold. This is an
+// operational signal that the table is running out of keys on the source.
+func (s *StateTracker) NearKeyExhaustion(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.nearKeyExhaustionUnlocked(table)
+}
+
+func (s *StateTracker) nearKeyExhaustionUnlocked(table string) bool {
+	max, found := s.declaredMaxPaginationKeys[table]
+	if !found || max == 0 {
+		return false
+	}
+
+	return float64(s.lastSuccessfulPaginationKeys[table]) >= KeyExhaustionThreshold*float64(max)
+}
+
+// A table whose recorded copy progress is beyond the maximum pagination key
+// observed on the source, see StateTracker.PaginationKeyAnomalies.
+type PaginationKeyAnomaly struct {
+	Table string
+
+	// The highest pagination key recorded as copied, including the ranges
+	// completed via MarkRangeComplete.
+	RecordedPaginationKey    uint64
+	ObservedMaxPaginationKey uint64
+}
+
+func (a PaginationKeyAnomaly) String() string {
+	return fmt.Sprintf("%s: recorded pagination key %d is beyond the observed max pagination key %d", a.Table, a.RecordedPaginationKey, a.ObservedMaxPaginationKey)
+}
+
+// Returns the last successful pagination keys of the tables in the middle of
+// their copy, which are the pagination keys of the last rows copied, such that
+// a resumed run can check that these rows still exist on the source. The keys
+// advanced to the end of an excluded range, see ExcludePaginationKeyRange,
+// are not the keys of rows and are left out.
+//
+// A key advanced to the end of a range given to MarkRangeComplete is not
+// told apart, and may not be the key of a row either.
+func (s *StateTracker) ResumeCursors() map[string]uint64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	cursors := make(map[string]uint64)
+	for table, paginationKey := range s.lastSuccessfulPaginationKeys {
+		if paginationKey == 0 || paginationKey == math.MaxUint64 || s.isTableCopiedUnlocked(table) {
+			continue
+		}
+
+		if end, found := paginationKeyRangeEnd(s.excludedPaginationKeyRanges[table], paginationKey); found && end == paginationKey {
+			continue
+		}
+
+		cursors[table] = paginationKey
+	}
+	return cursors
+}
+
+// Returns the names of the tables whose recorded copy progress is beyond the
+// freshly observed maximum pagination key, sorted. See
+// PaginationKeyAnomalies.
+func (s *StateTracker) AnomalousTables(currentMax map[string]uint64) []string {
+	anomalies := s.PaginationKeyAnomalies(currentMax)
+	tables := make([]string, len(anomalies))
+	for i, anomaly := range anomalies {
+		tables[i] = anomaly.Table
+	}
+	return tables
+}
+
+// Compares the recorded copy progress with the freshly observed maximum
+// pagination key of each table in currentMax, and returns the tables whose
+// progress is beyond it, sorted by table name. Tables missing from currentMax
+// are not checked.
+//
+// This should not happen when resuming the same run against the same source:
+// it indicates that the source was restored from a backup, that the state is
+// from a different run, or that the newest rows were deleted. In the first
+// two cases, the rows between the observed max and the recorded progress
+// would be silently skipped by the copy.
+func (s *StateTracker) PaginationKeyAnomalies(currentMax map[string]uint64) []PaginationKeyAnomaly {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	anomalies := make([]PaginationKeyAnomaly, 0)
+	for table, observedMax := range currentMax {
+		recorded, found := s.lastSuccessfulPaginationKeys[table]
+		if ranges, hasRanges := s.completedPaginationKeyRanges[table]; hasRanges {
+			recorded = ranges.last()
+			found = true
+		}
+
+		if found && recorded > observedMax {
+			anomalies = append(anomalies, PaginationKeyAnomaly{
+				Table:                    table,
+				RecordedPaginationKey:    recorded,
+				ObservedMaxPaginationKey: observedMax,
+			})
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Table < anomalies[j].Table
+	})
+	return anomalies
+}
+
+// Discards the samples of the speed log, such as after a long throttle, so
+// that EstimatedPaginationKeysPerSecond reflects the speed from now on rather
+// than averaging in the stale samples of the window. The copy progress and
+// the completed tables are untouched, as are the Rates and the per-table
+// rates. The log starts over from a sample taken now, so the next update
+// yields a rate again.
+func (s *StateTracker) ResetSpeedLog() {
+	s.lockCopy("ResetSpeedLog")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("ResetSpeedLog") {
+		return
+	}
+
+	if s.iterationSpeedLog == nil {
+		return
+	}
+
+	var currentTotalPaginationKey uint64
+	if s.iterationSpeedLog.Value != nil {
+		currentTotalPaginationKey = s.iterationSpeedLog.Value.(PaginationKeyPositionLog).Position
+	}
+
+	now := time.Now()
+	s.iterationSpeedLog = newSpeedLogRing(s.iterationSpeedLog.Len())
+	s.iterationSpeedLog.Value = PaginationKeyPositionLog{
+		Position: currentTotalPaginationKey + s.pendingSpeedLogPaginationKeys,
+		At:       now,
+	}
+	s.pendingSpeedLogPaginationKeys = 0
+	s.lastSpeedLogSampleAt = now
+}
+
+// This is reasonably accurate if the rows copied are distributed uniformly
+// between paginationKey = 0 -> max(paginationKey). It would not be accurate if the distribution is
+// concentrated in a particular region.
+func (s *StateTracker) EstimatedPaginationKeysPerSecond() float64 {
+	return s.estimatedPaginationKeysPerSecond(false)
+}
+
+// Same as EstimatedPaginationKeysPerSecond, but ignores the newest entry of
+// the speed log. The newest entry is as recent as the last update, so the
+// interval leading to it is usually shorter than the others and makes the
+// rate fluctuate with every update. This is more stable, at the cost of
+// lagging one entry behind and requiring one more entry to return a rate.
+func (s *StateTracker) EstimatedPaginationKeysPerSecondExcludingLatest() float64 {
+	return s.estimatedPaginationKeysPerSecond(true)
+}
+
+// Same as EstimatedPaginationKeysPerSecond, but as an exponentially weighted
+// moving average of the speed of every update, see SmoothedSpeedHalfLife,
+// rather than the rate between the ends of the speed log. A burst of progress
+// or a pause of a few updates only moves the average progressively, and the
+// average decays toward 0 when there is no update, e.g. after a half-life
+// without progress it is half of the last one. Time spent paused is
+// excluded once Resume is called.
+func (s *StateTracker) SmoothedPaginationKeysPerSecond() float64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.smoothedSpeed.rate(time.Now(), s.SmoothedSpeedHalfLife)
+}
+
+// The speed log is read under the same lock as it is advanced by
+// updateSpeedLog and shifted by Resume, including the iterationSpeedLog
+// pointer itself, which moves to the next entry with every sample.
+func (s *StateTracker) estimatedPaginationKeysPerSecond(excludeLatest bool) float64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.estimatedPaginationKeysPerSecondUnlocked(excludeLatest)
+}
+
+func (s *StateTracker) estimatedPaginationKeysPerSecondUnlocked(excludeLatest bool) float64 {
+	return speedLogPaginationKeysPerSecond(s.iterationSpeedLog, excludeLatest, s.speedLogWindowStart())
+}
+
+// Returns the time before which the entries of the speed logs are ignored,
+// see SpeedLogWindow, or the zero time if none are.
+func (s *StateTracker) speedLogWindowStart() time.Time {
+	if s.SpeedLogWindow <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(-s.SpeedLogWindow)
+}
+
+// Same as EstimatedPaginationKeysPerSecond, but for the copy of a single
+// table alone, such that a burst on a small table does not skew the estimate
+// of a large one. This is the rate WeightedETA uses for the table: its
+// average rate since its copy started or the run resumed, excluding the
+// pauses. Returns 0 if the table was not copied since then, or unless
+// TrackTableRates is set. The timings of a table are dropped when its copy
+// completes.
+func (s *StateTracker) EstimatedPaginationKeysPerSecondForTable(table string) float64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	timing, found := s.tableCopyTimings[table]
+	if !found {
+		return 0.0
+	}
+
+	return timing.paginationKeysPerSecond()
+}
+
+// Returns the rate between the earliest and the latest entries of the speed
+// log, of which speedLog is the latest entry, or 0 if it has fewer than two
+// entries. The entries logged before windowStart are ignored.
+//
+// The earliest entry is the one logged at the earliest time among all the
+// slots of the ring, which are each visited exactly once, rather than the
+// first one found walking back from the latest entry: a ring is circular, so
+// walking back only stops at an empty slot or back at the latest entry.
+func speedLogPaginationKeysPerSecond(speedLog *ring.Ring, excludeLatest bool, windowStart time.Time) float64 {
+	if speedLog == nil {
+		return 0.0
+	}
+
+	current := speedLog
+	if excludeLatest {
+		current = current.Prev()
+	}
+
+	if current.Value == nil {
+		return 0.0
+	}
+
+	currentValue := current.Value.(PaginationKeyPositionLog)
+	if currentValue.At.Before(windowStart) {
+		return 0.0
+	}
+
+	earliestValue := currentValue
+	found := false
+	size := speedLog.Len()
+	for i, r := 0, speedLog.Next(); i < size; i, r = i+1, r.Next() {
+		if r == current || r.Value == nil || (excludeLatest && r == speedLog) {
+			continue
+		}
+
+		entry := r.Value.(PaginationKeyPositionLog)
+		if entry.At.Before(windowStart) {
+			continue
+		}
+
+		if !found || entry.At.Before(earliestValue.At) {
+			earliestValue = entry
+			found = true
+		}
+	}
+
+	if !found {
+		return 0.0
+	}
+
+	deltaPaginationKey := currentValue.Position - earliestValue.Position
+	deltaT := currentValue.At.Sub(earliestValue.At).Seconds()
+
+	// The entries are recorded with monotonic clock readings, see
+	// restoreSpeedLog, so this only guards against entries that are too close
+	// for the clock resolution.
+	if deltaT <= 0 {
+		return 0.0
+	}
+
+	return float64(deltaPaginationKey) / deltaT
+}
+
+// Returns the tables being copied whose current copy rate is below factor
+// times their peak rate over the SlowTableWindow, sorted by name, such as the
+// tables slowed down by hot rows or lock waits. The rates are those of the
+// intervals of SlowTableWindow divided in 30 samples: the current rate is the
+// one of the last interval, which includes the time since the last progress
+// of the table, so a stalled table is slow as well.
+//
+// A table is only considered once its rate was measured over at least one
+// interval. Nothing is returned unless TrackTableRates is set, nor while the
+// tracker is paused, as every table would be slow.
+func (s *StateTracker) SlowTables(factor float64) []string {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	if !s.pausedAt.IsZero() {
+		return nil
+	}
+
+	now := time.Now()
+	interval := s.slowTableSampleInterval()
+	slowTables := make([]string, 0)
+	for table, speedLog := range s.tableSpeedLogs {
+		if _, paused := s.pausedTables[table]; paused {
+			continue
+		}
+
+		peak, found := speedLog.peak()
+		if !found || peak == 0 {
+			continue
+		}
+
+		current, found := speedLog.current(s.lastSuccessfulPaginationKeys[table], now, interval)
+		if found && current < factor*peak {
+			slowTables = append(slowTables, table)
+		}
+	}
+
+	sort.Strings(slowTables)
+	return slowTables
+}
+
+func (s *StateTracker) slowTableSampleInterval() time.Duration {
+	window := s.SlowTableWindow
+	if window <= 0 {
+		window = DefaultSlowTableWindow
+	}
+	return window / tableSpeedLogSamples
+}
+
+// Replaces the windows of Rates, keyed by their name, with empty windows.
+// Each window uses a fixed amount of memory regardless of its duration.
+func (s *StateTracker) SetRateWindows(windows map[string]time.Duration) {
+	s.lockCopy("SetRateWindows")
+	defer s.copyMutex.Unlock()
+
+	s.rateWindows = newRateWindows(windows)
+}
+
+// Returns the pagination keys copied per second over each of the windows set
+// via SetRateWindows, keyed by the window name, and DefaultRateWindows
+// otherwise. Unlike EstimatedPaginationKeysPerSecond, the rates are averaged
+// over a fixed duration rather than a fixed number of updates, so the short
+// and long term rates can be compared. A window that did not last for its
+// whole duration yet is averaged over the time since the first update. Time
+// spent paused is excluded once Resume is called.
+func (s *StateTracker) Rates() map[string]float64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.ratesUnlocked()
+}
+
+func (s *StateTracker) ratesUnlocked() map[string]float64 {
+	now := time.Now()
+	rates := make(map[string]float64, len(s.rateWindows))
+	for name, window := range s.rateWindows {
+		rates[name] = window.rate(now)
+	}
+	return rates
+}
+
+func newRateWindows(windows map[string]time.Duration) map[string]*rateWindow {
+	rateWindows := make(map[string]*rateWindow, len(windows))
+	for name, duration := range windows {
+		rateWindows[name] = newRateWindow(duration)
+	}
+	return rateWindows
+}
+
+// Estimates the time remaining for the copy of the given tables, where
+// tableSizes maps each table to its target (maximum) pagination key. Unlike
+// an ETA derived from EstimatedPaginationKeysPerSecond alone, this does not
+// assume that the remaining work is spread uniformly across the tables.
+//
+// The estimate is the larger of:
+//
+//   - the time for the overall speed to copy all the remaining pagination
+//     keys, and
+//   - the time for the slowest of the tables being copied to finish at its
+//     own speed, if TrackTableRates is set.
+//
+// The second bound dominates when a single, large table remains, as its copy
+// is limited to its own speed regardless of the overall speed the smaller
+// tables reached. Returns 0 if no speed is known yet.
+func (s *StateTracker) WeightedETA(tableSizes map[string]uint64) time.Duration {
+	overallRate := s.EstimatedPaginationKeysPerSecond()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	var totalRemaining float64
+	var slowestTable time.Duration
+	for table, size := range tableSizes {
+		if s.isTableCopiedUnlocked(table) {
+			continue
+		}
+
+		lastSuccessfulPaginationKey := s.lastSuccessfulPaginationKeys[table]
+		if lastSuccessfulPaginationKey >= size {
+			continue
+		}
+
+		remaining := float64(size - lastSuccessfulPaginationKey)
+		totalRemaining += remaining
+
+		timing, found := s.tableCopyTimings[table]
+		if !found {
+			continue
+		}
+
+		if rate := timing.paginationKeysPerSecond(); rate > 0 {
+			eta := time.Duration(remaining / rate * float64(time.Second))
+			if eta > slowestTable {
+				slowestTable = eta
+			}
+		}
+	}
+
+	var eta time.Duration
+	if overallRate > 0 && !math.IsNaN(overallRate) && !math.IsInf(overallRate, 0) {
+		eta = time.Duration(totalRemaining / overallRate * float64(time.Second))
+	}
+
+	if slowestTable > eta {
+		eta = slowestTable
+	}
+
+	return eta
+}
+
+// Estimates the time remaining for the copy of the given tables at the
+// EstimatedPaginationKeysPerSecond, where tableSizes maps each table to its
+// target (maximum) pagination key. The remaining work of a table is the
+// pagination keys between its copy progress and its target, including the
+// ranges completed via MarkRangeComplete, and none once its copy is complete.
+//
+// As EstimatedPaginationKeysPerSecond, this is reasonably accurate if the rows
+// are distributed uniformly between pagination key 0 and the target of each
+// table, but not if they are concentrated in a particular region. See
+// WeightedETA for an estimate accounting for the slow tables.
+//
+// Returns false if the time cannot be estimated as no speed is known, i.e.
+// the speed log is empty or the copy is not progressing.
+func (s *StateTracker) EstimatedTimeRemaining(tableSizes map[string]uint64) (time.Duration, bool) {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	rate := s.estimatedPaginationKeysPerSecondUnlocked(false)
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return 0, false
+	}
+
+	var remaining float64
+	for table, size := range tableSizes {
+		if s.isTableCopiedUnlocked(table) {
+			continue
+		}
+
+		copied := s.lastSuccessfulPaginationKeys[table]
+		if ranges, found := s.completedPaginationKeyRanges[table]; found {
+			copied += ranges.count()
+		}
+
+		if copied < size {
+			remaining += float64(size - copied)
+		}
+	}
+
+	return time.Duration(remaining / rate * float64(time.Second)), true
+}
+
+// Returns the fraction of the copy that is complete, between 0 and 1, where
+// tableSizes maps each table to its size, e.g. its target (maximum)
+// pagination key. Each table contributes in proportion to its size: the
+// tables whose copy is complete count as their full size, the tables being
+// copied as the pagination keys copied so far, including the ranges completed
+// via MarkRangeComplete, and the tables not started as zero.
+//
+// Without sizes, either because tableSizes is empty or all the sizes are 0,
+// this falls back to the fraction of the tables whose copy is complete, among
+// the tables of tableSizes or, if it is empty, among the tables known to the
+// tracker.
+func (s *StateTracker) OverallProgress(tableSizes map[string]uint64) float64 {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.overallProgressUnlocked(tableSizes)
+}
+
+func (s *StateTracker) overallProgressUnlocked(tableSizes map[string]uint64) float64 {
+	var totalSize, copiedSize float64
+	for table, size := range tableSizes {
+		totalSize += float64(size)
+		if s.isTableCopiedUnlocked(table) {
+			copiedSize += float64(size)
+			continue
+		}
+
+		copied := s.lastSuccessfulPaginationKeys[table]
+		if ranges, found := s.completedPaginationKeyRanges[table]; found {
+			copied += ranges.count()
+		}
+
+		if copied > size {
+			copied = size
+		}
+		copiedSize += float64(copied)
+	}
+
+	if totalSize > 0 {
+		return copiedSize / totalSize
+	}
+
+	tables := make(map[string]bool)
+	if len(tableSizes) > 0 {
+		for table := range tableSizes {
+			tables[table] = true
+		}
+	} else {
+		for table := range s.lastSuccessfulPaginationKeys {
+			tables[table] = true
+		}
+		for table := range s.completedTables {
+			tables[table] = true
+		}
+		for table := range s.copyCompletedTables {
+			tables[table] = true
+		}
+	}
+
+	if len(tables) == 0 {
+		return 0
+	}
+
+	var copiedTables int
+	for table := range tables {
+		if s.isTableCopiedUnlocked(table) {
+			copiedTables++
+		}
+	}
+
+	return float64(copiedTables) / float64(len(tables))
+}
+
+// Sets the sizes of the tables the OverallProgress is evaluated against for
+// OnMilestone, see OverallProgress. The DataIterator sets the target
+// pagination key of each table as it starts.
+func (s *StateTracker) SetTableSizes(tableSizes map[string]uint64) {
+	sizes := make(map[string]uint64, len(tableSizes))
+	for table, size := range tableSizes {
+		sizes[table] = size
+	}
+
+	s.milestonesMutex.Lock()
+	s.tableSizes = sizes
+	s.milestonesMutex.Unlock()
+
+	s.notifyMilestones()
+}
+
+// Sets the size of a single table, as SetTableSizes does for all of them,
+// such as the target pagination key of a table created after the copy
+// started.
+func (s *StateTracker) SetTargetPaginationKey(table string, maxPaginationKey uint64) {
+	s.milestonesMutex.Lock()
+	sizes := make(map[string]uint64, len(s.tableSizes)+1)
+	for existingTable, size := range s.tableSizes {
+		sizes[existingTable] = size
+	}
+	sizes[table] = maxPaginationKey
+	s.tableSizes = sizes
+	s.milestonesMutex.Unlock()
+
+	s.notifyMilestones()
+}
+
+// Returns the fraction of the copy of each table that is complete, between 0
+// and 1, and the OverallProgress, against the sizes given to SetTableSizes and
+// SetTargetPaginationKey. The tables whose copy is complete are at 1, with or
+// without a size, and the other tables without a size, or of size 0, are not
+// in the map. Without any sizes, the map only has the completed tables.
+func (s *StateTracker) Progress() (map[string]float64, float64) {
+	s.milestonesMutex.Lock()
+	tableSizes := s.tableSizes
+	s.milestonesMutex.Unlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	progress := make(map[string]float64)
+	for table, size := range tableSizes {
+		if s.isTableCopiedUnlocked(table) || size == 0 {
+			continue
+		}
+
+		copied := s.lastSuccessfulPaginationKeys[table]
+		if ranges, found := s.completedPaginationKeyRanges[table]; found {
+			copied += ranges.count()
+		}
+
+		if copied > size {
+			copied = size
+		}
+		progress[table] = float64(copied) / float64(size)
+	}
+
+	for table, completed := range s.completedTables {
+		if completed {
+			progress[table] = 1
+		}
+	}
+	for table := range s.copyCompletedTables {
+		progress[table] = 1
+	}
+
+	return progress, s.overallProgressUnlocked(tableSizes)
+}
+
+// Calls OnMilestone with the milestones not reached until now that the
+// OverallProgress reached. Must be called without holding the locks.
+func (s *StateTracker) notifyMilestones() {
+	if s.OnMilestone == nil {
+		return
+	}
+
+	s.milestonesMutex.Lock()
+	tableSizes := s.tableSizes
+	s.milestonesMutex.Unlock()
+
+	progress := s.OverallProgress(tableSizes)
+
+	milestones := s.Milestones
+	if milestones == nil {
+		milestones = DefaultMilestones
+	}
+
+	reached := make([]float64, 0)
+	s.milestonesMutex.Lock()
+	for _, milestone := range milestones {
+		if progress >= milestone && !s.reachedMilestones[milestone] {
+			s.reachedMilestones[milestone] = true
+			reached = append(reached, milestone)
+		}
+	}
+	s.milestonesMutex.Unlock()
+
+	sort.Float64s(reached)
+	for _, milestone := range reached {
+		s.OnMilestone(milestone)
+	}
+}
+
+func (s *StateTracker) reachedMilestonesSorted() []float64 {
+	s.milestonesMutex.Lock()
+	defer s.milestonesMutex.Unlock()
+
+	if len(s.reachedMilestones) == 0 {
+		return nil
+	}
+
+	milestones := make([]float64, 0, len(s.reachedMilestones))
+	for milestone := range s.reachedMilestones {
+		milestones = append(milestones, milestone)
+	}
+	sort.Float64s(milestones)
+	return milestones
+}
+
+func (s *StateTracker) lockCopy(method string) {
+	s.lockInstrumented(s.copyMutex, "copy", method)
+}
+
+func (s *StateTracker) lockBinlog(method string) {
+	s.lockInstrumented(s.binlogMutex, "binlog", method)
+}
+
+func (s *StateTracker) lockInstrumented(mutex rwLocker, mutexName, method string) {
+	if !s.InstrumentLockContention {
+		mutex.Lock()
+		return
+	}
+
+	start := time.Now()
+	mutex.Lock()
+	metrics.Timer("StateTrackerLockWait", time.Since(start), []MetricTag{
+		MetricTag{"mutex", mutexName},
+		MetricTag{"method", method},
+	}, 1.0)
+}
+
+func (s *StateTracker) updateSpeedLog(deltaPaginationKey uint64) {
+	now := time.Now()
+	if deltaPaginationKey > 0 {
+		s.lastProgressAt = now
+	}
+
+	for _, window := range s.rateWindows {
+		window.observe(deltaPaginationKey, now)
+	}
+	s.smoothedSpeed.observe(deltaPaginationKey, now, s.SmoothedSpeedHalfLife)
+
+	if s.iterationSpeedLog == nil {
+		return
+	}
+
+	s.pendingSpeedLogPaginationKeys += deltaPaginationKey
+	if !s.lastSpeedLogSampleAt.IsZero() && now.Sub(s.lastSpeedLogSampleAt) < s.MinSpeedLogSampleInterval {
+		return
+	}
+
+	deltaPaginationKey = s.pendingSpeedLogPaginationKeys
+	s.pendingSpeedLogPaginationKeys = 0
+	s.lastSpeedLogSampleAt = now
+
+	var currentTotalPaginationKey uint64
+	if s.iterationSpeedLog.Value != nil {
+		currentTotalPaginationKey = s.iterationSpeedLog.Value.(PaginationKeyPositionLog).Position
+	}
+
+	// This wraps around on overflow, see PaginationKeyPositionLog.
+	s.iterationSpeedLog = s.iterationSpeedLog.Next()
+	s.iterationSpeedLog.Value = PaginationKeyPositionLog{
+		Position: currentTotalPaginationKey + deltaPaginationKey,
+		At:       now,
+	}
 }
 
-func (s *SerializableState) MinBinlogPosition() mysql.Position {
-	nilPosition := mysql.Position{}
-	if s.LastWrittenBinlogPosition == nilPosition {
-		return s.LastStoredBinlogPositionForInlineVerifier
+// Components that buffer progress before reporting it to the StateTracker
+// must register a flush listener. When called, the listener must report all
+// the progress that has been committed to the target but not yet reported,
+// via the Update* and Mark* methods, before returning. It must not block
+// indefinitely, as the flush may happen while Ghostferry is shutting down due
+// to an error.
+func (s *StateTracker) AddFlushListener(listener func() error) {
+	s.flushListenersMutex.Lock()
+	defer s.flushListenersMutex.Unlock()
+
+	s.flushListeners = append(s.flushListeners, listener)
+}
+
+// Flush is called by the Ferry before the final Serialize, at the end of the
+// run and when the state is dumped by SerializeStateToJSON, such that the
+// serialized state does not under-report the progress and cause data to be
+// needlessly recopied on resume. The periodic checkpoints do not flush, as
+// they are superseded by the next one anyway. When Flush returns, all flush
+// listeners have reported their pending progress. The first error returned by
+// a listener is returned, but all the listeners are always called.
+func (s *StateTracker) Flush() error {
+	s.flushListenersMutex.Lock()
+	listeners := make([]func() error, len(s.flushListeners))
+	copy(listeners, s.flushListeners)
+	s.flushListenersMutex.Unlock()
+
+	var firstErr error
+	for _, listener := range listeners {
+		err := listener()
+		if err != nil {
+			s.logger.WithError(err).Error("failed to flush pending progress")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
 
-	if s.LastStoredBinlogPositionForInlineVerifier == nilPosition {
-		return s.LastWrittenBinlogPosition
+	return firstErr
+}
+
+// The size of the buffer of each subscription channel. Events are dropped for
+// subscribers whose buffer is full.
+const progressEventBufferSize = 100
+
+// Subscribe returns a channel on which ProgressEvents are delivered as they
+// happen, as an alternative to polling the StateTracker. Events are never
+// blocking: if the subscriber does not keep up and the channel buffer is
+// full, events are dropped, such that a stuck subscriber cannot stall the
+// copy. The channel is closed by Unsubscribe.
+func (s *StateTracker) Subscribe() <-chan ProgressEvent {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	ch := make(chan ProgressEvent, progressEventBufferSize)
+	s.subscribers[ch] = ch
+	return ch
+}
+
+// Returns a channel on which the name of each table is delivered when it
+// completes, once per table: completing an already completed table delivers
+// nothing. The tables completed before the call are not delivered, see
+// WaitForTableComplete to wait for a given table instead. As for Subscribe,
+// the completions are dropped when the channel buffer is full, so as not to
+// stall the copy.
+//
+// The channel is closed by Finalize, which the Ferry calls when the run is
+// done, so it can be ranged over. The channel of a finalized tracker is
+// returned closed.
+func (s *StateTracker) CompletionEvents() <-chan string {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	ch := make(chan string, progressEventBufferSize)
+	if !s.FinalizedAt().IsZero() {
+		close(ch)
+		return ch
 	}
 
-	if s.LastWrittenBinlogPosition.Compare(s.LastStoredBinlogPositionForInlineVerifier) >= 0 {
-		return s.LastStoredBinlogPositionForInlineVerifier
-	} else {
-		return s.LastWrittenBinlogPosition
+	s.completionSubscribers = append(s.completionSubscribers, ch)
+	return ch
+}
+
+// Must be called after the tracker is finalized, such that no table can
+// complete anymore.
+func (s *StateTracker) closeCompletionEvents() {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	for _, subscriber := range s.completionSubscribers {
+		close(subscriber)
 	}
+	s.completionSubscribers = nil
 }
 
-// For tracking the speed of the copy
-type PaginationKeyPositionLog struct {
-	Position uint64
-	At       time.Time
+func (s *StateTracker) Unsubscribe(ch <-chan ProgressEvent) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	subscriber, found := s.subscribers[ch]
+	if !found {
+		return
+	}
+
+	delete(s.subscribers, ch)
+	close(subscriber)
 }
 
-func newSpeedLogRing(speedLogCount int) *ring.Ring {
-	if speedLogCount <= 0 {
-		return nil
+func (s *StateTracker) publish(event ProgressEvent) {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	s.traceEvent(event)
+
+	for _, subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			s.logger.WithField("event", event.Type).Debug("progress event subscriber is full, dropping event")
+		}
+	}
+}
+
+// Records the phase the Ferry is in. Possible values are defined in ferry.go.
+func (s *StateTracker) SetPhase(phase string) {
+	s.lockCopy("SetPhase")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("SetPhase") {
+		return
 	}
 
-	speedLog := ring.New(speedLogCount)
-	speedLog.Value = PaginationKeyPositionLog{
-		Position: 0,
-		At:       time.Now(),
+	if s.phase == phase {
+		return
 	}
 
-	return speedLog
+	now := time.Now()
+	if s.phase != "" {
+		s.phaseDurations[s.phase] += now.Sub(s.phaseStartedAt)
+	}
+
+	s.phase = phase
+	s.phaseStartedAt = now
+	s.publish(ProgressEvent{
+		Type:  ProgressEventPhaseChanged,
+		At:    time.Now(),
+		Phase: phase,
+	})
 }
 
-type StateTracker struct {
-	BinlogRWMutex *sync.RWMutex
-	CopyRWMutex   *sync.RWMutex
+func (s *StateTracker) Phase() string {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
 
-	lastWrittenBinlogPosition                 mysql.Position
-	lastStoredBinlogPositionForInlineVerifier mysql.Position
+	return s.phase
+}
 
-	lastSuccessfulPaginationKeys map[string]uint64
-	completedTables              map[string]bool
+// Records that the schema is frozen, such as while the application changes
+// the schema of the target, until the matching EndSchemaFreeze. A state
+// serialized in between could reference a schema that is about to change, so
+// CanSerialize returns false. Freezes can be nested.
+func (s *StateTracker) BeginSchemaFreeze() {
+	s.lockCopy("BeginSchemaFreeze")
+	defer s.copyMutex.Unlock()
 
-	iterationSpeedLog *ring.Ring
+	s.schemaFreezes++
 }
 
-func NewStateTracker(speedLogCount int) *StateTracker {
-	return &StateTracker{
-		BinlogRWMutex: &sync.RWMutex{},
-		CopyRWMutex:   &sync.RWMutex{},
+func (s *StateTracker) EndSchemaFreeze() {
+	s.lockCopy("EndSchemaFreeze")
+	defer s.copyMutex.Unlock()
 
-		lastSuccessfulPaginationKeys: make(map[string]uint64),
-		completedTables:              make(map[string]bool),
-		iterationSpeedLog:            newSpeedLogRing(speedLogCount),
+	if s.schemaFreezes == 0 {
+		s.logger.Error("cannot end a schema freeze that did not begin, this is likely a programmer error")
+		return
 	}
-}
 
-// serializedState is a state the tracker should start from, as opposed to
-// starting from the beginning.
-func NewStateTrackerFromSerializedState(speedLogCount int, serializedState *SerializableState) *StateTracker {
-	s := NewStateTracker(speedLogCount)
-	s.lastSuccessfulPaginationKeys = serializedState.LastSuccessfulPaginationKeys
-	s.completedTables = serializedState.CompletedTables
-	s.lastWrittenBinlogPosition = serializedState.LastWrittenBinlogPosition
-	s.lastStoredBinlogPositionForInlineVerifier = serializedState.LastStoredBinlogPositionForInlineVerifier
-	return s
+	s.schemaFreezes--
 }
 
-func (s *StateTracker) UpdateLastWrittenBinlogPosition(pos mysql.Position) {
-	s.BinlogRWMutex.Lock()
-	defer s.BinlogRWMutex.Unlock()
+// Returns false while the tracker is in a transient state that a serialized
+// state should not capture, as it would not be safe to resume from:
+//
+//   - during the cutover (see SetPhase), from the time the application is
+//     notified that the row copy is complete until Finalize, as the
+//     application is changing the source and the target;
+//   - during a schema freeze, see BeginSchemaFreeze.
+//
+// A finalized tracker can always be serialized. This only advises the
+// callers such as the periodic checkpointing of the Ferry: Serialize itself
+// is not prevented.
+func (s *StateTracker) CanSerialize() bool {
+	if !s.FinalizedAt().IsZero() {
+		return true
+	}
 
-	s.lastWrittenBinlogPosition = pos
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.phase != StateCutover && s.schemaFreezes == 0
 }
 
-func (s *StateTracker) UpdateLastStoredBinlogPositionForInlineVerifier(pos mysql.Position) {
-	s.BinlogRWMutex.Lock()
-	defer s.BinlogRWMutex.Unlock()
+// Returns the time spent in each phase, including the time spent in the
+// current phase so far. Runs resumed from a serialized state include the time
+// spent in the interrupted runs, but not the time in between the runs.
+func (s *StateTracker) PhaseDurations() map[string]time.Duration {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
 
-	s.lastStoredBinlogPositionForInlineVerifier = pos
+	return s.phaseDurationsUnlocked()
 }
 
-func (s *StateTracker) UpdateLastSuccessfulPaginationKey(table string, paginationKey uint64) {
-	s.CopyRWMutex.Lock()
-	defer s.CopyRWMutex.Unlock()
+func (s *StateTracker) phaseDurationsUnlocked() map[string]time.Duration {
+	durations := make(map[string]time.Duration, len(s.phaseDurations)+1)
+	for phase, duration := range s.phaseDurations {
+		durations[phase] = duration
+	}
 
-	deltaPaginationKey := paginationKey - s.lastSuccessfulPaginationKeys[table]
-	s.lastSuccessfulPaginationKeys[table] = paginationKey
+	if s.phase != "" {
+		end := s.FinalizedAt()
+		if end.IsZero() {
+			end = time.Now()
+		}
+		durations[s.phase] += end.Sub(s.phaseStartedAt)
+	}
 
-	s.updateSpeedLog(deltaPaginationKey)
+	return durations
 }
 
-func (s *StateTracker) LastSuccessfulPaginationKey(table string) uint64 {
-	s.CopyRWMutex.RLock()
-	defer s.CopyRWMutex.RUnlock()
+// Publishes the estimated copy speed to the subscribers at every interval,
+// until the context is done.
+func (s *StateTracker) PublishRateUpdates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	_, found := s.completedTables[table]
-	if found {
-		return math.MaxUint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.publish(ProgressEvent{
+				Type:                    ProgressEventRateUpdated,
+				At:                      time.Now(),
+				PaginationKeysPerSecond: s.EstimatedPaginationKeysPerSecond(),
+			})
+		}
 	}
+}
 
-	paginationKey, found := s.lastSuccessfulPaginationKeys[table]
-	if !found {
-		return 0
+func (s *StateTracker) SetMetadata(key, value string) {
+	s.metadataMutex.Lock()
+	defer s.metadataMutex.Unlock()
+
+	if s.rejectIfFinalized("SetMetadata") {
+		return
 	}
 
-	return paginationKey
+	s.metadata[key] = value
 }
 
-func (s *StateTracker) MarkTableAsCompleted(table string) {
-	s.CopyRWMutex.Lock()
-	defer s.CopyRWMutex.Unlock()
+func (s *StateTracker) GetMetadata(key string) (string, bool) {
+	s.metadataMutex.RLock()
+	defer s.metadataMutex.RUnlock()
 
-	s.completedTables[table] = true
+	value, found := s.metadata[key]
+	return value, found
 }
 
-func (s *StateTracker) IsTableComplete(table string) bool {
-	s.CopyRWMutex.RLock()
-	defer s.CopyRWMutex.RUnlock()
+// Pause marks the beginning of a planned pause, such as a database maintenance
+// window. The tracker does not stop the copy or the binlog streaming by
+// itself: that is done by pausing the Throttler. Until Resume is called, the
+// elapsed time is recorded as paused and is excluded from the speed
+// estimations, keeping the ETA honest across planned pauses.
+func (s *StateTracker) Pause() {
+	s.lockCopy("Pause")
+	defer s.copyMutex.Unlock()
 
-	return s.completedTables[table]
+	if s.rejectIfFinalized("Pause") {
+		return
+	}
+
+	if s.pausedAt.IsZero() {
+		s.pausedAt = time.Now()
+	}
 }
 
-// This is reasonably accurate if the rows copied are distributed uniformly
-// between paginationKey = 0 -> max(paginationKey). It would not be accurate if the distribution is
-// concentrated in a particular region.
-func (s *StateTracker) EstimatedPaginationKeysPerSecond() float64 {
-	if s.iterationSpeedLog == nil {
-		return 0.0
+func (s *StateTracker) Resume() {
+	s.lockCopy("Resume")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("Resume") {
+		return
 	}
 
-	s.CopyRWMutex.RLock()
-	defer s.CopyRWMutex.RUnlock()
+	if s.pausedAt.IsZero() {
+		return
+	}
 
-	if s.iterationSpeedLog.Value.(PaginationKeyPositionLog).Position == 0 {
-		return 0.0
+	pausedAt := s.pausedAt
+	pausedDuration := time.Since(pausedAt)
+	s.pausedAt = time.Time{}
+	s.totalPausedDuration += pausedDuration
+
+	// A planned pause is not a stall.
+	if !s.stallClockStartedAt.IsZero() {
+		s.stallClockStartedAt = s.stallClockStartedAt.Add(pausedDuration)
 	}
+	if !s.lastProgressAt.IsZero() {
+		s.lastProgressAt = s.lastProgressAt.Add(pausedDuration)
+	}
+
+	// Shift the speed log forward so the paused interval does not count
+	// towards the time it took to copy the logged pagination keys. The
+	// entries logged during the pause, such as by a batch in flight, are
+	// already past it.
+	shiftSpeedLog(s.iterationSpeedLog, pausedAt, pausedDuration)
 
-	earliest := s.iterationSpeedLog
-	for earliest.Prev() != nil && earliest.Prev() != s.iterationSpeedLog && earliest.Prev().Value.(PaginationKeyPositionLog).Position != 0 {
-		earliest = earliest.Prev()
+	for _, window := range s.rateWindows {
+		window.shift(pausedAt, pausedDuration)
 	}
+	s.smoothedSpeed.shift(pausedAt, pausedDuration)
 
-	currentValue := s.iterationSpeedLog.Value.(PaginationKeyPositionLog)
-	earliestValue := earliest.Value.(PaginationKeyPositionLog)
-	deltaPaginationKey := currentValue.Position - earliestValue.Position
-	deltaT := currentValue.At.Sub(earliestValue.At).Seconds()
+	for table, timing := range s.tableCopyTimings {
+		s.tableCopyTimings[table] = timing.shift(pausedAt, pausedDuration)
+	}
 
-	return float64(deltaPaginationKey) / deltaT
+	for _, speedLog := range s.tableSpeedLogs {
+		speedLog.shift(pausedAt, pausedDuration)
+	}
+
+	// The tables paused during the pause already had their timings shifted,
+	// so the pause is excluded from their own pause as well.
+	for _, pause := range s.pausedTables {
+		pause.at = pause.at.Add(pausedDuration)
+	}
 }
 
-func (s *StateTracker) updateSpeedLog(deltaPaginationKey uint64) {
-	if s.iterationSpeedLog == nil {
+type tablePause struct {
+	at time.Time
+
+	// Closed once the table is resumed.
+	resumed chan struct{}
+}
+
+func newTablePause(at time.Time) *tablePause {
+	return &tablePause{at: at, resumed: make(chan struct{})}
+}
+
+// Pauses the copy of a single table, such as a table whose copy causes lock
+// contention on the source, while the other tables keep being copied. The
+// DataIterator stops iterating the table before its next batch, and iterates
+// it again from its last successful pagination key once ResumeTable is
+// called. The paused interval does not count towards the copy rate of the
+// table. The table stays paused on resume from a serialized state.
+//
+// Unlike Pause, the binlog streaming is not affected, and the overall copy
+// rate keeps accounting for the time, as the other tables are copied.
+func (s *StateTracker) PauseTable(table string) {
+	s.lockCopy("PauseTable")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("PauseTable") {
 		return
 	}
 
-	currentTotalPaginationKey := s.iterationSpeedLog.Value.(PaginationKeyPositionLog).Position
-	s.iterationSpeedLog = s.iterationSpeedLog.Next()
-	s.iterationSpeedLog.Value = PaginationKeyPositionLog{
-		Position: currentTotalPaginationKey + deltaPaginationKey,
-		At:       time.Now(),
+	if _, found := s.pausedTables[table]; found || s.droppedTables[table] {
+		return
+	}
+
+	s.pausedTables[table] = newTablePause(time.Now())
+}
+
+func (s *StateTracker) ResumeTable(table string) {
+	s.lockCopy("ResumeTable")
+	defer s.copyMutex.Unlock()
+
+	if s.rejectIfFinalized("ResumeTable") {
+		return
+	}
+
+	pause, found := s.pausedTables[table]
+	if !found {
+		return
+	}
+
+	delete(s.pausedTables, table)
+	close(pause.resumed)
+
+	// While the tracker itself is paused, the whole pause is excluded by
+	// Resume instead.
+	pausedDuration := time.Since(pause.at)
+	if !s.pausedAt.IsZero() {
+		pausedDuration = s.pausedAt.Sub(pause.at)
+	}
+	if pausedDuration <= 0 {
+		return
+	}
+
+	if timing, found := s.tableCopyTimings[table]; found {
+		s.tableCopyTimings[table] = timing.shift(pause.at, pausedDuration)
+	}
+
+	if speedLog, found := s.tableSpeedLogs[table]; found {
+		speedLog.shift(pause.at, pausedDuration)
+	}
+}
+
+// Shifts the entries of the speed log forward, such that a pause does not
+// count towards the time it took to copy the logged pagination keys.
+func shiftSpeedLog(speedLog *ring.Ring, pausedAt time.Time, pausedDuration time.Duration) {
+	if speedLog == nil {
+		return
+	}
+
+	for i, r := 0, speedLog; i < r.Len(); i, r = i+1, r.Next() {
+		if r.Value == nil {
+			continue
+		}
+
+		entry := r.Value.(PaginationKeyPositionLog)
+		if !entry.At.Before(pausedAt) {
+			continue
+		}
+
+		entry.At = entry.At.Add(pausedDuration)
+		r.Value = entry
+	}
+}
+
+func (s *StateTracker) IsTablePaused(table string) bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	_, found := s.pausedTables[table]
+	return found
+}
+
+// Returns the tables paused with PauseTable, sorted by name.
+func (s *StateTracker) PausedTables() []string {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.pausedTablesUnlocked()
+}
+
+func (s *StateTracker) pausedTablesUnlocked() []string {
+	tables := make([]string, 0, len(s.pausedTables))
+	for table := range s.pausedTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Returns a channel that is closed once the table is resumed with
+// ResumeTable, or dropped. The channel is already closed if the table is not
+// paused.
+func (s *StateTracker) TableResumed(table string) <-chan struct{} {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	pause, found := s.pausedTables[table]
+	if !found {
+		resumed := make(chan struct{})
+		close(resumed)
+		return resumed
+	}
+	return pause.resumed
+}
+
+func (s *StateTracker) IsPaused() bool {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return !s.pausedAt.IsZero()
+}
+
+// The total time spent paused, including the current pause if there is one and
+// the pauses of the interrupted runs this run resumed from.
+func (s *StateTracker) PausedDuration() time.Duration {
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	return s.pausedDurationUnlocked()
+}
+
+func (s *StateTracker) pausedDurationUnlocked() time.Duration {
+	if s.pausedAt.IsZero() {
+		return s.totalPausedDuration
 	}
+
+	return s.totalPausedDuration + time.Since(s.pausedAt)
 }
 
+// Serializes the state to checkpoint or dump it: every call increments the
+// Generation and is traced as a SpanSerialize. Use Snapshot to only inspect
+// the state, such that the Generation and the traces count the checkpoints.
 func (s *StateTracker) Serialize(lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore) *SerializableState {
-	s.BinlogRWMutex.RLock()
-	defer s.BinlogRWMutex.RUnlock()
+	// Hashing the schemas of all the tables is slow, so it is done before
+	// taking the locks rather than stalling the copy and the binlog streaming.
+	var schemaHashes map[string]string
+	if lastKnownTableSchemaCache != nil {
+		hashes, err := lastKnownTableSchemaCache.SchemaHashes()
+		if err != nil {
+			// The hashes are only an optimization for drift detection, which
+			// falls back to hashing LastKnownTableSchemaCache.
+			s.logger.WithError(err).Warn("failed to hash the table schema cache")
+		} else {
+			schemaHashes = hashes
+		}
+	}
+
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	s.metadataMutex.RLock()
+	defer s.metadataMutex.RUnlock()
+
+	span := s.startSpan(SpanSerialize, map[string]interface{}{
+		"binlog_file": s.lastWrittenBinlogPosition.Name,
+	})
+	defer span.End()
+
+	state := s.serializeUnlocked(lastKnownTableSchemaCache, binlogVerifyStore)
+	state.Generation = atomic.AddUint64(&s.generation, 1)
+	s.lastSerialized.Store(serializeRecord{At: time.Now(), BinlogPosition: state.MinBinlogPosition()})
+	if schemaHashes != nil {
+		state.LastKnownTableSchemaHashes = schemaHashes
+		state.LastKnownTableSchemaCacheHash = CombinedSchemaHash(schemaHashes)
+		s.storeSerializedSchemaHashes(schemaHashes)
+	}
+
+	return state
+}
 
-	s.CopyRWMutex.RLock()
-	defer s.CopyRWMutex.RUnlock()
+// Returns true if the schema of the table in previous differs from the schema
+// the table had in the schema cache of the last Serialize, according to the
+// per table SchemaHash stamped into its LastKnownTableSchemaHashes, including
+// if the table is only in one of them. A resumed tracker compares with the
+// schema of the state it was resumed from. The binlog applier can then detect
+// that a DDL changed the table since the schema it applies the row events
+// with was loaded. Returns false if no state was serialized with a schema
+// cache.
+func (s *StateTracker) SchemaChangedSince(table string, previous TableSchemaCache) bool {
+	hashes, _ := s.lastSerializedSchemaHashes.Load().(map[string]string)
+	if hashes == nil {
+		return false
+	}
+
+	lastHash, known := hashes[table]
+	previousTable, found := previous[table]
+	if !known || !found {
+		return known != found
+	}
+
+	previousHash, err := previousTable.SchemaHash()
+	if err != nil {
+		s.logger.WithError(err).WithField("table", table).Warn("failed to hash the schema of the table, assuming it changed")
+		return true
+	}
+	return previousHash != lastHash
+}
+
+// The hashes are copied, as the state they come from is owned by the caller
+// of Serialize.
+func (s *StateTracker) storeSerializedSchemaHashes(hashes map[string]string) {
+	stored := make(map[string]string, len(hashes))
+	for table, hash := range hashes {
+		stored[table] = hash
+	}
+	s.lastSerializedSchemaHashes.Store(stored)
+}
+
+// Returns a copy of the state at a single instant, as Serialize does, for
+// external tools to inspect, e.g. to compare the binlog position with the
+// copied pagination keys. Unlike Serialize, this is not a checkpoint: the
+// Generation is that of the last Serialize and is not incremented, and the
+// state has no schema cache nor binlog verify store, and it is not recorded
+// as the last serialized state, see EstimatedBinlogRetentionNeeded. The Ferry
+// builds its progress reports from it. The state shares no memory with the
+// tracker.
+func (s *StateTracker) Snapshot() SerializableState {
+	s.binlogMutex.RLock()
+	defer s.binlogMutex.RUnlock()
+
+	s.copyMutex.RLock()
+	defer s.copyMutex.RUnlock()
+
+	s.metadataMutex.RLock()
+	defer s.metadataMutex.RUnlock()
 
+	state := s.serializeUnlocked(nil, nil)
+	state.Generation = atomic.LoadUint64(&s.generation)
+	return *state
+}
+
+// Must be called with the read locks of BinlogRWMutex, CopyRWMutex and
+// metadataMutex held, see Serialize.
+func (s *StateTracker) serializeUnlocked(lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore) *SerializableState {
 	state := &SerializableState{
 		GhostferryVersion:                         VersionString,
 		LastKnownTableSchemaCache:                 lastKnownTableSchemaCache,
 		LastSuccessfulPaginationKeys:              make(map[string]uint64),
+		FirstPaginationKeys:                       make(map[string]uint64),
+		CompletedPaginationKeyRanges:              make(map[string][][2]uint64),
 		CompletedTables:                           make(map[string]bool),
+		CopyCompletedTables:                       make(map[string]bool),
+		TableErrors:                               make(map[string]string),
 		LastWrittenBinlogPosition:                 s.lastWrittenBinlogPosition,
 		LastStoredBinlogPositionForInlineVerifier: s.lastStoredBinlogPositionForInlineVerifier,
+		Paused:              !s.pausedAt.IsZero(),
+		TotalPausedDuration: s.pausedDurationUnlocked(),
+		PhaseDurations:      s.phaseDurationsUnlocked(),
+		RowsCopied:          s.rowsCopied,
+		FinalizedAt:         s.FinalizedAt(),
+
+		BinlogPositionOverrides:  append([]BinlogPositionOverride(nil), s.binlogPositionOverrides...),
+		EarliestAppliedEventTime: s.earliestAppliedEventTime,
+		LatestAppliedEventTime:   s.latestAppliedEventTime,
+		CompletionPredicates:     make(map[string]string),
+		CompactCompletedTables:   s.CompactCompletedTables,
+	}
+
+	if s.lastWrittenGTIDSet != nil {
+		state.LastWrittenGTIDSet = s.lastWrittenGTIDSet.String()
+	}
+
+	if s.lastWrittenCoordinate != nil {
+		coordinate, err := SerializeReplicationCoordinate(s.lastWrittenCoordinate)
+		if err != nil {
+			s.logger.WithError(err).WithField("coordinate", s.lastWrittenCoordinate.String()).Error("failed to serialize the last written coordinate")
+		} else {
+			state.LastWrittenCoordinate = coordinate
+		}
+	}
+
+	if len(s.binlogConsumerPositions) > 0 {
+		state.BinlogConsumerPositions = make(map[string]mysql.Position, len(s.binlogConsumerPositions))
+		for name, pos := range s.binlogConsumerPositions {
+			state.BinlogConsumerPositions[name] = pos
+		}
+	}
+
+	if s.TrackTableRowsCopied {
+		state.TableRowsCopied = s.tableRowsCopiedUnlocked()
+	}
+
+	if len(s.skippedRows) > 0 {
+		state.SkippedRows = make(map[string]uint64, len(s.skippedRows))
+		for table, rows := range s.skippedRows {
+			state.SkippedRows[table] = rows
+		}
+	}
+
+	if len(s.deletedRows) > 0 {
+		state.DeletedRows = make(map[string]uint64, len(s.deletedRows))
+		for table, rows := range s.deletedRows {
+			state.DeletedRows[table] = rows
+		}
+	}
+
+	if len(s.excludedPaginationKeyRanges) > 0 {
+		state.ExcludedPaginationKeyRanges = make(map[string][][2]uint64, len(s.excludedPaginationKeyRanges))
+		for table, ranges := range s.excludedPaginationKeyRanges {
+			state.ExcludedPaginationKeyRanges[table] = append([][2]uint64(nil), ranges...)
+		}
 	}
 
 	if binlogVerifyStore != nil {
@@ -236,9 +5223,125 @@ func (s *StateTracker) Serialize(lastKnownTableSchemaCache TableSchemaCache, bin
 		state.LastSuccessfulPaginationKeys[k] = v
 	}
 
+	for k, v := range s.firstPaginationKeys {
+		state.FirstPaginationKeys[k] = v
+	}
+
+	for k, v := range s.completedPaginationKeyRanges {
+		if v.isBitmap() {
+			if state.CompletedPaginationKeyBitmaps == nil {
+				state.CompletedPaginationKeyBitmaps = make(map[string][]byte)
+			}
+			state.CompletedPaginationKeyBitmaps[k] = v.marshalBitmap()
+			continue
+		}
+		state.CompletedPaginationKeyRanges[k] = append([][2]uint64(nil), v.ranges...)
+	}
+
 	for k, v := range s.completedTables {
 		state.CompletedTables[k] = v
 	}
 
+	for k, v := range s.copyCompletedTables {
+		state.CopyCompletedTables[k] = v
+	}
+
+	for k, v := range s.completionPredicates {
+		state.CompletionPredicates[k] = v.Name()
+	}
+
+	if len(s.unverifiedTables) > 0 {
+		state.UnverifiedCompletedTables = make([]string, 0, len(s.unverifiedTables))
+		for table := range s.unverifiedTables {
+			state.UnverifiedCompletedTables = append(state.UnverifiedCompletedTables, table)
+		}
+		sort.Strings(state.UnverifiedCompletedTables)
+	}
+
+	if s.iterationSpeedLog != nil {
+		for i, r := 0, s.iterationSpeedLog.Next(); i < r.Len(); i, r = i+1, r.Next() {
+			if r.Value != nil {
+				state.SpeedLog = append(state.SpeedLog, r.Value.(PaginationKeyPositionLog))
+			}
+		}
+	}
+
+	if len(s.droppedTables) > 0 {
+		state.DroppedTables = make([]string, 0, len(s.droppedTables))
+		for table := range s.droppedTables {
+			state.DroppedTables = append(state.DroppedTables, table)
+		}
+		sort.Strings(state.DroppedTables)
+	}
+
+	if len(s.pausedTables) > 0 {
+		state.PausedTables = s.pausedTablesUnlocked()
+	}
+
+	state.ReachedMilestones = s.reachedMilestonesSorted()
+
+	if len(s.lastCleanedPaginationKeys) > 0 {
+		state.LastCleanedPaginationKeys = make(map[string]uint64, len(s.lastCleanedPaginationKeys))
+		for table, paginationKey := range s.lastCleanedPaginationKeys {
+			state.LastCleanedPaginationKeys[table] = paginationKey
+		}
+	}
+
+	if len(s.tableCompletionBinlogPositions) > 0 {
+		state.TableCompletionBinlogPositions = make(map[string]mysql.Position, len(s.tableCompletionBinlogPositions))
+		for table, pos := range s.tableCompletionBinlogPositions {
+			state.TableCompletionBinlogPositions[table] = pos
+		}
+	}
+
+	if len(s.cleanedTables) > 0 {
+		state.CleanedTables = make([]string, 0, len(s.cleanedTables))
+		for table := range s.cleanedTables {
+			state.CleanedTables = append(state.CleanedTables, table)
+		}
+		sort.Strings(state.CleanedTables)
+	}
+
+	if len(s.tableDependencies) > 0 {
+		state.TableDependencies = make(map[string][]string, len(s.tableDependencies))
+		for table, prerequisites := range s.tableDependencies {
+			state.TableDependencies[table] = append([]string(nil), prerequisites...)
+		}
+	}
+
+	for table := range s.declaredMaxPaginationKeys {
+		if s.nearKeyExhaustionUnlocked(table) {
+			state.TablesNearKeyExhaustion = append(state.TablesNearKeyExhaustion, table)
+		}
+	}
+	sort.Strings(state.TablesNearKeyExhaustion)
+
+	for k, v := range s.tableErrors {
+		state.TableErrors[k] = v
+	}
+
+	if len(s.metadata) > 0 {
+		state.Metadata = make(map[string]string, len(s.metadata))
+		for k, v := range s.metadata {
+			state.Metadata[k] = v
+		}
+	}
+
+	return state
+}
+
+// Like Serialize, but leaves the LastKnownTableSchemaCache out of the state,
+// which is then orders of magnitude smaller with a large schema, for frequent
+// checkpoints. lastKnownTableSchemaCache is only hashed into
+// LastKnownTableSchemaHashes.
+//
+// Such a state cannot be resumed from on its own: the Ferry resumes with its
+// TableSchemaCacheToResumeWith, such as a schema cache stored separately at
+// the start of the run, or otherwise reloads the schema from the source. The
+// schema is then verified against the hashes of the state, if any.
+func (s *StateTracker) SerializeProgressOnly(lastKnownTableSchemaCache TableSchemaCache, binlogVerifyStore *BinlogVerifyStore) *SerializableState {
+	state := s.Serialize(lastKnownTableSchemaCache, binlogVerifyStore)
+	state.LastKnownTableSchemaCache = nil
+	state.LastKnownTableSchemaCacheOmitted = true
 	return state
 }
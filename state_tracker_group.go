@@ -0,0 +1,183 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// The state of a StateTrackerGroup: the state of each of its trackers, keyed
+// by the name of its migration. This is stored in place of a
+// SerializableState by processes running several migrations.
+type SerializableStateGroup struct {
+	States map[string]*SerializableState
+}
+
+// Owns the StateTrackers of logically separate migrations run by a single
+// process, such as a copydb migrating several tenants. The trackers are
+// independent and keyed by the name of their migration: the group only adds
+// the views aggregated across them, and serializes them into a single
+// SerializableStateGroup, from which each one is restored on resume.
+type StateTrackerGroup struct {
+	speedLogCount int
+
+	trackersMutex sync.RWMutex
+	trackers      map[string]*StateTracker
+}
+
+// The trackers created by the group have speedLogCount entries in their speed
+// log, see NewStateTracker.
+func NewStateTrackerGroup(speedLogCount int) *StateTrackerGroup {
+	return &StateTrackerGroup{
+		speedLogCount: speedLogCount,
+		trackers:      make(map[string]*StateTracker),
+	}
+}
+
+// Restores a tracker from each of the states of serializedState, see
+// NewStateTrackerFromSerializedState.
+func NewStateTrackerGroupFromSerializedState(speedLogCount int, serializedState *SerializableStateGroup) *StateTrackerGroup {
+	g := NewStateTrackerGroup(speedLogCount)
+	for name, state := range serializedState.States {
+		g.trackers[name] = NewStateTrackerFromSerializedState(speedLogCount, state)
+	}
+	return g
+}
+
+// Returns the tracker of the migration, which is created if the group does
+// not have one yet, such as for a migration that was not part of the state
+// the group was restored from.
+func (g *StateTrackerGroup) Tracker(name string) *StateTracker {
+	g.trackersMutex.Lock()
+	defer g.trackersMutex.Unlock()
+
+	tracker, found := g.trackers[name]
+	if !found {
+		tracker = NewStateTracker(g.speedLogCount)
+		g.trackers[name] = tracker
+	}
+	return tracker
+}
+
+// Adds a tracker constructed by the caller, such as with
+// NewStateTrackerForBinlogOnly. An error is returned if the group already
+// has a tracker for the migration.
+func (g *StateTrackerGroup) Add(name string, tracker *StateTracker) error {
+	g.trackersMutex.Lock()
+	defer g.trackersMutex.Unlock()
+
+	if _, found := g.trackers[name]; found {
+		return fmt.Errorf("the group already has a tracker for migration %s", name)
+	}
+
+	g.trackers[name] = tracker
+	return nil
+}
+
+// Removes the tracker of the migration, such that it is not part of the
+// aggregated views nor of the serialized states anymore.
+func (g *StateTrackerGroup) Remove(name string) {
+	g.trackersMutex.Lock()
+	defer g.trackersMutex.Unlock()
+
+	delete(g.trackers, name)
+}
+
+// Returns the names of the migrations of the group, sorted.
+func (g *StateTrackerGroup) Names() []string {
+	g.trackersMutex.RLock()
+	defer g.trackersMutex.RUnlock()
+
+	names := make([]string, 0, len(g.trackers))
+	for name := range g.trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The sum of the EstimatedPaginationKeysPerSecond of the trackers.
+func (g *StateTrackerGroup) EstimatedPaginationKeysPerSecond() float64 {
+	var rate float64
+	for _, tracker := range g.snapshot() {
+		rate += tracker.EstimatedPaginationKeysPerSecond()
+	}
+	return rate
+}
+
+// The sum of the Rates of the trackers, for each of the rate windows.
+func (g *StateTrackerGroup) Rates() map[string]float64 {
+	rates := make(map[string]float64)
+	for _, tracker := range g.snapshot() {
+		for window, rate := range tracker.Rates() {
+			rates[window] += rate
+		}
+	}
+	return rates
+}
+
+// The sum of the RowsCopied of the trackers.
+func (g *StateTrackerGroup) RowsCopied() uint64 {
+	var rows uint64
+	for _, tracker := range g.snapshot() {
+		rows += tracker.RowsCopied()
+	}
+	return rows
+}
+
+// Returns the fraction of the copy that is complete across the migrations.
+// tableSizes maps each migration to the table sizes given to the
+// OverallProgress of its tracker. Each migration contributes in proportion to
+// the total size of its tables or, if none of the migrations has sizes,
+// equally.
+func (g *StateTrackerGroup) OverallProgress(tableSizes map[string]map[string]uint64) float64 {
+	trackers := g.snapshot()
+	if len(trackers) == 0 {
+		return 0
+	}
+
+	var totalSize, copiedSize, progressSum float64
+	for name, tracker := range trackers {
+		progress := tracker.OverallProgress(tableSizes[name])
+		progressSum += progress
+
+		var size float64
+		for _, tableSize := range tableSizes[name] {
+			size += float64(tableSize)
+		}
+		totalSize += size
+		copiedSize += size * progress
+	}
+
+	if totalSize == 0 {
+		return progressSum / float64(len(trackers))
+	}
+	return copiedSize / totalSize
+}
+
+// Serializes each tracker with the schema cache and binlog verify store of
+// its migration, if any, see StateTracker.Serialize.
+func (g *StateTrackerGroup) Serialize(lastKnownTableSchemaCaches map[string]TableSchemaCache, binlogVerifyStores map[string]*BinlogVerifyStore) *SerializableStateGroup {
+	trackers := g.snapshot()
+
+	state := &SerializableStateGroup{
+		States: make(map[string]*SerializableState, len(trackers)),
+	}
+	for name, tracker := range trackers {
+		state.States[name] = tracker.Serialize(lastKnownTableSchemaCaches[name], binlogVerifyStores[name])
+	}
+	return state
+}
+
+// Returns a copy of the trackers, such that the trackers are called without
+// holding the trackersMutex.
+func (g *StateTrackerGroup) snapshot() map[string]*StateTracker {
+	g.trackersMutex.RLock()
+	defer g.trackersMutex.RUnlock()
+
+	trackers := make(map[string]*StateTracker, len(g.trackers))
+	for name, tracker := range g.trackers {
+		trackers[name] = tracker
+	}
+	return trackers
+}
@@ -0,0 +1,73 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returns an error if a run of the Ghostferry currentVersion, usually
+// VersionString, cannot resume from the state. The versions are of the form
+// MAJOR.MINOR.PATCH, optionally followed by "+" and build metadata, which is
+// ignored. The policy is that:
+//
+//   - identical versions are always compatible, including the unparsable
+//     versions of development builds,
+//   - the major versions must be the same, as a new major version may change
+//     the meaning of the state, and
+//   - the version of the state must not be newer than the current version, as
+//     an older version would ignore, and then drop, the parts of the state it
+//     does not know about.
+//
+// See Config.AllowVersionMismatch to resume regardless.
+func (s *SerializableState) CheckCompatibility(currentVersion string) error {
+	if s.GhostferryVersion == currentVersion {
+		return nil
+	}
+
+	stateVersion, err := parseGhostferryVersion(s.GhostferryVersion)
+	if err != nil {
+		return fmt.Errorf("cannot resume from a state of version %q with version %q: %v", s.GhostferryVersion, currentVersion, err)
+	}
+
+	runningVersion, err := parseGhostferryVersion(currentVersion)
+	if err != nil {
+		return fmt.Errorf("cannot resume from a state of version %q with version %q: %v", s.GhostferryVersion, currentVersion, err)
+	}
+
+	if stateVersion[0] != runningVersion[0] {
+		return fmt.Errorf("cannot resume from a state of version %q with version %q: the major versions differ", s.GhostferryVersion, currentVersion)
+	}
+
+	for i := 1; i < len(stateVersion); i++ {
+		if stateVersion[i] != runningVersion[i] {
+			if stateVersion[i] > runningVersion[i] {
+				return fmt.Errorf("cannot resume from a state of version %q with version %q: the state is from a newer version", s.GhostferryVersion, currentVersion)
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// Parses the MAJOR.MINOR.PATCH of a VersionString.
+func parseGhostferryVersion(version string) ([3]uint64, error) {
+	var parsed [3]uint64
+
+	release := strings.SplitN(version, "+", 2)[0]
+	parts := strings.Split(release, ".")
+	if len(parts) != len(parsed) {
+		return parsed, fmt.Errorf("version %q is not of the form MAJOR.MINOR.PATCH", version)
+	}
+
+	for i, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return parsed, fmt.Errorf("version %q is not of the form MAJOR.MINOR.PATCH", version)
+		}
+		parsed[i] = number
+	}
+
+	return parsed, nil
+}
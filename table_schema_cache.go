@@ -1,8 +1,13 @@
 package ghostferry
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
@@ -39,6 +44,13 @@ type TableSchema struct {
 	PaginationKeyColumn              *schema.TableColumn
 	PaginationKeyIndex               int
 
+	// The name of the unique index the PaginationKeyColumn is paginated
+	// over: PRIMARY for the primary key, the configured index name if the
+	// table is paginated over a unique index, or empty if the column was
+	// configured directly. As the schema cache is part of the serialized
+	// state, a resumed run paginates over the same index.
+	PaginationKeyIndexName string
+
 	rowMd5Query string
 }
 
@@ -101,8 +113,53 @@ func (t *TableSchema) RowMd5Query() string {
 	return t.rowMd5Query
 }
 
+// A hash of everything Ghostferry knows about the table's schema. Two tables
+// with the same hash are interchangeable as far as Ghostferry is concerned,
+// which makes comparing schemas cheap.
+func (t *TableSchema) SchemaHash() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 type TableSchemaCache map[string]*TableSchema
 
+// Returns the SchemaHash of every table in the cache, keyed by table name.
+func (c TableSchemaCache) SchemaHashes() (map[string]string, error) {
+	hashes := make(map[string]string, len(c))
+	for tableName, tableSchema := range c {
+		hash, err := tableSchema.SchemaHash()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash schema of %s: %v", tableName, err)
+		}
+
+		hashes[tableName] = hash
+	}
+
+	return hashes, nil
+}
+
+// Combines the per table hashes, as returned by SchemaHashes, into a single
+// hash for the whole cache.
+func CombinedSchemaHash(hashes map[string]string) string {
+	tableNames := make([]string, 0, len(hashes))
+	for tableName := range hashes {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	h := sha256.New()
+	for _, tableName := range tableNames {
+		fmt.Fprintf(h, "%s:%s\n", tableName, hashes[tableName])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func fullTableName(schemaName, tableName string) string {
 	return fmt.Sprintf("%s.%s", schemaName, tableName)
 }
@@ -195,13 +252,14 @@ func LoadTables(db *sql.DB, tableFilter TableFilter, columnCompressionConfig Col
 			tableLog := dbLog.WithField("table", tableName)
 			tableLog.Debug("caching table schema")
 
-			paginationKeyColumn, paginationKeyIndex, err := tableSchema.paginationKeyColumn(cascadingPaginationColumnConfig)
+			paginationKeyColumn, paginationKeyIndex, paginationKeyIndexName, err := tableSchema.paginationKeyColumn(db, cascadingPaginationColumnConfig)
 			if err != nil {
 				logger.WithError(err).Error("invalid table")
 				return tableSchemaCache, err
 			}
 			tableSchema.PaginationKeyColumn = paginationKeyColumn
 			tableSchema.PaginationKeyIndex = paginationKeyIndex
+			tableSchema.PaginationKeyIndexName = paginationKeyIndexName
 
 			tableSchemaCache[tableSchema.String()] = tableSchema
 		}
@@ -212,6 +270,63 @@ func LoadTables(db *sql.DB, tableFilter TableFilter, columnCompressionConfig Col
 	return tableSchemaCache, nil
 }
 
+// Loads the schema of the targetTables, keyed by the names of the source
+// tables in lastKnown they are copied from, into a cache keyed by the names of
+// the target tables, see SerializableState.ValidateTargetAgainst. The tables
+// missing from db are missing from the cache. The pagination key column of a
+// target table is the column of the same name as that of its source table.
+func loadTargetTables(db *sql.DB, targetTables map[string]TableIdentifier, lastKnown TableSchemaCache) (TableSchemaCache, error) {
+	tableSchemaCache := make(TableSchemaCache)
+
+	dbnames, err := showDatabases(db)
+	if err != nil {
+		return tableSchemaCache, err
+	}
+
+	existingTables := make(map[string]map[string]bool, len(dbnames))
+	for _, dbname := range dbnames {
+		existingTables[dbname] = nil
+	}
+
+	for tableName, targetTable := range targetTables {
+		tables, found := existingTables[targetTable.SchemaName]
+		if !found {
+			continue
+		}
+
+		if tables == nil {
+			tableNames, err := showTablesFrom(db, targetTable.SchemaName)
+			if err != nil {
+				return tableSchemaCache, err
+			}
+
+			tables = make(map[string]bool, len(tableNames))
+			for _, name := range tableNames {
+				tables[name] = true
+			}
+			existingTables[targetTable.SchemaName] = tables
+		}
+
+		if !tables[targetTable.TableName] {
+			continue
+		}
+
+		table, err := schema.NewTableFromSqlDB(db, targetTable.SchemaName, targetTable.TableName)
+		if err != nil {
+			return tableSchemaCache, err
+		}
+
+		tableSchema := &TableSchema{Table: table}
+		if source := lastKnown[tableName]; source != nil && source.PaginationKeyColumn != nil {
+			tableSchema.PaginationKeyColumn, tableSchema.PaginationKeyIndex, _ = tableSchema.findColumnByName(source.PaginationKeyColumn.Name)
+		}
+
+		tableSchemaCache[tableSchema.String()] = tableSchema
+	}
+
+	return tableSchemaCache, nil
+}
+
 func (t *TableSchema) findColumnByName(name string) (*schema.TableColumn, int, error) {
 	for i, column := range t.Columns {
 		if column.Name == name {
@@ -228,7 +343,12 @@ func NonExistingPaginationKeyColumnError(schema, table, paginationKey string) er
 
 // NonExistingPaginationKeyError exported to facilitate black box testing
 func NonExistingPaginationKeyError(schema, table string) error {
-	return fmt.Errorf("%s has no Primary Key to default to for Pagination purposes. Kindly specify a Pagination Key for this table in the CascadingPaginationColumnConfig", QuotedTableNameFromString(schema, table))
+	return fmt.Errorf("%s has no Primary Key to default to for Pagination purposes. Kindly specify a Pagination Key or a unique index for this table in the CascadingPaginationColumnConfig", QuotedTableNameFromString(schema, table))
+}
+
+// UnsuitablePaginationIndexError exported to facilitate black box testing
+func UnsuitablePaginationIndexError(schema, table, index, reason string) error {
+	return fmt.Errorf("Pagination index `%s` for %s cannot be used for pagination: %s", index, QuotedTableNameFromString(schema, table), reason)
 }
 
 // NonNumericPaginationKeyError exported to facilitate black box testing
@@ -236,16 +356,22 @@ func NonNumericPaginationKeyError(schema, table, paginationKey string) error {
 	return fmt.Errorf("Pagination Key `%s` for %s is non-numeric", paginationKey, QuotedTableNameFromString(schema, table))
 }
 
-func (t *TableSchema) paginationKeyColumn(cascadingPaginationColumnConfig *CascadingPaginationColumnConfig) (*schema.TableColumn, int, error) {
+func (t *TableSchema) paginationKeyColumn(db *sql.DB, cascadingPaginationColumnConfig *CascadingPaginationColumnConfig) (*schema.TableColumn, int, string, error) {
 	var err error
 	var paginationKeyColumn *schema.TableColumn
 	var paginationKeyIndex int
+	var paginationKeyIndexName string
 
 	if paginationColumn, found := cascadingPaginationColumnConfig.PaginationColumnFor(t.Schema, t.Name); found {
 		// Use per-schema, per-table pagination key from config
 		paginationKeyColumn, paginationKeyIndex, err = t.findColumnByName(paginationColumn)
+	} else if indexName, found := cascadingPaginationColumnConfig.PaginationIndexFor(t.Schema, t.Name); found {
+		// Use per-schema, per-table unique index from config
+		paginationKeyIndexName = indexName
+		paginationKeyColumn, paginationKeyIndex, err = t.findColumnByUniqueIndex(db, indexName)
 	} else if len(t.PKColumns) == 1 {
 		// Use Primary Key
+		paginationKeyIndexName = "PRIMARY"
 		paginationKeyIndex = t.PKColumns[0]
 		paginationKeyColumn = &t.Columns[paginationKeyIndex]
 	} else if fallbackColumnName, found := cascadingPaginationColumnConfig.FallbackPaginationColumnName(); found {
@@ -256,11 +382,70 @@ func (t *TableSchema) paginationKeyColumn(cascadingPaginationColumnConfig *Casca
 		err = NonExistingPaginationKeyError(t.Schema, t.Name)
 	}
 
+	// The pagination keys are compared as integers both by MySQL and by the
+	// cursors and the StateTracker. String keys are rejected: with a
+	// non-binary collation (e.g. utf8mb4_general_ci), MySQL orders and
+	// compares them differently from their bytes, so a WHERE key > ? boundary
+	// computed from their bytes could skip or duplicate the rows whose keys
+	// are equal under the collation.
 	if paginationKeyColumn != nil && paginationKeyColumn.Type != schema.TYPE_NUMBER {
-		return nil, -1, NonNumericPaginationKeyError(t.Schema, t.Name, paginationKeyColumn.Name)
+		return nil, -1, "", NonNumericPaginationKeyError(t.Schema, t.Name, paginationKeyColumn.Name)
 	}
 
-	return paginationKeyColumn, paginationKeyIndex, err
+	return paginationKeyColumn, paginationKeyIndex, paginationKeyIndexName, err
+}
+
+// Returns the column of the given index if it is usable for pagination: the
+// index must be unique and consist of a single non nullable column.
+func (t *TableSchema) findColumnByUniqueIndex(db *sql.DB, indexName string) (*schema.TableColumn, int, error) {
+	query, args, err := sq.
+		Select("COLUMN_NAME", "NON_UNIQUE", "NULLABLE").
+		From("information_schema.STATISTICS").
+		Where(sq.Eq{"TABLE_SCHEMA": t.Schema, "TABLE_NAME": t.Name, "INDEX_NAME": indexName}).
+		OrderBy("SEQ_IN_INDEX").
+		ToSql()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer rows.Close()
+
+	var columnNames []string
+	var nonUnique bool
+	var nullable bool
+	for rows.Next() {
+		var columnName, nullableValue string
+		var nonUniqueValue int
+		err = rows.Scan(&columnName, &nonUniqueValue, &nullableValue)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		columnNames = append(columnNames, columnName)
+		nonUnique = nonUnique || nonUniqueValue != 0
+		nullable = nullable || nullableValue == "YES"
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, -1, err
+	}
+
+	switch {
+	case len(columnNames) == 0:
+		return nil, -1, UnsuitablePaginationIndexError(t.Schema, t.Name, indexName, "index does not exist")
+	case nonUnique:
+		return nil, -1, UnsuitablePaginationIndexError(t.Schema, t.Name, indexName, "index is not unique")
+	case len(columnNames) > 1:
+		return nil, -1, UnsuitablePaginationIndexError(t.Schema, t.Name, indexName, "index has more than one column")
+	case nullable:
+		return nil, -1, UnsuitablePaginationIndexError(t.Schema, t.Name, indexName, "index column is nullable")
+	}
+
+	return t.findColumnByName(columnNames[0])
 }
 
 // GetPaginationColumn retrieves PaginationKeyColumn
@@ -272,6 +457,45 @@ func (t *TableSchema) GetPaginationKeyIndex() int {
 	return t.PaginationKeyIndex
 }
 
+// Returns the largest value the pagination key column can hold according to
+// its declared integer type. Returns false if the type is not a known integer
+// type.
+func (t *TableSchema) MaxPaginationKeyValue() (uint64, bool) {
+	column := t.GetPaginationColumn()
+	if column == nil {
+		return 0, false
+	}
+
+	rawType := strings.ToLower(column.RawType)
+	unsigned := column.IsUnsigned || strings.Contains(rawType, "unsigned")
+
+	var bits uint
+	switch {
+	case strings.HasPrefix(rawType, "tinyint"):
+		bits = 8
+	case strings.HasPrefix(rawType, "smallint"):
+		bits = 16
+	case strings.HasPrefix(rawType, "mediumint"):
+		bits = 24
+	case strings.HasPrefix(rawType, "int"):
+		bits = 32
+	case strings.HasPrefix(rawType, "bigint"):
+		bits = 64
+	default:
+		return 0, false
+	}
+
+	if !unsigned {
+		bits--
+	}
+
+	if bits == 64 {
+		return math.MaxUint64, true
+	}
+
+	return (uint64(1) << bits) - 1, true
+}
+
 func (c TableSchemaCache) AsSlice() (tables []*TableSchema) {
 	for _, tableSchema := range c {
 		tables = append(tables, tableSchema)
@@ -339,6 +563,32 @@ func showTablesFrom(c *sql.DB, dbname string) ([]string, error) {
 	return tables, nil
 }
 
+func paginationKeyExists(db *sql.DB, table *TableSchema, paginationKey uint64) (bool, error) {
+	paginationKeyName := quoteField(table.GetPaginationColumn().Name)
+	query, args, err := sq.
+		Select(paginationKeyName).
+		From(QuotedTableName(table)).
+		Where(sq.Eq{paginationKeyName: paginationKey}).
+		Limit(1).
+		ToSql()
+
+	if err != nil {
+		return false, err
+	}
+
+	var found uint64
+	err = db.QueryRow(query, args...).Scan(&found)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
 func maxPaginationKey(db *sql.DB, table *TableSchema) (uint64, bool, error) {
 	primaryKeyColumn := table.GetPaginationColumn()
 	paginationKeyName := quoteField(primaryKeyColumn.Name)
@@ -0,0 +1,99 @@
+package ghostferry
+
+import (
+	"time"
+)
+
+// The number of samples kept by each tableSpeedLog. The memory of a log is
+// fixed regardless of the window, while its precision is the window divided
+// by the number of samples.
+const tableSpeedLogSamples = 30
+
+// The default window over which the copy rate of a table is compared to its
+// peak, see StateTracker.SlowTables.
+const DefaultSlowTableWindow = 5 * time.Minute
+
+// The default factor of Progress.SlowTables, see StateTracker.SlowTables.
+const DefaultSlowTableFactor = 0.1
+
+// Samples the pagination key of a single table at most once per interval, in
+// a ring of tableSpeedLogSamples samples. The sample at latest is the most
+// recent one.
+type tableSpeedLog struct {
+	samples [tableSpeedLogSamples]PaginationKeyPositionLog
+	count   int
+	latest  int
+}
+
+func (l *tableSpeedLog) observe(paginationKey uint64, now time.Time, interval time.Duration) {
+	if l.count > 0 && now.Sub(l.samples[l.latest].At) < interval {
+		return
+	}
+
+	l.latest = (l.latest + 1) % tableSpeedLogSamples
+	l.samples[l.latest] = PaginationKeyPositionLog{Position: paginationKey, At: now}
+	if l.count < tableSpeedLogSamples {
+		l.count++
+	}
+}
+
+// Returns the highest rate between two consecutive samples, or false if there
+// are not two samples yet.
+func (l *tableSpeedLog) peak() (float64, bool) {
+	if l.count < 2 {
+		return 0, false
+	}
+
+	peak := 0.0
+	for age := 0; age < l.count-1; age++ {
+		rate := speedBetween(l.sample(age+1), l.sample(age))
+		if rate > peak {
+			peak = rate
+		}
+	}
+	return peak, true
+}
+
+// Returns the rate over the last interval. If the latest sample is older than
+// the interval, the table has not progressed much since, or at all if the
+// copy is stalled, so the rate is measured from the latest sample to now.
+func (l *tableSpeedLog) current(paginationKey uint64, now time.Time, interval time.Duration) (float64, bool) {
+	if l.count == 0 {
+		return 0, false
+	}
+
+	latest := l.sample(0)
+	if now.Sub(latest.At) >= interval {
+		return speedBetween(latest, PaginationKeyPositionLog{Position: paginationKey, At: now}), true
+	}
+
+	if l.count < 2 {
+		return 0, false
+	}
+
+	return speedBetween(l.sample(1), latest), true
+}
+
+// Returns the sample taken age samples before the latest one.
+func (l *tableSpeedLog) sample(age int) PaginationKeyPositionLog {
+	return l.samples[(l.latest-age+tableSpeedLogSamples)%tableSpeedLogSamples]
+}
+
+// Shifts the samples taken before pausedAt forward by d.
+func (l *tableSpeedLog) shift(pausedAt time.Time, d time.Duration) {
+	for age := 0; age < l.count; age++ {
+		i := (l.latest - age + tableSpeedLogSamples) % tableSpeedLogSamples
+		if l.samples[i].At.Before(pausedAt) {
+			l.samples[i].At = l.samples[i].At.Add(d)
+		}
+	}
+}
+
+func speedBetween(from, to PaginationKeyPositionLog) float64 {
+	elapsed := to.At.Sub(from.At).Seconds()
+	if elapsed <= 0 || to.Position <= from.Position {
+		return 0
+	}
+
+	return float64(to.Position-from.Position) / elapsed
+}
@@ -0,0 +1,127 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/sirupsen/logrus"
+)
+
+// A completed table with much fewer rows on the target than on the source,
+// see Ferry.VerifyTargetConsistency.
+type TargetConsistencyMismatch struct {
+	Table          string
+	SourceRowCount uint64
+	TargetRowCount uint64
+}
+
+func (m TargetConsistencyMismatch) String() string {
+	return fmt.Sprintf("%s: %d rows on the target, %d rows on the source", m.Table, m.TargetRowCount, m.SourceRowCount)
+}
+
+// Spot checks that the target contains the data of the tables the resumed
+// state recorded as copied, whether completed or pending verification, by
+// comparing the row counts of a random sample of them on the source and on
+// the target. The binlog positions of the state are on the source, so a run
+// can be resumed onto a different target (e.g. a replica promoted after a
+// failover) as long as it has the copied data: this catches resuming onto an
+// empty or wrong target, which would otherwise go unnoticed until the
+// verification.
+//
+// The row counts are only roughly compared, using
+// TargetConsistencyCheckConfig.MinRowCountRatio, as the target does not have
+// the rows written since the state was dumped until the binlog streamer
+// catches up. Returns the mismatching tables, sorted by name.
+func (f *Ferry) VerifyTargetConsistency(config *TargetConsistencyCheckConfig) ([]TargetConsistencyMismatch, error) {
+	completedTables := make([]string, 0)
+	for tableName := range f.Tables {
+		if f.StateTracker.IsTableCopyComplete(tableName) {
+			completedTables = append(completedTables, tableName)
+		}
+	}
+	sort.Strings(completedTables)
+
+	sample := completedTables
+	if len(completedTables) > config.SampleSize {
+		sample = make([]string, config.SampleSize)
+		for i, j := range rand.Perm(len(completedTables))[:config.SampleSize] {
+			sample[i] = completedTables[j]
+		}
+		sort.Strings(sample)
+	}
+
+	mismatches := make([]TargetConsistencyMismatch, 0)
+	for _, tableName := range sample {
+		table := f.Tables[tableName]
+
+		sourceRowCount, err := countRows(f.SourceDB, table.Schema, table.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count the rows of %s on the source: %v", tableName, err)
+		}
+
+		targetDbName := table.Schema
+		if rewrittenName, exists := f.Config.DatabaseRewrites[targetDbName]; exists {
+			targetDbName = rewrittenName
+		}
+
+		targetTableName := table.Name
+		if rewrittenName, exists := f.Config.TableRewrites[targetTableName]; exists {
+			targetTableName = rewrittenName
+		}
+
+		targetRowCount, err := countRows(f.TargetDB, targetDbName, targetTableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count the rows of %s on the target: %v", tableName, err)
+		}
+
+		if float64(targetRowCount) < config.MinRowCountRatio*float64(sourceRowCount) {
+			mismatches = append(mismatches, TargetConsistencyMismatch{
+				Table:          tableName,
+				SourceRowCount: sourceRowCount,
+				TargetRowCount: targetRowCount,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+func (f *Ferry) checkTargetConsistency() error {
+	var mismatches []TargetConsistencyMismatch
+	var err error
+	metrics.Measure("VerifyTargetConsistency", nil, 1.0, func() {
+		mismatches, err = f.VerifyTargetConsistency(f.Config.TargetConsistencyCheck)
+	})
+	if err != nil {
+		f.logger.WithError(err).Error("failed to verify the consistency of the target")
+		return err
+	}
+
+	for _, mismatch := range mismatches {
+		f.logger.WithFields(logrus.Fields{
+			"table":            mismatch.Table,
+			"source_row_count": mismatch.SourceRowCount,
+			"target_row_count": mismatch.TargetRowCount,
+		}).Warn("completed table is missing rows on the target, the run may be resuming onto the wrong target")
+	}
+
+	if len(mismatches) > 0 && f.Config.TargetConsistencyCheck.FailOnMismatch {
+		return fmt.Errorf("the target is missing rows of %d completed tables, such as %s", len(mismatches), mismatches[0])
+	}
+
+	return nil
+}
+
+func countRows(db *sql.DB, schemaName, tableName string) (uint64, error) {
+	query, args, err := sq.Select("COUNT(*)").From(QuotedTableNameFromString(schemaName, tableName)).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint64
+	err = db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
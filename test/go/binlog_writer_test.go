@@ -0,0 +1,165 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+// The events of a table dropped from the source are not applied, so the
+// BinlogWriter only tracks their binlog positions and needs no target.
+type droppedTableEvent struct {
+	pos mysql.Position
+}
+
+func (e droppedTableEvent) Database() string { return "db" }
+func (e droppedTableEvent) Table() string    { return "dropped" }
+func (e droppedTableEvent) TableSchema() *ghostferry.TableSchema {
+	return &ghostferry.TableSchema{Table: &schema.Table{Schema: "db", Name: "dropped"}}
+}
+func (e droppedTableEvent) AsSQLString(string, string) (string, error) { return "", nil }
+func (e droppedTableEvent) OldValues() ghostferry.RowData              { return nil }
+func (e droppedTableEvent) NewValues() ghostferry.RowData              { return nil }
+func (e droppedTableEvent) PaginationKey() (uint64, error)             { return 0, nil }
+func (e droppedTableEvent) BinlogPosition() mysql.Position             { return e.pos }
+func (e droppedTableEvent) Timestamp() time.Time                       { return time.Time{} }
+func (e droppedTableEvent) GTIDSet() mysql.GTIDSet                     { return nil }
+
+func binlogWriterTestPosition(pos uint32) mysql.Position {
+	return mysql.Position{Name: "mysql-bin.00001", Pos: pos}
+}
+
+type BinlogWriterTestSuite struct {
+	suite.Suite
+
+	stateTracker *ghostferry.StateTracker
+	writer       *ghostferry.BinlogWriter
+	done         chan struct{}
+}
+
+func (s *BinlogWriterTestSuite) SetupTest() {
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.stateTracker.MarkTableDropped("db.dropped")
+
+	s.writer = &ghostferry.BinlogWriter{
+		Throttler:    &ghostferry.PauserThrottler{},
+		BatchSize:    10,
+		WriteRetries: 1,
+		ErrorHandler: &ghostferry.PanicErrorHandler{},
+		StateTracker: s.stateTracker,
+	}
+
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.writer.Run()
+	}()
+
+	// Run creates its buffer asynchronously.
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (s *BinlogWriterTestSuite) TearDownTest() {
+	s.writer.Stop()
+	<-s.done
+}
+
+func (s *BinlogWriterTestSuite) bufferEvents(positions ...uint32) {
+	events := make([]ghostferry.DMLEvent, len(positions))
+	for i, pos := range positions {
+		events[i] = droppedTableEvent{pos: binlogWriterTestPosition(pos)}
+	}
+	s.Require().Nil(s.writer.BufferBinlogEvents(events))
+}
+
+func (s *BinlogWriterTestSuite) waitUntilReached(reached <-chan struct{}) {
+	select {
+	case <-reached:
+	case <-time.After(5 * time.Second):
+		s.FailNow("the held binlog position was not reached")
+	}
+}
+
+func (s *BinlogWriterTestSuite) waitForBinlogPosition(pos uint32) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Require().Nil(s.stateTracker.WaitForBinlogPosition(ctx, binlogWriterTestPosition(pos)))
+}
+
+func (s *BinlogWriterTestSuite) TestWritesTheEventsUpToTheHeldPositionInASeparateBatch() {
+	reached, release := s.stateTracker.HoldBinlogPosition(binlogWriterTestPosition(20))
+	s.bufferEvents(10, 20, 30, 40)
+
+	s.waitUntilReached(reached)
+	s.Require().Equal(binlogWriterTestPosition(20), s.stateTracker.LastWrittenBinlogPosition())
+
+	time.Sleep(20 * time.Millisecond)
+	s.Require().Equal(binlogWriterTestPosition(20), s.stateTracker.LastWrittenBinlogPosition())
+
+	release()
+	s.waitForBinlogPosition(40)
+}
+
+func (s *BinlogWriterTestSuite) TestHeldPositionBetweenEventsIsReachedOnceTheNextEventIsPastIt() {
+	// Such as a position taken with SHOW MASTER STATUS after the XID event
+	// ending the transaction of the event at 20.
+	reached, release := s.stateTracker.HoldBinlogPosition(binlogWriterTestPosition(25))
+	s.bufferEvents(10, 20)
+	s.waitForBinlogPosition(20)
+
+	select {
+	case <-reached:
+		s.FailNow("the held binlog position is reached before the next event")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.bufferEvents(30, 40)
+	s.waitUntilReached(reached)
+	s.Require().Equal(binlogWriterTestPosition(20), s.stateTracker.LastWrittenBinlogPosition())
+
+	release()
+	s.waitForBinlogPosition(40)
+}
+
+func (s *BinlogWriterTestSuite) TestSerializeAt() {
+	ferry := &ghostferry.Ferry{StateTracker: s.stateTracker}
+
+	// The writer is held before the event at 30.
+	reached, release := s.stateTracker.HoldBinlogPosition(binlogWriterTestPosition(25))
+	defer release()
+	s.bufferEvents(10, 20, 30, 40)
+	s.waitUntilReached(reached)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := ferry.SerializeAt(ctx, binlogWriterTestPosition(20))
+	s.Require().Nil(err)
+	s.Require().Equal(binlogWriterTestPosition(20), state.LastWrittenBinlogPosition)
+
+	state, err = ferry.SerializeAt(ctx, binlogWriterTestPosition(22))
+	s.Require().Nil(err)
+	s.Require().Equal(binlogWriterTestPosition(20), state.LastWrittenBinlogPosition)
+
+	_, err = ferry.SerializeAt(ctx, binlogWriterTestPosition(15))
+	s.Require().NotNil(err)
+	s.Require().Contains(err.Error(), "was already passed")
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer shortCancel()
+	_, err = ferry.SerializeAt(shortCtx, binlogWriterTestPosition(35))
+	s.Require().Equal(context.DeadlineExceeded, err)
+
+	// The holds of SerializeAt are released when it returns.
+	release()
+	s.waitForBinlogPosition(40)
+}
+
+func TestBinlogWriterTestSuite(t *testing.T) {
+	suite.Run(t, new(BinlogWriterTestSuite))
+}
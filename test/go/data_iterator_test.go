@@ -160,6 +160,49 @@ func (this *DataIteratorTestSuite) TestDoneListenerGetsNotifiedWhenDone() {
 	this.Require().True(wasNotified)
 }
 
+type firstBatchCompletionPredicate struct{}
+
+func (p firstBatchCompletionPredicate) Name() string {
+	return "first_batch"
+}
+
+func (p firstBatchCompletionPredicate) IsComplete(progress ghostferry.TableCompletionProgress) bool {
+	return progress.Batch != nil
+}
+
+func (this *DataIteratorTestSuite) TestCompletionPredicates() {
+	table1 := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	compressedTable1 := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestCompressedTable1Name)
+
+	this.di.StateTracker.SetCompletionPredicate(table1, firstBatchCompletionPredicate{})
+	this.di.StateTracker.SetCompletionPredicate(compressedTable1, ghostferry.NeverCompletePredicate{})
+
+	this.di.Run(this.tables)
+
+	// The iteration stops once the predicate is satisfied.
+	this.Require().Equal(2, len(this.receivedRows[testhelpers.TestTable1Name]))
+	this.Require().Equal(5, len(this.receivedRows[testhelpers.TestCompressedTable1Name]))
+	this.Require().Equal(map[string]bool{table1: true}, this.completedTables())
+}
+
+func (this *DataIteratorTestSuite) TestDependentTableFailsIfItsPrerequisiteEndsIncomplete() {
+	table1 := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	compressedTable1 := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestCompressedTable1Name)
+
+	errorHandler := &testhelpers.ErrorHandler{}
+	this.di.ErrorHandler = errorHandler
+	this.di.StateTracker.SetCompletionPredicate(compressedTable1, ghostferry.NeverCompletePredicate{})
+	this.Require().Nil(this.di.StateTracker.SetTableDependencies(map[string][]string{table1: {compressedTable1}}))
+
+	// The run is over, instead of waiting forever for the prerequisite.
+	this.di.Run(this.tables)
+
+	this.Require().NotNil(errorHandler.LastError)
+	this.Require().Contains(errorHandler.LastError.Error(), compressedTable1)
+	this.Require().Equal(0, len(this.receivedRows[testhelpers.TestTable1Name]))
+	this.Require().Equal(0, len(this.completedTables()))
+}
+
 func (this *DataIteratorTestSuite) completedTables() map[string]bool {
 	return this.di.StateTracker.Serialize(nil, nil).CompletedTables
 }
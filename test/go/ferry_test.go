@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/Shopify/ghostferry"
@@ -39,6 +40,46 @@ func (t *FerryTestSuite) TestReadOnlyDatabaseFailsInitialization() {
 	t.Require().Nil(err)
 }
 
+func (t *FerryTestSuite) TestVerifyTargetConsistencyDetectsMissingRows() {
+	t.SeedSourceDB(10)
+	t.SeedTargetDB(0)
+
+	tableFilter := &testhelpers.TestTableFilter{
+		DbsFunc:    testhelpers.DbApplicabilityFilter([]string{testhelpers.TestSchemaName}),
+		TablesFunc: nil,
+	}
+
+	tables, err := ghostferry.LoadTables(t.Ferry.SourceDB, tableFilter, nil, nil, nil)
+	t.Require().Nil(err)
+	t.Ferry.Tables = tables
+
+	config := &ghostferry.TargetConsistencyCheckConfig{SampleSize: 10}
+	t.Require().Nil(config.Validate())
+
+	// Tables that are not completed yet are not checked.
+	mismatches, err := t.Ferry.VerifyTargetConsistency(config)
+	t.Require().Nil(err)
+	t.Require().Equal(0, len(mismatches))
+
+	table1 := testhelpers.TestSchemaName + "." + testhelpers.TestTable1Name
+	t.Ferry.StateTracker.MarkTableAsCompleted(table1)
+
+	mismatches, err = t.Ferry.VerifyTargetConsistency(config)
+	t.Require().Nil(err)
+	t.Require().Equal([]ghostferry.TargetConsistencyMismatch{
+		{Table: table1, SourceRowCount: 10, TargetRowCount: 0},
+	}, mismatches)
+
+	for i := 0; i < 9; i++ {
+		_, err = t.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO %s (data) VALUES ('data')", table1))
+		t.Require().Nil(err)
+	}
+
+	mismatches, err = t.Ferry.VerifyTargetConsistency(config)
+	t.Require().Nil(err)
+	t.Require().Equal(0, len(mismatches))
+}
+
 func TestFerryTestSuite(t *testing.T) {
 	suite.Run(t, &FerryTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
 }
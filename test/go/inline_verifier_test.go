@@ -1,9 +1,12 @@
 package test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
 	"github.com/stretchr/testify/require"
 )
 
@@ -44,3 +47,35 @@ func TestBinlogVerifySerializedStoreCopy(t *testing.T) {
 	r.Equal(uint64(10), s.RowCount())
 	r.Equal(uint64(11), s2.RowCount())
 }
+
+func TestBinlogVerifyStoreRoundTripsThroughTheState(t *testing.T) {
+	r := require.New(t)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00002", Pos: 10})
+
+	for _, serialized := range []ghostferry.BinlogVerifySerializedStore{nil, ghostferry.BinlogVerifySerializedStore{}, newMockBinlogVerifySerializedStore()} {
+		state := stateTracker.Serialize(nil, ghostferry.NewBinlogVerifyStoreFromSerialized(serialized))
+		data, err := json.Marshal(state)
+		r.Nil(err)
+
+		decoded := &ghostferry.SerializableState{}
+		r.Nil(json.Unmarshal(data, decoded))
+		r.Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 10}, decoded.LastStoredBinlogPositionForInlineVerifier)
+		r.Equal(serialized.RowCount(), decoded.BinlogVerifyStore.RowCount())
+
+		store := ghostferry.NewBinlogVerifyStoreFromSerialized(decoded.BinlogVerifyStore)
+		store.Add(&ghostferry.TableSchema{Table: &schema.Table{Schema: "db", Name: "table1"}}, 3)
+		r.Equal(serialized.RowCount()+1, store.Serialize().RowCount())
+		r.Equal(serialized.RowCount(), decoded.BinlogVerifyStore.RowCount())
+	}
+
+	state := stateTracker.Serialize(nil, nil)
+	data, err := json.Marshal(state)
+	r.Nil(err)
+
+	decoded := &ghostferry.SerializableState{}
+	r.Nil(json.Unmarshal(data, decoded))
+	r.Nil(decoded.BinlogVerifyStore)
+	r.Equal(uint64(0), ghostferry.NewBinlogVerifyStoreFromSerialized(decoded.BinlogVerifyStore).Serialize().RowCount())
+}
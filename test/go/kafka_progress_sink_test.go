@@ -0,0 +1,164 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeKafkaProducer struct {
+	mutex    sync.Mutex
+	failing  bool
+	blocked  chan struct{}
+	messages []ghostferry.KafkaMessage
+	topics   []string
+}
+
+func (p *fakeKafkaProducer) Produce(topic string, messages []ghostferry.KafkaMessage) error {
+	p.mutex.Lock()
+	blocked := p.blocked
+	p.mutex.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.failing {
+		return fmt.Errorf("broker unavailable")
+	}
+
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *fakeKafkaProducer) setFailing(failing bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.failing = failing
+}
+
+// Produce blocks until the returned channel is closed, as it does for
+// unreachable brokers with some clients.
+func (p *fakeKafkaProducer) block() chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.blocked = make(chan struct{})
+	return p.blocked
+}
+
+func (p *fakeKafkaProducer) produced() []ghostferry.KafkaProgressMessage {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	messages := make([]ghostferry.KafkaProgressMessage, len(p.messages))
+	for i, message := range p.messages {
+		json.Unmarshal(message.Value, &messages[i])
+	}
+	return messages
+}
+
+type KafkaProgressSinkTestSuite struct {
+	suite.Suite
+
+	stateTracker *ghostferry.StateTracker
+	producer     *fakeKafkaProducer
+	sink         *ghostferry.KafkaProgressSink
+	stop         func()
+}
+
+func (s *KafkaProgressSinkTestSuite) SetupTest() {
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.producer = &fakeKafkaProducer{}
+	s.sink = &ghostferry.KafkaProgressSink{
+		Producer:      s.producer,
+		Topic:         "migrations",
+		RunID:         "run-1",
+		FlushInterval: 10 * time.Millisecond,
+		BufferSize:    5,
+		StopTimeout:   50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.sink.Run(ctx, s.stateTracker)
+	}()
+	s.stop = func() {
+		cancel()
+		<-done
+	}
+
+	// Run subscribes asynchronously.
+	time.Sleep(10 * time.Millisecond)
+}
+
+func (s *KafkaProgressSinkTestSuite) TestProducesEventsKeyedByRunID() {
+	s.stateTracker.SetPhase("copying")
+	s.stateTracker.MarkTableAsCompleted("test.table1")
+	s.stop()
+
+	produced := s.producer.produced()
+	s.Require().Equal(2, len(produced))
+	s.Require().Equal(ghostferry.ProgressEventPhaseChanged, produced[0].Type)
+	s.Require().Equal("copying", produced[0].Phase)
+	s.Require().Equal(ghostferry.ProgressEventTableCompleted, produced[1].Type)
+	s.Require().Equal("test.table1", produced[1].Table)
+
+	for i, message := range s.producer.messages {
+		s.Require().Equal("run-1", string(message.Key))
+		s.Require().Equal("run-1", produced[i].RunID)
+	}
+	for _, topic := range s.producer.topics {
+		s.Require().Equal("migrations", topic)
+	}
+}
+
+func (s *KafkaProgressSinkTestSuite) TestDropsOldestEventsWhileBrokerIsUnavailable() {
+	s.producer.setFailing(true)
+
+	for i := 0; i < 8; i++ {
+		s.stateTracker.SetPhase(fmt.Sprintf("phase-%d", i))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	s.Require().Equal(0, len(s.producer.produced()))
+
+	s.producer.setFailing(false)
+	s.stop()
+
+	produced := s.producer.produced()
+	s.Require().Equal(5, len(produced))
+	for i, message := range produced {
+		s.Require().Equal(fmt.Sprintf("phase-%d", i+3), message.Phase)
+	}
+	s.Require().Equal(uint64(3), s.sink.Dropped())
+}
+
+func (s *KafkaProgressSinkTestSuite) TestStopsWaitingForABlockedProducer() {
+	unblock := s.producer.block()
+	defer close(unblock)
+
+	s.stateTracker.SetPhase("copying")
+	time.Sleep(30 * time.Millisecond)
+
+	start := time.Now()
+	s.stop()
+	s.Require().True(time.Since(start) < time.Second, time.Since(start))
+	s.Require().Equal(0, len(s.producer.produced()))
+}
+
+func TestKafkaProgressSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(KafkaProgressSinkTestSuite))
+}
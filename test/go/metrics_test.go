@@ -184,6 +184,11 @@ func (this *MetricsTestSuite) TestDropMetricIfSinkFull() {
 	}
 }
 
+func (this *MetricsTestSuite) TestEnabled() {
+	this.Require().True(this.metrics.Enabled())
+	this.Require().False((&ghostferry.Metrics{Prefix: "test"}).Enabled())
+}
+
 func TestMetricsTestSuite(t *testing.T) {
 	suite.Run(t, new(MetricsTestSuite))
 }
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDKeyspaceFraction(t *testing.T) {
+	fraction, err := ghostferry.UUIDKeyspaceFraction("00000000-0000-0000-0000-000000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, fraction)
+
+	fraction, err = ghostferry.UUIDKeyspaceFraction("80000000-0000-4000-8000-000000000000")
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.5, fraction, 1e-9)
+
+	fraction, err = ghostferry.UUIDKeyspaceFraction("40000000-0000-4000-8000-000000000000")
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.25, fraction, 1e-9)
+
+	fraction, err = ghostferry.UUIDKeyspaceFraction("ffffffff-ffff-ffff-ffff-ffffffffffff")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, fraction)
+
+	_, err = ghostferry.UUIDKeyspaceFraction("not-a-uuid")
+	assert.NotNil(t, err)
+}
+
+func TestTableProgressCompletedFraction(t *testing.T) {
+	progress := ghostferry.TableProgress{
+		LastSuccessfulPaginationKey: 1000000000000000500,
+		FirstPaginationKey:          1000000000000000100,
+		TargetPaginationKey:         1000000000000001000,
+		CurrentAction:               ghostferry.TableActionCopying,
+	}
+	assert.InDelta(t, 0.5, progress.CompletedFraction(1000000000000000000), 1e-9)
+	assert.InDelta(t, 400.0/900.0, progress.CompletedFraction(progress.FirstPaginationKey), 1e-9)
+	assert.Equal(t, 0.0, progress.CompletedFraction(progress.LastSuccessfulPaginationKey))
+
+	singleRow := ghostferry.TableProgress{
+		LastSuccessfulPaginationKey: 42,
+		FirstPaginationKey:          42,
+		TargetPaginationKey:         42,
+		CurrentAction:               ghostferry.TableActionCopying,
+	}
+	assert.Equal(t, 0.0, singleRow.CompletedFraction(singleRow.FirstPaginationKey))
+	assert.Equal(t, 1.0, singleRow.CompletedFraction(0))
+
+	singleRow.CurrentAction = ghostferry.TableActionCompleted
+	assert.Equal(t, 1.0, singleRow.CompletedFraction(singleRow.FirstPaginationKey))
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+const logicalOffsetKind = "test_logical_offset"
+
+type logicalOffset uint64
+
+func (o logicalOffset) Kind() string {
+	return logicalOffsetKind
+}
+
+func (o logicalOffset) Compare(other ghostferry.ReplicationCoordinate) int {
+	switch otherOffset := other.(logicalOffset); {
+	case o < otherOffset:
+		return -1
+	case o > otherOffset:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (o logicalOffset) String() string {
+	return fmt.Sprintf("offset %d", uint64(o))
+}
+
+func (o logicalOffset) Serialize() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(o), 10)), nil
+}
+
+func init() {
+	ghostferry.RegisterReplicationCoordinateKind(logicalOffsetKind, func(data []byte) (ghostferry.ReplicationCoordinate, error) {
+		offset, err := strconv.ParseUint(string(data), 10, 64)
+		return logicalOffset(offset), err
+	})
+}
+
+type ReplicationCoordinateTestSuite struct {
+	suite.Suite
+}
+
+func (s *ReplicationCoordinateTestSuite) TestBinlogFileCoordinateIsTheDefault() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	pos := mysql.Position{Name: "mysql-bin.00002", Pos: 10}
+	stateTracker.UpdateLastWrittenCoordinate(ghostferry.BinlogFileCoordinate(pos))
+	s.Require().Equal(pos, stateTracker.LastWrittenBinlogPosition())
+	s.Require().Equal(ghostferry.BinlogFileCoordinate(pos), stateTracker.LastWrittenCoordinate())
+	s.Require().Equal(ghostferry.BinlogFileCoordinate(pos), stateTracker.MinReplicationCoordinate())
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Nil(serializedState.LastWrittenCoordinate)
+	coordinate, err := serializedState.MinReplicationCoordinate()
+	s.Require().Nil(err)
+	s.Require().Equal("mysql-bin.00002:10", coordinate.String())
+
+	serialized, err := ghostferry.SerializeReplicationCoordinate(coordinate)
+	s.Require().Nil(err)
+	decoded, err := serialized.Decode()
+	s.Require().Nil(err)
+	s.Require().Equal(coordinate, decoded)
+
+	_, err = (&ghostferry.SerializedReplicationCoordinate{Kind: "unknown"}).Decode()
+	s.Require().NotNil(err)
+}
+
+func (s *ReplicationCoordinateTestSuite) TestTracksOtherCoordinates() {
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	waitErr := make(chan error)
+	go func() {
+		waitErr <- stateTracker.WaitForCoordinate(context.Background(), logicalOffset(100))
+	}()
+
+	stateTracker.UpdateLastWrittenCoordinate(logicalOffset(50))
+	select {
+	case <-waitErr:
+		s.Fail("expected the wait to block until the coordinate is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	stateTracker.UpdateLastWrittenCoordinate(logicalOffset(100))
+	s.Require().Nil(<-waitErr)
+
+	// Moving backwards and other kinds are ignored.
+	stateTracker.UpdateLastWrittenCoordinate(logicalOffset(20))
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 10})
+	s.Require().Equal(logicalOffset(100), stateTracker.LastWrittenCoordinate())
+	s.Require().Equal(logicalOffset(100), stateTracker.MinReplicationCoordinate())
+	s.Require().Equal(mysql.Position{}, stateTracker.LastWrittenBinlogPosition())
+
+	s.Require().NotNil(stateTracker.WaitForBinlogPosition(context.Background(), mysql.Position{Name: "mysql-bin.00002", Pos: 10}))
+
+	data, err := json.Marshal(stateTracker.Serialize(nil, nil))
+	s.Require().Nil(err)
+	serializedState := &ghostferry.SerializableState{}
+	s.Require().Nil(json.Unmarshal(data, serializedState))
+	s.Require().Equal(logicalOffsetKind, serializedState.LastWrittenCoordinate.Kind)
+
+	coordinate, err := serializedState.MinReplicationCoordinate()
+	s.Require().Nil(err)
+	s.Require().Equal(logicalOffset(100), coordinate)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Equal(logicalOffset(100), resumed.LastWrittenCoordinate())
+	s.Require().Nil(resumed.WaitForCoordinate(context.Background(), logicalOffset(80)))
+}
+
+func TestReplicationCoordinateTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplicationCoordinateTestSuite))
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateCompactTestSuite struct {
+	suite.Suite
+
+	state *ghostferry.SerializableState
+}
+
+func (s *StateCompactTestSuite) SetupTest() {
+	s.state = &ghostferry.SerializableState{
+		GhostferryVersion: "1.1.0",
+		LastKnownTableSchemaCache: ghostferry.TableSchemaCache{
+			"db.table1": &ghostferry.TableSchema{Table: &schema.Table{Schema: "db", Name: "table1"}},
+		},
+		LastKnownTableSchemaCacheHash: "abc",
+		LastSuccessfulPaginationKeys: map[string]uint64{
+			"db.table1": 1 << 40,
+			"db.table2": 0,
+		},
+		CompletedPaginationKeyRanges: map[string][][2]uint64{
+			"db.table2": {{10, 20}, {1 << 40, 1 << 41}},
+		},
+		CompletedTables: map[string]bool{
+			"db.table3": true,
+		},
+		TableErrors: map[string]string{
+			"db.table2": "some error",
+		},
+		LastWrittenBinlogPosition:                 mysql.Position{Name: "mysql-bin.00003", Pos: 4},
+		LastStoredBinlogPositionForInlineVerifier: mysql.Position{Name: "mysql-bin.00002", Pos: 10},
+		BinlogVerifyStore: ghostferry.BinlogVerifySerializedStore{
+			"db": {"table1": {42: 2, 43: -1}},
+		},
+		Metadata: map[string]string{"worker": "1"},
+	}
+}
+
+func (s *StateCompactTestSuite) TestRoundTripExcludesSchemaByDefault() {
+	data, err := s.state.MarshalCompact(false)
+	s.Require().Nil(err)
+
+	state, err := ghostferry.UnmarshalCompactState(data)
+	s.Require().Nil(err)
+
+	s.Require().Nil(state.LastKnownTableSchemaCache)
+	s.Require().Equal("", state.LastKnownTableSchemaCacheHash)
+
+	expected := *s.state
+	expected.LastKnownTableSchemaCache = nil
+	expected.LastKnownTableSchemaCacheHash = ""
+	s.Require().Equal(&expected, state)
+}
+
+func (s *StateCompactTestSuite) TestRoundTripWithSchema() {
+	data, err := s.state.MarshalCompact(true)
+	s.Require().Nil(err)
+
+	state, err := ghostferry.UnmarshalCompactState(data)
+	s.Require().Nil(err)
+
+	s.Require().Equal("abc", state.LastKnownTableSchemaCacheHash)
+	s.Require().Equal("table1", state.LastKnownTableSchemaCache["db.table1"].Name)
+	s.Require().Equal(s.state.LastSuccessfulPaginationKeys, state.LastSuccessfulPaginationKeys)
+	s.Require().Equal(s.state.BinlogVerifyStore, state.BinlogVerifyStore)
+}
+
+func (s *StateCompactTestSuite) TestUnmarshalRejectsInvalidData() {
+	_, err := ghostferry.UnmarshalCompactState([]byte(`{"GhostferryVersion":"1.1.0"}`))
+	s.Require().Equal(ghostferry.ErrNotCompactState, err)
+
+	data, err := s.state.MarshalCompact(false)
+	s.Require().Nil(err)
+
+	_, err = ghostferry.UnmarshalCompactState(data[:len(data)-5])
+	s.Require().NotNil(err)
+}
+
+func (s *StateCompactTestSuite) TestMarshalCompactNormalizesRanges() {
+	s.state.CompletedPaginationKeyRanges = map[string][][2]uint64{
+		"db.table2": {{50, 60}, {10, 20}, {15, 30}, {55, 58}},
+	}
+
+	data, err := s.state.MarshalCompact(false)
+	s.Require().Nil(err)
+
+	state, err := ghostferry.UnmarshalCompactState(data)
+	s.Require().Nil(err)
+	s.Require().Equal([][2]uint64{{10, 30}, {50, 60}}, state.CompletedPaginationKeyRanges["db.table2"])
+
+	s.state.CompletedPaginationKeyRanges["db.table2"] = [][2]uint64{{20, 10}}
+	_, err = s.state.MarshalCompact(false)
+	s.Require().EqualError(err, "the completed pagination key range [20, 10] of db.table2 ends before it starts")
+}
+
+func (s *StateCompactTestSuite) TestSerializeCompactFromTracker() {
+	tracker := ghostferry.NewStateTracker(10)
+	tracker.UpdateLastSuccessfulPaginationKey("db.table1", 100)
+	tracker.MarkTableAsCompleted("db.table2")
+
+	data, err := tracker.SerializeCompact(nil, nil, false)
+	s.Require().Nil(err)
+
+	state, err := ghostferry.UnmarshalCompactState(data)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(100), state.LastSuccessfulPaginationKeys["db.table1"])
+	s.Require().True(state.CompletedTables["db.table2"])
+}
+
+func TestStateCompactTestSuite(t *testing.T) {
+	suite.Run(t, new(StateCompactTestSuite))
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+func syntheticSchemaCache(tables int) ghostferry.TableSchemaCache {
+	cache := ghostferry.TableSchemaCache{}
+	for i := 0; i < tables; i++ {
+		columns := []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER, RawType: "bigint(20) unsigned", IsAuto: true, IsUnsigned: true},
+			{Name: "shop_id", Type: schema.TYPE_NUMBER, RawType: "bigint(20)"},
+			{Name: "title", Type: schema.TYPE_STRING, RawType: "varchar(255)", Collation: "utf8mb4_unicode_ci"},
+			{Name: "body", Type: schema.TYPE_STRING, RawType: "text", Collation: "utf8mb4_unicode_ci"},
+			{Name: "status", Type: schema.TYPE_ENUM, RawType: "enum('active','archived')", EnumValues: []string{"active", "archived"}},
+			{Name: "created_at", Type: schema.TYPE_DATETIME, RawType: "datetime"},
+			{Name: "updated_at", Type: schema.TYPE_DATETIME, RawType: "datetime"},
+		}
+
+		table := &ghostferry.TableSchema{
+			Table: &schema.Table{
+				Schema:    "db",
+				Name:      fmt.Sprintf("table%d", i),
+				Columns:   columns,
+				PKColumns: []int{0},
+				Indexes: []*schema.Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Cardinality: []uint64{1000}},
+					{Name: "index_on_shop_id", Columns: []string{"shop_id", "updated_at"}, Cardinality: []uint64{10, 1000}},
+				},
+			},
+			PaginationKeyColumn: &columns[0],
+		}
+		cache[table.String()] = table
+	}
+	return cache
+}
+
+type StateCompressedTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateCompressedTestSuite) TestRoundTrip() {
+	cache := syntheticSchemaCache(20)
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+
+	data, err := stateTracker.SerializeCompressed(cache, nil)
+	s.Require().Nil(err)
+
+	plain, err := json.Marshal(stateTracker.Serialize(cache, nil))
+	s.Require().Nil(err)
+	s.Require().True(len(data) < len(plain)/2, "compressed %d bytes, plain %d bytes", len(data), len(plain))
+
+	state, err := ghostferry.DeserializeCompressed(data)
+	s.Require().Nil(err)
+	s.Require().Nil(state.LastKnownTableSchemaCacheCompressed)
+	s.Require().Equal(uint64(42), state.LastSuccessfulPaginationKeys["db.table1"])
+	s.Require().Equal(20, len(state.LastKnownTableSchemaCache))
+	s.Require().Equal(cache["db.table3"].Columns, state.LastKnownTableSchemaCache["db.table3"].Columns)
+	s.Require().Equal("id", state.LastKnownTableSchemaCache["db.table3"].PaginationKeyColumn.Name)
+
+	// The plain JSON of Serialize is decoded as well.
+	state, err = ghostferry.DeserializeCompressed(plain)
+	s.Require().Nil(err)
+	s.Require().Equal(20, len(state.LastKnownTableSchemaCache))
+}
+
+func (s *StateCompressedTestSuite) TestWithoutSchemaCache() {
+	data, err := ghostferry.NewStateTracker(10).SerializeCompressed(nil, nil)
+	s.Require().Nil(err)
+
+	state, err := ghostferry.DeserializeCompressed(data)
+	s.Require().Nil(err)
+	s.Require().Nil(state.LastKnownTableSchemaCache)
+}
+
+func (s *StateCompressedTestSuite) TestRejectsCorruptedSchemaCache() {
+	data, err := json.Marshal(&ghostferry.SerializableState{LastKnownTableSchemaCacheCompressed: []byte("not gzip")})
+	s.Require().Nil(err)
+
+	_, err = ghostferry.DeserializeCompressed(data)
+	s.Require().NotNil(err)
+}
+
+func TestStateCompressedTestSuite(t *testing.T) {
+	suite.Run(t, new(StateCompressedTestSuite))
+}
+
+func benchmarkSerialize(b *testing.B, serialize func(*ghostferry.StateTracker, ghostferry.TableSchemaCache) ([]byte, error)) {
+	cache := syntheticSchemaCache(2000)
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	b.ResetTimer()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := serialize(stateTracker, cache)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/state")
+}
+
+func BenchmarkSerializeWith2000Tables(b *testing.B) {
+	benchmarkSerialize(b, func(stateTracker *ghostferry.StateTracker, cache ghostferry.TableSchemaCache) ([]byte, error) {
+		return json.Marshal(stateTracker.Serialize(cache, nil))
+	})
+}
+
+func BenchmarkSerializeCompressedWith2000Tables(b *testing.B) {
+	benchmarkSerialize(b, func(stateTracker *ghostferry.StateTracker, cache ghostferry.TableSchemaCache) ([]byte, error) {
+		return stateTracker.SerializeCompressed(cache, nil)
+	})
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateDashboardTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateDashboardTestSuite) TestDashboard() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableErrors = true
+	stateTracker.SetPhase("copy")
+	stateTracker.SetTableSizes(map[string]uint64{"db.table1": 100, "db.table2": 100, "db.table3": 200})
+	stateTracker.MarkTableAsCompleted("db.table1")
+	stateTracker.UpdateBatch(map[string]uint64{"db.table2": 50}, 50)
+	stateTracker.MarkTableCopyComplete("db.table3")
+	stateTracker.RecordTableError("db.table2", errors.New("some error"))
+	stateTracker.PauseTable("db.table2")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 10})
+
+	dashboard := stateTracker.Dashboard()
+	s.Require().Equal(ghostferry.DashboardVersion, dashboard.Version)
+	s.Require().Equal("copy", dashboard.Phase)
+	s.Require().InDelta(350.0/400, dashboard.Progress.OverallProgress, 0.001)
+	s.Require().Equal(uint64(50), dashboard.Progress.RowsCopied)
+	s.Require().Equal(1, dashboard.Progress.CompletedTables)
+	s.Require().Equal(1, dashboard.Progress.PendingVerificationTables)
+	s.Require().Equal(1, dashboard.Progress.InProgressTables)
+	s.Require().Equal([]string{"db.table2"}, dashboard.Progress.ErroredTables)
+	s.Require().Equal([]string{"db.table2"}, dashboard.Progress.PausedTables)
+	s.Require().Equal("mysql-bin.00002:10", dashboard.Binlog.LastWrittenBinlogPosition)
+	s.Require().Equal(1, dashboard.Binlog.BinlogFilesTraversed)
+	s.Require().Equal(ghostferry.DashboardHealthWarning, dashboard.Health.Status)
+	s.Require().Equal([]string{"tables with errors: 1", "paused tables: 1"}, dashboard.Health.Warnings)
+
+	data, err := stateTracker.DashboardJSON()
+	s.Require().Nil(err)
+
+	decoded := map[string]interface{}{}
+	s.Require().Nil(json.Unmarshal(data, &decoded))
+	s.Require().Equal(float64(ghostferry.DashboardVersion), decoded["Version"])
+	for _, field := range []string{"GeneratedAt", "Phase", "PhaseDurations", "Progress", "Rates", "Binlog", "Health"} {
+		s.Require().Contains(decoded, field)
+	}
+}
+
+func (s *StateDashboardTestSuite) TestHealthyDashboard() {
+	dashboard := ghostferry.NewStateTracker(10).Dashboard()
+	s.Require().Equal(ghostferry.DashboardHealthOK, dashboard.Health.Status)
+	s.Require().Equal([]string{}, dashboard.Health.Warnings)
+	s.Require().Equal("", dashboard.Binlog.LastWrittenBinlogPosition)
+}
+
+func TestStateDashboardTestSuite(t *testing.T) {
+	suite.Run(t, new(StateDashboardTestSuite))
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateDeltaTestSuite struct {
+	suite.Suite
+
+	tables       ghostferry.TableSchemaCache
+	stateTracker *ghostferry.StateTracker
+}
+
+func (s *StateDeltaTestSuite) SetupTest() {
+	s.tables = ghostferry.TableSchemaCache{
+		"test.table1": &ghostferry.TableSchema{
+			Table: &schema.Table{Schema: "test", Name: "table1"},
+		},
+	}
+
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 20)
+	s.stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+}
+
+func (s *StateDeltaTestSuite) TestSerializeDeltaOnlyContainsChanges() {
+	base := s.stateTracker.Serialize(s.tables, nil)
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 15)
+	s.stateTracker.MarkTableAsCompleted("test.table3")
+	s.stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 100})
+
+	delta := s.stateTracker.SerializeDelta(base, nil)
+	s.Require().Nil(delta.LastKnownTableSchemaCache)
+	s.Require().Equal(map[string]uint64{"test.table1": 15}, delta.LastSuccessfulPaginationKeys)
+	s.Require().Equal(map[string]bool{"test.table3": true}, delta.CompletedTables)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00001", Pos: 100}, delta.LastWrittenBinlogPosition)
+}
+
+func (s *StateDeltaTestSuite) TestApplyStateDeltasReconstructsFullState() {
+	base := s.stateTracker.Serialize(s.tables, nil)
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 15)
+	delta1 := s.stateTracker.SerializeDelta(base, nil)
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 30)
+	s.stateTracker.MarkTableAsCompleted("test.table1")
+	s.stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	delta2 := s.stateTracker.SerializeDelta(ghostferry.ApplyStateDeltas(base, delta1), nil)
+
+	state := ghostferry.ApplyStateDeltas(base, delta1, delta2)
+	expected := s.stateTracker.Serialize(s.tables, nil)
+	s.Require().Equal(delta2.Generation, state.Generation)
+	s.Require().Equal(expected.Generation-1, state.Generation)
+	expected.Generation = state.Generation
+	s.Require().Equal(expected, state)
+
+	// The base must not be modified.
+	s.Require().Equal(uint64(10), base.LastSuccessfulPaginationKeys["test.table1"])
+	s.Require().False(base.CompletedTables["test.table1"])
+}
+
+func (s *StateDeltaTestSuite) TestApplyStateDeltasRemovesTheProgressOfAResetTable() {
+	s.stateTracker.MarkTableAsCompleted("test.table2")
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table3", 30)
+	base := s.stateTracker.Serialize(s.tables, nil)
+
+	s.stateTracker.ResetTable("test.table1")
+	s.stateTracker.ResetTable("test.table2")
+	delta := s.stateTracker.SerializeDelta(base, nil)
+	s.Require().Equal([]string{"test.table1", "test.table2"}, delta.RemovedLastSuccessfulPaginationKeys)
+	s.Require().Equal([]string{"test.table2"}, delta.RemovedCompletedTables)
+
+	// The removals survive the encoding of the delta.
+	data, err := json.Marshal(delta)
+	s.Require().Nil(err)
+	decoded := &ghostferry.StateDelta{}
+	s.Require().Nil(json.Unmarshal(data, decoded))
+	s.Require().Equal(delta.StateDeltaRemovals, decoded.StateDeltaRemovals)
+
+	state := ghostferry.ApplyStateDeltas(base, decoded)
+	s.Require().Equal(map[string]uint64{"test.table3": 30}, state.LastSuccessfulPaginationKeys)
+	s.Require().Empty(state.CompletedTables)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	s.Require().False(resumed.IsTableComplete("test.table2"))
+	s.Require().Equal(uint64(0), resumed.LastSuccessfulPaginationKey("test.table1"))
+}
+
+func (s *StateDeltaTestSuite) TestApplyStateDeltasRemovesDroppedTablesAndPrunedTableErrors() {
+	s.stateTracker.TrackTableErrors = true
+	s.stateTracker.RecordTableError("test.table2", errors.New("deadlock"))
+	base := s.stateTracker.Serialize(s.tables, nil)
+	s.Require().Contains(base.TableErrors, "test.table2")
+
+	// The error of a table is pruned once it is completed.
+	s.stateTracker.MarkTableDropped("test.table1")
+	s.stateTracker.MarkTableAsCompleted("test.table2")
+	delta := s.stateTracker.SerializeDelta(base, nil)
+	s.Require().Equal([]string{"test.table2"}, delta.RemovedTableErrors)
+
+	state := ghostferry.ApplyStateDeltas(base, delta)
+	s.Require().Equal(s.stateTracker.Serialize(s.tables, nil).LastSuccessfulPaginationKeys, state.LastSuccessfulPaginationKeys)
+	s.Require().Empty(state.TableErrors)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	s.Require().True(resumed.IsTableDropped("test.table1"))
+	s.Require().False(resumed.IsTableComplete("test.table1"))
+	s.Require().True(resumed.IsTableComplete("test.table2"))
+	s.Require().Empty(resumed.Serialize(nil, nil).TableErrors)
+}
+
+func TestStateDeltaTestSuite(t *testing.T) {
+	suite.Run(t, new(StateDeltaTestSuite))
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateDiffTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateDiffTestSuite) TestDiffStates() {
+	older := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{
+			"db.table1": 10,
+			"db.table2": 20,
+		},
+		CompletedTables: map[string]bool{
+			"db.table3": true,
+		},
+		LastWrittenBinlogPosition: mysql.Position{Name: "mysql-bin.00002", Pos: 10},
+	}
+
+	newer := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{
+			"db.table1": 15,
+			"db.table2": 20,
+			"db.table4": 5,
+		},
+		CompletedTables: map[string]bool{
+			"db.table2": true,
+			"db.table3": true,
+		},
+		LastWrittenBinlogPosition: mysql.Position{Name: "mysql-bin.00003", Pos: 4},
+	}
+
+	diff := ghostferry.DiffStates(older, newer)
+
+	s.Require().Equal(map[string]ghostferry.PaginationKeyAdvance{
+		"db.table1": {From: 10, To: 15},
+		"db.table4": {From: 0, To: 5},
+	}, diff.AdvancedTables)
+	s.Require().Equal([]string{"db.table2"}, diff.NewlyCompletedTables)
+	s.Require().True(diff.LastWrittenBinlogPosition.Moved())
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00003", Pos: 4}, diff.LastWrittenBinlogPosition.To)
+	s.Require().False(diff.LastStoredBinlogPositionForInlineVerifier.Moved())
+
+	_, err := json.Marshal(diff)
+	s.Require().Nil(err)
+}
+
+func (s *StateDiffTestSuite) TestDiffStatesOfIdenticalStatesIsEmpty() {
+	state := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{"db.table1": 10},
+		CompletedTables:              map[string]bool{"db.table2": true},
+	}
+
+	diff := ghostferry.DiffStates(state, state)
+	s.Require().Equal(0, len(diff.AdvancedTables))
+	s.Require().Equal(0, len(diff.NewlyCompletedTables))
+	s.Require().False(diff.LastWrittenBinlogPosition.Moved())
+	s.Require().Equal(0, len(diff.ResetTables))
+	s.Require().Equal(0, len(diff.NewlyDroppedTables))
+}
+
+func (s *StateDiffTestSuite) TestDiffStatesWithTablesMissingFromTheNewerState() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table2", 20)
+	stateTracker.MarkTableAsCompleted("db.table3")
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table4", 40)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table5", 50)
+	older := stateTracker.Serialize(nil, nil)
+
+	stateTracker.ResetTable("db.table1")
+	stateTracker.ResetTable("db.table2")
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table2", 5)
+	stateTracker.ResetTable("db.table3")
+	stateTracker.MarkTableDropped("db.table4")
+	stateTracker.MarkTableAsCompleted("db.table5")
+	newer := stateTracker.Serialize(nil, nil)
+
+	diff := ghostferry.DiffStates(older, newer)
+	s.Require().Equal([]string{"db.table1", "db.table2", "db.table3"}, diff.ResetTables)
+	s.Require().Equal([]string{"db.table4"}, diff.NewlyDroppedTables)
+	s.Require().Equal([]string{"db.table5"}, diff.NewlyCompletedTables)
+	s.Require().Equal(0, len(diff.AdvancedTables))
+
+	// The tables only in the newer state are advancing from 0.
+	diff = ghostferry.DiffStates(newer, older)
+	s.Require().Equal(map[string]ghostferry.PaginationKeyAdvance{
+		"db.table1": {From: 0, To: 10},
+		"db.table2": {From: 5, To: 20},
+		"db.table4": {From: 0, To: 40},
+	}, diff.AdvancedTables)
+	s.Require().Equal([]string{"db.table3"}, diff.NewlyCompletedTables)
+	s.Require().Equal([]string{"db.table5"}, diff.ResetTables)
+}
+
+func TestStateDiffTestSuite(t *testing.T) {
+	suite.Run(t, new(StateDiffTestSuite))
+}
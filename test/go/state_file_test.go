@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateFileTestSuite struct {
+	suite.Suite
+
+	dir          string
+	path         string
+	stateTracker *ghostferry.StateTracker
+}
+
+func (s *StateFileTestSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ghostferry-state-file")
+	s.Require().Nil(err)
+
+	s.path = filepath.Join(s.dir, "state.json")
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	s.stateTracker.MarkTableAsCompleted("db.table2")
+	s.stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+}
+
+func (s *StateFileTestSuite) TearDownTest() {
+	os.RemoveAll(s.dir)
+}
+
+func (s *StateFileTestSuite) TestDumpAndLoad() {
+	s.Require().Nil(s.stateTracker.DumpStateToFile(s.path, nil))
+
+	state, err := ghostferry.LoadStateFromFile(s.path)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(42), state.LastSuccessfulPaginationKeys["db.table1"])
+	s.Require().True(state.CompletedTables["db.table2"])
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00003", Pos: 4}, state.LastWrittenBinlogPosition)
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 43)
+	s.Require().Nil(s.stateTracker.DumpStateToFile(s.path, nil))
+
+	state, err = ghostferry.LoadStateFromFile(s.path)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(43), state.LastSuccessfulPaginationKeys["db.table1"])
+
+	files, err := ioutil.ReadDir(s.dir)
+	s.Require().Nil(err)
+	s.Require().Equal(1, len(files))
+}
+
+func (s *StateFileTestSuite) TestFailedDumpKeepsThePreviousState() {
+	s.Require().Nil(s.stateTracker.DumpStateToFile(s.path, nil))
+
+	err := s.stateTracker.DumpStateToFile(filepath.Join(s.dir, "missing", "state.json"), nil)
+	s.Require().NotNil(err)
+
+	_, err = ghostferry.LoadStateFromFile(s.path)
+	s.Require().Nil(err)
+
+	_, err = ghostferry.LoadStateFromFile(filepath.Join(s.dir, "missing.json"))
+	s.Require().True(os.IsNotExist(err))
+}
+
+func (s *StateFileTestSuite) TestPeriodicDump() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.stateTracker.StartPeriodicDump(ctx, s.path, 10*time.Millisecond, nil)
+
+	var dumped bool
+	for i := 0; i < 100 && !dumped; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err := os.Stat(s.path)
+		dumped = err == nil
+	}
+	s.Require().True(dumped)
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 50)
+	time.Sleep(50 * time.Millisecond)
+
+	state, err := ghostferry.LoadStateFromFile(s.path)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(42), state.LastSuccessfulPaginationKeys["db.table1"])
+}
+
+func (s *StateFileTestSuite) TestFileStateStore() {
+	store := &ghostferry.FileStateStore{Path: s.path}
+	state, err := store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Nil(state)
+
+	stateTracker, err := ghostferry.NewStateTrackerFromStateStore(10, store)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(0), stateTracker.LastSuccessfulPaginationKey("db.table1"))
+
+	s.Require().Nil(s.stateTracker.StoreState(store, nil))
+	stale := s.stateTracker.Serialize(nil, nil)
+	s.Require().Nil(s.stateTracker.StoreState(store, nil))
+	s.Require().Equal(ghostferry.ErrStaleStateGeneration, store.StoreState(stale))
+
+	stateTracker, err = ghostferry.NewStateTrackerFromStateStore(10, &ghostferry.FileStateStore{Path: s.path})
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(42), stateTracker.LastSuccessfulPaginationKey("db.table1"))
+	s.Require().True(stateTracker.IsTableComplete("db.table2"))
+
+	// A new store compares the generations with the one of the stored state.
+	s.Require().Equal(ghostferry.ErrStaleStateGeneration, (&ghostferry.FileStateStore{Path: s.path}).StoreState(stale))
+}
+
+func TestStateFileTestSuite(t *testing.T) {
+	suite.Run(t, new(StateFileTestSuite))
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateIncrementalTestSuite struct {
+	suite.Suite
+
+	tables       ghostferry.TableSchemaCache
+	stateTracker *ghostferry.StateTracker
+}
+
+func (s *StateIncrementalTestSuite) SetupTest() {
+	s.tables = ghostferry.TableSchemaCache{
+		"test.table1": &ghostferry.TableSchema{Table: &schema.Table{Schema: "test", Name: "table1"}},
+		"test.table2": &ghostferry.TableSchema{Table: &schema.Table{Schema: "test", Name: "table2"}},
+		"test.table3": &ghostferry.TableSchema{Table: &schema.Table{Schema: "test", Name: "table3"}},
+	}
+
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	s.stateTracker.MarkTableAsCompleted("test.table1")
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 20)
+}
+
+func (s *StateIncrementalTestSuite) TestSerializeIncrementalOmitsPreviouslyCompletedTables() {
+	prior := s.stateTracker.Serialize(s.tables, nil)
+
+	s.stateTracker.MarkTableAsCompleted("test.table2")
+	incremental := s.stateTracker.SerializeIncremental(prior, s.tables, nil)
+
+	s.Require().Equal([]string{"test.table1"}, incremental.OmittedCompletedTables)
+	s.Require().Equal(map[string]bool{"test.table2": true}, incremental.CompletedTables)
+	s.Require().Equal(map[string]uint64{"test.table2": 20}, incremental.LastSuccessfulPaginationKeys)
+	s.Require().Nil(incremental.LastKnownTableSchemaCache["test.table1"])
+	s.Require().Equal("", incremental.LastKnownTableSchemaHashes["test.table1"])
+	s.Require().Equal(prior.LastKnownTableSchemaCacheHash, incremental.LastKnownTableSchemaCacheHash)
+
+	// The given cache must not be modified.
+	s.Require().NotNil(s.tables["test.table1"])
+
+	merged, err := ghostferry.MergeIncrementalState(prior, incremental)
+	s.Require().Nil(err)
+	expected := s.stateTracker.Serialize(s.tables, nil)
+	s.Require().Equal(incremental.Generation, merged.Generation)
+	s.Require().Equal(expected.Generation-1, merged.Generation)
+	expected.Generation = merged.Generation
+	s.Require().Equal(expected, merged)
+}
+
+func (s *StateIncrementalTestSuite) TestSerializeIncrementalKeepsTablesWithSchemaChanges() {
+	prior := s.stateTracker.Serialize(s.tables, nil)
+
+	s.tables["test.table1"] = &ghostferry.TableSchema{
+		Table: &schema.Table{Schema: "test", Name: "table1", Columns: []schema.TableColumn{{Name: "id"}}},
+	}
+	incremental := s.stateTracker.SerializeIncremental(prior, s.tables, nil)
+	s.Require().Nil(incremental.OmittedCompletedTables)
+	s.Require().True(incremental.CompletedTables["test.table1"])
+}
+
+func (s *StateIncrementalTestSuite) TestMergeIncrementalStateRejectsWrongPrior() {
+	prior := s.stateTracker.Serialize(s.tables, nil)
+	incremental := s.stateTracker.SerializeIncremental(prior, s.tables, nil)
+
+	otherTracker := ghostferry.NewStateTracker(10)
+	_, err := ghostferry.MergeIncrementalState(otherTracker.Serialize(s.tables, nil), incremental)
+	s.Require().NotNil(err)
+
+	otherTracker.MarkTableAsCompleted("test.table1")
+	otherTables := ghostferry.TableSchemaCache{
+		"test.table1": &ghostferry.TableSchema{Table: &schema.Table{Schema: "other", Name: "table1"}},
+	}
+	_, err = ghostferry.MergeIncrementalState(otherTracker.Serialize(otherTables, nil), incremental)
+	s.Require().NotNil(err)
+}
+
+func TestStateIncrementalTestSuite(t *testing.T) {
+	suite.Run(t, new(StateIncrementalTestSuite))
+}
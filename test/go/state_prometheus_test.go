@@ -0,0 +1,68 @@
+package test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StatePrometheusTestSuite struct {
+	suite.Suite
+}
+
+func (s *StatePrometheusTestSuite) TestGather() {
+	registry := ghostferry.NewPrometheusRegistry()
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	stateTracker.MarkTableAsCompleted("db.table2")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: 10})
+	stateTracker.RegisterMetrics(registry, `run"1`)
+
+	metrics := string(registry.Gather())
+	s.Require().Contains(metrics, "# TYPE ghostferry_pagination_keys_per_second gauge\n")
+	s.Require().Contains(metrics, `ghostferry_completed_tables{run_id="run\"1"} 1`+"\n")
+	s.Require().Contains(metrics, `ghostferry_last_successful_pagination_key{run_id="run\"1",table="db.table1"} 42`+"\n")
+	s.Require().Contains(metrics, "# TYPE ghostferry_last_written_binlog_position counter\n")
+	s.Require().Contains(metrics, `ghostferry_last_written_binlog_position{run_id="run\"1"} 8.589934602e+09`+"\n")
+
+	// The metrics are read on scrape.
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 50)
+	s.Require().Contains(string(registry.Gather()), `table="db.table1"} 50`+"\n")
+}
+
+func (s *StatePrometheusTestSuite) TestRegisterIsIdempotentPerRunID() {
+	registry := ghostferry.NewPrometheusRegistry()
+
+	ghostferry.NewStateTracker(10).RegisterMetrics(registry, "run1")
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("db.table1")
+	stateTracker.RegisterMetrics(registry, "run1")
+	stateTracker.RegisterMetrics(registry, "run1")
+
+	metrics := string(registry.Gather())
+	s.Require().Equal(1, strings.Count(metrics, "ghostferry_completed_tables{"))
+	s.Require().Contains(metrics, `ghostferry_completed_tables{run_id="run1"} 1`+"\n")
+
+	registry.Unregister("run1")
+	s.Require().NotContains(string(registry.Gather()), "run1")
+}
+
+func (s *StatePrometheusTestSuite) TestServeHTTP() {
+	registry := ghostferry.NewPrometheusRegistry()
+	ghostferry.NewStateTracker(10).RegisterMetrics(registry, "run1")
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	s.Require().Equal(200, recorder.Code)
+	s.Require().Equal("text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	s.Require().Contains(recorder.Body.String(), `ghostferry_pagination_keys_per_second{run_id="run1"} 0`+"\n")
+}
+
+func TestStatePrometheusTestSuite(t *testing.T) {
+	suite.Run(t, new(StatePrometheusTestSuite))
+}
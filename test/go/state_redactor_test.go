@@ -0,0 +1,77 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type columnNameRedactor struct{}
+
+func (columnNameRedactor) RedactTableSchema(table *ghostferry.TableSchema) error {
+	for i := range table.Columns {
+		table.Columns[i].Name = "redacted"
+	}
+	return nil
+}
+
+type failingRedactor struct{}
+
+func (failingRedactor) RedactTableSchema(table *ghostferry.TableSchema) error {
+	return errors.New("cannot redact")
+}
+
+type StateRedactorTestSuite struct {
+	suite.Suite
+
+	tables ghostferry.TableSchemaCache
+}
+
+func (s *StateRedactorTestSuite) SetupTest() {
+	s.tables = ghostferry.TableSchemaCache{
+		"db.table1": &ghostferry.TableSchema{
+			Table: &schema.Table{
+				Schema:  "db",
+				Name:    "table1",
+				Columns: []schema.TableColumn{{Name: "id"}, {Name: "secret"}},
+			},
+		},
+	}
+}
+
+func (s *StateRedactorTestSuite) TestRedactSerializableState() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	serializedState := stateTracker.Serialize(s.tables, nil)
+
+	err := ghostferry.RedactSerializableState(serializedState, columnNameRedactor{})
+	s.Require().Nil(err)
+
+	s.Require().True(serializedState.LastKnownTableSchemaCacheRedacted)
+	s.Require().Equal("redacted", serializedState.LastKnownTableSchemaCache["db.table1"].Columns[1].Name)
+
+	// The schema in use is not modified and still matches the hashes.
+	s.Require().Equal("secret", s.tables["db.table1"].Columns[1].Name)
+	driftedTables, err := serializedState.TablesWithSchemaDrift(s.tables)
+	s.Require().Nil(err)
+	s.Require().Equal(0, len(driftedTables))
+}
+
+func (s *StateRedactorTestSuite) TestRedactSerializableStateErrors() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	serializedState := stateTracker.Serialize(s.tables, nil)
+
+	err := ghostferry.RedactSerializableState(serializedState, failingRedactor{})
+	s.Require().NotNil(err)
+	s.Require().False(serializedState.LastKnownTableSchemaCacheRedacted)
+
+	serializedState.LastKnownTableSchemaHashes = nil
+	err = ghostferry.RedactSerializableState(serializedState, columnNameRedactor{})
+	s.Require().NotNil(err)
+}
+
+func TestStateRedactorTestSuite(t *testing.T) {
+	suite.Run(t, new(StateRedactorTestSuite))
+}
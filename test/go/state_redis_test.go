@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+// Speaks just enough of the Redis protocol for the RedisStateStore, and runs
+// the store script itself.
+type fakeRedisServer struct {
+	listener net.Listener
+	password string
+
+	mutex    sync.Mutex
+	hashes   map[string]map[string]string
+	commands []string
+}
+
+func newFakeRedisServer(password string) (*fakeRedisServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &fakeRedisServer{
+		listener: listener,
+		password: password,
+		hashes:   make(map[string]map[string]string),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server, nil
+}
+
+func (f *fakeRedisServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mutex.Lock()
+		f.commands = append(f.commands, strings.ToUpper(args[0]))
+		reply := "-ERR unknown command\r\n"
+		switch {
+		case strings.ToUpper(args[0]) == "AUTH":
+			if args[1] == f.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case strings.ToUpper(args[0]) == "SELECT", strings.ToUpper(args[0]) == "PING":
+			reply = "+OK\r\n"
+		case strings.ToUpper(args[0]) == "HGET":
+			value, found := f.hashes[args[1]][args[2]]
+			if found {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case strings.ToUpper(args[0]) == "EVAL":
+			key, state, generation := args[3], args[4], args[5]
+			hash, found := f.hashes[key]
+			if !found {
+				hash = make(map[string]string)
+				f.hashes[key] = hash
+			}
+
+			stored, _ := strconv.ParseUint(hash["generation"], 10, 64)
+			newGeneration, _ := strconv.ParseUint(generation, 10, 64)
+			if newGeneration != 0 && newGeneration <= stored {
+				reply = ":0\r\n"
+			} else {
+				hash["state"] = state
+				if newGeneration > stored {
+					hash["generation"] = generation
+				}
+				reply = ":1\r\n"
+			}
+		}
+		f.mutex.Unlock()
+
+		_, err = io.WriteString(conn, reply)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+
+	return args, nil
+}
+
+type RedisStateStoreTestSuite struct {
+	suite.Suite
+
+	server *fakeRedisServer
+	store  *ghostferry.RedisStateStore
+}
+
+func (s *RedisStateStoreTestSuite) SetupTest() {
+	var err error
+	s.server, err = newFakeRedisServer("secret")
+	s.Require().Nil(err)
+
+	s.store = &ghostferry.RedisStateStore{
+		Addr:     s.server.listener.Addr().String(),
+		Password: "secret",
+		DB:       2,
+		RunID:    "run1",
+	}
+	s.Require().Nil(s.store.Initialize())
+}
+
+func (s *RedisStateStoreTestSuite) TearDownTest() {
+	s.server.listener.Close()
+}
+
+func (s *RedisStateStoreTestSuite) TestStoreAndLoadState() {
+	state, err := s.store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Nil(state)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	stateTracker.MarkTableAsCompleted("db.table2")
+	s.Require().Nil(stateTracker.StoreState(s.store, nil))
+
+	resumedStateTracker, err := ghostferry.NewStateTrackerFromStateStore(10, s.store)
+	s.Require().Nil(err)
+	s.Require().Equal(uint64(42), resumedStateTracker.LastSuccessfulPaginationKey("db.table1"))
+	s.Require().True(resumedStateTracker.IsTableComplete("db.table2"))
+
+	s.Require().Contains(s.server.hashes, "ghostferry:state:run1")
+	s.Require().Equal([]string{"AUTH", "SELECT", "PING"}, s.server.commands[:3])
+}
+
+func (s *RedisStateStoreTestSuite) TestRunsAreKeyedByRunID() {
+	s.Require().Nil(s.store.StoreState(&ghostferry.SerializableState{GhostferryVersion: "run1"}))
+
+	otherStore := *s.store
+	otherStore.RunID = "run2"
+	state, err := otherStore.LoadState()
+	s.Require().Nil(err)
+	s.Require().Nil(state)
+
+	s.Require().Nil(otherStore.StoreState(&ghostferry.SerializableState{GhostferryVersion: "run2"}))
+	state, err = s.store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Equal("run1", state.GhostferryVersion)
+}
+
+func (s *RedisStateStoreTestSuite) TestStaleStateIsNotStored() {
+	s.Require().Nil(s.store.StoreState(&ghostferry.SerializableState{Generation: 2, GhostferryVersion: "2"}))
+	s.Require().Equal(ghostferry.ErrStaleStateGeneration, s.store.StoreState(&ghostferry.SerializableState{Generation: 2, GhostferryVersion: "stale"}))
+	s.Require().Equal(ghostferry.ErrStaleStateGeneration, s.store.StoreState(&ghostferry.SerializableState{Generation: 1, GhostferryVersion: "stale"}))
+
+	state, err := s.store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Equal("2", state.GhostferryVersion)
+
+	// States without a Generation are always stored.
+	s.Require().Nil(s.store.StoreState(&ghostferry.SerializableState{GhostferryVersion: "0"}))
+	s.Require().Nil(s.store.StoreState(&ghostferry.SerializableState{Generation: 3, GhostferryVersion: "3"}))
+	s.Require().Equal(ghostferry.ErrStaleStateGeneration, s.store.StoreState(&ghostferry.SerializableState{Generation: 2, GhostferryVersion: "stale"}))
+}
+
+func (s *RedisStateStoreTestSuite) TestInitializeErrors() {
+	s.Require().EqualError((&ghostferry.RedisStateStore{Addr: s.store.Addr}).Initialize(), "RedisStateStore requires a RunID")
+
+	wrongPassword := &ghostferry.RedisStateStore{Addr: s.store.Addr, RunID: "run1", Password: "wrong"}
+	err := wrongPassword.Initialize()
+	s.Require().NotNil(err)
+	s.Require().Contains(err.Error(), "WRONGPASS")
+
+	noPassword := &ghostferry.RedisStateStore{Addr: s.store.Addr, RunID: "run1"}
+	err = noPassword.Initialize()
+	s.Require().NotNil(err)
+	s.Require().Contains(err.Error(), "NOAUTH")
+}
+
+func TestRedisStateStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(RedisStateStoreTestSuite))
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateReportTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateReportTestSuite) TestReport() {
+	state := &ghostferry.SerializableState{
+		GhostferryVersion: "1.1.0",
+		LastSuccessfulPaginationKeys: map[string]uint64{
+			"db.table1": 10,
+			"db.table2": 20,
+		},
+		CompletedTables: map[string]bool{
+			"db.table3": true,
+		},
+		CopyCompletedTables: map[string]bool{
+			"db.table4": true,
+		},
+		TableErrors: map[string]string{
+			"db.table2": "connection refused",
+		},
+		LastWrittenBinlogPosition: mysql.Position{Name: "mysql-bin.00002", Pos: 10},
+		RowsCopied:                42,
+		FinalizedAt:               time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	expected := `Ghostferry version: 1.1.0
+Finalized at: 2020-01-02T03:04:05Z
+Binlog position: mysql-bin.00002:10
+Inline verifier binlog position: none
+Rows copied: 42
+Tables: 1/4 completed, 1 pending verification, 2 in progress
+
+In progress tables:
+  db.table1: pagination key 10
+  db.table2: pagination key 20 (last error: connection refused)
+
+Tables pending verification:
+  db.table4
+`
+	s.Require().Equal(expected, state.Report())
+}
+
+func (s *StateReportTestSuite) TestReportTruncatesLargeTableCounts() {
+	state := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: make(map[string]uint64),
+	}
+	for i := 0; i < 1000; i++ {
+		state.LastSuccessfulPaginationKeys[fmt.Sprintf("db.table%04d", i)] = uint64(i)
+	}
+
+	report := state.ReportWithLimit(3)
+	s.Require().Contains(report, "Tables: 0/1000 completed, 0 pending verification, 1000 in progress\n")
+	s.Require().Contains(report, "  db.table0002: pagination key 2\n  ... and 997 more tables\n")
+	s.Require().NotContains(report, "db.table0003")
+
+	s.Require().Equal(1000+8, strings.Count(state.ReportWithLimit(0), "\n"))
+}
+
+func TestStateReportTestSuite(t *testing.T) {
+	suite.Run(t, new(StateReportTestSuite))
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateResumePlanTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateResumePlanTestSuite) TestResumePlan() {
+	state := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{
+			"db.resuming": 10,
+			"db.errored":  20,
+			"db.excluded": 30,
+		},
+		CompletedPaginationKeyRanges: map[string][][2]uint64{
+			"db.ranges": {{100, 200}, {300, 400}},
+		},
+		CompletedTables: map[string]bool{
+			"db.completed": true,
+		},
+		CopyCompletedTables: map[string]bool{
+			"db.copied": true,
+		},
+		TableErrors: map[string]string{
+			"db.errored": "connection refused",
+		},
+		DroppedTables:                             []string{"db.dropped"},
+		LastWrittenBinlogPosition:                 mysql.Position{Name: "mysql-bin.00002", Pos: 10},
+		LastStoredBinlogPositionForInlineVerifier: mysql.Position{Name: "mysql-bin.00001", Pos: 20},
+	}
+
+	plan := state.ResumePlan([]string{"db.resuming", "db.errored", "db.ranges", "db.completed", "db.copied", "db.dropped", "db.new"})
+	s.Require().Equal([]string{"db.completed"}, plan.CompletedTables)
+	s.Require().Equal([]string{"db.copied"}, plan.PendingVerificationTables)
+	s.Require().Equal([]ghostferry.ResumePlanTable{
+		{Table: "db.errored", LastSuccessfulPaginationKey: 20, LastError: "connection refused"},
+		{Table: "db.ranges", CompletedRanges: 2},
+		{Table: "db.resuming", LastSuccessfulPaginationKey: 10},
+	}, plan.ResumingTables)
+	s.Require().Equal([]string{"db.new"}, plan.NewTables)
+	s.Require().Equal([]string{"db.dropped"}, plan.DroppedTables)
+	s.Require().Equal([]string{"db.excluded"}, plan.UnknownTables)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00001", Pos: 20}, plan.BinlogPosition)
+	s.Require().Equal([]string{
+		"1 tables with progress in the state are not part of the run",
+		"db.errored failed in the previous run: connection refused",
+	}, plan.Warnings)
+	s.Require().True(plan.IsRisky())
+
+	expected := `Binlog position: mysql-bin.00001:20
+Tables: 1 skipped as completed, 1 skipped pending verification, 3 resuming, 1 starting, 1 dropped
+
+Resuming tables:
+  db.errored: after pagination key 20
+  db.ranges: after pagination key 0, skipping 2 completed ranges
+  db.resuming: after pagination key 10
+
+Tables not part of the run:
+  db.excluded
+
+Warnings:
+  1 tables with progress in the state are not part of the run
+  db.errored failed in the previous run: connection refused
+`
+	s.Require().Equal(expected, plan.String())
+}
+
+func (s *StateResumePlanTestSuite) TestResumePlanOfCleanState() {
+	state := &ghostferry.SerializableState{
+		CompletedTables:           map[string]bool{"db.table1": true},
+		LastWrittenBinlogPosition: mysql.Position{Name: "mysql-bin.00002", Pos: 10},
+	}
+
+	plan := state.ResumePlan([]string{"db.table1", "db.table2"})
+	s.Require().False(plan.IsRisky())
+	s.Require().Equal([]string{"db.table2"}, plan.NewTables)
+
+	plan = (&ghostferry.SerializableState{OmittedCompletedTables: []string{"db.table1"}}).ResumePlan(nil)
+	s.Require().Equal([]string{
+		"the state is incremental, 1 completed tables are omitted and would be copied again unless it is merged with MergeIncrementalState",
+		"the state has no binlog position to resume from",
+	}, plan.Warnings)
+}
+
+func TestStateResumePlanTestSuite(t *testing.T) {
+	suite.Run(t, new(StateResumePlanTestSuite))
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type memoryStateStore struct {
+	states []*ghostferry.SerializableState
+}
+
+func (s *memoryStateStore) StoreState(state *ghostferry.SerializableState) error {
+	s.states = append(s.states, state)
+	return nil
+}
+
+func (s *memoryStateStore) LoadState() (*ghostferry.SerializableState, error) {
+	if len(s.states) == 0 {
+		return nil, nil
+	}
+	state := *s.states[len(s.states)-1]
+	return &state, nil
+}
+
+type SplitSchemaStateStoreTestSuite struct {
+	suite.Suite
+
+	dir          string
+	tables       ghostferry.TableSchemaCache
+	stateStore   *memoryStateStore
+	store        *ghostferry.SplitSchemaStateStore
+	stateTracker *ghostferry.StateTracker
+}
+
+func (s *SplitSchemaStateStoreTestSuite) SetupTest() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "ghostferry-schema-cache")
+	s.Require().Nil(err)
+
+	s.tables = ghostferry.TableSchemaCache{
+		"test.table1": &ghostferry.TableSchema{Table: &schema.Table{Schema: "test", Name: "table1"}},
+	}
+	s.stateStore = &memoryStateStore{}
+	s.store = &ghostferry.SplitSchemaStateStore{
+		StateStore:       s.stateStore,
+		SchemaCacheStore: &ghostferry.FileSchemaCacheStore{Dir: s.dir},
+	}
+	s.stateTracker = ghostferry.NewStateTracker(10)
+}
+
+func (s *SplitSchemaStateStoreTestSuite) TearDownTest() {
+	os.RemoveAll(s.dir)
+}
+
+func (s *SplitSchemaStateStoreTestSuite) schemaCacheFiles() []string {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"))
+	s.Require().Nil(err)
+	return files
+}
+
+func (s *SplitSchemaStateStoreTestSuite) TestSchemaCacheIsStoredOnlyWhenChanged() {
+	ref, err := ghostferry.SchemaCacheRef(s.tables)
+	s.Require().Nil(err)
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	s.Require().Nil(s.store.StoreState(s.stateTracker.Serialize(s.tables, nil)))
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 20)
+	s.Require().Nil(s.store.StoreState(s.stateTracker.Serialize(s.tables, nil)))
+
+	s.Require().Equal(1, len(s.schemaCacheFiles()))
+	for _, state := range s.stateStore.states {
+		s.Require().Nil(state.LastKnownTableSchemaCache)
+		s.Require().Equal(ref, state.LastKnownTableSchemaCacheRef)
+	}
+
+	s.tables["test.table2"] = &ghostferry.TableSchema{Table: &schema.Table{Schema: "test", Name: "table2"}}
+	s.Require().Nil(s.store.StoreState(s.stateTracker.Serialize(s.tables, nil)))
+	s.Require().Equal(2, len(s.schemaCacheFiles()))
+
+	state, err := s.store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Equal("", state.LastKnownTableSchemaCacheRef)
+	s.Require().Equal(uint64(20), state.LastSuccessfulPaginationKeys["test.table1"])
+	s.Require().Equal(2, len(state.LastKnownTableSchemaCache))
+	s.Require().Equal("table2", state.LastKnownTableSchemaCache["test.table2"].Name)
+}
+
+func (s *SplitSchemaStateStoreTestSuite) TestLoadStateFailsWithMissingSchemaCache() {
+	s.Require().Nil(s.store.StoreState(s.stateTracker.Serialize(s.tables, nil)))
+	for _, file := range s.schemaCacheFiles() {
+		s.Require().Nil(os.Remove(file))
+	}
+
+	_, err := s.store.LoadState()
+	s.Require().NotNil(err)
+}
+
+func (s *SplitSchemaStateStoreTestSuite) TestStateWithoutSchemaCacheIsStoredAsIs() {
+	s.Require().Nil(s.store.StoreState(s.stateTracker.Serialize(nil, nil)))
+	s.Require().Equal(0, len(s.schemaCacheFiles()))
+
+	state, err := s.store.LoadState()
+	s.Require().Nil(err)
+	s.Require().Nil(state.LastKnownTableSchemaCache)
+
+	_, err = s.store.ListGenerations()
+	s.Require().NotNil(err)
+}
+
+func TestSplitSchemaStateStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(SplitSchemaStateStoreTestSuite))
+}
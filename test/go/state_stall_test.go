@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateStallTestSuite struct {
+	suite.Suite
+
+	stateTracker *ghostferry.StateTracker
+}
+
+func (s *StateStallTestSuite) SetupTest() {
+	s.stateTracker = ghostferry.NewStateTracker(10)
+	s.stateTracker.SetTableSizes(map[string]uint64{"test.table1": 1000, "test.table2": 1000})
+}
+
+func (s *StateStallTestSuite) TestIsStalled() {
+	time.Sleep(30 * time.Millisecond)
+	s.Require().False(s.stateTracker.IsStalled())
+
+	s.stateTracker.SetStallThreshold(20 * time.Millisecond)
+	s.Require().False(s.stateTracker.IsStalled())
+
+	// The copy of no table started.
+	time.Sleep(30 * time.Millisecond)
+	s.Require().True(s.stateTracker.IsStalled())
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	s.Require().False(s.stateTracker.IsStalled())
+
+	// Updates not moving the pagination key forward are no progress.
+	time.Sleep(30 * time.Millisecond)
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	s.Require().True(s.stateTracker.IsStalled())
+
+	// A planned pause is not a stall.
+	s.stateTracker.Pause()
+	s.Require().False(s.stateTracker.IsStalled())
+	time.Sleep(30 * time.Millisecond)
+	s.stateTracker.Resume()
+	s.Require().True(s.stateTracker.IsStalled())
+
+	s.stateTracker.MarkTableAsCompleted("test.table1")
+	s.Require().False(s.stateTracker.IsStalled())
+
+	// The copy is complete.
+	s.stateTracker.MarkTableAsCompleted("test.table2")
+	time.Sleep(30 * time.Millisecond)
+	s.Require().False(s.stateTracker.IsStalled())
+}
+
+func (s *StateStallTestSuite) TestStallMonitor() {
+	var stalls int32
+	s.stateTracker.OnStall = func() {
+		atomic.AddInt32(&stalls, 1)
+	}
+	s.stateTracker.SetStallThreshold(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.stateTracker.StartStallMonitor(ctx, 2*time.Millisecond)
+
+	// Called once per stall.
+	time.Sleep(60 * time.Millisecond)
+	s.Require().Equal(int32(1), atomic.LoadInt32(&stalls))
+
+	s.stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	time.Sleep(10 * time.Millisecond)
+	s.Require().Equal(int32(1), atomic.LoadInt32(&stalls))
+	time.Sleep(50 * time.Millisecond)
+	s.Require().Equal(int32(2), atomic.LoadInt32(&stalls))
+
+	// Not called once the copy is complete.
+	s.stateTracker.MarkTableAsCompleted("test.table1")
+	s.stateTracker.MarkTableAsCompleted("test.table2")
+	time.Sleep(60 * time.Millisecond)
+	s.Require().Equal(int32(2), atomic.LoadInt32(&stalls))
+}
+
+func (s *StateStallTestSuite) TestStallMonitorStopsWithTheContext() {
+	var stalls int32
+	s.stateTracker.OnStall = func() {
+		atomic.AddInt32(&stalls, 1)
+	}
+	s.stateTracker.SetStallThreshold(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stateTracker.StartStallMonitor(ctx, 2*time.Millisecond)
+	cancel()
+
+	time.Sleep(60 * time.Millisecond)
+	s.Require().Equal(int32(0), atomic.LoadInt32(&stalls))
+}
+
+func TestStateStallTestSuite(t *testing.T) {
+	suite.Run(t, new(StateStallTestSuite))
+}
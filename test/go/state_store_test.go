@@ -0,0 +1,135 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type MySQLStateStoreTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	store *ghostferry.MySQLStateStore
+}
+
+func (this *MySQLStateStoreTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", testhelpers.TestSchemaName))
+	this.Require().Nil(err)
+
+	this.store = &ghostferry.MySQLStateStore{
+		DB:       this.Ferry.TargetDB,
+		Database: testhelpers.TestSchemaName,
+		Table:    "_ghostferry_state",
+		RunID:    "run1",
+	}
+
+	this.Require().Nil(this.store.Initialize())
+}
+
+func (this *MySQLStateStoreTestSuite) TestLoadStateWithoutStoredState() {
+	state, err := this.store.LoadState()
+	this.Require().Nil(err)
+	this.Require().Nil(state)
+}
+
+func (this *MySQLStateStoreTestSuite) TestStoreStateReplacesPreviousState() {
+	state := &ghostferry.SerializableState{
+		GhostferryVersion:            ghostferry.VersionString,
+		LastSuccessfulPaginationKeys: map[string]uint64{"gftest.table1": 10},
+		CompletedTables:              map[string]bool{},
+		LastWrittenBinlogPosition:    mysql.Position{Name: "mysql-bin.00001", Pos: 4},
+	}
+	this.Require().Nil(this.store.StoreState(state))
+
+	state.LastSuccessfulPaginationKeys["gftest.table1"] = 20
+	this.Require().Nil(this.store.StoreState(state))
+
+	loaded, err := this.store.LoadState()
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(20), loaded.LastSuccessfulPaginationKeys["gftest.table1"])
+	this.Require().Equal(state.LastWrittenBinlogPosition, loaded.LastWrittenBinlogPosition)
+
+	var count int
+	row := this.Ferry.TargetDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s._ghostferry_state", testhelpers.TestSchemaName))
+	this.Require().Nil(row.Scan(&count))
+	this.Require().Equal(1, count)
+}
+
+func (this *MySQLStateStoreTestSuite) TestRunsAreStoredSeparately() {
+	other := &ghostferry.MySQLStateStore{
+		DB:       this.Ferry.TargetDB,
+		Database: testhelpers.TestSchemaName,
+		Table:    "_ghostferry_state",
+		RunID:    "run2",
+	}
+	this.Require().Nil(other.Initialize())
+
+	this.Require().Nil(this.store.StoreState(&ghostferry.SerializableState{GhostferryVersion: "1"}))
+
+	state, err := other.LoadState()
+	this.Require().Nil(err)
+	this.Require().Nil(state)
+}
+
+func (this *MySQLStateStoreTestSuite) TestLoadOlderGeneration() {
+	store := &ghostferry.MySQLStateStore{
+		DB:              this.Ferry.TargetDB,
+		Database:        testhelpers.TestSchemaName,
+		Table:           "_ghostferry_state",
+		RunID:           "run3",
+		KeepGenerations: 2,
+	}
+	this.Require().Nil(store.Initialize())
+
+	for _, paginationKey := range []uint64{10, 20, 30} {
+		state := &ghostferry.SerializableState{
+			LastSuccessfulPaginationKeys: map[string]uint64{"gftest.table1": paginationKey},
+		}
+		this.Require().Nil(store.StoreState(state))
+	}
+
+	generations, err := store.ListGenerations()
+	this.Require().Nil(err)
+	this.Require().Equal([]uint64{2, 3}, generations)
+
+	state, err := store.LoadStateGeneration(2)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(20), state.LastSuccessfulPaginationKeys["gftest.table1"])
+
+	state, err = store.LoadStateGeneration(1)
+	this.Require().Nil(err)
+	this.Require().Nil(state)
+
+	state, err = store.LoadState()
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(30), state.LastSuccessfulPaginationKeys["gftest.table1"])
+}
+
+func (this *MySQLStateStoreTestSuite) TestRejectsStaleGenerations() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table1", 10)
+	stale := stateTracker.Serialize(nil, nil)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("gftest.table1", 20)
+	this.Require().Nil(this.store.StoreState(stateTracker.Serialize(nil, nil)))
+
+	this.Require().Equal(ghostferry.ErrStaleStateGeneration, this.store.StoreState(stale))
+
+	// The states without a Generation, from older versions, are still stored.
+	this.Require().Nil(this.store.StoreState(&ghostferry.SerializableState{GhostferryVersion: "1"}))
+
+	loaded, err := this.store.LoadState()
+	this.Require().Nil(err)
+	this.Require().Equal("1", loaded.GhostferryVersion)
+}
+
+func TestMySQLStateStoreTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &MySQLStateStoreTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateStringTestSuite struct {
+	suite.Suite
+
+	state *ghostferry.SerializableState
+}
+
+func (s *StateStringTestSuite) SetupTest() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 1<<40)
+	stateTracker.MarkRangeComplete("db.table2", 10, 20)
+	stateTracker.MarkTableAsCompleted("db.table3")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+	stateTracker.SetMetadata("worker", "1")
+	s.state = stateTracker.Serialize(nil, nil)
+}
+
+func (s *StateStringTestSuite) TestRoundTrip() {
+	str, err := s.state.ToString()
+	s.Require().Nil(err)
+	s.Require().Regexp(regexp.MustCompile(`^[A-Za-z0-9_:-]+$`), str)
+
+	state, err := ghostferry.SerializableStateFromString(str + "\n")
+	s.Require().Nil(err)
+	s.Require().Equal(s.state.LastSuccessfulPaginationKeys, state.LastSuccessfulPaginationKeys)
+	s.Require().Equal(s.state.CompletedPaginationKeyRanges, state.CompletedPaginationKeyRanges)
+	s.Require().Equal(s.state.CompletedTables, state.CompletedTables)
+	s.Require().Equal(s.state.LastWrittenBinlogPosition, state.LastWrittenBinlogPosition)
+	s.Require().Equal(s.state.Metadata, state.Metadata)
+	s.Require().Equal(s.state.GhostferryVersion, state.GhostferryVersion)
+}
+
+func (s *StateStringTestSuite) TestRejectsInvalidStrings() {
+	str, err := s.state.ToString()
+	s.Require().Nil(err)
+
+	_, err = ghostferry.SerializableStateFromString(`{"GhostferryVersion": "1.1.0"}`)
+	s.Require().Equal(ghostferry.ErrNotStateString, err)
+
+	_, err = ghostferry.SerializableStateFromString(str[:len(str)-10])
+	s.Require().NotNil(err)
+
+	_, err = ghostferry.SerializableStateFromString(str + "!")
+	s.Require().NotNil(err)
+}
+
+func TestStateStringTestSuite(t *testing.T) {
+	suite.Run(t, new(StateStringTestSuite))
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateTrackerGroupTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateTrackerGroupTestSuite) TestTrackersAreIndependent() {
+	group := ghostferry.NewStateTrackerGroup(10)
+	group.Tracker("tenant1").MarkTableAsCompleted("db.table1")
+	group.Tracker("tenant2").UpdateLastSuccessfulPaginationKey("db.table1", 10)
+
+	s.Require().Equal([]string{"tenant1", "tenant2"}, group.Names())
+	s.Require().True(group.Tracker("tenant1").IsTableComplete("db.table1"))
+	s.Require().False(group.Tracker("tenant2").IsTableComplete("db.table1"))
+
+	s.Require().Nil(group.Add("tenant3", ghostferry.NewStateTracker(10)))
+	s.Require().NotNil(group.Add("tenant3", ghostferry.NewStateTracker(10)))
+
+	group.Remove("tenant3")
+	s.Require().Equal([]string{"tenant1", "tenant2"}, group.Names())
+}
+
+func (s *StateTrackerGroupTestSuite) TestAggregates() {
+	group := ghostferry.NewStateTrackerGroup(10)
+	for _, name := range []string{"tenant1", "tenant2"} {
+		tracker := group.Tracker(name)
+		tracker.MinSpeedLogSampleInterval = 0
+		tracker.UpdateBatch(map[string]uint64{"db.table1": 1000}, 100)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for _, name := range []string{"tenant1", "tenant2"} {
+		group.Tracker(name).UpdateBatch(map[string]uint64{"db.table1": 2000}, 100)
+	}
+
+	s.Require().Equal(uint64(400), group.RowsCopied())
+	s.Require().InDelta(
+		group.Tracker("tenant1").EstimatedPaginationKeysPerSecond()+group.Tracker("tenant2").EstimatedPaginationKeysPerSecond(),
+		group.EstimatedPaginationKeysPerSecond(),
+		0.001,
+	)
+	s.Require().True(group.Rates()["1m"] > 0)
+
+	// tenant1 is done with its table of 2000, and tenant2 is at 2000 out of
+	// 6000.
+	group.Tracker("tenant1").MarkTableAsCompleted("db.table1")
+	s.Require().InDelta(0.5, group.OverallProgress(map[string]map[string]uint64{
+		"tenant1": {"db.table1": 2000},
+		"tenant2": {"db.table1": 6000},
+	}), 0.001)
+
+	// Without sizes, each migration counts equally.
+	s.Require().InDelta(0.5, group.OverallProgress(nil), 0.001)
+}
+
+func (s *StateTrackerGroupTestSuite) TestSerializeAndResume() {
+	group := ghostferry.NewStateTrackerGroup(10)
+	group.Tracker("tenant1").MarkTableAsCompleted("db.table1")
+	group.Tracker("tenant2").UpdateLastSuccessfulPaginationKey("db.table1", 10)
+
+	data, err := json.Marshal(group.Serialize(nil, nil))
+	s.Require().Nil(err)
+
+	state := &ghostferry.SerializableStateGroup{}
+	s.Require().Nil(json.Unmarshal(data, state))
+	s.Require().Equal(2, len(state.States))
+
+	resumed := ghostferry.NewStateTrackerGroupFromSerializedState(10, state)
+	s.Require().Equal([]string{"tenant1", "tenant2"}, resumed.Names())
+	s.Require().True(resumed.Tracker("tenant1").IsTableComplete("db.table1"))
+	s.Require().True(resumed.Tracker("tenant1").IsResume())
+
+	_, paginationKeys := resumed.Tracker("tenant2").CopyProgressSnapshot()
+	s.Require().Equal(uint64(10), paginationKeys["db.table1"])
+
+	// A migration that was not part of the state starts from scratch.
+	s.Require().False(resumed.Tracker("tenant3").IsResume())
+}
+
+func TestStateTrackerGroupTestSuite(t *testing.T) {
+	suite.Run(t, new(StateTrackerGroupTestSuite))
+}
@@ -1,10 +1,19 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -66,6 +75,2938 @@ func (s *StateTrackerTestSuite) TestMinBinlogPosition() {
 	s.Require().Equal(serializedState.MinBinlogPosition(), mysql.Position{"mysql-bin.00002", 10})
 }
 
+func (s *StateTrackerTestSuite) TestMinBinlogPositionWithConsumers() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00004", Pos: 100})
+
+	// The consumers start at the current minimum.
+	stateTracker.RegisterBinlogConsumer("cdc")
+	stateTracker.RegisterBinlogConsumer("audit")
+	stateTracker.RegisterBinlogConsumer("cache")
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00004", Pos: 100}, stateTracker.MinBinlogPosition())
+
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+	stateTracker.UpdateConsumerPosition("cdc", mysql.Position{Name: "mysql-bin.00006", Pos: 4})
+	stateTracker.UpdateConsumerPosition("audit", mysql.Position{Name: "mysql-bin.00004", Pos: 200})
+	stateTracker.UpdateConsumerPosition("cache", mysql.Position{Name: "mysql-bin.00005", Pos: 50})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00004", Pos: 200}, stateTracker.MinBinlogPosition())
+
+	// Moving backwards and unregistered consumers are ignored.
+	stateTracker.UpdateConsumerPosition("audit", mysql.Position{Name: "mysql-bin.00004", Pos: 150})
+	stateTracker.UpdateConsumerPosition("unknown", mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00004", Pos: 200}, stateTracker.MinBinlogPosition())
+
+	stateTracker.UnregisterBinlogConsumer("audit")
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, stateTracker.MinBinlogPosition())
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00007", Pos: 4})
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00007", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 50}, stateTracker.MinBinlogPosition())
+
+	// The consumers are restored on resume, and keep their position when
+	// registered again.
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 50}, state.MinBinlogPosition())
+	s.Require().Equal(2, len(state.BinlogConsumerPositions))
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	resumed.RegisterBinlogConsumer("cache")
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 50}, resumed.MinBinlogPosition())
+
+	// An override moves the consumers as well.
+	overridden := state.WithBinlogPositionOverride(mysql.Position{Name: "mysql-bin.00009", Pos: 4}, time.Now())
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00009", Pos: 4}, overridden.MinBinlogPosition())
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 50}, state.BinlogConsumerPositions["cache"])
+}
+
+func (s *StateTrackerTestSuite) TestNamedBinlogPositions() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateBinlogPosition(ghostferry.BinlogWriterConsumer, mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+	stateTracker.UpdateBinlogPosition(ghostferry.InlineVerifierConsumer, mysql.Position{Name: "mysql-bin.00005", Pos: 8})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, stateTracker.LastWrittenBinlogPosition())
+
+	_, found := stateTracker.BinlogPosition("intermediate")
+	s.Require().False(found)
+
+	stateTracker.UpdateBinlogPosition("intermediate", mysql.Position{Name: "mysql-bin.00004", Pos: 100})
+	pos, found := stateTracker.BinlogPosition("intermediate")
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00004", Pos: 100}, pos)
+	s.Require().Equal(ghostferry.BinlogConsumerPosition{Consumer: "intermediate", Position: pos}, stateTracker.MinBinlogConsumerPosition())
+
+	// Moving backwards is ignored.
+	stateTracker.UpdateBinlogPosition("intermediate", mysql.Position{Name: "mysql-bin.00004", Pos: 50})
+	stateTracker.UpdateBinlogPosition("intermediate", mysql.Position{Name: "mysql-bin.00006", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, stateTracker.MinBinlogPosition())
+
+	pos, found = stateTracker.BinlogPosition(ghostferry.InlineVerifierConsumer)
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 8}, pos)
+
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]mysql.Position{"intermediate": {Name: "mysql-bin.00006", Pos: 4}}, state.BinlogConsumerPositions)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	pos, found = resumed.BinlogPosition("intermediate")
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00006", Pos: 4}, pos)
+}
+
+func (s *StateTrackerTestSuite) TestMinBinlogConsumerPosition() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(ghostferry.BinlogConsumerPosition{}, stateTracker.MinBinlogConsumerPosition())
+	s.Require().Equal("none", stateTracker.MinBinlogConsumerPosition().String())
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+
+	// On a tie, the binlog writer holds the position, then the inline
+	// verifier, then the consumers by name.
+	s.Require().Equal(ghostferry.BinlogWriterConsumer, stateTracker.MinBinlogConsumerPosition().Consumer)
+	stateTracker.RegisterBinlogConsumer("cdc")
+	stateTracker.RegisterBinlogConsumer("audit")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00006", Pos: 4})
+	s.Require().Equal(ghostferry.InlineVerifierConsumer, stateTracker.MinBinlogConsumerPosition().Consumer)
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00006", Pos: 4})
+	s.Require().Equal("audit at mysql-bin.00005:4", stateTracker.MinBinlogConsumerPosition().String())
+
+	stateTracker.UpdateConsumerPosition("audit", mysql.Position{Name: "mysql-bin.00005", Pos: 10})
+	s.Require().Equal(ghostferry.BinlogConsumerPosition{
+		Consumer: "cdc",
+		Position: mysql.Position{Name: "mysql-bin.00005", Pos: 4},
+	}, stateTracker.Serialize(nil, nil).MinBinlogConsumerPosition())
+
+	// The names of the built-in consumers are reserved.
+	stateTracker.RegisterBinlogConsumer(ghostferry.InlineVerifierConsumer)
+	s.Require().Equal(2, len(stateTracker.Serialize(nil, nil).BinlogConsumerPositions))
+}
+
+func (s *StateTrackerTestSuite) TestMinBinlogConsumerPositionWithConcurrentUpdates() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+
+	consumers := []string{"audit", "cache", "cdc", "search"}
+	for _, name := range consumers {
+		stateTracker.RegisterBinlogConsumer(name)
+	}
+	// The consumers hold the minimum from now on.
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00009", Pos: 4})
+
+	// Each consumer moves forward at its own pace, so the minimum only moves
+	// forward as well, and is held by a consumer at that position.
+	const updates = 500
+	wg := &sync.WaitGroup{}
+	for i, name := range consumers {
+		wg.Add(1)
+		go func(name string, step uint32) {
+			defer wg.Done()
+			for pos := uint32(1); pos <= updates; pos++ {
+				stateTracker.UpdateConsumerPosition(name, mysql.Position{Name: "mysql-bin.00002", Pos: pos * step})
+			}
+		}(name, uint32(i+1))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var previous mysql.Position
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+
+		min := stateTracker.MinBinlogConsumerPosition()
+		s.Require().Contains(consumers, min.Consumer)
+		s.Require().True(min.Position.Compare(previous) >= 0, "%v moved backwards from %v", min, previous)
+		previous = min.Position
+	}
+
+	s.Require().Equal(ghostferry.BinlogConsumerPosition{
+		Consumer: "audit",
+		Position: mysql.Position{Name: "mysql-bin.00002", Pos: updates},
+	}, stateTracker.MinBinlogConsumerPosition())
+}
+
+func (s *StateTrackerTestSuite) TestPauseExcludesPausedTimeFromSpeedEstimate() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().False(stateTracker.IsPaused())
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1000)
+
+	stateTracker.Pause()
+	s.Require().True(stateTracker.IsPaused())
+	s.Require().True(stateTracker.Serialize(nil, nil).Paused)
+	time.Sleep(200 * time.Millisecond)
+	stateTracker.Resume()
+	s.Require().False(stateTracker.IsPaused())
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 2000)
+
+	// Without excluding the pause, the estimate would be ~5000 keys/s.
+	s.Require().True(stateTracker.EstimatedPaginationKeysPerSecond() > 50000)
+	s.Require().True(stateTracker.PausedDuration() >= 200*time.Millisecond)
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().False(serializedState.Paused)
+	s.Require().Equal(stateTracker.PausedDuration(), serializedState.TotalPausedDuration)
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Equal(serializedState.TotalPausedDuration, resumedStateTracker.PausedDuration())
+}
+
+func (s *StateTrackerTestSuite) TestResumedFromPausedState() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.Pause()
+	time.Sleep(50 * time.Millisecond)
+	serializedState := stateTracker.Serialize(nil, nil)
+
+	// The pause carries on in the resumed tracker, without counting the
+	// paused time of the state twice.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumedStateTracker.IsPaused())
+	s.Require().True(resumedStateTracker.Serialize(nil, nil).Paused)
+	time.Sleep(50 * time.Millisecond)
+	resumedStateTracker.Resume()
+	s.Require().False(resumedStateTracker.IsPaused())
+
+	pausedDuration := resumedStateTracker.PausedDuration()
+	s.Require().True(pausedDuration >= serializedState.TotalPausedDuration+50*time.Millisecond, pausedDuration)
+	s.Require().True(pausedDuration < serializedState.TotalPausedDuration+200*time.Millisecond, pausedDuration)
+}
+
+func (s *StateTrackerTestSuite) TestPauseExcludesPausedTimeFromRates() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.SmoothedSpeedHalfLife = 50 * time.Millisecond
+	stateTracker.SetRateWindows(map[string]time.Duration{"long": time.Hour})
+
+	for i := uint64(1); i <= 10; i++ {
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table", i*100)
+		time.Sleep(5 * time.Millisecond)
+	}
+	rate := stateTracker.Rates()["long"]
+	smoothedRate := stateTracker.SmoothedPaginationKeysPerSecond()
+
+	// The pause lasts for 4 half-lives and 5 times the copy so far.
+	stateTracker.Pause()
+	time.Sleep(250 * time.Millisecond)
+	stateTracker.Resume()
+
+	s.Require().True(stateTracker.Rates()["long"] > rate/2, "rate %v, rate before the pause %v", stateTracker.Rates()["long"], rate)
+	s.Require().True(stateTracker.SmoothedPaginationKeysPerSecond() > smoothedRate/2, "rate %v, rate before the pause %v", stateTracker.SmoothedPaginationKeysPerSecond(), smoothedRate)
+}
+
+func (s *StateTrackerTestSuite) TestResumeDoesNotShiftEntriesLoggedDuringThePause() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MinSpeedLogSampleInterval = 0
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1000)
+
+	stateTracker.Pause()
+	time.Sleep(100 * time.Millisecond)
+
+	// A batch in flight finishes during the pause.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 2000)
+	loggedAt := time.Now()
+	time.Sleep(100 * time.Millisecond)
+	stateTracker.Resume()
+
+	speedLog := stateTracker.Serialize(nil, nil).SpeedLog
+	latest := speedLog[len(speedLog)-1]
+	s.Require().Equal(uint64(2000), latest.Position)
+	s.Require().False(latest.At.After(loggedAt))
+	s.Require().False(latest.At.After(time.Now()))
+
+	// The entry logged before the pause is shifted past the paused interval.
+	s.Require().True(speedLog[len(speedLog)-2].At.After(loggedAt))
+}
+
+func (s *StateTrackerTestSuite) TestSpeedEstimateAcrossPositionOverflow() {
+	// The entry at 0 the log starts with is replaced by the second update.
+	stateTracker := ghostferry.NewStateTracker(2)
+	stateTracker.MinSpeedLogSampleInterval = 0
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecond())
+
+	start := time.Now()
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", math.MaxUint64-10)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The cumulative position wraps around here.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 1000)
+	elapsed := time.Since(start).Seconds()
+
+	estimate := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(estimate <= 1000/0.1, "estimate %v", estimate)
+	s.Require().True(estimate >= 1000/elapsed, "estimate %v", estimate)
+}
+
+func (s *StateTrackerTestSuite) TestSpeedEstimateAfterTheSpeedLogWraps() {
+	serializedState := ghostferry.NewStateTracker(4).Serialize(nil, nil)
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		serializedState.SpeedLog = append(serializedState.SpeedLog, ghostferry.PaginationKeyPositionLog{
+			Position: uint64(i) * 1000,
+			At:       start.Add(time.Duration(i) * 10 * time.Second),
+		})
+	}
+
+	stateTracker := ghostferry.NewStateTrackerFromSerializedState(4, serializedState)
+	stateTracker.MinSpeedLogSampleInterval = 0
+	s.Require().InDelta(100.0, stateTracker.EstimatedPaginationKeysPerSecond(), 0.001)
+
+	// Each new entry overwrites the earliest one: 0, then 1000.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 100)
+	s.Require().InDelta(2100.0/20, stateTracker.EstimatedPaginationKeysPerSecond(), 1)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 200)
+	s.Require().InDelta(1200.0/10, stateTracker.EstimatedPaginationKeysPerSecond(), 1)
+}
+
+func (s *StateTrackerTestSuite) TestSpeedEstimateOverAWindow() {
+	stateTracker := ghostferry.NewStateTrackerWithWindow(200 * time.Millisecond)
+	s.Require().Equal(2*time.Millisecond, stateTracker.MinSpeedLogSampleInterval)
+
+	countTracker := ghostferry.NewStateTracker(10)
+	countTracker.MinSpeedLogSampleInterval = 0
+
+	for _, tracker := range []*ghostferry.StateTracker{stateTracker, countTracker} {
+		tracker.UpdateLastSuccessfulPaginationKey("test.table", 1000)
+		time.Sleep(50 * time.Millisecond)
+		tracker.UpdateLastSuccessfulPaginationKey("test.table", 2000)
+		s.Require().True(tracker.EstimatedPaginationKeysPerSecond() > 0)
+	}
+
+	// The entries are older than the window, but remain in the speed log of
+	// the tracker without a window.
+	time.Sleep(250 * time.Millisecond)
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecond())
+	s.Require().True(countTracker.EstimatedPaginationKeysPerSecond() > 0)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 3000)
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecond())
+
+	time.Sleep(50 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 4000)
+	estimate := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(estimate > 0 && estimate <= 1000/0.05, "estimate %v", estimate)
+}
+
+func (s *StateTrackerTestSuite) TestLastSuccessfulPaginationKeyNeverMovesBackwards() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1000)
+	time.Sleep(100 * time.Millisecond)
+	for paginationKey := uint64(900); paginationKey > 0; paginationKey -= 100 {
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table", paginationKey)
+	}
+	stateTracker.UpdateBatch(map[string]uint64{"test.table": 10}, 1)
+
+	s.Require().Equal(uint64(1000), stateTracker.LastSuccessfulPaginationKey("test.table"))
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecond())
+
+	time.Sleep(100 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1100)
+	s.Require().Equal(uint64(1100), stateTracker.LastSuccessfulPaginationKey("test.table"))
+
+	estimate := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(estimate > 0 && estimate <= 100/0.1, "estimate %v", estimate)
+}
+
+func (s *StateTrackerTestSuite) TestRecordTableErrorKeepsMostRecentError() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableErrors = true
+
+	_, found := stateTracker.LastTableError("test.table")
+	s.Require().False(found)
+
+	stateTracker.RecordTableError("test.table", errors.New("first"))
+	stateTracker.RecordTableError("test.table", errors.New("second"))
+
+	err, found := stateTracker.LastTableError("test.table")
+	s.Require().True(found)
+	s.Require().Equal("second", err)
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]string{"test.table": "second"}, serializedState.TableErrors)
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	err, found = resumedStateTracker.LastTableError("test.table")
+	s.Require().True(found)
+	s.Require().Equal("second", err)
+}
+
+func (s *StateTrackerTestSuite) TestTableErrorsAreOptInAndPrunedOnCompletion() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.RecordTableError("test.table1", errors.New("failed"))
+	_, found := stateTracker.LastTableError("test.table1")
+	s.Require().False(found)
+
+	stateTracker.TrackTableErrors = true
+	stateTracker.RecordTableError("test.table1", errors.New("failed"))
+	stateTracker.RecordTableError("test.table2", errors.New("failed"))
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.MarkTablesCompleted([]string{"test.table2"})
+
+	s.Require().Equal(0, len(stateTracker.Serialize(nil, nil).TableErrors))
+}
+
+func (s *StateTrackerTestSuite) TestLastWrittenBinlogPositionNeverRegresses() {
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 10})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 20})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00003", Pos: 10}, stateTracker.Serialize(nil, nil).LastWrittenBinlogPosition)
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00004", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00004", Pos: 4}, stateTracker.Serialize(nil, nil).LastWrittenBinlogPosition)
+
+	stateTracker.ForceBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 4}, stateTracker.Serialize(nil, nil).LastWrittenBinlogPosition)
+}
+
+func (s *StateTrackerTestSuite) TestTablesWithSchemaDrift() {
+	newTableSchemaCache := func() ghostferry.TableSchemaCache {
+		tables := ghostferry.TableSchemaCache{}
+		for _, name := range []string{"table1", "table2"} {
+			tables["test."+name] = &ghostferry.TableSchema{
+				Table: &schema.Table{
+					Schema:    "test",
+					Name:      name,
+					Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}, {Name: "data", Type: schema.TYPE_STRING}},
+					PKColumns: []int{0},
+				},
+			}
+		}
+		return tables
+	}
+
+	serializedState := ghostferry.NewStateTracker(10).Serialize(newTableSchemaCache(), nil)
+	s.Require().Equal(2, len(serializedState.LastKnownTableSchemaHashes))
+	s.Require().NotEqual("", serializedState.LastKnownTableSchemaCacheHash)
+
+	driftedTables, err := serializedState.TablesWithSchemaDrift(newTableSchemaCache())
+	s.Require().Nil(err)
+	s.Require().Equal([]string{}, driftedTables)
+
+	current := newTableSchemaCache()
+	current["test.table2"].Columns = append(current["test.table2"].Columns, schema.TableColumn{Name: "extra"})
+	driftedTables, err = serializedState.TablesWithSchemaDrift(current)
+	s.Require().Nil(err)
+	s.Require().Equal([]string{"test.table2"}, driftedTables)
+
+	delete(current, "test.table1")
+	driftedTables, err = serializedState.TablesWithSchemaDrift(current)
+	s.Require().Nil(err)
+	s.Require().Equal([]string{"test.table1", "test.table2"}, driftedTables)
+
+	// States serialized without hashes are hashed on the fly.
+	serializedState.LastKnownTableSchemaHashes = nil
+	serializedState.LastKnownTableSchemaCacheHash = ""
+	driftedTables, err = serializedState.TablesWithSchemaDrift(current)
+	s.Require().Nil(err)
+	s.Require().Equal([]string{"test.table1", "test.table2"}, driftedTables)
+}
+
+func (s *StateTrackerTestSuite) TestValidateAgainst() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table2", 42)
+	stateTracker.MarkTableAsCompleted("db.table3")
+	serializedState := stateTracker.Serialize(syntheticSchemaCache(5), nil)
+
+	s.Require().Nil(serializedState.ValidateAgainst(syntheticSchemaCache(5)))
+
+	// Completed tables and new tables are not validated.
+	current := syntheticSchemaCache(6)
+	current["db.table3"].PKColumns = []int{1}
+	s.Require().Nil(serializedState.ValidateAgainst(current))
+
+	current["db.table1"].PKColumns = []int{0, 1}
+	current["db.table2"].Columns = append(current["db.table2"].Columns[1:], schema.TableColumn{Name: "extra", RawType: "int(11)"})
+	current["db.table2"].Columns[0].RawType = "int(11)"
+	current["db.table2"].PaginationKeyColumn = &current["db.table2"].Columns[0]
+	delete(current, "db.table4")
+
+	err := serializedState.ValidateAgainst(current)
+	s.Require().NotNil(err)
+	s.Require().Equal(
+		"the schema of the tables in progress changed since the state was serialized: "+
+			"db.table1: the primary key changed from [id] to [id shop_id]; "+
+			"db.table2: the primary key changed from [id] to [shop_id]; "+
+			"db.table2: the pagination key column changed from id to shop_id; "+
+			"db.table2: the column id was removed; "+
+			"db.table2: the type of the column shop_id changed from bigint(20) to int(11); "+
+			"db.table2: the column extra was added; "+
+			"db.table4: the table no longer exists",
+		err.Error(),
+	)
+}
+
+func (s *StateTrackerTestSuite) TestValidateTargetAgainst() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table2", 42)
+	stateTracker.MarkTableAsCompleted("db.table0")
+	serializedState := stateTracker.Serialize(syntheticSchemaCache(3), nil)
+
+	databaseRewrites := map[string]string{"db": "target_db"}
+	tableRewrites := map[string]string{"table2": "renamed_table2"}
+	s.Require().Equal(map[string]ghostferry.TableIdentifier{
+		"db.table1": {SchemaName: "target_db", TableName: "table1"},
+		"db.table2": {SchemaName: "target_db", TableName: "renamed_table2"},
+	}, serializedState.TargetTablesInProgress(databaseRewrites, tableRewrites))
+
+	target := ghostferry.TableSchemaCache{}
+	for _, table := range syntheticSchemaCache(3) {
+		table.Schema = "target_db"
+		if table.Name == "table2" {
+			table.Name = "renamed_table2"
+		}
+		target[table.String()] = table
+	}
+	s.Require().Nil(serializedState.ValidateTargetAgainst(target, databaseRewrites, tableRewrites))
+
+	// Only the rewritten names are looked up.
+	err := serializedState.ValidateTargetAgainst(syntheticSchemaCache(3), databaseRewrites, tableRewrites)
+	s.Require().NotNil(err)
+	s.Require().Contains(err.Error(), "db.table1: the target table target_db.table1 no longer exists")
+
+	target["target_db.table1"].Columns = target["target_db.table1"].Columns[:6]
+	delete(target, "target_db.renamed_table2")
+	err = serializedState.ValidateTargetAgainst(target, databaseRewrites, tableRewrites)
+	s.Require().NotNil(err)
+	s.Require().Equal(
+		"the schema of the target tables of the tables in progress differs from the schema of the state: "+
+			"db.table1: in the target table target_db.table1, the column updated_at was removed; "+
+			"db.table2: the target table target_db.renamed_table2 no longer exists",
+		err.Error(),
+	)
+}
+
+func (s *StateTrackerTestSuite) TestSchemaChangedSince() {
+	cache := syntheticSchemaCache(3)
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().False(stateTracker.SchemaChangedSince("db.table1", cache))
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 42)
+	first := stateTracker.Serialize(cache, nil)
+	s.Require().False(stateTracker.SchemaChangedSince("db.table1", cache))
+
+	// The schema of the table changes between the two Serialize.
+	previous := syntheticSchemaCache(3)
+	cache["db.table1"].Columns = append(cache["db.table1"].Columns, schema.TableColumn{Name: "extra", RawType: "int(11)"})
+	second := stateTracker.Serialize(cache, nil)
+	s.Require().NotEqual(first.LastKnownTableSchemaHashes["db.table1"], second.LastKnownTableSchemaHashes["db.table1"])
+	s.Require().Equal(first.LastKnownTableSchemaHashes["db.table2"], second.LastKnownTableSchemaHashes["db.table2"])
+
+	s.Require().True(stateTracker.SchemaChangedSince("db.table1", previous))
+	s.Require().False(stateTracker.SchemaChangedSince("db.table2", previous))
+	s.Require().False(stateTracker.SchemaChangedSince("db.table1", cache))
+
+	// Tables only in one of the schemas changed.
+	s.Require().True(stateTracker.SchemaChangedSince("db.table2", syntheticSchemaCache(2)))
+	s.Require().True(stateTracker.SchemaChangedSince("db.table4", syntheticSchemaCache(5)))
+	s.Require().False(stateTracker.SchemaChangedSince("db.table5", previous))
+
+	// A resumed tracker compares with the schema of the state.
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, first)
+	s.Require().False(resumed.SchemaChangedSince("db.table1", previous))
+	s.Require().True(resumed.SchemaChangedSince("db.table1", cache))
+}
+
+func (s *StateTrackerTestSuite) TestRegisterNewTable() {
+	newTableSchema := func(name string) *ghostferry.TableSchema {
+		return &ghostferry.TableSchema{
+			Table: &schema.Table{
+				Schema:    "test",
+				Name:      name,
+				Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}},
+				PKColumns: []int{0},
+			},
+		}
+	}
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	stateTracker.MarkTableAsCompleted("test.table2")
+	stateTracker.MarkTableDropped("test.table3")
+
+	serializedState := stateTracker.Serialize(ghostferry.TableSchemaCache{
+		"test.table1": newTableSchema("table1"),
+		"test.table2": newTableSchema("table2"),
+	}, nil)
+
+	current := ghostferry.TableSchemaCache{
+		"test.table1": newTableSchema("table1"),
+		"test.table2": newTableSchema("table2"),
+		"test.table4": newTableSchema("table4"),
+	}
+	s.Require().Equal([]string{"test.table4"}, serializedState.NewTables(current))
+
+	// A state without its schema knows every table.
+	s.Require().Equal([]string{}, (&ghostferry.SerializableState{}).NewTables(current))
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().False(resumed.RegisterNewTable("test.table1"))
+	s.Require().False(resumed.RegisterNewTable("test.table2"))
+	s.Require().Equal(uint64(100), resumed.LastSuccessfulPaginationKey("test.table1"))
+
+	s.Require().True(resumed.RegisterNewTable("test.table4"))
+	s.Require().False(resumed.RegisterNewTable("test.table4"))
+	s.Require().Equal(uint64(0), resumed.LastSuccessfulPaginationKey("test.table4"))
+
+	// A re-created table is not dropped anymore.
+	s.Require().True(resumed.IsTableDropped("test.table3"))
+	s.Require().True(resumed.RegisterNewTable("test.table3"))
+	s.Require().False(resumed.IsTableDropped("test.table3"))
+
+	serializedState = resumed.Serialize(nil, nil)
+	s.Require().Empty(serializedState.DroppedTables)
+	s.Require().Equal(uint64(0), serializedState.LastSuccessfulPaginationKeys["test.table3"])
+	s.Require().Contains(serializedState.LastSuccessfulPaginationKeys, "test.table4")
+}
+
+func (s *StateTrackerTestSuite) TestResetTable() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRowsCopied = true
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 10}, 10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 200)
+	stateTracker.MarkTableAsCompleted("test.table2")
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table3", 50)
+	stateTracker.MarkTableCopyComplete("test.table4")
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table5", 60)
+	stateTracker.IncrementSkippedRows("test.table1", 3)
+	stateTracker.IncrementDeletedRows("test.table1", 2)
+
+	stateTracker.ResetTable("test.table1")
+	stateTracker.ResetTable("test.table2")
+	stateTracker.ResetTable("test.table4")
+
+	for _, table := range []string{"test.table1", "test.table2", "test.table4"} {
+		s.Require().Equal(uint64(0), stateTracker.LastSuccessfulPaginationKey(table))
+		s.Require().False(stateTracker.IsTableComplete(table))
+		s.Require().False(stateTracker.IsTableCopyComplete(table))
+	}
+	s.Require().Empty(stateTracker.TableRowsCopied())
+	s.Require().Equal(uint64(0), stateTracker.SkippedRows("test.table1"))
+	s.Require().Equal(uint64(0), stateTracker.DeletedRows("test.table1"))
+
+	// The other tables are untouched.
+	after := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]uint64{"test.table3": 50, "test.table5": 60}, after.LastSuccessfulPaginationKeys)
+	s.Require().Empty(after.CompletedTables)
+	s.Require().Empty(after.CopyCompletedTables)
+
+	// The reset table is copied again from the start.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 5)
+	s.Require().Equal(uint64(5), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	stateTracker.MarkTableAsCompleted("test.table2")
+	s.Require().True(stateTracker.IsTableComplete("test.table2"))
+
+	// A dropped table cannot be reset.
+	stateTracker.MarkTableDropped("test.table5")
+	stateTracker.ResetTable("test.table5")
+	s.Require().True(stateTracker.IsTableDropped("test.table5"))
+}
+
+func (s *StateTrackerTestSuite) TestMarkTablesCompletedSurvivesResume() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTablesCompleted([]string{"test.table1", "test.table2"})
+
+	s.Require().True(stateTracker.IsTableComplete("test.table1"))
+	s.Require().True(stateTracker.IsTableComplete("test.table2"))
+	s.Require().False(stateTracker.IsTableComplete("test.table3"))
+	s.Require().Equal(uint64(math.MaxUint64), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().True(resumedStateTracker.IsTableComplete("test.table1"))
+	s.Require().True(resumedStateTracker.IsTableComplete("test.table2"))
+}
+
+func (s *StateTrackerTestSuite) TestUpdateBatch() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 5)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 10, "test.table2": 20}, 30)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table2": 25}, 5)
+
+	s.Require().Equal(uint64(10), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	s.Require().Equal(uint64(25), stateTracker.LastSuccessfulPaginationKey("test.table2"))
+	s.Require().Equal(uint64(35), stateTracker.RowsCopied())
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal(uint64(35), resumedStateTracker.RowsCopied())
+}
+
+func (s *StateTrackerTestSuite) TestIsResume() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().False(stateTracker.IsResume())
+
+	// Resuming from a state without any progress is still a resume.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().True(resumedStateTracker.IsResume())
+}
+
+func (s *StateTrackerTestSuite) TestFirstPaginationKey() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	_, found := stateTracker.FirstPaginationKey("test.table1")
+	s.Require().False(found)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 2000)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table2": 50}, 1)
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	resumedStateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 3000)
+
+	paginationKey, found := resumedStateTracker.FirstPaginationKey("test.table1")
+	s.Require().True(found)
+	s.Require().Equal(uint64(1000), paginationKey)
+
+	paginationKey, found = resumedStateTracker.FirstPaginationKey("test.table2")
+	s.Require().True(found)
+	s.Require().Equal(uint64(50), paginationKey)
+}
+
+func (s *StateTrackerTestSuite) TestFinalizeSealsTheTracker() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	stateTracker.SetPhase(ghostferry.StateDone)
+	s.Require().True(stateTracker.FinalizedAt().IsZero())
+
+	stateTracker.Finalize()
+	finalizedAt := stateTracker.FinalizedAt()
+	s.Require().False(finalizedAt.IsZero())
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 20)
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	stateTracker.SetMetadata("key", "value")
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(uint64(10), serializedState.LastSuccessfulPaginationKeys["test.table1"])
+	s.Require().False(serializedState.CompletedTables["test.table1"])
+	s.Require().Equal(mysql.Position{}, serializedState.LastWrittenBinlogPosition)
+	s.Require().Nil(serializedState.Metadata)
+	s.Require().Equal(finalizedAt, serializedState.FinalizedAt)
+
+	doneDuration := stateTracker.PhaseDurations()[ghostferry.StateDone]
+	time.Sleep(10 * time.Millisecond)
+	s.Require().Equal(doneDuration, stateTracker.PhaseDurations()[ghostferry.StateDone])
+
+	stateTracker.Finalize()
+	s.Require().Equal(finalizedAt, stateTracker.FinalizedAt())
+
+	stateTracker.PanicOnMutationAfterFinalize = true
+	s.Require().Panics(func() {
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 30)
+	})
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumedStateTracker.FinalizedAt().IsZero())
+}
+
+func (s *StateTrackerTestSuite) TestIsPaginationKeyCopied() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	stateTracker.MarkTableAsCompleted("test.table2")
+
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table1", 5))
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table1", 10))
+	s.Require().False(stateTracker.IsPaginationKeyCopied("test.table1", 11))
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table2", math.MaxUint64))
+	s.Require().False(stateTracker.IsPaginationKeyCopied("test.table3", 0))
+}
+
+func (s *StateTrackerTestSuite) TestSingleThreadedStateTracker() {
+	stateTracker := ghostferry.NewSingleThreadedStateTracker(10, nil)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	stateTracker.MarkTableAsCompleted("test.table2")
+	stateTracker.SetMetadata("ticket", "1")
+
+	rewrittenStateTracker := ghostferry.NewSingleThreadedStateTracker(10, stateTracker.Serialize(nil, nil))
+	rewrittenStateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 20)
+
+	serializedState := rewrittenStateTracker.Serialize(nil, nil)
+	s.Require().Equal(uint64(20), serializedState.LastSuccessfulPaginationKeys["test.table1"])
+	s.Require().True(serializedState.CompletedTables["test.table2"])
+	s.Require().Equal("1", serializedState.Metadata["ticket"])
+
+	// The tracker does not take its mutexes.
+	rewrittenStateTracker.CopyRWMutex.Lock()
+	defer rewrittenStateTracker.CopyRWMutex.Unlock()
+	rewrittenStateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 30)
+}
+
+func (s *StateTrackerTestSuite) TestStateTrackerTakesItsExportedMutexes() {
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	stateTracker.CopyRWMutex.Lock()
+	updated := make(chan struct{})
+	go func() {
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+		close(updated)
+	}()
+
+	select {
+	case <-updated:
+		s.Fail("the update did not wait for the CopyRWMutex")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stateTracker.CopyRWMutex.Unlock()
+	<-updated
+}
+
+func (s *StateTrackerTestSuite) TestInstrumentLockContention() {
+	sink := make(chan interface{}, 10)
+	ghostferry.SetGlobalMetrics("test", sink)
+	defer ghostferry.SetGlobalMetrics("ghostferry", nil)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1)
+	s.Require().Equal(0, len(sink))
+
+	stateTracker.InstrumentLockContention = true
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 2)
+	s.Require().Equal(1, len(sink))
+
+	metric := (<-sink).(ghostferry.TimerMetric)
+	s.Require().Equal("test.StateTrackerLockWait", metric.Key)
+	s.Require().Equal([]ghostferry.MetricTag{
+		{Name: "mutex", Value: "copy"},
+		{Name: "method", Value: "UpdateLastSuccessfulPaginationKey"},
+	}, metric.Tags)
+
+	stateTracker.MarkTablesCompleted([]string{"test.table"})
+	metric = (<-sink).(ghostferry.TimerMetric)
+	s.Require().Equal([]ghostferry.MetricTag{
+		{Name: "mutex", Value: "copy"},
+		{Name: "method", Value: "MarkTablesCompleted"},
+	}, metric.Tags)
+
+	stateTracker.ForceBinlogPosition(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	metric = (<-sink).(ghostferry.TimerMetric)
+	s.Require().Equal([]ghostferry.MetricTag{
+		{Name: "mutex", Value: "binlog"},
+		{Name: "method", Value: "ForceBinlogPosition"},
+	}, metric.Tags)
+}
+
+func (s *StateTrackerTestSuite) TestVerifyOnlyStateTrackerRequiresCompletedCopy() {
+	serializedState := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{"test.table1": 10, "test.table2": 20},
+		CompletedTables:              map[string]bool{"test.table1": true},
+	}
+
+	_, err := ghostferry.NewVerifyOnlyStateTrackerFromSerializedState(10, serializedState)
+	s.Require().EqualError(err, "cannot only verify a state where test.table2 is not completely copied")
+
+	serializedState.CompletedTables["test.table2"] = true
+	stateTracker, err := ghostferry.NewVerifyOnlyStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Nil(err)
+	s.Require().True(stateTracker.IsVerifyOnly())
+	s.Require().False(ghostferry.NewStateTrackerFromSerializedState(10, serializedState).IsVerifyOnly())
+}
+
+func (s *StateTrackerTestSuite) TestNearKeyExhaustion() {
+	newTable := func(name, rawType string) *ghostferry.TableSchema {
+		column := schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER, RawType: rawType}
+		return &ghostferry.TableSchema{
+			Table:               &schema.Table{Schema: "test", Name: name, Columns: []schema.TableColumn{column}},
+			PaginationKeyColumn: &column,
+		}
+	}
+
+	tables := ghostferry.TableSchemaCache{
+		"test.signed":   newTable("signed", "int(11)"),
+		"test.unsigned": newTable("unsigned", "int(10) unsigned"),
+		"test.bigint":   newTable("bigint", "bigint(20) unsigned"),
+	}
+
+	max, ok := tables["test.signed"].MaxPaginationKeyValue()
+	s.Require().True(ok)
+	s.Require().Equal(uint64(math.MaxInt32), max)
+	max, ok = tables["test.bigint"].MaxPaginationKeyValue()
+	s.Require().True(ok)
+	s.Require().Equal(uint64(math.MaxUint64), max)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.SetDeclaredMaxPaginationKeys(tables)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.signed", math.MaxInt32-1000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.unsigned", math.MaxInt32-1000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.bigint", math.MaxInt32)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.unknown", math.MaxUint64-1)
+
+	s.Require().True(stateTracker.NearKeyExhaustion("test.signed"))
+	s.Require().False(stateTracker.NearKeyExhaustion("test.unsigned"))
+	s.Require().False(stateTracker.NearKeyExhaustion("test.bigint"))
+	s.Require().False(stateTracker.NearKeyExhaustion("test.unknown"))
+	s.Require().Equal([]string{"test.signed"}, stateTracker.Serialize(nil, nil).TablesNearKeyExhaustion)
+}
+
+func (s *StateTrackerTestSuite) TestMetadataRoundTrips() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Nil(stateTracker.Serialize(nil, nil).Metadata)
+
+	stateTracker.SetMetadata("ticket", "OPS-1234")
+	stateTracker.SetMetadata("operator", "someone")
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]string{"ticket": "OPS-1234", "operator": "someone"}, serializedState.Metadata)
+
+	// The serialized state must not alias the tracker's metadata.
+	stateTracker.SetMetadata("ticket", "OPS-5678")
+	s.Require().Equal("OPS-1234", serializedState.Metadata["ticket"])
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	value, found := resumedStateTracker.GetMetadata("operator")
+	s.Require().True(found)
+	s.Require().Equal("someone", value)
+
+	_, found = resumedStateTracker.GetMetadata("missing")
+	s.Require().False(found)
+}
+
+func (s *StateTrackerTestSuite) TestFlushReportsBufferedProgress() {
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	// A writer that has committed rows but only reports its progress
+	// periodically.
+	bufferedPaginationKeys := map[string]uint64{"test.table1": 100, "test.table2": 200}
+	stateTracker.AddFlushListener(func() error {
+		for table, paginationKey := range bufferedPaginationKeys {
+			stateTracker.UpdateLastSuccessfulPaginationKey(table, paginationKey)
+		}
+		bufferedPaginationKeys = map[string]uint64{}
+		return nil
+	})
+
+	failingListenerCalled := false
+	stateTracker.AddFlushListener(func() error {
+		failingListenerCalled = true
+		return errors.New("flush failed")
+	})
+
+	s.Require().Equal(0, len(stateTracker.Serialize(nil, nil).LastSuccessfulPaginationKeys))
+
+	err := stateTracker.Flush()
+	s.Require().EqualError(err, "flush failed")
+	s.Require().True(failingListenerCalled)
+
+	s.Require().Equal(map[string]uint64{"test.table1": 100, "test.table2": 200}, stateTracker.Serialize(nil, nil).LastSuccessfulPaginationKeys)
+}
+
+func (s *StateTrackerTestSuite) TestPhaseDurationsAccumulateAcrossResumes() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(0, len(stateTracker.PhaseDurations()))
+
+	stateTracker.SetPhase(ghostferry.StateCopying)
+	time.Sleep(50 * time.Millisecond)
+	stateTracker.SetPhase(ghostferry.StateCutover)
+
+	durations := stateTracker.PhaseDurations()
+	s.Require().True(durations[ghostferry.StateCopying] >= 50*time.Millisecond)
+	s.Require().True(durations[ghostferry.StateCutover] < 50*time.Millisecond)
+
+	stateTracker = ghostferry.NewStateTracker(10)
+	stateTracker.SetPhase(ghostferry.StateCopying)
+	time.Sleep(50 * time.Millisecond)
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().True(serializedState.PhaseDurations[ghostferry.StateCopying] >= 50*time.Millisecond)
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	resumedStateTracker.SetPhase(ghostferry.StateCopying)
+	time.Sleep(50 * time.Millisecond)
+	s.Require().True(resumedStateTracker.PhaseDurations()[ghostferry.StateCopying] >= 100*time.Millisecond)
+}
+
+func (s *StateTrackerTestSuite) TestSubscribeDeliversProgressEvents() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	events := stateTracker.Subscribe()
+
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.SetPhase(ghostferry.StateCopying)
+	stateTracker.SetPhase(ghostferry.StateCopying)
+
+	stateTracker.MarkTablesCompleted([]string{"test.table2"})
+
+	event := <-events
+	s.Require().Equal(ghostferry.ProgressEventTableCompleted, event.Type)
+	s.Require().Equal("test.table1", event.Table)
+
+	event = <-events
+	s.Require().Equal(ghostferry.ProgressEventPhaseChanged, event.Type)
+	s.Require().Equal(ghostferry.StateCopying, event.Phase)
+	s.Require().Equal(ghostferry.StateCopying, stateTracker.Phase())
+
+	event = <-events
+	s.Require().Equal(ghostferry.ProgressEventTableCompleted, event.Type)
+	s.Require().Equal("test.table2", event.Table)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go stateTracker.PublishRateUpdates(ctx, 10*time.Millisecond)
+	event = <-events
+	cancel()
+	s.Require().Equal(ghostferry.ProgressEventRateUpdated, event.Type)
+
+	stateTracker.Unsubscribe(events)
+	for range events {
+	}
+}
+
+func (s *StateTrackerTestSuite) TestSlowSubscriberDoesNotBlockUpdates() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	events := stateTracker.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			stateTracker.MarkTableAsCompleted(fmt.Sprintf("test.table%d", i))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Require().Fail("MarkTableAsCompleted blocked on a slow subscriber")
+	}
+
+	s.Require().True(len(events) < 1000)
+	stateTracker.Unsubscribe(events)
+}
+
+func (s *StateTrackerTestSuite) TestDualWriteLag() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().True(stateTracker.DualWriteLag().CaughtUp)
+
+	stateTracker.UpdateDualWriteTargetHead(mysql.Position{Name: "mysql-bin.000042", Pos: 1000})
+	stateTracker.UpdateDualWriteAppliedPosition(mysql.Position{Name: "mysql-bin.000042", Pos: 1000})
+	s.Require().True(stateTracker.DualWriteLag().CaughtUp)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.000042", Pos: 1000}, stateTracker.DualWriteTargetHead())
+
+	stateTracker.UpdateDualWriteTargetHead(mysql.Position{Name: "mysql-bin.000042", Pos: 1500})
+	lag := stateTracker.DualWriteLag()
+	s.Require().False(lag.CaughtUp)
+	s.Require().Equal(uint64(500), lag.Bytes)
+	s.Require().Equal(uint64(0), lag.Files)
+	s.Require().True(lag.Duration > 0)
+
+	stateTracker.UpdateDualWriteTargetHead(mysql.Position{Name: "mysql-bin.000044", Pos: 300})
+	lag = stateTracker.DualWriteLag()
+	s.Require().Equal(uint64(2), lag.Files)
+	s.Require().Equal(uint64(300), lag.Bytes)
+
+	stateTracker.UpdateDualWriteAppliedPosition(mysql.Position{Name: "mysql-bin.000044", Pos: 300})
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.000044", Pos: 300}, stateTracker.DualWriteAppliedPosition())
+	s.Require().True(stateTracker.DualWriteLag().CaughtUp)
+}
+
+func (s *StateTrackerTestSuite) TestPaginationKeyProgressSorted() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.b", 10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.c", 30)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.a", 10)
+	stateTracker.MarkTableAsCompleted("test.c")
+	stateTracker.MarkTableAsCompleted("test.d")
+
+	s.Require().Equal([]ghostferry.TablePaginationKeyProgress{
+		{Table: "test.a", LastSuccessfulPaginationKey: 10},
+		{Table: "test.b", LastSuccessfulPaginationKey: 10},
+		{Table: "test.c", LastSuccessfulPaginationKey: 30, Completed: true},
+		{Table: "test.d", Completed: true},
+	}, stateTracker.PaginationKeyProgressSorted(ghostferry.SortByTableName))
+
+	s.Require().Equal([]ghostferry.TablePaginationKeyProgress{
+		{Table: "test.c", LastSuccessfulPaginationKey: 30, Completed: true},
+		{Table: "test.a", LastSuccessfulPaginationKey: 10},
+		{Table: "test.b", LastSuccessfulPaginationKey: 10},
+		{Table: "test.d", Completed: true},
+	}, stateTracker.PaginationKeyProgressSorted(ghostferry.SortByPaginationKeyDescending))
+}
+
+// Meant to be run with -race.
+func (s *StateTrackerTestSuite) TestConcurrentSpeedLogUpdatesAndRates() {
+	stateTracker := ghostferry.NewStateTracker(5)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			table := fmt.Sprintf("test.table%d", i)
+			for j := uint64(1); j <= 500; j++ {
+				if j%2 == 0 {
+					stateTracker.UpdateLastSuccessfulPaginationKey(table, j)
+				} else {
+					stateTracker.UpdateBatch(map[string]uint64{table: j}, 1)
+				}
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			stateTracker.Pause()
+			stateTracker.Resume()
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				for _, rate := range []float64{
+					stateTracker.EstimatedPaginationKeysPerSecond(),
+					stateTracker.EstimatedPaginationKeysPerSecondExcludingLatest(),
+				} {
+					if rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+						panic(fmt.Sprintf("invalid rate %v", rate))
+					}
+				}
+				if i%10 == 0 {
+					stateTracker.Serialize(nil, nil)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	s.Require().Equal(5, len(stateTracker.Serialize(nil, nil).SpeedLog))
+}
+
+// Meant to be run with -race.
+func (s *StateTrackerTestSuite) TestConcurrentUpdatesAndSnapshots() {
+	stateTracker := ghostferry.NewStateTracker(5)
+
+	wg := &sync.WaitGroup{}
+
+	// The binlog position is always written before the pagination key, so a
+	// consistent snapshot never has a pagination key beyond the position.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := uint64(1); j <= 1000; j++ {
+			stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: uint32(j)})
+			stateTracker.UpdateLastSuccessfulPaginationKey("test.coupled", j)
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			table := fmt.Sprintf("test.table%d", i)
+			for j := uint64(1); j <= 1000; j++ {
+				stateTracker.UpdateLastSuccessfulPaginationKey(table, j)
+			}
+		}(i)
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last ghostferry.SerializableState
+			for i := 0; i < 500; i++ {
+				snapshot := stateTracker.Snapshot()
+				pos := uint64(snapshot.LastWrittenBinlogPosition.Pos)
+				if paginationKey := snapshot.LastSuccessfulPaginationKeys["test.coupled"]; paginationKey > pos {
+					panic(fmt.Sprintf("torn snapshot: pagination key %d beyond binlog position %d", paginationKey, pos))
+				}
+
+				if pos < uint64(last.LastWrittenBinlogPosition.Pos) {
+					panic(fmt.Sprintf("binlog position went back from %d to %d", last.LastWrittenBinlogPosition.Pos, pos))
+				}
+				for table, paginationKey := range last.LastSuccessfulPaginationKeys {
+					if snapshot.LastSuccessfulPaginationKeys[table] < paginationKey {
+						panic(fmt.Sprintf("pagination key of %s went back from %d to %d", table, paginationKey, snapshot.LastSuccessfulPaginationKeys[table]))
+					}
+				}
+
+				last = snapshot
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	snapshot := stateTracker.Snapshot()
+	s.Require().Equal(uint32(1000), snapshot.LastWrittenBinlogPosition.Pos)
+	s.Require().Equal(uint64(1000), snapshot.LastSuccessfulPaginationKeys["test.coupled"])
+	s.Require().Equal(uint64(0), snapshot.Generation)
+
+	// The snapshot shares no memory with the tracker.
+	snapshot.LastSuccessfulPaginationKeys["test.coupled"] = 1
+	s.Require().Equal(uint64(1000), stateTracker.LastSuccessfulPaginationKey("test.coupled"))
+}
+
+func (s *StateTrackerTestSuite) TestConcurrentUpdatesAndSerialize() {
+	serializedState := &ghostferry.SerializableState{
+		LastSuccessfulPaginationKeys: map[string]uint64{"test.table0": 1},
+		CompletedTables:              map[string]bool{},
+	}
+	stateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			table := fmt.Sprintf("test.table%d", i)
+			for j := uint64(1); j <= 1000; j++ {
+				stateTracker.UpdateLastSuccessfulPaginationKey(table, j)
+			}
+			stateTracker.MarkTableAsCompleted(table)
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			stateTracker.Serialize(nil, nil)
+			stateTracker.EstimatedPaginationKeysPerSecond()
+
+			// The state resumed from must not be modified by the tracker.
+			for range serializedState.LastSuccessfulPaginationKeys {
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	finalState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(8, len(finalState.CompletedTables))
+	for i := 0; i < 8; i++ {
+		s.Require().Equal(uint64(1000), finalState.LastSuccessfulPaginationKeys[fmt.Sprintf("test.table%d", i)])
+	}
+	s.Require().Equal(map[string]uint64{"test.table0": 1}, serializedState.LastSuccessfulPaginationKeys)
+}
+
 func TestStateTrackerTestSuite(t *testing.T) {
 	suite.Run(t, new(StateTrackerTestSuite))
 }
+
+func (s *StateTrackerTestSuite) TestWeightedETAAccountsForSlowTables() {
+	tableSizes := map[string]uint64{
+		"test.table1": 20000,
+		"test.table2": 1000,
+	}
+
+	newStateTracker := func(trackTableRates bool) *ghostferry.StateTracker {
+		stateTracker := ghostferry.NewStateTracker(10)
+		stateTracker.TrackTableRates = trackTableRates
+		s.Require().Equal(time.Duration(0), stateTracker.WeightedETA(tableSizes))
+
+		stateTracker.UpdateBatch(map[string]uint64{"test.table1": 1, "test.table2": 1}, 2)
+		time.Sleep(50 * time.Millisecond)
+		stateTracker.UpdateBatch(map[string]uint64{"test.table1": 10001, "test.table2": 101}, 10100)
+		return stateTracker
+	}
+
+	// The overall speed alone predicts both tables are about to finish, while
+	// test.table2 still needs 9 times as long as it took so far.
+	unweightedETA := newStateTracker(false).WeightedETA(tableSizes)
+	s.Require().True(unweightedETA > 0)
+
+	stateTracker := newStateTracker(true)
+	weightedETA := stateTracker.WeightedETA(tableSizes)
+	s.Require().True(weightedETA > 5*unweightedETA, "weighted %v, unweighted %v", weightedETA, unweightedETA)
+	s.Require().True(weightedETA >= 450*time.Millisecond)
+
+	stateTracker.MarkTableAsCompleted("test.table2")
+	s.Require().True(stateTracker.WeightedETA(tableSizes) < weightedETA/5)
+}
+
+func (s *StateTrackerTestSuite) TestEstimatedTimeRemaining() {
+	tableSizes := map[string]uint64{
+		"test.table1": 2000,
+		"test.table2": 1000,
+	}
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	_, ok := stateTracker.EstimatedTimeRemaining(tableSizes)
+	s.Require().False(ok)
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1)
+	time.Sleep(100 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1001)
+
+	rate := stateTracker.EstimatedPaginationKeysPerSecond()
+	eta, ok := stateTracker.EstimatedTimeRemaining(tableSizes)
+	s.Require().True(ok)
+	s.Require().InDelta(float64(999+1000)/rate, eta.Seconds(), 0.001)
+
+	stateTracker.MarkTableAsCompleted("test.table2")
+	eta, ok = stateTracker.EstimatedTimeRemaining(tableSizes)
+	s.Require().True(ok)
+	s.Require().InDelta(float64(999)/rate, eta.Seconds(), 0.001)
+}
+
+func (s *StateTrackerTestSuite) TestEstimatedPaginationKeysPerSecondForTable() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRates = true
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table1"))
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 1)
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table1"))
+
+	time.Sleep(100 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 101)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 10001)
+
+	table1Rate := stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table1")
+	table2Rate := stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table2")
+	s.Require().True(table1Rate > 0)
+	s.Require().InDelta(100*table1Rate, table2Rate, table2Rate*0.05)
+
+	stateTracker.MarkTableAsCompleted("test.table1")
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table1"))
+
+	untracked := ghostferry.NewStateTracker(10)
+	untracked.UpdateLastSuccessfulPaginationKey("test.table1", 1)
+	untracked.UpdateLastSuccessfulPaginationKey("test.table1", 101)
+	s.Require().Equal(0.0, untracked.EstimatedPaginationKeysPerSecondForTable("test.table1"))
+}
+
+func (s *StateTrackerTestSuite) TestMarkRangeComplete() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	table := "test.table1"
+
+	stateTracker.MarkRangeComplete(table, 201, 300)
+	stateTracker.MarkRangeComplete(table, 501, 600)
+	stateTracker.MarkRangeComplete(table, 250, 400)
+	s.Require().Equal(uint64(0), stateTracker.LastSuccessfulPaginationKey(table))
+	s.Require().False(stateTracker.IsPaginationKeyCopied(table, 200))
+	s.Require().True(stateTracker.IsPaginationKeyCopied(table, 201))
+	s.Require().True(stateTracker.IsPaginationKeyCopied(table, 400))
+	s.Require().False(stateTracker.IsPaginationKeyCopied(table, 401))
+	s.Require().True(stateTracker.IsPaginationKeyCopied(table, 600))
+
+	s.Require().Equal([][2]uint64{{0, 200}, {401, 500}, {601, 1000}}, stateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal([][2]uint64{{0, 200}, {401, 500}, {601, 1000}}, resumedStateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	// Completing the first range advances the last successful pagination key
+	// through the ranges contiguous with it.
+	resumedStateTracker.MarkRangeComplete(table, 1, 200)
+	s.Require().Equal(uint64(400), resumedStateTracker.LastSuccessfulPaginationKey(table))
+	s.Require().Equal([][2]uint64{{401, 500}}, resumedStateTracker.UncopiedPaginationKeyRanges(table, 600))
+
+	resumedStateTracker.MarkRangeComplete(table, 350, 500)
+	s.Require().Equal(uint64(600), resumedStateTracker.LastSuccessfulPaginationKey(table))
+	s.Require().Equal(0, len(resumedStateTracker.UncopiedPaginationKeyRanges(table, 600)))
+	s.Require().Equal(0, len(resumedStateTracker.Serialize(nil, nil).CompletedPaginationKeyRanges))
+}
+
+func (s *StateTrackerTestSuite) TestPaginationKeyAnomalies() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 100)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table3", 100)
+	stateTracker.MarkRangeComplete("test.table3", 500, 600)
+
+	currentMax := map[string]uint64{
+		"test.table1": 50,
+		"test.table2": 100,
+		"test.table3": 550,
+		"test.table4": 10,
+	}
+
+	anomalies := stateTracker.PaginationKeyAnomalies(currentMax)
+	s.Require().Equal([]ghostferry.PaginationKeyAnomaly{
+		{Table: "test.table1", RecordedPaginationKey: 100, ObservedMaxPaginationKey: 50},
+		{Table: "test.table3", RecordedPaginationKey: 600, ObservedMaxPaginationKey: 550},
+	}, anomalies)
+	s.Require().Equal([]string{"test.table1", "test.table3"}, stateTracker.AnomalousTables(currentMax))
+}
+
+func (s *StateTrackerTestSuite) TestRecordBatchLatency() {
+	sink := make(chan interface{}, 10)
+	ghostferry.SetGlobalMetrics("test", sink)
+	defer ghostferry.SetGlobalMetrics("ghostferry", nil)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.RecordBatchLatency("test.table", 20*time.Millisecond)
+
+	metric := (<-sink).(ghostferry.HistogramMetric)
+	s.Require().Equal("test.BatchCopyLatency", metric.Key)
+	s.Require().Equal([]ghostferry.MetricTag{{Name: "table", Value: "test.table"}}, metric.Tags)
+	s.Require().Equal(0.02, metric.Value)
+	s.Require().Equal(ghostferry.DefaultBatchLatencyBuckets, metric.Buckets)
+
+	stateTracker.BatchLatencyBuckets = []float64{0.1, 1}
+	stateTracker.RecordBatchLatency("test.table", time.Second)
+	metric = (<-sink).(ghostferry.HistogramMetric)
+	s.Require().Equal([]float64{0.1, 1}, metric.Buckets)
+}
+
+func (s *StateTrackerTestSuite) TestStateTrackerForBinlogOnly() {
+	pos := mysql.Position{Name: "mysql-bin.00002", Pos: 10}
+	stateTracker := ghostferry.NewStateTrackerForBinlogOnly(pos, []string{"test.table1", "test.table2"})
+	s.Require().True(stateTracker.IsBinlogOnly())
+	s.Require().False(stateTracker.IsResume())
+
+	s.Require().Equal(uint64(math.MaxUint64), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	s.Require().Equal(uint64(math.MaxUint64), stateTracker.LastSuccessfulPaginationKey("test.table2"))
+	s.Require().Equal(uint64(0), stateTracker.LastSuccessfulPaginationKey("test.table3"))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(pos, serializedState.MinBinlogPosition())
+	s.Require().Equal(map[string]bool{"test.table1": true, "test.table2": true}, serializedState.CompletedTables)
+
+	s.Require().False(ghostferry.NewStateTracker(10).IsBinlogOnly())
+}
+
+func (s *StateTrackerTestSuite) TestBinlogFilesTraversed() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(0, len(stateTracker.BinlogFilesTraversed()))
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 100})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	// Rejected, as it moves the position backwards.
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00000", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+
+	s.Require().Equal([]string{"mysql-bin.00001", "mysql-bin.00002", "mysql-bin.00003"}, stateTracker.BinlogFilesTraversed())
+	s.Require().Equal(3, stateTracker.BinlogFilesTraversedCount())
+}
+
+func (s *StateTrackerTestSuite) TestLastWrittenBinlogPositionAcrossAFileNumberWithMoreDigits() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "binlog.999999", Pos: 100})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "binlog.1000000", Pos: 4})
+	s.Require().Equal(mysql.Position{Name: "binlog.1000000", Pos: 4}, stateTracker.LastWrittenBinlogPosition())
+
+	// Rejected, as it moves the position backwards.
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "binlog.999999", Pos: 200})
+	s.Require().Equal(mysql.Position{Name: "binlog.1000000", Pos: 4}, stateTracker.LastWrittenBinlogPosition())
+
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "binlog.999999", Pos: 200})
+	s.Require().Equal(mysql.Position{Name: "binlog.999999", Pos: 200}, stateTracker.MinBinlogPosition())
+}
+
+func (s *StateTrackerTestSuite) TestEstimatedBinlogRetentionNeeded() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+	s.Require().Equal(ghostferry.UnknownBinlogRetention, stateTracker.EstimatedBinlogRetentionNeeded())
+
+	// The rate of the binlog files is unknown until two files are traversed.
+	stateTracker.Serialize(nil, nil)
+	s.Require().Equal(ghostferry.UnknownBinlogRetention, stateTracker.EstimatedBinlogRetentionNeeded())
+
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+
+	// The age of the first file, plus the 20ms per file.
+	retention := stateTracker.EstimatedBinlogRetentionNeeded()
+	s.Require().True(retention >= 60*time.Millisecond, retention)
+	s.Require().True(retention < 200*time.Millisecond, retention)
+
+	// A snapshot is not a serialized state.
+	stateTracker.Snapshot()
+	retention = stateTracker.EstimatedBinlogRetentionNeeded()
+	s.Require().True(retention >= 60*time.Millisecond, retention)
+
+	// The file of the last serialized state is the latest one.
+	stateTracker.Serialize(nil, nil)
+	retention = stateTracker.EstimatedBinlogRetentionNeeded()
+	s.Require().True(retention >= 20*time.Millisecond, retention)
+	s.Require().True(retention < 60*time.Millisecond, retention)
+}
+
+func (s *StateTrackerTestSuite) TestEstimatedBinlogRetentionNeededAfterResume() {
+	state := ghostferry.NewStateTracker(10).Serialize(nil, nil)
+	state.LastWrittenBinlogPosition = mysql.Position{Name: "mysql-bin.00001", Pos: 100}
+
+	// The resumed run starts four files after the file of the state.
+	stateTracker := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	stateTracker.Serialize(nil, nil)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00005", Pos: 4})
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00006", Pos: 4})
+
+	// Four files before the first traversed one, each taking 20ms, plus the
+	// age of that one and a file.
+	retention := stateTracker.EstimatedBinlogRetentionNeeded()
+	s.Require().True(retention >= 120*time.Millisecond, retention)
+	s.Require().True(retention < 300*time.Millisecond, retention)
+}
+
+func (s *StateTrackerTestSuite) TestMinSpeedLogSampleIntervalAccumulatesUpdates() {
+	start := time.Now()
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(ghostferry.DefaultMinSpeedLogSampleInterval, stateTracker.MinSpeedLogSampleInterval)
+	stateTracker.MinSpeedLogSampleInterval = 50 * time.Millisecond
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1000)
+	first := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(first > 0)
+
+	// Updates within the interval are accumulated rather than sampled.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 2000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 3000)
+	s.Require().Equal(first, stateTracker.EstimatedPaginationKeysPerSecond())
+
+	time.Sleep(50 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 4000)
+	elapsed := time.Since(start).Seconds()
+
+	// The log starts at 0 when the tracker is constructed.
+	estimate := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(estimate <= 4000/0.05, "estimate %v", estimate)
+	s.Require().True(estimate >= 4000/elapsed, "estimate %v", estimate)
+}
+
+type recordedSpan struct {
+	name       string
+	attributes map[string]interface{}
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name string, attributes map[string]interface{}) ghostferry.Span {
+	span := &recordedSpan{name: name, attributes: attributes}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *StateTrackerTestSuite) TestTracerSpans() {
+	tracer := &recordingTracer{}
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	// Without a tracer, nothing is traced.
+	stateTracker.SetPhase(ghostferry.StateStarting)
+	stateTracker.Tracer = tracer
+
+	stateTracker.SetPhase(ghostferry.StateCopying)
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	stateTracker.Serialize(nil, nil)
+	stateTracker.Snapshot()
+	stateTracker.SetPhase(ghostferry.StateDone)
+	stateTracker.Finalize()
+
+	// The snapshot is not traced.
+	s.Require().Equal(4, len(tracer.spans))
+	s.Require().Equal(&recordedSpan{ghostferry.SpanPhase, map[string]interface{}{"phase": ghostferry.StateCopying}, true}, tracer.spans[0])
+	s.Require().Equal(&recordedSpan{ghostferry.SpanTableCompleted, map[string]interface{}{"table": "test.table1"}, true}, tracer.spans[1])
+	s.Require().Equal(&recordedSpan{ghostferry.SpanSerialize, map[string]interface{}{"binlog_file": "mysql-bin.00002"}, true}, tracer.spans[2])
+	s.Require().Equal(&recordedSpan{ghostferry.SpanPhase, map[string]interface{}{"phase": ghostferry.StateDone}, true}, tracer.spans[3])
+}
+
+func (s *StateTrackerTestSuite) TestTableCompletedSpanCarriesTheRateOfTheTable() {
+	tracer := &recordingTracer{}
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRates = true
+	stateTracker.Tracer = tracer
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1)
+	time.Sleep(50 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 101)
+	rate := stateTracker.EstimatedPaginationKeysPerSecondForTable("test.table1")
+	stateTracker.MarkTableAsCompleted("test.table1")
+
+	s.Require().Equal(1, len(tracer.spans))
+	s.Require().Equal(ghostferry.SpanTableCompleted, tracer.spans[0].name)
+	s.Require().Equal(rate, tracer.spans[0].attributes["pagination_keys_per_second"])
+}
+
+func (s *StateTrackerTestSuite) TestTableCopyCompletePendingVerification() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	stateTracker.MarkTableCopyComplete("test.table1")
+
+	s.Require().True(stateTracker.IsTableCopyComplete("test.table1"))
+	s.Require().True(stateTracker.IsTablePendingVerification("test.table1"))
+	s.Require().False(stateTracker.IsTableComplete("test.table1"))
+	s.Require().Equal(uint64(math.MaxUint64), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table1", 1000))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().False(serializedState.CompletedTables["test.table1"])
+	s.Require().True(serializedState.CopyCompletedTables["test.table1"])
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumedStateTracker.IsTablePendingVerification("test.table1"))
+	s.Require().Equal(uint64(math.MaxUint64), resumedStateTracker.LastSuccessfulPaginationKey("test.table1"))
+
+	// Tables pending verification can be resumed in verify-only mode.
+	_, err := ghostferry.NewVerifyOnlyStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Nil(err)
+
+	resumedStateTracker.MarkTableVerified("test.table1")
+	s.Require().True(resumedStateTracker.IsTableComplete("test.table1"))
+	s.Require().False(resumedStateTracker.IsTablePendingVerification("test.table1"))
+
+	serializedState = resumedStateTracker.Serialize(nil, nil)
+	s.Require().True(serializedState.CompletedTables["test.table1"])
+	s.Require().Equal(0, len(serializedState.CopyCompletedTables))
+
+	// A table can only be verified once copied.
+	resumedStateTracker.MarkTableVerified("test.table2")
+	s.Require().False(resumedStateTracker.IsTableComplete("test.table2"))
+}
+
+func (s *StateTrackerTestSuite) TestOverallProgress() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(0.0, stateTracker.OverallProgress(nil))
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 250)
+	stateTracker.MarkRangeComplete("test.table2", 501, 750)
+
+	tableSizes := map[string]uint64{
+		"test.table1": 100,
+		"test.table2": 1000,
+		"test.table3": 900,
+	}
+	s.Require().InDelta((100.0+500.0)/2000.0, stateTracker.OverallProgress(tableSizes), 1e-9)
+
+	// Without sizes, the fraction of completed tables is used.
+	s.Require().Equal(0.5, stateTracker.OverallProgress(nil))
+	s.Require().InDelta(1.0/3.0, stateTracker.OverallProgress(map[string]uint64{
+		"test.table1": 0,
+		"test.table2": 0,
+		"test.table3": 0,
+	}), 1e-9)
+}
+
+func (s *StateTrackerTestSuite) TestProgress() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	progress, overall := stateTracker.Progress()
+	s.Require().Equal(map[string]float64{}, progress)
+	s.Require().Equal(0.0, overall)
+
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 250)
+	stateTracker.MarkRangeComplete("test.table2", 501, 750)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table3", 100)
+
+	progress, _ = stateTracker.Progress()
+	s.Require().Equal(map[string]float64{"test.table1": 1}, progress)
+
+	stateTracker.SetTableSizes(map[string]uint64{"test.table1": 100, "test.table2": 1000})
+	stateTracker.SetTargetPaginationKey("test.table3", 900)
+
+	progress, overall = stateTracker.Progress()
+	s.Require().Equal(3, len(progress))
+	s.Require().Equal(1.0, progress["test.table1"])
+	s.Require().InDelta(0.5, progress["test.table2"], 1e-9)
+	s.Require().InDelta(100.0/900, progress["test.table3"], 1e-9)
+	s.Require().InDelta((100.0+500.0+100.0)/2000.0, overall, 1e-9)
+}
+
+func (s *StateTrackerTestSuite) TestBinlogPositionAtTableCompletion() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 100})
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 200})
+	stateTracker.MarkTableCopyComplete("test.table2")
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	stateTracker.MarkTableVerified("test.table2")
+	stateTracker.CompleteTableWithFinalPaginationKey("test.table3", 10, 10)
+	stateTracker.MarkTableAsCompleted("test.table1")
+
+	pos, found := stateTracker.BinlogPositionAtTableCompletion("test.table1")
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00001", Pos: 100}, pos)
+
+	pos, found = stateTracker.BinlogPositionAtTableCompletion("test.table2")
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00001", Pos: 200}, pos)
+
+	_, found = stateTracker.BinlogPositionAtTableCompletion("test.table4")
+	s.Require().False(found)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	pos, found = resumed.BinlogPositionAtTableCompletion("test.table3")
+	s.Require().True(found)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 4}, pos)
+
+	resumed.MarkTableDropped("test.table3")
+	_, found = resumed.BinlogPositionAtTableCompletion("test.table3")
+	s.Require().False(found)
+}
+
+func (s *StateTrackerTestSuite) TestCompletionEvents() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("test.before")
+
+	events := stateTracker.CompletionEvents()
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.CompleteTableWithFinalPaginationKey("test.table2", 10, 10)
+	stateTracker.MarkTableCopyComplete("test.table3")
+	stateTracker.MarkTableVerified("test.table3")
+	stateTracker.MarkTableDropped("test.table4")
+	stateTracker.Finalize()
+
+	completed := make([]string, 0)
+	for table := range events {
+		completed = append(completed, table)
+	}
+	s.Require().Equal([]string{"test.table1", "test.table2", "test.table3"}, completed)
+
+	_, open := <-stateTracker.CompletionEvents()
+	s.Require().False(open)
+}
+
+func (s *StateTrackerTestSuite) TestCompletionEventsDoNotBlock() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	events := stateTracker.CompletionEvents()
+
+	for i := 0; i < 200; i++ {
+		stateTracker.MarkTableAsCompleted(fmt.Sprintf("test.table%d", i))
+	}
+	s.Require().Equal(100, len(events))
+}
+
+func (s *StateTrackerTestSuite) TestOnBinlogRotate() {
+	rotations := make([][2]string, 0)
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.OnBinlogRotate = func(oldFile, newFile string) {
+		// The callback is called outside of the locks.
+		s.Require().Equal(newFile, stateTracker.Serialize(nil, nil).LastWrittenBinlogPosition.Name)
+		rotations = append(rotations, [2]string{oldFile, newFile})
+	}
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 100})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00001", Pos: 200})
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00003", Pos: 4})
+
+	s.Require().Equal([][2]string{
+		{"mysql-bin.00001", "mysql-bin.00002"},
+		{"mysql-bin.00002", "mysql-bin.00003"},
+	}, rotations)
+}
+
+func (s *StateTrackerTestSuite) TestDuplicateTableCompletionFiresOnce() {
+	tracer := &recordingTracer{}
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.Tracer = tracer
+	events := stateTracker.Subscribe()
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 100)
+	for i := 0; i < 3; i++ {
+		stateTracker.MarkTableAsCompleted("test.table1")
+	}
+	stateTracker.MarkTablesCompleted([]string{"test.table1"})
+	stateTracker.MarkTableCopyComplete("test.table1")
+	stateTracker.MarkTableVerified("test.table1")
+
+	s.Require().True(stateTracker.IsTableComplete("test.table1"))
+	s.Require().False(stateTracker.IsTablePendingVerification("test.table1"))
+
+	stateTracker.Unsubscribe(events)
+	completions := 0
+	for event := range events {
+		if event.Type == ghostferry.ProgressEventTableCompleted {
+			completions++
+		}
+	}
+	s.Require().Equal(1, completions)
+	s.Require().Equal(1, len(tracer.spans))
+	s.Require().Equal(ghostferry.SpanTableCompleted, tracer.spans[0].name)
+
+	stateTracker.DuplicateTableCompletion = ghostferry.DuplicateTableCompletionWarn
+	s.Require().NotPanics(func() { stateTracker.MarkTableAsCompleted("test.table1") })
+
+	stateTracker.DuplicateTableCompletion = ghostferry.DuplicateTableCompletionPanic
+	s.Require().Panics(func() { stateTracker.MarkTableAsCompleted("test.table1") })
+	s.Require().Panics(func() { stateTracker.MarkTablesCompleted([]string{"test.table1"}) })
+	s.Require().NotPanics(func() { stateTracker.MarkTableAsCompleted("test.table2") })
+}
+
+func (s *StateTrackerTestSuite) TestBinlogPositionOverride() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 10})
+	stateTracker.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	serializedState := stateTracker.Serialize(nil, nil)
+
+	at := time.Now()
+	overridden := serializedState.WithBinlogPositionOverride(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, at)
+
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 10}, serializedState.LastWrittenBinlogPosition)
+	s.Require().Equal(0, len(serializedState.BinlogPositionOverrides))
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, overridden.MinBinlogPosition())
+
+	// The override is carried across resumes.
+	resumedState := ghostferry.NewStateTrackerFromSerializedState(10, overridden).Serialize(nil, nil)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, resumedState.LastWrittenBinlogPosition)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00005", Pos: 4}, resumedState.LastStoredBinlogPositionForInlineVerifier)
+	s.Require().Equal([]ghostferry.BinlogPositionOverride{
+		{
+			From: mysql.Position{Name: "mysql-bin.00002", Pos: 4},
+			To:   mysql.Position{Name: "mysql-bin.00005", Pos: 4},
+			At:   at,
+		},
+	}, resumedState.BinlogPositionOverrides)
+}
+
+func (s *StateTrackerTestSuite) TestAppliedEventTime() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().True(stateTracker.EarliestAppliedEventTime().IsZero())
+	s.Require().Equal(time.Duration(0), stateTracker.AppliedEventLag())
+
+	first := time.Unix(1500000000, 0)
+	stateTracker.UpdateAppliedEventTime(first.Add(10 * time.Second))
+	stateTracker.UpdateAppliedEventTime(first)
+	stateTracker.UpdateAppliedEventTime(first.Add(20 * time.Second))
+	stateTracker.UpdateAppliedEventTime(first.Add(15 * time.Second))
+	stateTracker.UpdateAppliedEventTime(time.Time{})
+
+	s.Require().Equal(first, stateTracker.EarliestAppliedEventTime())
+	s.Require().Equal(first.Add(20*time.Second), stateTracker.LatestAppliedEventTime())
+	minimumLag := time.Since(first.Add(20 * time.Second))
+	s.Require().True(stateTracker.AppliedEventLag() >= minimumLag)
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal(first, resumedStateTracker.EarliestAppliedEventTime())
+	s.Require().Equal(first.Add(20*time.Second), resumedStateTracker.LatestAppliedEventTime())
+}
+
+type namedCompletionPredicate struct {
+	ghostferry.NeverCompletePredicate
+	name string
+}
+
+func (p namedCompletionPredicate) Name() string {
+	return p.name
+}
+
+func (s *StateTrackerTestSuite) TestCompletionPredicates() {
+	s.Require().NotNil(ghostferry.RegisterCompletionPredicate(ghostferry.NeverCompletePredicate{}))
+	// The registration fails if the test already ran in this process.
+	ghostferry.RegisterCompletionPredicate(namedCompletionPredicate{name: "state_tracker_test"})
+	_, found := ghostferry.LookupCompletionPredicate("state_tracker_test")
+	s.Require().True(found)
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(ghostferry.ReachedMaxPaginationKeyPredicate{}, stateTracker.CompletionPredicate("test.table1"))
+
+	stateTracker.SetCompletionPredicate("test.table1", ghostferry.NeverCompletePredicate{})
+	stateTracker.SetCompletionPredicate("test.table2", namedCompletionPredicate{name: "state_tracker_test"})
+	stateTracker.SetCompletionPredicate("test.table3", namedCompletionPredicate{name: "unregistered"})
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]string{
+		"test.table1": ghostferry.CompletionPredicateNever,
+		"test.table2": "state_tracker_test",
+		"test.table3": "unregistered",
+	}, serializedState.CompletionPredicates)
+
+	// The unregistered predicates fall back to the default on resume.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Equal(ghostferry.NeverCompletePredicate{}, resumedStateTracker.CompletionPredicate("test.table1"))
+	s.Require().Equal(namedCompletionPredicate{name: "state_tracker_test"}, resumedStateTracker.CompletionPredicate("test.table2"))
+	s.Require().Equal(ghostferry.ReachedMaxPaginationKeyPredicate{}, resumedStateTracker.CompletionPredicate("test.table3"))
+
+	resumedStateTracker.SetCompletionPredicate("test.table1", nil)
+	s.Require().Equal(ghostferry.ReachedMaxPaginationKeyPredicate{}, resumedStateTracker.CompletionPredicate("test.table1"))
+
+	predicate := ghostferry.ReachedMaxPaginationKeyPredicate{}
+	s.Require().False(predicate.IsComplete(ghostferry.TableCompletionProgress{LastSuccessfulPaginationKey: 5, MaxPaginationKey: 10}))
+	s.Require().True(predicate.IsComplete(ghostferry.TableCompletionProgress{LastSuccessfulPaginationKey: 10, MaxPaginationKey: 10}))
+	s.Require().True(predicate.IsComplete(ghostferry.TableCompletionProgress{LastSuccessfulPaginationKey: 5, MaxPaginationKey: 10, Exhausted: true}))
+}
+
+func (s *StateTrackerTestSuite) TestPopCompletedForVerification() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MarkTableAsCompleted("test.table0")
+	_, found := stateTracker.PopCompletedForVerification()
+	s.Require().False(found)
+
+	stateTracker.VerificationQueueSize = 2
+	stateTracker.MarkTableAsCompleted("test.table3")
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.MarkTableAsCompleted("test.table1")
+	stateTracker.MarkTableAsCompleted("test.table2")
+
+	// test.table2 did not fit in the queue and is queued once it is drained.
+	table, found := stateTracker.PopCompletedForVerification()
+	s.Require().True(found)
+	s.Require().Equal("test.table3", table)
+	stateTracker.MarkTableVerified("test.table3")
+
+	table, _ = stateTracker.PopCompletedForVerification()
+	s.Require().Equal("test.table1", table)
+	table, _ = stateTracker.PopCompletedForVerification()
+	s.Require().Equal("test.table2", table)
+	_, found = stateTracker.PopCompletedForVerification()
+	s.Require().False(found)
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal([]string{"test.table1", "test.table2"}, serializedState.UnverifiedCompletedTables)
+
+	// The tables being verified when the state was serialized are handed out
+	// again on resume.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	resumedStateTracker.VerificationQueueSize = 2
+	resumedStateTracker.MarkTableVerified("test.table2")
+
+	table, found = resumedStateTracker.PopCompletedForVerification()
+	s.Require().True(found)
+	s.Require().Equal("test.table1", table)
+	resumedStateTracker.MarkTableVerified("test.table1")
+	_, found = resumedStateTracker.PopCompletedForVerification()
+	s.Require().False(found)
+	s.Require().Nil(resumedStateTracker.Serialize(nil, nil).UnverifiedCompletedTables)
+}
+
+func (s *StateTrackerTestSuite) TestDistinctTablesSeen() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(0, stateTracker.DistinctTablesSeen())
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	stateTracker.MarkRangeComplete("test.table2", 100, 200)
+	stateTracker.MarkTableCopyComplete("test.table3")
+	stateTracker.MarkTableAsCompleted("test.table4")
+	stateTracker.MarkTableAsCompleted("test.table1")
+
+	s.Require().Equal(4, stateTracker.DistinctTablesSeen())
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal(4, resumedStateTracker.DistinctTablesSeen())
+}
+
+func (s *StateTrackerTestSuite) TestSeedProgress() {
+	column := schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER, RawType: "int(10) unsigned"}
+	tables := ghostferry.TableSchemaCache{
+		"test.table1": &ghostferry.TableSchema{
+			Table:               &schema.Table{Schema: "test", Name: "table1", Columns: []schema.TableColumn{column}},
+			PaginationKeyColumn: &column,
+		},
+		"test.table2": &ghostferry.TableSchema{
+			Table:               &schema.Table{Schema: "test", Name: "table2", Columns: []schema.TableColumn{column}},
+			PaginationKeyColumn: &column,
+		},
+	}
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table2", 5)
+	estimate := stateTracker.EstimatedPaginationKeysPerSecond()
+
+	s.Require().NotNil(stateTracker.SeedProgress(map[string]uint64{"test.table1": 100, "test.table3": 10}, tables))
+	s.Require().NotNil(stateTracker.SeedProgress(map[string]uint64{"test.table1": math.MaxUint32 + 1}, tables))
+	s.Require().NotNil(stateTracker.SeedProgress(map[string]uint64{"test.table1": 100, "test.table2": 10}, tables))
+
+	// Nothing is seeded by an invalid seed.
+	s.Require().Equal(uint64(0), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+
+	s.Require().Nil(stateTracker.SeedProgress(map[string]uint64{"test.table1": 100}, tables))
+	s.Require().Equal(uint64(100), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	s.Require().False(stateTracker.IsTableComplete("test.table1"))
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table1", 100))
+	s.Require().False(stateTracker.IsPaginationKeyCopied("test.table1", 101))
+
+	// The seeded keys are not counted as copied by this run.
+	s.Require().Equal(estimate, stateTracker.EstimatedPaginationKeysPerSecond())
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(mysql.Position{}, serializedState.LastWrittenBinlogPosition)
+	_, found := serializedState.FirstPaginationKeys["test.table1"]
+	s.Require().False(found)
+}
+
+func (s *StateTrackerTestSuite) TestEstimatedPaginationKeysPerSecondExcludingLatest() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1000)
+	s.Require().True(stateTracker.EstimatedPaginationKeysPerSecond() > 0)
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecondExcludingLatest())
+
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 2000)
+	s.Require().True(stateTracker.EstimatedPaginationKeysPerSecondExcludingLatest() > 0)
+
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 3000)
+	closedRate := stateTracker.EstimatedPaginationKeysPerSecond()
+
+	// The latest update does not change the rate over the previous entries.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 3001)
+	s.Require().Equal(closedRate, stateTracker.EstimatedPaginationKeysPerSecondExcludingLatest())
+}
+
+func (s *StateTrackerTestSuite) TestResetSpeedLog() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 0}, 0)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 1000}, 100)
+	stateTracker.MarkTableAsCompleted("test.table2")
+
+	// The stale samples of a long stall.
+	time.Sleep(300 * time.Millisecond)
+	stateTracker.ResetSpeedLog()
+	s.Require().Equal(0.0, stateTracker.EstimatedPaginationKeysPerSecond())
+
+	s.Require().Equal(uint64(1000), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+	s.Require().True(stateTracker.IsTableComplete("test.table2"))
+	s.Require().Equal(uint64(100), stateTracker.RowsCopied())
+
+	// Including the stall, the rate would be about 3000 pagination keys per
+	// second.
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 2000}, 100)
+	s.Require().True(stateTracker.EstimatedPaginationKeysPerSecond() > 10000, "rate: %v", stateTracker.EstimatedPaginationKeysPerSecond())
+	s.Require().Equal(uint64(2000), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(2, len(serializedState.SpeedLog))
+	s.Require().Equal(map[string]bool{"test.table2": true}, serializedState.CompletedTables)
+}
+
+func (s *StateTrackerTestSuite) TestSpeedLogCountChangeOnResume() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	for i := uint64(1); i <= 6; i++ {
+		time.Sleep(5 * time.Millisecond)
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", i*1000)
+	}
+
+	// The log starts with an entry at 0.
+	state := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(7, len(state.SpeedLog))
+	s.Require().Equal(uint64(0), state.SpeedLog[0].Position)
+	s.Require().Equal(uint64(6000), state.SpeedLog[6].Position)
+
+	// The most recent entries are kept in a smaller speed log.
+	smaller := ghostferry.NewStateTrackerFromSerializedState(3, state)
+	s.Require().Equal(3, len(smaller.Serialize(nil, nil).SpeedLog))
+	s.Require().Equal(uint64(4000), smaller.Serialize(nil, nil).SpeedLog[0].Position)
+	s.Require().True(smaller.EstimatedPaginationKeysPerSecond() > 0)
+
+	// A larger speed log keeps all the entries and fills up from there.
+	larger := ghostferry.NewStateTrackerFromSerializedState(20, state)
+	larger.MinSpeedLogSampleInterval = 0
+	s.Require().Equal(7, len(larger.Serialize(nil, nil).SpeedLog))
+	s.Require().True(larger.EstimatedPaginationKeysPerSecond() > 0)
+	larger.UpdateLastSuccessfulPaginationKey("test.table1", 7000)
+	s.Require().Equal(8, len(larger.Serialize(nil, nil).SpeedLog))
+
+	// The time between the runs does not count towards the rates.
+	time.Sleep(50 * time.Millisecond)
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	s.Require().InDelta(stateTracker.EstimatedPaginationKeysPerSecond(), resumed.EstimatedPaginationKeysPerSecond(), 1)
+	s.Require().WithinDuration(time.Now(), resumed.Serialize(nil, nil).SpeedLog[6].At, 10*time.Millisecond)
+
+	// No speed log, nothing to restore.
+	s.Require().Equal(0, len(ghostferry.NewStateTrackerFromSerializedState(0, state).Serialize(nil, nil).SpeedLog))
+}
+
+func (s *StateTrackerTestSuite) TestSerializeProgressOnly() {
+	tables := ghostferry.TableSchemaCache{}
+	for i := 0; i < 100; i++ {
+		tables[fmt.Sprintf("db.table%d", i)] = &ghostferry.TableSchema{
+			Table: &schema.Table{
+				Schema:  "db",
+				Name:    fmt.Sprintf("table%d", i),
+				Columns: []schema.TableColumn{{Name: "id"}, {Name: "data"}, {Name: "created_at"}},
+			},
+		}
+	}
+
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 10)
+
+	fullData, err := json.Marshal(stateTracker.Serialize(tables, nil))
+	s.Require().Nil(err)
+	progressOnlyData, err := json.Marshal(stateTracker.SerializeProgressOnly(tables, nil))
+	s.Require().Nil(err)
+	s.Require().True(len(progressOnlyData) < len(fullData)/2)
+
+	state := &ghostferry.SerializableState{}
+	s.Require().Nil(json.Unmarshal(progressOnlyData, state))
+	s.Require().True(state.LastKnownTableSchemaCacheOmitted)
+	s.Require().Nil(state.LastKnownTableSchemaCache)
+	s.Require().Equal(uint64(10), state.LastSuccessfulPaginationKeys["db.table1"])
+
+	// The schema it is resumed with is verified against the hashes.
+	driftedTables, err := state.TablesWithSchemaDrift(tables)
+	s.Require().Nil(err)
+	s.Require().Equal(0, len(driftedTables))
+
+	tables["db.table1"].Columns = append(tables["db.table1"].Columns, schema.TableColumn{Name: "added"})
+	driftedTables, err = state.TablesWithSchemaDrift(tables)
+	s.Require().Nil(err)
+	s.Require().Equal([]string{"db.table1"}, driftedTables)
+
+	s.Require().Contains(state.ResumePlan(nil).Warnings, "the state has no schema cache, it is resumed with the schema of the source or Ferry.TableSchemaCacheToResumeWith")
+}
+
+func (s *StateTrackerTestSuite) TestCompactCompletedTables() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	for i := 0; i < 1000; i++ {
+		stateTracker.MarkTableAsCompleted(fmt.Sprintf("db.table%04d", i))
+	}
+
+	mapData, err := json.Marshal(stateTracker.Serialize(nil, nil))
+	s.Require().Nil(err)
+
+	stateTracker.CompactCompletedTables = true
+	listData, err := json.Marshal(stateTracker.Serialize(nil, nil))
+	s.Require().Nil(err)
+	s.Require().Equal(len(mapData)-1000*len(`:true`), len(listData))
+
+	var raw map[string]json.RawMessage
+	s.Require().Nil(json.Unmarshal(listData, &raw))
+	var completedTables []string
+	s.Require().Nil(json.Unmarshal(raw["CompletedTables"], &completedTables))
+	s.Require().Equal(1000, len(completedTables))
+	s.Require().Equal("db.table0000", completedTables[0])
+	s.Require().Equal("db.table0999", completedTables[999])
+
+	// Both forms load into the same state, and are encoded back in their form.
+	for _, data := range [][]byte{mapData, listData} {
+		state := &ghostferry.SerializableState{}
+		s.Require().Nil(json.Unmarshal(data, state))
+		s.Require().Equal(1000, len(state.CompletedTables))
+		s.Require().True(state.CompletedTables["db.table0500"])
+		s.Require().True(ghostferry.NewStateTrackerFromSerializedState(10, state).IsTableComplete("db.table0500"))
+
+		reencoded, err := json.Marshal(state)
+		s.Require().Nil(err)
+		s.Require().Equal(len(data), len(reencoded))
+	}
+}
+
+func (s *StateTrackerTestSuite) TestSpeedLogSurvivesBackwardClockJump() {
+	// The previous run had its clock an hour ahead, and its wall clock jumped
+	// back by a minute between the last two entries.
+	ahead := time.Now().Add(time.Hour)
+	state := ghostferry.NewStateTracker(10).Serialize(nil, nil)
+	state.SpeedLog = []ghostferry.PaginationKeyPositionLog{
+		{Position: 1000, At: ahead.Add(-3 * time.Second)},
+		{Position: 2000, At: ahead.Add(-2 * time.Second)},
+		{Position: 3000, At: ahead.Add(time.Minute)},
+		{Position: 4000, At: ahead},
+	}
+
+	// The monotonic clock readings are lost through serialization.
+	data, err := json.Marshal(state)
+	s.Require().Nil(err)
+	state = &ghostferry.SerializableState{}
+	s.Require().Nil(json.Unmarshal(data, state))
+
+	stateTracker := ghostferry.NewStateTrackerFromSerializedState(10, state)
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	speedLog := stateTracker.Serialize(nil, nil).SpeedLog
+	for i := 1; i < len(speedLog); i++ {
+		s.Require().False(speedLog[i].At.Before(speedLog[i-1].At))
+	}
+	s.Require().False(speedLog[len(speedLog)-1].At.After(time.Now()))
+
+	for i := 0; i < 3; i++ {
+		rate := stateTracker.EstimatedPaginationKeysPerSecond()
+		s.Require().True(rate >= 0)
+		s.Require().False(math.IsInf(rate, 0) || math.IsNaN(rate))
+
+		time.Sleep(5 * time.Millisecond)
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", uint64(i+1)*1000)
+	}
+
+	rate := stateTracker.EstimatedPaginationKeysPerSecond()
+	s.Require().True(rate > 0)
+	s.Require().False(math.IsInf(rate, 0) || math.IsNaN(rate))
+}
+
+func (s *StateTrackerTestSuite) TestWaitForTableComplete() {
+	stateTracker := ghostferry.NewStateTracker(10)
+
+	waited := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			waited <- stateTracker.WaitForTableComplete(context.Background(), "test.table1")
+		}()
+	}
+
+	select {
+	case <-waited:
+		s.Fail("returned before the table completed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	stateTracker.MarkTableAsCompleted("test.table1")
+	s.Require().Nil(<-waited)
+	s.Require().Nil(<-waited)
+
+	// Returns immediately once the table is completed.
+	s.Require().Nil(stateTracker.WaitForTableComplete(context.Background(), "test.table1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s.Require().Equal(context.DeadlineExceeded, stateTracker.WaitForTableComplete(ctx, "test.table2"))
+
+	// Tables pending verification complete once verified.
+	stateTracker.MarkTableCopyComplete("test.table2")
+	go func() {
+		waited <- stateTracker.WaitForTableComplete(context.Background(), "test.table2")
+	}()
+	stateTracker.MarkTableVerified("test.table2")
+	s.Require().Nil(<-waited)
+}
+
+func (s *StateTrackerTestSuite) TestTableStatus() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableErrors = true
+
+	assertStatus := func(table string, expectedState ghostferry.TableState, expectedReason ghostferry.TableReason) {
+		state, reason := stateTracker.TableStatus(table)
+		s.Require().Equal(expectedState, state, table)
+		s.Require().Equal(expectedReason, reason, table)
+	}
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.copying", 10)
+	stateTracker.MarkRangeComplete("test.ranges", 100, 200)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.errored", 10)
+	stateTracker.RecordTableError("test.errored", errors.New("connection refused"))
+	stateTracker.MarkTableCopyComplete("test.copied")
+	stateTracker.MarkTableAsCompleted("test.completed")
+
+	assertStatus("test.not_started", ghostferry.TableStateIncomplete, ghostferry.TableReasonNotStarted)
+	assertStatus("test.copying", ghostferry.TableStateIncomplete, ghostferry.TableReasonCopying)
+	assertStatus("test.ranges", ghostferry.TableStateIncomplete, ghostferry.TableReasonCopying)
+	assertStatus("test.errored", ghostferry.TableStateIncomplete, ghostferry.TableReasonErrored)
+	assertStatus("test.copied", ghostferry.TableStatePendingVerification, ghostferry.TableReasonAwaitingVerification)
+	assertStatus("test.completed", ghostferry.TableStateCompleted, ghostferry.TableReasonNone)
+
+	stateTracker.Pause()
+	assertStatus("test.copying", ghostferry.TableStateIncomplete, ghostferry.TableReasonThrottled)
+	assertStatus("test.not_started", ghostferry.TableStateIncomplete, ghostferry.TableReasonNotStarted)
+	stateTracker.Resume()
+
+	stateTracker.Finalize()
+	assertStatus("test.copying", ghostferry.TableStateIncomplete, ghostferry.TableReasonFrozen)
+	assertStatus("test.completed", ghostferry.TableStateCompleted, ghostferry.TableReasonNone)
+}
+
+func (s *StateTrackerTestSuite) TestRates() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	rates := stateTracker.Rates()
+	s.Require().Len(rates, len(ghostferry.DefaultRateWindows))
+	s.Require().Equal(0.0, rates["1m"])
+
+	stateTracker.SetRateWindows(map[string]time.Duration{
+		"short": 200 * time.Millisecond,
+		"long":  time.Hour,
+	})
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 100)
+	time.Sleep(10 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 200)
+
+	rates = stateTracker.Rates()
+	s.Require().Len(rates, 2)
+	s.Require().True(rates["short"] > 0)
+	s.Require().True(rates["long"] > 0)
+
+	// The copy stalled for longer than the short window.
+	time.Sleep(300 * time.Millisecond)
+	rates = stateTracker.Rates()
+	s.Require().Equal(0.0, rates["short"])
+	s.Require().True(rates["long"] > 0)
+}
+
+func (s *StateTrackerTestSuite) TestSmoothedPaginationKeysPerSecondDecaysWhenIdle() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.SmoothedSpeedHalfLife = 50 * time.Millisecond
+	s.Require().Equal(0.0, stateTracker.SmoothedPaginationKeysPerSecond())
+
+	for i := uint64(1); i <= 10; i++ {
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.table", i*100)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rate := stateTracker.SmoothedPaginationKeysPerSecond()
+	s.Require().True(rate > 0)
+
+	// Nothing was copied for 4 half-lives.
+	time.Sleep(200 * time.Millisecond)
+	idleRate := stateTracker.SmoothedPaginationKeysPerSecond()
+	s.Require().True(idleRate > 0)
+	s.Require().True(idleRate < rate/8, "idle rate %v, rate before the gap %v", idleRate, rate)
+
+	// The update ending the gap is averaged over the whole gap.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 1100)
+	s.Require().True(stateTracker.SmoothedPaginationKeysPerSecond() < rate/2)
+}
+
+func (s *StateTrackerTestSuite) TestMarkTableDropped() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.copying", 10)
+	stateTracker.MarkTableCopyComplete("test.copied")
+	stateTracker.MarkTableAsCompleted("test.completed")
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.kept", 10)
+
+	waited := make(chan error)
+	go func() {
+		waited <- stateTracker.WaitForTableComplete(context.Background(), "test.copying")
+	}()
+
+	for _, table := range []string{"test.copying", "test.copied", "test.completed"} {
+		stateTracker.MarkTableDropped(table)
+		s.Require().True(stateTracker.IsTableDropped(table))
+		state, _ := stateTracker.TableStatus(table)
+		s.Require().Equal(ghostferry.TableStateDropped, state)
+	}
+	s.Require().NotNil(<-waited)
+	s.Require().NotNil(stateTracker.WaitForTableComplete(context.Background(), "test.copied"))
+
+	// The progress and completion of a dropped table are ignored.
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.copying", 20)
+	stateTracker.MarkTableAsCompleted("test.copying")
+	s.Require().False(stateTracker.IsTableComplete("test.copying"))
+	s.Require().False(stateTracker.IsTableDropped("test.kept"))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal([]string{"test.completed", "test.copied", "test.copying"}, serializedState.DroppedTables)
+	s.Require().Equal(map[string]uint64{"test.kept": 10}, serializedState.LastSuccessfulPaginationKeys)
+	s.Require().Empty(serializedState.CompletedTables)
+	s.Require().Empty(serializedState.CopyCompletedTables)
+	s.Require().Contains(serializedState.Report(), "Dropped tables:\n  test.completed\n")
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumedStateTracker.IsTableDropped("test.copying"))
+	s.Require().False(resumedStateTracker.IsTableCopyComplete("test.copied"))
+}
+
+func (s *StateTrackerTestSuite) TestCanSerialize() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().True(stateTracker.CanSerialize())
+
+	stateTracker.BeginSchemaFreeze()
+	stateTracker.BeginSchemaFreeze()
+	s.Require().False(stateTracker.CanSerialize())
+	stateTracker.EndSchemaFreeze()
+	s.Require().False(stateTracker.CanSerialize())
+	stateTracker.EndSchemaFreeze()
+	s.Require().True(stateTracker.CanSerialize())
+
+	stateTracker.SetPhase(ghostferry.StateWaitingForCutover)
+	s.Require().True(stateTracker.CanSerialize())
+	stateTracker.SetPhase(ghostferry.StateCutover)
+	s.Require().False(stateTracker.CanSerialize())
+
+	stateTracker.Finalize()
+	s.Require().True(stateTracker.CanSerialize())
+}
+
+func (s *StateTrackerTestSuite) TestSlowTables() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.untracked", 100)
+	s.Require().Empty(stateTracker.SlowTables(0.5))
+
+	stateTracker = ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRates = true
+	// Samples every 10ms.
+	stateTracker.SlowTableWindow = 300 * time.Millisecond
+
+	for i := uint64(1); i <= 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.stalled", i*1000)
+		stateTracker.UpdateLastSuccessfulPaginationKey("test.steady", i*1000)
+	}
+	s.Require().Empty(stateTracker.SlowTables(0.01))
+
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.steady", 4000)
+	s.Require().Equal([]string{"test.stalled"}, stateTracker.SlowTables(0.01))
+
+	stateTracker.Pause()
+	s.Require().Empty(stateTracker.SlowTables(0.01))
+	stateTracker.Resume()
+
+	stateTracker.MarkTableAsCompleted("test.stalled")
+	s.Require().Empty(stateTracker.SlowTables(0.01))
+}
+
+func (s *StateTrackerTestSuite) TestTableRowsCopied() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 10}, 10)
+	s.Require().Empty(stateTracker.TableRowsCopied())
+	s.Require().Nil(stateTracker.Serialize(nil, nil).TableRowsCopied)
+
+	stateTracker.TrackTableRowsCopied = true
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 20}, 10)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table2": 5}, 5)
+	stateTracker.MarkTableAsCompleted("test.table2")
+	// Not attributed to either table.
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 30, "test.table3": 10}, 20)
+	stateTracker.UpdateBatch(map[string]uint64{"test.table4": 10}, 10)
+	stateTracker.MarkTableDropped("test.table4")
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]uint64{"test.table1": 10, "test.table2": 5}, serializedState.TableRowsCopied)
+	s.Require().Equal(uint64(55), serializedState.RowsCopied)
+
+	// The serialized counts are a copy.
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 40}, 10)
+	s.Require().Equal(uint64(10), serializedState.TableRowsCopied["test.table1"])
+
+	data, err := json.Marshal(serializedState)
+	s.Require().Nil(err)
+	resumedState := &ghostferry.SerializableState{}
+	s.Require().Nil(json.Unmarshal(data, resumedState))
+
+	// The counts keep accumulating on resume.
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, resumedState)
+	resumed.TrackTableRowsCopied = true
+	resumed.UpdateBatch(map[string]uint64{"test.table1": 40}, 10)
+	s.Require().Equal(map[string]uint64{"test.table1": 20, "test.table2": 5}, resumed.TableRowsCopied())
+}
+
+func (s *StateTrackerTestSuite) TestSkippedAndDeletedRows() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Nil(stateTracker.Serialize(nil, nil).SkippedRows)
+	s.Require().Nil(stateTracker.Serialize(nil, nil).DeletedRows)
+
+	stateTracker.IncrementSkippedRows("test.table1", 3)
+	stateTracker.IncrementSkippedRows("test.table1", 2)
+	stateTracker.IncrementDeletedRows("test.table1", 1)
+	stateTracker.IncrementDeletedRows("test.table2", 4)
+	stateTracker.IncrementSkippedRows("test.table3", 4)
+	stateTracker.MarkTableDropped("test.table3")
+	stateTracker.IncrementSkippedRows("test.table3", 4)
+
+	s.Require().Equal(uint64(5), stateTracker.SkippedRows("test.table1"))
+	s.Require().Equal(uint64(1), stateTracker.DeletedRows("test.table1"))
+	s.Require().Equal(uint64(0), stateTracker.SkippedRows("test.table2"))
+	s.Require().Equal(uint64(0), stateTracker.SkippedRows("test.table3"))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]uint64{"test.table1": 5}, serializedState.SkippedRows)
+	s.Require().Equal(map[string]uint64{"test.table1": 1, "test.table2": 4}, serializedState.DeletedRows)
+
+	// The serialized counts are a copy.
+	stateTracker.IncrementSkippedRows("test.table1", 1)
+	s.Require().Equal(uint64(5), serializedState.SkippedRows["test.table1"])
+
+	// The counts keep accumulating on resume.
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	resumed.IncrementDeletedRows("test.table2", 1)
+	s.Require().Equal(uint64(5), resumed.SkippedRows("test.table1"))
+	s.Require().Equal(uint64(5), resumed.DeletedRows("test.table2"))
+}
+
+func (s *StateTrackerTestSuite) TestCompleteTableWithFinalPaginationKey() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRowsCopied = true
+
+	const tables = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < tables; i++ {
+			stateTracker.CompleteTableWithFinalPaginationKey(fmt.Sprintf("test.table%d", i), 100, 10)
+		}
+	}()
+
+	// A serialized table copied up to its final pagination key is completed.
+	for serializing := true; serializing; {
+		select {
+		case <-done:
+			serializing = false
+		default:
+		}
+
+		serializedState := stateTracker.Serialize(nil, nil)
+		for table := range serializedState.LastSuccessfulPaginationKeys {
+			s.Require().True(serializedState.CompletedTables[table], "%s is copied but not completed", table)
+		}
+		s.Require().Equal(uint64(10*len(serializedState.CompletedTables)), serializedState.RowsCopied)
+	}
+
+	s.Require().Equal(tables, len(stateTracker.Serialize(nil, nil).CompletedTables))
+	s.Require().Equal(uint64(10), stateTracker.TableRowsCopied()["test.table0"])
+
+	// Completing a table again is a duplicate completion.
+	stateTracker.CompleteTableWithFinalPaginationKey("test.table0", 200, 10)
+	s.Require().Equal(uint64(10*tables), stateTracker.RowsCopied())
+}
+
+func (s *StateTrackerTestSuite) TestExcludePaginationKeyRange() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	table := "test.table1"
+
+	stateTracker.ExcludePaginationKeyRange(table, 301, 400)
+	stateTracker.ExcludePaginationKeyRange(table, 351, 500)
+	stateTracker.ExcludePaginationKeyRange(table, 20, 10)
+	s.Require().Equal([][2]uint64{{301, 500}}, stateTracker.ExcludedPaginationKeyRanges(table))
+	s.Require().Equal([][2]uint64{{0, 300}, {501, 1000}}, stateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	// The excluded and completed ranges are both covered.
+	stateTracker.MarkRangeComplete(table, 501, 600)
+	s.Require().Equal([][2]uint64{{0, 300}, {601, 1000}}, stateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	// The last successful pagination key advances through the excluded range
+	// and the completed range following it.
+	stateTracker.MarkRangeComplete(table, 1, 300)
+	s.Require().Equal(uint64(600), stateTracker.LastSuccessfulPaginationKey(table))
+	s.Require().Equal([][2]uint64{{601, 1000}}, stateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	// As does a cursor reporting the last row before an excluded range.
+	stateTracker.ExcludePaginationKeyRange(table, 701, 800)
+	stateTracker.UpdateLastSuccessfulPaginationKey(table, 700)
+	s.Require().Equal(uint64(800), stateTracker.LastSuccessfulPaginationKey(table))
+
+	// The excluded ranges are kept once passed, and restored on resume.
+	data, err := json.Marshal(stateTracker.Serialize(nil, nil))
+	s.Require().Nil(err)
+	serializedState := &ghostferry.SerializableState{}
+	s.Require().Nil(json.Unmarshal(data, serializedState))
+	s.Require().Equal([][2]uint64{{301, 500}, {701, 800}}, serializedState.ExcludedPaginationKeyRanges[table])
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Equal([][2]uint64{{301, 500}, {701, 800}}, resumedStateTracker.ExcludedPaginationKeyRanges(table))
+	s.Require().Equal([][2]uint64{{801, 1000}}, resumedStateTracker.UncopiedPaginationKeyRanges(table, 1000))
+
+	// A table excluded from its first pagination key starts past the range.
+	stateTracker.ExcludePaginationKeyRange("test.table2", 1, 100)
+	s.Require().Equal(uint64(100), stateTracker.LastSuccessfulPaginationKey("test.table2"))
+
+	// The excluded ranges are dropped once the table completes.
+	resumedStateTracker.MarkTableAsCompleted(table)
+	s.Require().Equal(0, len(resumedStateTracker.ExcludedPaginationKeyRanges(table)))
+	s.Require().Nil(resumedStateTracker.Serialize(nil, nil).ExcludedPaginationKeyRanges)
+}
+
+func (s *StateTrackerTestSuite) TestOnMilestone() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	reached := make([]float64, 0)
+	stateTracker.OnMilestone = func(fraction float64) {
+		reached = append(reached, fraction)
+	}
+	stateTracker.SetTableSizes(map[string]uint64{"test.table1": 100, "test.table2": 100})
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 40)
+	s.Require().Equal([]float64{}, reached)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 50)
+	s.Require().Equal([]float64{0.25}, reached)
+
+	// Several milestones reached at once are called in order.
+	stateTracker.UpdateBatch(map[string]uint64{"test.table1": 100, "test.table2": 90}, 10)
+	s.Require().Equal([]float64{0.25, 0.5, 0.75, 0.9}, reached)
+
+	// Going back below a milestone and above it again does not call it again.
+	stateTracker.SetTableSizes(map[string]uint64{"test.table1": 100, "test.table2": 1000})
+	stateTracker.SetTableSizes(map[string]uint64{"test.table1": 100, "test.table2": 100})
+	s.Require().Equal([]float64{0.25, 0.5, 0.75, 0.9}, reached)
+
+	stateTracker.MarkTableAsCompleted("test.table2")
+	s.Require().Equal([]float64{0.25, 0.5, 0.75, 0.9, 1}, reached)
+
+	// The reached milestones are not called again on resume.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	resumedStateTracker.OnMilestone = func(fraction float64) {
+		s.Fail("expected the reached milestones not to be called again")
+	}
+	resumedStateTracker.MarkTableAsCompleted("test.table1")
+
+	// Without sizes, the milestones are the fraction of the tables completed.
+	stateTracker = ghostferry.NewStateTracker(10)
+	reached = make([]float64, 0)
+	stateTracker.Milestones = []float64{0.5, 1}
+	stateTracker.OnMilestone = func(fraction float64) {
+		reached = append(reached, fraction)
+	}
+	stateTracker.SetTableSizes(map[string]uint64{"test.table1": 0, "test.table2": 0})
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 50)
+	s.Require().Equal([]float64{}, reached)
+	stateTracker.MarkTableAsCompleted("test.table1")
+	s.Require().Equal([]float64{0.5}, reached)
+}
+
+func (s *StateTrackerTestSuite) TestTableDependencies() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Nil(stateTracker.SetTableDependencies(map[string][]string{
+		"test.orders":      {"test.customers", "test.products"},
+		"test.order_items": {"test.orders"},
+	}))
+
+	s.Require().True(stateTracker.CanStartTable("test.customers"))
+	s.Require().False(stateTracker.CanStartTable("test.orders"))
+
+	stateTracker.MarkTableAsCompleted("test.customers")
+	s.Require().False(stateTracker.CanStartTable("test.orders"))
+
+	// A dropped prerequisite is not waited for.
+	stateTracker.MarkTableDropped("test.products")
+	s.Require().True(stateTracker.CanStartTable("test.orders"))
+	s.Require().False(stateTracker.CanStartTable("test.order_items"))
+
+	// The dependencies are restored on resume.
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal([]string{"test.orders"}, resumedStateTracker.TablePrerequisites("test.order_items"))
+	s.Require().False(resumedStateTracker.CanStartTable("test.order_items"))
+	resumedStateTracker.MarkTableAsCompleted("test.orders")
+	s.Require().True(resumedStateTracker.CanStartTable("test.order_items"))
+
+	// Cycles are rejected, leaving the dependencies untouched.
+	err := resumedStateTracker.SetTableDependencies(map[string][]string{
+		"test.a": {"test.b"},
+		"test.b": {"test.c"},
+		"test.c": {"test.a"},
+	})
+	s.Require().EqualError(err, "the table dependencies have a cycle: test.a -> test.b -> test.c -> test.a")
+	s.Require().Equal([]string{"test.orders"}, resumedStateTracker.TablePrerequisites("test.order_items"))
+	s.Require().NotNil(ghostferry.CheckTableDependencies(map[string][]string{"test.a": {"test.a"}}))
+}
+
+func (s *StateTrackerTestSuite) TestCleanupProgress() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 100)
+	stateTracker.UpdateLastCleanedPaginationKey("db.table1", 40)
+	stateTracker.UpdateLastCleanedPaginationKey("db.table1", 30)
+	stateTracker.UpdateLastCleanedPaginationKey("db.table2", 10)
+
+	s.Require().Equal(uint64(40), stateTracker.LastCleanedPaginationKey("db.table1"))
+	s.Require().Equal(uint64(100), stateTracker.LastSuccessfulPaginationKey("db.table1"))
+	s.Require().Equal(uint64(0), stateTracker.LastCleanedPaginationKey("db.table3"))
+
+	// The cleanup progress outlives the completion of the copy.
+	stateTracker.MarkTableAsCompleted("db.table1")
+	s.Require().Equal(uint64(40), stateTracker.LastCleanedPaginationKey("db.table1"))
+
+	stateTracker.MarkTableCleaned("db.table2")
+	stateTracker.UpdateLastCleanedPaginationKey("db.table2", 20)
+	s.Require().True(stateTracker.IsTableCleaned("db.table2"))
+	s.Require().Equal(uint64(math.MaxUint64), stateTracker.LastCleanedPaginationKey("db.table2"))
+	s.Require().False(stateTracker.IsCleanupComplete([]string{"db.table1", "db.table2"}))
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal(map[string]uint64{"db.table1": 40}, serializedState.LastCleanedPaginationKeys)
+	s.Require().Equal([]string{"db.table2"}, serializedState.CleanedTables)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().Equal(uint64(40), resumed.LastCleanedPaginationKey("db.table1"))
+	s.Require().True(resumed.IsTableCleaned("db.table2"))
+
+	resumed.MarkTableDropped("db.table1")
+	s.Require().Equal(uint64(0), resumed.LastCleanedPaginationKey("db.table1"))
+	s.Require().True(resumed.IsCleanupComplete([]string{"db.table1", "db.table2"}))
+}
+
+func (s *StateTrackerTestSuite) TestResumeCursors() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table1", 100)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table2", 10)
+	stateTracker.ExcludePaginationKeyRange("db.table2", 11, 50)
+	stateTracker.UpdateLastSuccessfulPaginationKey("db.table3", 10)
+	stateTracker.MarkTableCopyComplete("db.table3")
+	stateTracker.MarkTableAsCompleted("db.table4")
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal(uint64(50), resumed.LastSuccessfulPaginationKey("db.table2"))
+	s.Require().Equal(map[string]uint64{"db.table1": 100}, resumed.ResumeCursors())
+}
+
+func (s *StateTrackerTestSuite) TestGenerationIncreasesWithEverySerialize() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal(uint64(1), stateTracker.Serialize(nil, nil).Generation)
+	s.Require().Equal(uint64(2), stateTracker.SerializeProgressOnly(nil, nil).Generation)
+
+	// Snapshots are not checkpoints.
+	s.Require().Equal(uint64(2), stateTracker.Snapshot().Generation)
+	s.Require().Equal(uint64(2), stateTracker.Snapshot().Generation)
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, stateTracker.Serialize(nil, nil))
+	s.Require().Equal(uint64(4), resumed.Serialize(nil, nil).Generation)
+}
+
+func (s *StateTrackerTestSuite) TestLastWrittenGTIDSet() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Nil(stateTracker.LastWrittenGTIDSet())
+	s.Require().Equal("", stateTracker.Serialize(nil, nil).LastWrittenGTIDSet)
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10")
+	s.Require().Nil(err)
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 10})
+	stateTracker.UpdateLastWrittenGTID(gtidSet)
+
+	older, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	s.Require().Nil(err)
+	stateTracker.UpdateLastWrittenGTID(older)
+	s.Require().Equal(gtidSet.String(), stateTracker.LastWrittenGTIDSet().String())
+
+	stateTracker.UpdateLastWrittenGTID(nil)
+	var nilMysqlGTIDSet *mysql.MysqlGTIDSet
+	stateTracker.UpdateLastWrittenGTID(nilMysqlGTIDSet)
+	s.Require().Equal(gtidSet.String(), stateTracker.LastWrittenGTIDSet().String())
+	s.Require().Equal(gtidSet.String(), stateTracker.MinGTIDSet().String())
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-10", serializedState.LastWrittenGTIDSet)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 10}, serializedState.LastWrittenBinlogPosition)
+
+	minGTIDSet, err := serializedState.MinGTIDSet()
+	s.Require().Nil(err)
+	s.Require().True(minGTIDSet.Equal(gtidSet))
+
+	resumed := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumed.LastWrittenGTIDSet().Equal(gtidSet))
+
+	// The binlog streaming resumes from the binlog position of the inline
+	// verifier if it is behind, as its GTID set is not known.
+	resumed.UpdateLastStoredBinlogPositionForInlineVerifier(mysql.Position{Name: "mysql-bin.00002", Pos: 4})
+	s.Require().Nil(resumed.MinGTIDSet())
+	minGTIDSet, err = resumed.Serialize(nil, nil).MinGTIDSet()
+	s.Require().Nil(err)
+	s.Require().Nil(minGTIDSet)
+
+	// The states without a GTID set, or with an invalid one, resume from the
+	// binlog position.
+	resumed = ghostferry.NewStateTrackerFromSerializedState(10, &ghostferry.SerializableState{LastWrittenGTIDSet: "invalid"})
+	s.Require().Nil(resumed.LastWrittenGTIDSet())
+	minGTIDSet, err = (&ghostferry.SerializableState{}).MinGTIDSet()
+	s.Require().Nil(err)
+	s.Require().Nil(minGTIDSet)
+}
+
+func (s *StateTrackerTestSuite) TestPauseTable() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.TrackTableRates = true
+	stateTracker.MinSpeedLogSampleInterval = 0
+
+	s.Require().False(stateTracker.IsTablePaused("test.table1"))
+	select {
+	case <-stateTracker.TableResumed("test.table1"):
+	default:
+		s.Fail("expected the channel of a table not paused to be closed")
+	}
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 1000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.other", 10000000)
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 2000)
+
+	stateTracker.PauseTable("test.table1")
+	stateTracker.PauseTable("test.table2")
+	s.Require().True(stateTracker.IsTablePaused("test.table1"))
+	s.Require().Equal([]string{"test.table1", "test.table2"}, stateTracker.PausedTables())
+
+	resumed := stateTracker.TableResumed("test.table1")
+	select {
+	case <-resumed:
+		s.Fail("expected the channel of a paused table to be open")
+	default:
+	}
+
+	// The table stays paused on resume.
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Equal([]string{"test.table1", "test.table2"}, serializedState.PausedTables)
+	restored := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(restored.IsTablePaused("test.table1"))
+
+	time.Sleep(500 * time.Millisecond)
+	stateTracker.ResumeTable("test.table1")
+	<-resumed
+	s.Require().False(stateTracker.IsTablePaused("test.table1"))
+
+	time.Sleep(20 * time.Millisecond)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 3000)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.other", 20000000)
+
+	// The pause is excluded from the rate of the table, which copied 2000
+	// pagination keys in about 40ms. Including it, the 2000 remaining would
+	// take over 500ms. The overall rate is dominated by test.other.
+	eta := stateTracker.WeightedETA(map[string]uint64{"test.table1": 5000})
+	s.Require().True(eta > 0)
+	s.Require().True(eta < 300*time.Millisecond, "eta: %v", eta)
+
+	// Dropping a paused table resumes it, as there is nothing left to copy.
+	resumed = stateTracker.TableResumed("test.table2")
+	stateTracker.MarkTableDropped("test.table2")
+	<-resumed
+	s.Require().Empty(stateTracker.PausedTables())
+}
+
+func (s *StateTrackerTestSuite) TestSortableBinlogPosition() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	s.Require().Equal("", stateTracker.LastWrittenBinlogPositionString())
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.000042", Pos: 154})
+	s.Require().Equal("mysql-bin.00000000000000000042:0000000154", stateTracker.LastWrittenBinlogPositionString())
+
+	// The file numbers past 999999 are not padded consistently by MySQL.
+	positions := []mysql.Position{
+		{Name: "mysql-bin.1000000", Pos: 4},
+		{Name: "mysql-bin.999999", Pos: 1000},
+		{Name: "mysql-bin.999999", Pos: 999},
+		{},
+	}
+	formatted := make([]string, len(positions))
+	for i, pos := range positions {
+		formatted[i] = ghostferry.FormatSortableBinlogPosition(pos)
+
+		parsed, err := ghostferry.ParseSortableBinlogPosition(formatted[i])
+		s.Require().Nil(err)
+		s.Require().Equal(pos, parsed)
+	}
+
+	sort.Strings(formatted)
+	s.Require().Equal([]string{
+		"",
+		"mysql-bin.00000000000000999999:0000000999",
+		"mysql-bin.00000000000000999999:0000001000",
+		"mysql-bin.00000000000001000000:0000000004",
+	}, formatted)
+
+	_, err := ghostferry.ParseSortableBinlogPosition("mysql-bin.000042")
+	s.Require().NotNil(err)
+	_, err = ghostferry.ParseSortableBinlogPosition("mysql-bin.000042:offset")
+	s.Require().NotNil(err)
+}
+
+func (s *StateTrackerTestSuite) TestWaitForBinlogPosition() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	target := mysql.Position{Name: "mysql-bin.00002", Pos: 100}
+
+	waited := make(chan error)
+	go func() {
+		waited <- stateTracker.WaitForBinlogPosition(context.Background(), target)
+	}()
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 50})
+	select {
+	case <-waited:
+		s.Fail("the wait returned before the position was reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	stateTracker.UpdateLastWrittenBinlogPosition(mysql.Position{Name: "mysql-bin.00002", Pos: 150})
+	s.Require().Nil(<-waited)
+	s.Require().Equal(mysql.Position{Name: "mysql-bin.00002", Pos: 150}, stateTracker.LastWrittenBinlogPosition())
+
+	// The position is already passed.
+	s.Require().Nil(stateTracker.WaitForBinlogPosition(context.Background(), target))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Require().Equal(context.Canceled, stateTracker.WaitForBinlogPosition(ctx, mysql.Position{Name: "mysql-bin.00003", Pos: 4}))
+}
+
+// Completes every other pagination key of the table up to maxPaginationKey,
+// the worst case for the completed ranges.
+func markFragmentedRangesComplete(stateTracker *ghostferry.StateTracker, table string, maxPaginationKey uint64) {
+	for paginationKey := uint64(2); paginationKey <= maxPaginationKey; paginationKey += 2 {
+		stateTracker.MarkRangeComplete(table, paginationKey, paginationKey)
+	}
+}
+
+func (s *StateTrackerTestSuite) TestFragmentedCompletedRanges() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	markFragmentedRangesComplete(stateTracker, "test.table", 200000)
+
+	s.Require().True(stateTracker.IsPaginationKeyCopied("test.table", 4))
+	s.Require().False(stateTracker.IsPaginationKeyCopied("test.table", 5))
+	s.Require().False(stateTracker.IsPaginationKeyCopied("test.table", 200001))
+	s.Require().Equal([][2]uint64{{0, 1}, {3, 3}, {5, 5}, {7, 7}, {9, 9}}, stateTracker.UncopiedPaginationKeyRanges("test.table", 10))
+	s.Require().Equal([][2]uint64{{199999, 199999}, {200001, 300000}}, stateTracker.UncopiedPaginationKeyRanges("test.table", 300000)[99999:])
+
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Empty(serializedState.CompletedPaginationKeyRanges)
+	s.Require().Contains(serializedState.CompletedPaginationKeyBitmaps, "test.table")
+	data, err := json.Marshal(serializedState)
+	s.Require().Nil(err)
+	s.Require().True(len(data) < 64*1024, "serialized to %d bytes", len(data))
+
+	resumedStateTracker := ghostferry.NewStateTrackerFromSerializedState(10, serializedState)
+	s.Require().True(resumedStateTracker.IsPaginationKeyCopied("test.table", 200000))
+	s.Require().False(resumedStateTracker.IsPaginationKeyCopied("test.table", 199999))
+
+	// Filling the gaps advances the last successful pagination key through
+	// all the completed pagination keys.
+	resumedStateTracker.MarkRangeComplete("test.table", 1, 199999)
+	s.Require().Equal(uint64(200000), resumedStateTracker.LastSuccessfulPaginationKey("test.table"))
+	serializedState = resumedStateTracker.Serialize(nil, nil)
+	s.Require().Empty(serializedState.CompletedPaginationKeyRanges)
+	s.Require().Empty(serializedState.CompletedPaginationKeyBitmaps)
+}
+
+func (s *StateTrackerTestSuite) TestFragmentedCompletedRangesShrinkBackToRanges() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	markFragmentedRangesComplete(stateTracker, "test.table", 200000)
+	stateTracker.MarkRangeComplete("test.table", 300000, 300100)
+	s.Require().Contains(stateTracker.Serialize(nil, nil).CompletedPaginationKeyBitmaps, "test.table")
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table", 250000)
+	serializedState := stateTracker.Serialize(nil, nil)
+	s.Require().Empty(serializedState.CompletedPaginationKeyBitmaps)
+	s.Require().Equal([][2]uint64{{300000, 300100}}, serializedState.CompletedPaginationKeyRanges["test.table"])
+}
+
+func BenchmarkSerializedSizeOfFragmentedTable(b *testing.B) {
+	stateTracker := ghostferry.NewStateTracker(10)
+	markFragmentedRangesComplete(stateTracker, "test.table", 1000000)
+
+	b.ResetTimer()
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(stateTracker.Serialize(nil, nil))
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/state")
+}
+
+func (s *StateTrackerTestSuite) TestCopyProgressSnapshot() {
+	stateTracker := ghostferry.NewStateTracker(10)
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 10)
+	stateTracker.MarkTableAsCompleted("test.table2")
+	stateTracker.MarkTableCopyComplete("test.table3")
+
+	completed, paginationKeys := stateTracker.CopyProgressSnapshot()
+	s.Require().Equal(map[string]bool{"test.table2": true}, completed)
+	s.Require().Equal(map[string]uint64{"test.table1": 10}, paginationKeys)
+
+	// The maps are copies.
+	completed["test.table1"] = true
+	paginationKeys["test.table1"] = 20
+	s.Require().False(stateTracker.IsTableComplete("test.table1"))
+	s.Require().Equal(uint64(10), stateTracker.LastSuccessfulPaginationKey("test.table1"))
+
+	stateTracker.UpdateLastSuccessfulPaginationKey("test.table1", 30)
+	s.Require().Equal(uint64(20), paginationKeys["test.table1"])
+}
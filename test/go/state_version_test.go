@@ -0,0 +1,46 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type StateVersionTestSuite struct {
+	suite.Suite
+}
+
+func (s *StateVersionTestSuite) TestCompatibleVersions() {
+	for _, versions := range [][2]string{
+		{"1.1.0+20200101000000+abcdef0", "1.1.0+20200101000000+abcdef0"},
+		{"1.1.0+20200101000000+abcdef0", "1.1.0+20200202000000+1234567"},
+		{"1.1.0", "1.2.0"},
+		{"1.1.9", "1.2.0"},
+		{"?.?.?+??????????????+???????", "?.?.?+??????????????+???????"},
+	} {
+		stateVersion, currentVersion := versions[0], versions[1]
+		state := &ghostferry.SerializableState{GhostferryVersion: stateVersion}
+		s.Require().Nil(state.CheckCompatibility(currentVersion), "%s -> %s", stateVersion, currentVersion)
+	}
+}
+
+func (s *StateVersionTestSuite) TestIncompatibleVersions() {
+	for _, versions := range [][2]string{
+		{"1.1.0", "2.0.0"},
+		{"1.2.0", "1.1.0"},
+		{"1.1.1", "1.1.0"},
+		{"", "1.1.0"},
+		{"?.?.?+??????????????+???????", "1.1.0"},
+	} {
+		stateVersion, currentVersion := versions[0], versions[1]
+		state := &ghostferry.SerializableState{GhostferryVersion: stateVersion}
+		err := state.CheckCompatibility(currentVersion)
+		s.Require().NotNil(err, "%s -> %s", stateVersion, currentVersion)
+		s.Require().Contains(err.Error(), currentVersion)
+	}
+}
+
+func TestStateVersionTestSuite(t *testing.T) {
+	suite.Run(t, new(StateVersionTestSuite))
+}
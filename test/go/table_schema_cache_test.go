@@ -96,6 +96,22 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectTablesWithoutNumericP
 	this.Require().Contains(err.Error(), table)
 }
 
+func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectTablesWithCaseInsensitivePK() {
+	table := "test_table_4"
+	paginationColumn := "id"
+	query := fmt.Sprintf("CREATE TABLE %s.%s (%s varchar(20) COLLATE utf8mb4_general_ci not null, data TEXT, primary key(%s))", testhelpers.TestSchemaName, table, paginationColumn, paginationColumn)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES ('a'), ('A')", testhelpers.TestSchemaName, table, paginationColumn))
+	this.Require().NotNil(err, "'a' and 'A' are equal under the collation")
+
+	_, err = ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, nil)
+
+	this.Require().NotNil(err)
+	this.Require().EqualError(err, ghostferry.NonNumericPaginationKeyError(testhelpers.TestSchemaName, table, paginationColumn).Error())
+}
+
 func (this *TableSchemaCacheTestSuite) TestLoadTablesCascadingPaginationColumnConfigRightScenario1() {
 	table := "pagination_by_column_config_right_scenario_1"
 	paginationColumn := "identity"
@@ -240,6 +256,47 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesWithCompositePKButIDColumnT
 	this.assertLoadTablesWithCascadingPaginationColumnConfig(table, paginationColumn, cascadingPaginationColumnConfig)
 }
 
+func (this *TableSchemaCacheTestSuite) TestLoadTablesWithUniqueIndexPagination() {
+	table := "pagination_by_unique_index"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		PerTableIndex: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: "identity_index",
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (identity bigint(20) not null, data TEXT, unique key identity_index (identity))", testhelpers.TestSchemaName, table)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	this.assertLoadTablesWithCascadingPaginationColumnConfig(table, "identity", cascadingPaginationColumnConfig)
+
+	tableSchemaCache, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+	this.Require().Nil(err)
+	this.Require().Equal("identity_index", tableSchemaCache.Get(testhelpers.TestSchemaName, table).PaginationKeyIndexName)
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectTablesWithUnsuitablePaginationIndex() {
+	table := "pagination_by_unsuitable_index"
+	cascadingPaginationColumnConfig := &ghostferry.CascadingPaginationColumnConfig{
+		PerTableIndex: map[string]map[string]string{
+			testhelpers.TestSchemaName: map[string]string{
+				table: "identity_index",
+			},
+		},
+	}
+
+	query := fmt.Sprintf("CREATE TABLE %s.%s (identity bigint(20), data TEXT, unique key identity_index (identity))", testhelpers.TestSchemaName, table)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, cascadingPaginationColumnConfig)
+
+	this.Require().NotNil(err)
+	this.Require().EqualError(err, ghostferry.UnsuitablePaginationIndexError(testhelpers.TestSchemaName, table, "identity_index", "index column is nullable").Error())
+}
+
 func (this *TableSchemaCacheTestSuite) TestAllTableNames() {
 	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter, nil, nil, nil)
 	this.Require().Nil(err)
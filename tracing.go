@@ -0,0 +1,92 @@
+package ghostferry
+
+// A Tracer creates spans around the significant operations of the
+// StateTracker and the Ferry, for the migration to appear in distributed traces. This is
+// the minimal surface of a tracer, so an OpenTelemetry tracer, or any other,
+// can be adapted to it in a few lines without Ghostferry depending on it. For
+// example, with OpenTelemetry:
+//
+//	func (t otelTracer) StartSpan(name string, attributes map[string]interface{}) ghostferry.Span {
+//	  _, span := t.tracer.Start(t.ctx, name, trace.WithAttributes(toKeyValues(attributes)...))
+//	  return otelSpan{span}
+//	}
+//
+// The spans are:
+//
+//   - ghostferry.phase: one for each phase of the run (see StateTracker.SetPhase),
+//     ending when the next phase starts or when the tracker is finalized.
+//     It carries the phase, and the latest pagination_keys_per_second
+//     published by StateTracker.PublishRateUpdates during the phase.
+//   - ghostferry.table_completed: an instantaneous span with the table, when a
+//     table completes, and the pagination_keys_per_second of its copy if it
+//     is known, see ProgressEvent.PaginationKeysPerSecond.
+//   - ghostferry.serialize: around StateTracker.Serialize, with the
+//     binlog_file of the last written binlog position.
+//   - ghostferry.cutover_wait: around the wait of the Ferry for
+//     AutomaticCutover, during the StateWaitingForCutover phase.
+//
+// The tracer is called while the StateTracker holds its locks, so it must not
+// block nor call the StateTracker.
+type Tracer interface {
+	StartSpan(name string, attributes map[string]interface{}) Span
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+const (
+	SpanPhase          = "ghostferry.phase"
+	SpanTableCompleted = "ghostferry.table_completed"
+	SpanSerialize      = "ghostferry.serialize"
+	SpanCutoverWait    = "ghostferry.cutover_wait"
+)
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) End()                                       {}
+
+func (s *StateTracker) startSpan(name string, attributes map[string]interface{}) Span {
+	if s.Tracer == nil {
+		return noopSpan{}
+	}
+
+	return s.Tracer.StartSpan(name, attributes)
+}
+
+// Called with the subscribersMutex held, which also guards the phase span.
+func (s *StateTracker) traceEvent(event ProgressEvent) {
+	if s.Tracer == nil {
+		return
+	}
+
+	switch event.Type {
+	case ProgressEventPhaseChanged:
+		if s.phaseSpan != nil {
+			s.phaseSpan.End()
+		}
+		s.phaseSpan = s.startSpan(SpanPhase, map[string]interface{}{"phase": event.Phase})
+	case ProgressEventRateUpdated:
+		if s.phaseSpan != nil {
+			s.phaseSpan.SetAttribute("pagination_keys_per_second", event.PaginationKeysPerSecond)
+		}
+	case ProgressEventTableCompleted:
+		attributes := map[string]interface{}{"table": event.Table}
+		if event.PaginationKeysPerSecond > 0 {
+			attributes["pagination_keys_per_second"] = event.PaginationKeysPerSecond
+		}
+		s.startSpan(SpanTableCompleted, attributes).End()
+	}
+}
+
+func (s *StateTracker) endPhaseSpan() {
+	s.subscribersMutex.Lock()
+	defer s.subscribersMutex.Unlock()
+
+	if s.phaseSpan != nil {
+		s.phaseSpan.End()
+		s.phaseSpan = nil
+	}
+}
@@ -186,9 +186,16 @@ func (c *StmtCache) getStmt(query string) (*sql.Stmt, bool) {
 }
 
 func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
+	pos, _, err := ShowMasterStatusBinlogPositionAndGTIDSet(db)
+	return pos, err
+}
+
+// Returns the current binlog position along with the GTID set executed up to
+// it, which is nil if GTIDs are not enabled on the server.
+func ShowMasterStatusBinlogPositionAndGTIDSet(db *sql.DB) (mysql.Position, mysql.GTIDSet, error) {
 	rows, err := db.Query("SHOW MASTER STATUS")
 	if err != nil {
-		return NewMysqlPosition("", 0, err)
+		return mysql.Position{}, nil, err
 	}
 	defer rows.Close()
 	var file string
@@ -198,7 +205,7 @@ func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
 	if rows.Next() {
 		cols, err = rows.Columns()
 		if err != nil {
-			return NewMysqlPosition(file, position, err)
+			return mysql.Position{}, nil, err
 		}
 		switch len(cols) {
 		case 4:
@@ -207,7 +214,17 @@ func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
 			err = rows.Scan(&file, &position, &binlog_do_db, &binlog_ignore_db, &executed_gtid_set)
 		}
 	}
-	return NewMysqlPosition(file, position, err)
+
+	pos, err := NewMysqlPosition(file, position, err)
+	if err != nil || executed_gtid_set == "" {
+		return pos, nil, err
+	}
+
+	gtidSet, err := mysql.ParseMysqlGTIDSet(executed_gtid_set)
+	if err != nil {
+		return pos, nil, fmt.Errorf("failed to parse the executed GTID set of show master status: %v", err)
+	}
+	return pos, gtidSet, nil
 }
 
 func NewMysqlPosition(file string, position uint32, err error) (mysql.Position, error) {